@@ -8,6 +8,8 @@ import (
 	"time"
 
 	"github.com/wangn9900/StealthForward/internal/agent"
+	"github.com/wangn9900/StealthForward/internal/generator"
+	"github.com/wangn9900/StealthForward/internal/metrics"
 )
 
 func main() {
@@ -23,9 +25,45 @@ func main() {
 	adminToken := flag.String("token", "", "Admin token for controller authentication")
 	useInternal := flag.Bool("internal", false, "Use internal sing-box core for accurate traffic stats")
 	once := flag.Bool("once", false, "Run once and exit")
+	spoolMB := flag.Int("spool-mb", 16, "Max size in MB of the local traffic spool")
+	statsAPI := flag.String("stats-api", "", "Stats API for external core: v2ray (per-user, core needs with_v2ray_api) or clash (node totals only)")
+	metricsListen := flag.String("metrics-listen", "", "Localhost address for the Prometheus /metrics endpoint (e.g. 127.0.0.1:9102), disabled when empty")
+	probeInterval := flag.Int("probe-interval", 0, "Seconds between exit reachability probes (TCP connect + URL test through the outbound), 0 disables (default); in -probe mode 0 means 300")
+	probeURL := flag.String("probe-url", agent.DefaultProbeURL, "URL fetched through each exit outbound during probes (internal core only)")
+	probeMode := flag.Bool("probe", false, "Run as a reachability prober inside a restricted network instead of serving traffic")
+	probeISP := flag.String("probe-isp", "", "ISP label reported in -probe mode (e.g. ct, cu, cm)")
+	probeRegion := flag.String("probe-region", "", "Region label reported in -probe mode (e.g. gd, sh)")
+	probeName := flag.String("probe-name", "", "Prober name shown in local logs in -probe mode (default hostname)")
+	probeToken := flag.String("probe-token", "", "Prober token issued by the controller (POST /api/v1/probers), required in -probe mode")
+	statsListen := flag.String("stats-listen", "", "Localhost address of the external core stats API (default 127.0.0.1:10085 for v2ray, 127.0.0.1:9090 for clash)")
 
 	flag.Parse()
 
+	// 探测机模式：不启动内核与伪装站，只做可达性探测
+	if *probeMode {
+		// 探测机默认 300 秒一轮；节点侧的落地探测需显式开启
+		interval := 300 * time.Second
+		if *probeInterval > 0 {
+			interval = time.Duration(*probeInterval) * time.Second
+		}
+		if *once {
+			interval = 0
+		}
+		if *probeToken == "" {
+			log.Fatalf("-probe requires -probe-token (create a prober on the controller to get one)")
+		}
+		agent.NewProber(agent.ProberConfig{
+			ControllerAddr: *controllerAddr,
+			Token:          *probeToken,
+			Name:           *probeName,
+			ISP:            *probeISP,
+			Region:         *probeRegion,
+			Interval:       interval,
+			ProbeURL:       *probeURL,
+		}).Run()
+		return
+	}
+
 	// 智能探测内核路径
 	if _, err := os.Stat(*corePath); os.IsNotExist(err) {
 		candidates := []string{"/usr/local/bin/stealth-core", "/usr/bin/stealth-core", "/usr/local/bin/sing-box"}
@@ -42,6 +80,12 @@ func main() {
 
 	log.Printf("StealthForward Agent starting for Node ID: %d", *nodeID)
 	log.Printf("Core path: %s", *corePath)
+	if !generator.ValidStatsAPI(*statsAPI) {
+		log.Fatalf("Unknown -stats-api %q (expected v2ray or clash)", *statsAPI)
+	}
+	if *metricsListen != "" && !metrics.IsLoopbackAddr(*metricsListen) {
+		log.Fatalf("-metrics-listen %q must be a loopback address (e.g. 127.0.0.1:9102)", *metricsListen)
+	}
 
 	// 2. 初始化 Agent
 	ag := agent.NewAgent(agent.Config{
@@ -52,6 +96,12 @@ func main() {
 		SingBoxPath:    *corePath,
 		UseInternal:    *useInternal,
 		AdminToken:     *adminToken,
+		SpoolMaxBytes:  *spoolMB << 20,
+		StatsAPI:       *statsAPI,
+		StatsListen:    *statsListen,
+		MetricsListen:  *metricsListen,
+		ProbeInterval:  time.Duration(*probeInterval) * time.Second,
+		ProbeURL:       *probeURL,
 	})
 
 	// 3. 启动本地伪装服务器（用于 SNI 回落目的地）
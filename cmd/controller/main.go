@@ -9,6 +9,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/wangn9900/StealthForward/internal/api"
+	"github.com/wangn9900/StealthForward/internal/bot"
 	"github.com/wangn9900/StealthForward/internal/database"
 	"github.com/wangn9900/StealthForward/internal/license"
 	"github.com/wangn9900/StealthForward/internal/sync"
@@ -62,9 +63,15 @@ func main() {
 	database.InitDB()
 
 	// 2. 启动 V2Board 自动同步任务与流量上报任务
+	sync.MigrateLegacyIdentities() // 旧版 n<node>-<uuid> 标签迁移到身份表
+	sync.RefreshRuleIndex()        // 流量汇报只读内存索引
 	sync.StartV2boardSync()
 	sync.StartTrafficReporting()
 	sync.InitTrafficFromDB() // 从数据库恢复流量统计
+	sync.StartNodeMonitor()  // 节点在线状态与告警
+	sync.StartEventBus()     // 事件 Webhook 投递
+	sync.StartAutoRotation() // 按策略自动换 IP
+	bot.StartTelegramBot()   // Telegram 运维机器人 (可选)
 
 	// 2. 设置 Gin 路由
 	r := gin.Default()
@@ -121,6 +128,9 @@ func main() {
 		c.String(200, "pong")
 	})
 
+	// Prometheus 指标 (与 API 共用管理员 Token，抓取配置中用 params: token 传入)
+	r.GET("/metrics", authMiddleware, api.MetricsHandler)
+
 	// 静态文件目录 (极致鲁棒探测)
 	cwd, _ := os.Getwd()
 	searchPaths := []string{
@@ -172,6 +182,15 @@ func main() {
 
 	// 公开 API
 	r.POST("/api/v1/auth/login", api.LoginHandler)
+	r.POST("/api/v1/sync/webhook/:id", api.SyncWebhookHandler) // 面板推送，使用入口通讯密钥鉴权
+
+	// 探测机 (stealth-agent -probe) 接口，使用探测机各自的 Token 鉴权，不接受管理员 Token
+	probe := r.Group("/api/v1/probe")
+	probe.Use(api.ProberAuthMiddleware)
+	{
+		probe.GET("/targets", api.GetReachabilityTargetsHandler) // 探测机拉取入口端口列表
+		probe.POST("/report", api.ReportReachabilityHandler)     // 探测机上报可达性结果
+	}
 
 	// API 分组 (Protected)
 	v1 := r.Group("/api/v1")
@@ -203,6 +222,7 @@ func main() {
 		v1.GET("/node/:id/config", api.GetConfigHandler)
 		// Agent 上报流量的接口
 		v1.POST("/node/:id/traffic", api.ReportTrafficHandler)
+		v1.POST("/node/:id/probes", api.ReportProbesHandler) // Agent 上报落地探测结果
 
 		// Agent 一键换 IP 接口 (AWS Only)
 		// --- Cloud Instance Provisioning & Keys ---
@@ -217,11 +237,28 @@ func main() {
 		v1.POST("/cloud/rotate-ip", api.RotateIPHandler) // 通用入口
 		v1.POST("/entries/:id/reprovision", api.ReprovisionNodeHandler)
 
+		// --- Auto IP Rotation (entries with auto_rotate_ip) ---
+		v1.GET("/rotation/policy", api.GetRotationPolicyHandler)
+		v1.PUT("/rotation/policy", api.UpdateRotationPolicyHandler)
+		v1.POST("/rotation/evaluate", api.EvaluateRotationHandler)      // 立即检查一轮 (?dry_run=1 只返回决策)
+		v1.GET("/rotation/decisions", api.ListRotationDecisionsHandler) // 决策日志 (?entry_id=&limit=)
+
 		// --- Cloud Account Pool ---
 		v1.GET("/cloud/accounts", api.ListCloudAccountsHandler)
 		v1.POST("/cloud/accounts", api.CreateCloudAccountHandler)
 		v1.PUT("/cloud/accounts/:id", api.UpdateCloudAccountHandler)
 		v1.DELETE("/cloud/accounts/:id", api.DeleteCloudAccountHandler)
+		v1.GET("/cloud/accounts/usage", api.ListCloudAccountUsageHandler)
+
+		// --- DNS Zones (cloudflare, route53, alidns, dnspod) ---
+		v1.GET("/dns/providers", api.ListDNSProvidersHandler)
+		v1.GET("/dns/zones", api.ListDNSZonesHandler)
+		v1.POST("/dns/zones", api.CreateDNSZoneHandler)
+		v1.PUT("/dns/zones/:id", api.UpdateDNSZoneHandler)
+		v1.DELETE("/dns/zones/:id", api.DeleteDNSZoneHandler)
+		v1.GET("/dns/zones/:id/records", api.ListDNSRecordsHandler)     // ?name=&type=
+		v1.POST("/dns/zones/:id/records", api.UpsertDNSRecordHandler)   // 按名称+类型创建或更新
+		v1.DELETE("/dns/zones/:id/records", api.DeleteDNSRecordHandler) // ?name=&type=
 
 		// --- SSH Keys ---
 		v1.GET("/system/ssh-keys", api.ListSSHKeysHandler)
@@ -237,20 +274,95 @@ func main() {
 		v1.POST("/cloud/lightsail/terminate", api.TerminateLightsailHandler)
 		v1.POST("/cloud/lightsail/rotate-ip", api.RotateLightsailIPHandler)
 
+		// --- Cloud Providers (aws_ec2, aws_lightsail, vultr, digitalocean, hetzner) ---
+		v1.GET("/cloud/providers", api.ListCloudProvidersHandler)
+		v1.GET("/cloud/providers/:provider/regions", api.ListProviderRegionsHandler)
+		v1.GET("/cloud/providers/:provider/images", api.ListProviderImagesHandler)
+		v1.GET("/cloud/providers/:provider/plans", api.ListProviderPlansHandler)
+		v1.GET("/cloud/providers/:provider/instances", api.ListProviderInstancesHandler)
+		v1.POST("/cloud/providers/:provider/instances", api.ProvisionProviderInstanceHandler)
+		v1.POST("/cloud/providers/:provider/instances/terminate", api.TerminateProviderInstanceHandler)
+		v1.POST("/cloud/providers/:provider/instances/rotate-ip", api.RotateProviderInstanceIPHandler)
+		v1.POST("/cloud/providers/:provider/instances/open-ports", api.OpenProviderInstancePortsHandler)
+
 		// --- Traffic Stats ---
 		v1.GET("/traffic", api.GetTrafficStatsHandler)
+		v1.GET("/traffic/outbox", api.GetTrafficOutboxHandler)        // 待推送面板的流量积压
+		v1.GET("/traffic/history", api.GetTrafficHistoryHandler)      // 小时/天 级流量历史 (支持 CSV 导出)
 		v1.DELETE("/traffic/entry/:id", api.ClearEntryTrafficHandler) // 清除入口节点流量
 		v1.DELETE("/traffic/exit/:id", api.ClearExitTrafficHandler)   // 清除落地节点流量
 		v1.DELETE("/traffic/all", api.ClearAllTrafficHandler)         // 清除所有流量
 
+		// --- Traffic Quotas & Suspensions ---
+		v1.GET("/quotas", api.ListQuotasHandler)
+		v1.POST("/quotas", api.CreateQuotaHandler)
+		v1.PUT("/quotas/:id", api.UpdateQuotaHandler)
+		v1.DELETE("/quotas/:id", api.DeleteQuotaHandler)
+		v1.GET("/suspensions", api.ListSuspensionsHandler)
+		v1.POST("/suspensions", api.CreateSuspensionHandler)       // 手动暂停
+		v1.DELETE("/suspensions/:id", api.DeleteSuspensionHandler) // 解除暂停
+
+		// --- Billing Cycles ---
+		v1.GET("/billing/status", api.GetBillingStatusHandler)  // 各节点当前周期用量
+		v1.GET("/billing/cycles", api.ListBillingCyclesHandler) // 已归档的周期流量
+		v1.PUT("/billing/:scope/:id", api.UpdateBillingHandler) // 设置重置日/时区/额度
+
+		// --- Cloud Bandwidth Allowance ---
+		v1.GET("/bandwidth", api.GetBandwidthStatusHandler)              // 各入口本周期网卡用量 / 额度
+		v1.GET("/bandwidth/:id/history", api.GetBandwidthHistoryHandler) // 入口各周期网卡用量
+		v1.PUT("/bandwidth/:id", api.UpdateBandwidthAllowanceHandler)    // 设置额度来源与超额动作
+
+		// --- Node Status & Alerts ---
+		v1.GET("/nodes/status", api.ListNodeStatusHandler)                   // 各入口在线状态
+		v1.GET("/nodes/:id/status/history", api.GetNodeStatusHistoryHandler) // 状态变化历史
+		v1.GET("/alerts/rules", api.ListAlertRulesHandler)
+		v1.POST("/alerts/rules", api.CreateAlertRuleHandler)
+		v1.PUT("/alerts/rules/:id", api.UpdateAlertRuleHandler)
+		v1.DELETE("/alerts/rules/:id", api.DeleteAlertRuleHandler)
+		v1.GET("/alerts/events", api.ListAlertEventsHandler) // 告警记录 (?state=firing)
+		v1.GET("/notify/channels", api.ListNotificationChannelsHandler)
+		v1.POST("/notify/channels", api.CreateNotificationChannelHandler)
+		v1.PUT("/notify/channels/:id", api.UpdateNotificationChannelHandler)
+		v1.DELETE("/notify/channels/:id", api.DeleteNotificationChannelHandler)
+		v1.POST("/notify/channels/:id/test", api.TestNotificationChannelHandler) // 发送测试通知
+
+		// --- Events & Webhooks ---
+		v1.GET("/events", api.ListEventsHandler) // 事件记录 (?type=node.offline)
+		v1.GET("/webhooks", api.ListWebhooksHandler)
+		v1.POST("/webhooks", api.CreateWebhookHandler)
+		v1.PUT("/webhooks/:id", api.UpdateWebhookHandler)
+		v1.DELETE("/webhooks/:id", api.DeleteWebhookHandler)
+		v1.POST("/webhooks/:id/test", api.TestWebhookHandler)                                   // 发送 ping
+		v1.GET("/webhooks/:id/deliveries", api.ListWebhookDeliveriesHandler)                    // 投递记录
+		v1.POST("/webhooks/:id/deliveries/:delivery_id/retry", api.RetryWebhookDeliveryHandler) // 重新投递
+
+		// --- Exit Probing ---
+		v1.GET("/probes/matrix", api.GetProbeMatrixHandler)   // 入口 x 落地 延迟矩阵 (?window=15m)
+		v1.GET("/probes/history", api.GetProbeHistoryHandler) // 探测历史 (?entry_id=&exit_id=&hours=)
+
+		// --- Reachability (probe agents inside restricted networks) ---
+		v1.GET("/reachability/matrix", api.GetReachabilityMatrixHandler)   // 运营商/地区 x 入口端口 可达性矩阵 (?window=30m)
+		v1.GET("/reachability/history", api.GetReachabilityHistoryHandler) // 可达性探测历史 (?label=&entry_id=&hours=)
+		v1.GET("/reachability/states", api.GetReachabilityStatesHandler)   // 当前封锁/抖动状态
+		v1.GET("/probers", api.ListProbersHandler)
+		v1.POST("/probers", api.CreateProberHandler) // 返回探测机 Token (只显示一次)
+		v1.PUT("/probers/:id", api.UpdateProberHandler)
+		v1.DELETE("/probers/:id", api.DeleteProberHandler)
+		v1.POST("/probers/:id/token", api.RegenerateProberTokenHandler) // 重置 Token 与代理凭证
+
 		// 分流映射管理 (NodeMappings)
 		v1.GET("/mappings", api.ListNodeMappingsHandler)
 		v1.POST("/mappings", api.CreateNodeMappingHandler)
 		v1.PUT("/mappings/:id", api.UpdateNodeMappingHandler)
 		v1.DELETE("/mappings/:id", api.DeleteNodeMappingHandler)
+		v1.POST("/mappings/:id/failover", api.SwitchMappingExitHandler) // 手动切换落地 (exit_id 为 0 切回主落地)
+		v1.GET("/mappings/failovers", api.GetFailoverHistoryHandler)    // 切换历史 (?mapping_id=&entry_id=&limit=)
 
 		// 触发 V2Board 同步
 		v1.POST("/sync", api.TriggerSyncHandler)
+		v1.GET("/sync/status", api.GetSyncStatusHandler)
+		v1.GET("/sync/history", api.GetSyncHistoryHandler)
+		v1.POST("/sync/dry-run", api.DryRunSyncHandler) // 仅预览差异，不写库
 
 		// 系统备份与恢复
 		v1.GET("/system/backup", api.ExportConfigHandler)
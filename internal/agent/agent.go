@@ -3,6 +3,8 @@ package agent
 import (
 	"bytes"
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -38,16 +40,40 @@ type Config struct {
 	SingBoxPath    string
 	AdminToken     string
 	UseInternal    bool // 是否使用内置内核 (支持精准流量统计)
+	SpoolMaxBytes  int  // 本地流量暂存上限 (字节)，0 为默认 16MB
+
+	// 外部内核的统计接口 (v2ray / clash)，由 Controller 写入配置并绑定在本机，内置内核时忽略
+	StatsAPI    string
+	StatsListen string
+
+	// MetricsListen 本机 Prometheus /metrics 监听地址 (只允许回环地址)，为空不开启
+	MetricsListen string
+
+	// ProbeInterval 落地探测间隔，0 为不探测；ProbeURL 为经出站做 URL 测试的地址 (默认 DefaultProbeURL)
+	ProbeInterval time.Duration
+	ProbeURL      string
 }
 
 type Agent struct {
-	cfg             Config
-	lastConfig      string
-	box             *box.Box
+	cfg        Config
+	lastConfig string
+	box        *box.Box
+	// coreMu 保护 lastConfig、box 与 hs：同步循环替换/关闭内核时持写锁，
+	// 落地探测读取配置及经内核出站拨号期间、指标采集读取 hs 时持读锁，避免读到半更新的配置或使用已关闭的内核
+	coreMu          sync.RWMutex
 	hs              *HookServer
 	client          *http.Client
 	externalTraffic map[uint][2]int64
 	trafficMu       sync.Mutex
+
+	// spool 未确认流量的本地暂存 (含实例 ID 与序号)，让 Controller 对重发的流量去重
+	spool *trafficSpool
+	// extStats 外部内核统计接口轮询器，未开启时为 nil
+	extStats *externalStats
+	// throttles Controller 下发的超额限速 (用户标签 -> 字节/秒)，仅内置内核生效
+	throttles map[string]int64
+	// metrics 本机 /metrics 指标，未开启时为 nil
+	metrics *agentMetrics
 }
 
 func NewAgent(cfg Config) *Agent {
@@ -63,19 +89,42 @@ func NewAgent(cfg Config) *Agent {
 		cfg:             cfg,
 		client:          &http.Client{Timeout: 10 * time.Second},
 		externalTraffic: make(map[uint][2]int64),
+		spool:           loadTrafficSpool(cfg.LocalConfigDir, cfg.SpoolMaxBytes),
+	}
+	if !cfg.UseInternal {
+		a.extStats = newExternalStats(cfg.StatsAPI, cfg.StatsListen)
 	}
 	// 启动时确保伪装页存在
 	a.EnsureMasquerade()
 	log.Printf("Masquerade directory: %s", cfg.MasqueradeDir)
 
+	if cfg.MetricsListen != "" {
+		a.startMetricsServer(cfg.MetricsListen)
+	}
+
+	if cfg.ProbeInterval > 0 {
+		a.startExitProbing(cfg.ProbeInterval, cfg.ProbeURL)
+	}
+
 	// 启动定时上报任务
 	go a.reportTrafficLoop()
 	return a
 }
 
+// newInstanceID 生成 Agent 实例标识
+func newInstanceID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
 // FetchConfig 从 Controller 获取最新的 Sing-box 配置
 func (a *Agent) FetchConfig() (string, error) {
 	url := fmt.Sprintf("%s/api/v1/node/%d/config", a.cfg.ControllerAddr, a.cfg.NodeID)
+	if a.extStats != nil {
+		// 外部内核无法挂钩统计，请 Controller 在配置中开启本机统计接口
+		url += fmt.Sprintf("?stats_api=%s&stats_listen=%s", a.extStats.api, a.extStats.listen)
+	}
 
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
@@ -220,7 +269,9 @@ func (a *Agent) ApplyConfig(configStr string) error {
 		return err
 	}
 
+	a.coreMu.Lock()
 	a.lastConfig = configStr
+	a.coreMu.Unlock()
 	log.Printf("New config applied to %s", configPath)
 
 	// 3. 确保内核二进制文件存在，否则自动下载
@@ -252,6 +303,7 @@ func (a *Agent) RestartSingBox() error {
 	}
 
 	log.Println("Sing-box service restarted successfully.")
+	a.observeCoreRestart()
 	return nil
 }
 
@@ -272,16 +324,23 @@ func (a *Agent) UpdateInternalCore(configStr string) error {
 		return fmt.Errorf("create sing-box error: %s", err)
 	}
 
-	// 注入我们的统计钩子
-	hs := &HookServer{
-		counter: sync.Map{},
+	// 注入我们的统计钩子 (热重载时沿用同一个，避免丢失尚未上报的计数)
+	hs := a.hs
+	if hs == nil {
+		hs = &HookServer{
+			counter: sync.Map{},
+		}
+		hs.SetThrottles(a.throttles)
 	}
 	b.Router().AppendTracker(hs)
 
-	// 热重载：先停止旧内核释放端口，再启动新内核
+	// 热重载：先停止旧内核释放端口，再启动新内核 (等待进行中的探测用完旧内核)
+	a.coreMu.Lock()
+	defer a.coreMu.Unlock()
 	if a.box != nil {
 		log.Println("Hot reload: stopping old core to release ports...")
 		a.box.Close()
+		a.box = nil
 		time.Sleep(200 * time.Millisecond) // 等待端口释放
 	}
 
@@ -301,40 +360,48 @@ func (a *Agent) UpdateInternalCore(configStr string) error {
 
 	a.box = b
 	a.hs = hs
+	a.observeCoreRestart()
 	log.Println("Internal Sing-box core updated (Graceful). New core running.")
 	return nil
 }
 
 func (a *Agent) reportTrafficLoop() {
 	ticker := time.NewTicker(20 * time.Second) // 加快频率
-	// pendingStats: [Email] -> [Up, Down]
-	pendingUserStats := make(map[string][2]int64)
 
 	for range ticker.C {
 		userTraffic := []models.UserTraffic{}
+		var inbounds, outbounds []models.TagTraffic
 
-		// 1. 尝试从内置核心获取用户级流量
+		// 1. 尝试从内置核心 (或外部内核的统计接口) 获取用户级流量，以及按 inbound / outbound 实测的流量
+		var userStats, inboundStats, outboundStats map[string][2]int64
 		if a.hs != nil {
-			newStats := a.hs.GetStats()
-			for email, traffic := range newStats {
-				val := pendingUserStats[email]
-				val[0] += traffic[0]
-				val[1] += traffic[1]
-				pendingUserStats[email] = val
+			userStats = a.hs.GetStats()
+			inboundStats, outboundStats = a.hs.GetTagStats()
+		} else if a.extStats != nil {
+			var extUp, extDown int64
+			var err error
+			userStats, inboundStats, outboundStats, extUp, extDown, err = a.extStats.Collect()
+			if err != nil {
+				log.Printf("[Stats] 读取外部内核统计接口 (%s %s) 失败: %v", a.extStats.api, a.extStats.listen, err)
 			}
-			for email, traffic := range pendingUserStats {
-				userTraffic = append(userTraffic, models.UserTraffic{
-					UserEmail: email,
-					Upload:    traffic[0],
-					Download:  traffic[1],
-				})
+			a.addExternalTraffic(extUp, extDown)
+		}
+		a.observeUserTraffic(userStats)
+		for email, traffic := range userStats {
+			if traffic[0] == 0 && traffic[1] == 0 {
+				continue
 			}
+			userTraffic = append(userTraffic, models.UserTraffic{
+				UserEmail: email,
+				Upload:    traffic[0],
+				Download:  traffic[1],
+			})
 		}
+		inbounds = toTagTraffic(inboundStats)
+		outbounds = toTagTraffic(outboundStats)
 
-		// 2. 尝试获取节点级汇总流量 (支持外部魔改内核)
+		// 2. 获取节点级汇总流量 (外部内核经 Clash API 只能统计到节点总量)
 		var nodeUp, nodeDown int64
-		// 这里未来可以扩展：通过 ss -ti 实时扫描并将数据存入 a.externalTraffic
-		// 暂时先上报已发现的部分
 		a.trafficMu.Lock()
 		nodeUp = a.externalTraffic[uint(a.cfg.NodeID)][0]
 		nodeDown = a.externalTraffic[uint(a.cfg.NodeID)][1]
@@ -342,42 +409,136 @@ func (a *Agent) reportTrafficLoop() {
 		a.externalTraffic[uint(a.cfg.NodeID)] = [2]int64{0, 0}
 		a.trafficMu.Unlock()
 
-		// 即使没有用户流量，也允许上报（为了上报系统探针数据）
-		// if len(userTraffic) == 0 && nodeUp == 0 && nodeDown == 0 {
-		// 	continue
-		// }
-
-		report := models.NodeTrafficReport{
-			NodeID:        uint(a.cfg.NodeID),
-			Traffic:       userTraffic,
-			TotalUpload:   nodeUp,
-			TotalDownload: nodeDown,
-			Stats:         GetSystemStats(), // 获取并附加系统状态
+		// 新流量封装为新批次并先落盘，再尝试上报
+		if len(userTraffic) > 0 || len(inbounds) > 0 || len(outbounds) > 0 || nodeUp > 0 || nodeDown > 0 {
+			a.spool.Append(trafficBatch{
+				Traffic:   userTraffic,
+				Upload:    nodeUp,
+				Download:  nodeDown,
+				Inbounds:  inbounds,
+				Outbounds: outbounds,
+			})
 		}
 
-		jsonData, _ := json.Marshal(report)
-		url := fmt.Sprintf("%s/api/v1/node/%d/traffic", a.cfg.ControllerAddr, a.cfg.NodeID)
-		req, _ := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
-		if a.cfg.AdminToken != "" {
-			req.Header.Set("Authorization", a.cfg.AdminToken)
+		// 即使没有用户流量，也允许上报（为了上报系统探针数据）
+		stats := GetSystemStats() // 获取并附加系统状态
+		if a.hs != nil {
+			for _, n := range a.hs.ActiveConnections() {
+				stats.ActiveConns += n
+			}
+		}
+		a.observeSystemStats(stats)
+		if len(a.spool.Batches) == 0 {
+			a.sendTrafficReport(models.NodeTrafficReport{
+				NodeID:     uint(a.cfg.NodeID),
+				Traffic:    []models.UserTraffic{},
+				Stats:      stats,
+				InstanceID: a.spool.InstanceID,
+			})
+			continue
 		}
-		req.Header.Set("Content-Type", "application/json")
 
-		resp, err := a.client.Do(req)
-		if err == nil {
-			if resp.StatusCode == http.StatusOK {
-				pendingUserStats = make(map[string][2]int64) // 只有成功才清空
+		// 按序号依次补发，遇到失败留待下个周期
+		for len(a.spool.Batches) > 0 {
+			batch := a.spool.Batches[0]
+			a.spool.MarkSent(batch.Seq)
+			acked, err := a.sendTrafficReport(models.NodeTrafficReport{
+				NodeID:        uint(a.cfg.NodeID),
+				Traffic:       batch.Traffic,
+				TotalUpload:   batch.Upload,
+				TotalDownload: batch.Download,
+				Inbounds:      batch.Inbounds,
+				Outbounds:     batch.Outbounds,
+				Stats:         stats,
+				InstanceID:    a.spool.InstanceID,
+				Seq:           batch.Seq,
+			})
+			if err != nil {
+				break
+			}
+			// 只有 Controller 确认入账的批次才丢弃
+			if a.spool.Ack(acked) == 0 {
+				break
 			}
-			resp.Body.Close()
 		}
 	}
 }
 
+// applyThrottles 更新超额用户的限速
+func (a *Agent) applyThrottles(throttles map[string]int64) {
+	if len(throttles) != len(a.throttles) {
+		if len(throttles) > 0 && !a.cfg.UseInternal {
+			log.Printf("[Quota] %d 个用户已超额限速，但外部内核不支持限速，请使用 -internal", len(throttles))
+		} else {
+			log.Printf("[Quota] 超额限速用户: %d", len(throttles))
+		}
+	}
+	a.throttles = throttles
+	if a.hs != nil {
+		a.hs.SetThrottles(throttles)
+	}
+}
+
+// addExternalTraffic 累加外部内核的节点级流量
+func (a *Agent) addExternalTraffic(up, down int64) {
+	if up == 0 && down == 0 {
+		return
+	}
+	a.trafficMu.Lock()
+	defer a.trafficMu.Unlock()
+	key := uint(a.cfg.NodeID)
+	total := a.externalTraffic[key]
+	a.externalTraffic[key] = [2]int64{total[0] + up, total[1] + down}
+}
+
+// toTagTraffic 将 tag 计数转换为上报结构
+func toTagTraffic(stats map[string][2]int64) []models.TagTraffic {
+	var result []models.TagTraffic
+	for tag, traffic := range stats {
+		result = append(result, models.TagTraffic{Tag: tag, Upload: traffic[0], Download: traffic[1]})
+	}
+	return result
+}
+
+// sendTrafficReport 上报一次流量，返回 Controller 确认的已入账序号
+func (a *Agent) sendTrafficReport(report models.NodeTrafficReport) (uint64, error) {
+	jsonData, _ := json.Marshal(report)
+	url := fmt.Sprintf("%s/api/v1/node/%d/traffic", a.cfg.ControllerAddr, a.cfg.NodeID)
+	req, _ := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	if a.cfg.AdminToken != "" {
+		req.Header.Set("Authorization", a.cfg.AdminToken)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("controller returned status: %d", resp.StatusCode)
+	}
+
+	var result struct {
+		AckedSeq *uint64 `json:"acked_seq"`
+	}
+	json.NewDecoder(resp.Body).Decode(&result)
+	if result.AckedSeq == nil {
+		// 旧版 Controller 不返回确认序号，HTTP 200 即视为本批次已入账
+		return report.Seq, nil
+	}
+	return *result.AckedSeq, nil
+}
+
 func (a *Agent) RunOnce() {
 	log.Println("Syncing state from controller...")
 
 	// 1. 获取来自控制端的最新数据 (JSON 格式)
 	url := fmt.Sprintf("%s/api/v1/node/%d/config", a.cfg.ControllerAddr, a.cfg.NodeID)
+	if a.extStats != nil {
+		// 外部内核无法挂钩统计，请 Controller 在配置中开启本机统计接口
+		url += fmt.Sprintf("?stats_api=%s&stats_listen=%s", a.extStats.api, a.extStats.listen)
+	}
 	req, _ := http.NewRequest("GET", url, nil)
 	if a.cfg.AdminToken != "" {
 		req.Header.Set("Authorization", a.cfg.AdminToken)
@@ -391,14 +552,16 @@ func (a *Agent) RunOnce() {
 	defer resp.Body.Close()
 
 	var result struct {
-		Config   string `json:"config"`
-		CertTask bool   `json:"cert_task"`
-		Domain   string `json:"domain"`
+		Config   string           `json:"config"`
+		CertTask bool             `json:"cert_task"`
+		Domain   string           `json:"domain"`
+		Throttle map[string]int64 `json:"throttle"`
 	}
 	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
 		log.Printf("Failed to decode sync response: %v", err)
 		return
 	}
+	a.applyThrottles(result.Throttle)
 
 	// 2. 检查是否有证书申请任务
 	if result.CertTask {
@@ -0,0 +1,79 @@
+package agent
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+
+	N "github.com/sagernet/sing/common/network"
+)
+
+// activeCounter 返回 inbound 的活跃连接计数，未知 inbound 返回 nil
+func (h *HookServer) activeCounter(inbound string) *atomic.Int64 {
+	if inbound == "" {
+		return nil
+	}
+	val, _ := h.active.LoadOrStore(inbound, &atomic.Int64{})
+	return val.(*atomic.Int64)
+}
+
+// ActiveConnections 返回各 inbound 当前的活跃连接数
+func (h *HookServer) ActiveConnections() map[string]int64 {
+	result := make(map[string]int64)
+	h.active.Range(func(key, value interface{}) bool {
+		result[key.(string)] = value.(*atomic.Int64).Load()
+		return true
+	})
+	return result
+}
+
+// trackConn 连接建立时计数加一，关闭时减一
+// 包装层声明可被替换，bufio.CopyConn 会剥离它继续走 splice 等零拷贝路径；连接管理器关闭的仍是外层连接
+func (h *HookServer) trackConn(inbound string, conn net.Conn) net.Conn {
+	counter := h.activeCounter(inbound)
+	if counter == nil {
+		return conn
+	}
+	counter.Add(1)
+	return &trackedConn{Conn: conn, counter: counter}
+}
+
+// trackPacketConn 同 trackConn，用于 UDP
+func (h *HookServer) trackPacketConn(inbound string, conn N.PacketConn) N.PacketConn {
+	counter := h.activeCounter(inbound)
+	if counter == nil {
+		return conn
+	}
+	counter.Add(1)
+	return &trackedPacketConn{PacketConn: conn, counter: counter}
+}
+
+type trackedConn struct {
+	net.Conn
+	counter *atomic.Int64
+	once    sync.Once
+}
+
+func (c *trackedConn) Close() error {
+	c.once.Do(func() { c.counter.Add(-1) })
+	return c.Conn.Close()
+}
+
+func (c *trackedConn) Upstream() any           { return c.Conn }
+func (c *trackedConn) ReaderReplaceable() bool { return true }
+func (c *trackedConn) WriterReplaceable() bool { return true }
+
+type trackedPacketConn struct {
+	N.PacketConn
+	counter *atomic.Int64
+	once    sync.Once
+}
+
+func (c *trackedPacketConn) Close() error {
+	c.once.Do(func() { c.counter.Add(-1) })
+	return c.PacketConn.Close()
+}
+
+func (c *trackedPacketConn) Upstream() any           { return c.PacketConn }
+func (c *trackedPacketConn) ReaderReplaceable() bool { return true }
+func (c *trackedPacketConn) WriterReplaceable() bool { return true }
@@ -0,0 +1,137 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/sagernet/sing-box/experimental/v2rayapi"
+	"github.com/wangn9900/StealthForward/internal/generator"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// v2rayQueryStatsMethod sing-box 以 V2Ray 兼容的服务名注册 StatsService，生成代码中的方法名无法直接使用
+const v2rayQueryStatsMethod = "/v2ray.core.app.stats.command.StatsService/QueryStats"
+
+// externalStats 外部内核统计接口的轮询状态
+type externalStats struct {
+	api    string
+	listen string
+
+	conn *grpc.ClientConn
+
+	// Clash API 只提供累计值，记录上次读数以计算增量
+	lastUpload   int64
+	lastDownload int64
+	hasLast      bool
+}
+
+// newExternalStats 创建外部内核统计轮询器，未开启统计接口时返回 nil
+func newExternalStats(api, listen string) *externalStats {
+	if api == "" {
+		return nil
+	}
+	return &externalStats{api: api, listen: generator.StatsListenAddr(api, listen)}
+}
+
+// Collect 读取一次增量流量：用户、inbound、outbound 三个维度，以及节点总量 (仅 Clash API)
+func (e *externalStats) Collect() (users, inbounds, outbounds map[string][2]int64, nodeUp, nodeDown int64, err error) {
+	switch e.api {
+	case generator.StatsAPIV2Ray:
+		users, inbounds, outbounds, err = e.queryV2Ray()
+	case generator.StatsAPIClash:
+		nodeUp, nodeDown, err = e.queryClash()
+	default:
+		err = fmt.Errorf("unknown stats api: %s", e.api)
+	}
+	return
+}
+
+// queryV2Ray 通过 V2Ray Stats API 读取并清零计数器
+// 计数器名称形如 user>>>{name}>>>traffic>>>uplink，uplink 为上行 (客户端发出)，与内置内核的方向一致
+func (e *externalStats) queryV2Ray() (users, inbounds, outbounds map[string][2]int64, err error) {
+	if e.conn == nil {
+		conn, err := grpc.NewClient(e.listen, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		e.conn = conn
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	resp := new(v2rayapi.QueryStatsResponse)
+	if err := e.conn.Invoke(ctx, v2rayQueryStatsMethod, &v2rayapi.QueryStatsRequest{Reset_: true}, resp); err != nil {
+		return nil, nil, nil, err
+	}
+
+	users = make(map[string][2]int64)
+	inbounds = make(map[string][2]int64)
+	outbounds = make(map[string][2]int64)
+	for _, stat := range resp.Stat {
+		if stat.Value == 0 {
+			continue
+		}
+		parts := strings.Split(stat.Name, ">>>")
+		if len(parts) != 4 || parts[2] != "traffic" {
+			continue
+		}
+		var target map[string][2]int64
+		switch parts[0] {
+		case "user":
+			target = users
+		case "inbound":
+			target = inbounds
+		case "outbound":
+			target = outbounds
+		default:
+			continue
+		}
+		counters := target[parts[1]]
+		switch parts[3] {
+		case "uplink":
+			counters[0] += stat.Value
+		case "downlink":
+			counters[1] += stat.Value
+		}
+		target[parts[1]] = counters
+	}
+	return users, inbounds, outbounds, nil
+}
+
+// queryClash 通过 Clash API 读取节点累计流量并换算为增量
+// 内核重启后累计值归零，此时本次读数即为增量
+func (e *externalStats) queryClash() (int64, int64, error) {
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Get("http://" + e.listen + "/connections")
+	if err != nil {
+		return 0, 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, 0, fmt.Errorf("clash api returned status: %d", resp.StatusCode)
+	}
+
+	var snapshot struct {
+		UploadTotal   int64 `json:"uploadTotal"`
+		DownloadTotal int64 `json:"downloadTotal"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&snapshot); err != nil {
+		return 0, 0, err
+	}
+
+	up, down := snapshot.UploadTotal, snapshot.DownloadTotal
+	if e.hasLast && up >= e.lastUpload && down >= e.lastDownload {
+		up -= e.lastUpload
+		down -= e.lastDownload
+	} else if !e.hasLast {
+		// 首次读数包含 Agent 启动前的累计值，无法区分是否已上报过，只作为基准
+		up, down = 0, 0
+	}
+	e.lastUpload, e.lastDownload, e.hasLast = snapshot.UploadTotal, snapshot.DownloadTotal, true
+	return up, down, nil
+}
@@ -0,0 +1,109 @@
+package agent
+
+import (
+	"log"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/wangn9900/StealthForward/internal/metrics"
+	"github.com/wangn9900/StealthForward/internal/models"
+)
+
+// agentMetrics Agent 本机 /metrics 输出的指标
+type agentMetrics struct {
+	registry     *metrics.Registry
+	coreRestarts *metrics.Counter
+	userBytes    *metrics.Counter
+	activeConns  *metrics.Gauge
+	system       map[string]*metrics.Gauge
+	lastStats    atomic.Pointer[models.SystemStats]
+}
+
+// systemGauges 探针数据对应的指标
+var systemGauges = []struct {
+	name  string
+	help  string
+	value func(s *models.SystemStats) float64
+}{
+	{"stealth_agent_cpu_percent", "CPU usage in percent.", func(s *models.SystemStats) float64 { return s.CPU }},
+	{"stealth_agent_memory_percent", "Memory usage in percent.", func(s *models.SystemStats) float64 { return s.Mem }},
+	{"stealth_agent_swap_percent", "Swap usage in percent.", func(s *models.SystemStats) float64 { return s.Swap }},
+	{"stealth_agent_disk_percent", "Root filesystem usage in percent.", func(s *models.SystemStats) float64 { return s.Disk }},
+	{"stealth_agent_load1", "1 minute load average.", func(s *models.SystemStats) float64 { return s.Load1 }},
+	{"stealth_agent_load5", "5 minute load average.", func(s *models.SystemStats) float64 { return s.Load5 }},
+	{"stealth_agent_load15", "15 minute load average.", func(s *models.SystemStats) float64 { return s.Load15 }},
+	{"stealth_agent_network_receive_bytes_per_second", "Recent receive rate.", func(s *models.SystemStats) float64 { return float64(s.NetIn) }},
+	{"stealth_agent_network_transmit_bytes_per_second", "Recent transmit rate.", func(s *models.SystemStats) float64 { return float64(s.NetOut) }},
+	{"stealth_agent_network_receive_bytes", "Bytes received on non-loopback interfaces since boot.", func(s *models.SystemStats) float64 { return float64(s.NetRxTotal) }},
+	{"stealth_agent_network_transmit_bytes", "Bytes sent on non-loopback interfaces since boot.", func(s *models.SystemStats) float64 { return float64(s.NetTxTotal) }},
+	{"stealth_agent_uptime_seconds", "Host uptime.", func(s *models.SystemStats) float64 { return float64(s.Uptime) }},
+}
+
+func newAgentMetrics(a *Agent) *agentMetrics {
+	r := metrics.NewRegistry()
+	m := &agentMetrics{
+		registry:     r,
+		coreRestarts: r.Counter("stealth_agent_core_restarts_total", "Core (re)starts after a config change."),
+		userBytes:    r.Counter("stealth_agent_user_traffic_bytes_total", "Traffic per user tag since the agent started.", "user", "direction"),
+		activeConns:  r.Gauge("stealth_agent_active_connections", "Open connections per inbound (internal core only).", "inbound"),
+		system:       make(map[string]*metrics.Gauge),
+	}
+	for _, g := range systemGauges {
+		m.system[g.name] = r.Gauge(g.name, g.help)
+	}
+	r.OnCollect(func() {
+		if stats := m.lastStats.Load(); stats != nil {
+			for _, g := range systemGauges {
+				m.system[g.name].Set(g.value(stats))
+			}
+		}
+		m.activeConns.Reset()
+		a.coreMu.RLock()
+		hs := a.hs
+		a.coreMu.RUnlock()
+		if hs != nil {
+			for inbound, n := range hs.ActiveConnections() {
+				m.activeConns.Set(float64(n), inbound)
+			}
+		}
+	})
+	return m
+}
+
+// startMetricsServer 在本机地址上提供 /metrics
+func (a *Agent) startMetricsServer(listen string) {
+	a.metrics = newAgentMetrics(a)
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", a.metrics.registry)
+	go func() {
+		log.Printf("[Metrics] Agent metrics listening on http://%s/metrics", listen)
+		if err := http.ListenAndServe(listen, mux); err != nil {
+			log.Printf("[Metrics] Agent metrics server stopped: %v", err)
+		}
+	}()
+}
+
+// observeCoreRestart 记录一次内核 (重) 启动
+func (a *Agent) observeCoreRestart() {
+	if a.metrics != nil {
+		a.metrics.coreRestarts.Inc()
+	}
+}
+
+// observeUserTraffic 累加用户流量
+func (a *Agent) observeUserTraffic(stats map[string][2]int64) {
+	if a.metrics == nil {
+		return
+	}
+	for user, traffic := range stats {
+		a.metrics.userBytes.Add(float64(traffic[0]), user, "up")
+		a.metrics.userBytes.Add(float64(traffic[1]), user, "down")
+	}
+}
+
+// observeSystemStats 缓存最近一次探针数据，抓取时直接读取，避免额外的 CPU 采样
+func (a *Agent) observeSystemStats(stats *models.SystemStats) {
+	if a.metrics != nil && stats != nil {
+		a.metrics.lastStats.Store(stats)
+	}
+}
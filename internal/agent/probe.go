@@ -0,0 +1,173 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sagernet/sing-box/common/urltest"
+	"github.com/wangn9900/StealthForward/internal/models"
+)
+
+const (
+	// DefaultProbeURL 经出站做真实 URL 测试的默认地址
+	DefaultProbeURL = "https://www.gstatic.com/generate_204"
+	// probeTCPAttempts 每轮对每个落地的 TCP 建连次数
+	probeTCPAttempts = 3
+	probeTCPTimeout  = 3 * time.Second
+	probeURLTimeout  = 10 * time.Second
+	// probeConcurrency 同时探测的落地数
+	probeConcurrency = 8
+)
+
+// probeTarget 待探测的落地出站
+type probeTarget struct {
+	tag    string
+	server string
+	port   int
+}
+
+// probeTargets 从当前配置中找出带远端地址的落地出站 (out-<落地名>)
+func probeTargets(configStr string) []probeTarget {
+	var cfg struct {
+		Outbounds []struct {
+			Tag        string `json:"tag"`
+			Server     string `json:"server"`
+			ServerPort int    `json:"server_port"`
+		} `json:"outbounds"`
+	}
+	if err := json.Unmarshal([]byte(configStr), &cfg); err != nil {
+		return nil
+	}
+	var targets []probeTarget
+	for _, o := range cfg.Outbounds {
+		if strings.HasPrefix(o.Tag, "out-") && o.Server != "" && o.ServerPort > 0 {
+			targets = append(targets, probeTarget{tag: o.Tag, server: o.Server, port: o.ServerPort})
+		}
+	}
+	return targets
+}
+
+// startExitProbing 定时探测各落地 (TCP 建连 + 经出站的 URL 测试) 并上报 Controller
+func (a *Agent) startExitProbing(interval time.Duration, probeURL string) {
+	if probeURL == "" {
+		probeURL = DefaultProbeURL
+	}
+	go func() {
+		// 等待首次配置下发
+		time.Sleep(30 * time.Second)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			a.runExitProbes(probeURL)
+			<-ticker.C
+		}
+	}()
+}
+
+// runExitProbes 执行一轮探测并上报
+func (a *Agent) runExitProbes(probeURL string) {
+	a.coreMu.RLock()
+	configStr := a.lastConfig
+	a.coreMu.RUnlock()
+	targets := probeTargets(configStr)
+	if len(targets) == 0 {
+		return
+	}
+	probedAt := time.Now()
+	results := make([]models.ExitProbeResult, len(targets))
+	sem := make(chan struct{}, probeConcurrency)
+	var wg sync.WaitGroup
+	for i, t := range targets {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, t probeTarget) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i] = a.probeExit(t, probeURL)
+		}(i, t)
+	}
+	wg.Wait()
+
+	report := models.ExitProbeReport{NodeID: uint(a.cfg.NodeID), ProbedAt: probedAt.Unix(), Results: results}
+	if err := a.sendProbeReport(report); err != nil {
+		log.Printf("[Probe] 上报探测结果失败: %v", err)
+	}
+}
+
+// probeExit 探测单个落地：多次 TCP 建连取平均耗时，内置内核时再经该出站做一次 URL 测试
+func (a *Agent) probeExit(t probeTarget, probeURL string) models.ExitProbeResult {
+	result := models.ExitProbeResult{Tag: t.tag, Server: t.server, TCPAttempts: probeTCPAttempts}
+	addr := net.JoinHostPort(t.server, strconv.Itoa(t.port))
+	var total time.Duration
+	for i := 0; i < probeTCPAttempts; i++ {
+		start := time.Now()
+		conn, err := net.DialTimeout("tcp", addr, probeTCPTimeout)
+		if err != nil {
+			result.TCPFailures++
+			result.TCPError = err.Error()
+			continue
+		}
+		total += time.Since(start)
+		conn.Close()
+	}
+	if ok := probeTCPAttempts - result.TCPFailures; ok > 0 {
+		result.TCPLatencyMs = float64(total.Microseconds()) / 1000 / float64(ok)
+		result.TCPError = ""
+	}
+
+	a.urlTestExit(&result, t.tag, probeURL)
+	return result
+}
+
+// sendProbeReport 上报探测结果
+func (a *Agent) sendProbeReport(report models.ExitProbeReport) error {
+	jsonData, _ := json.Marshal(report)
+	url := fmt.Sprintf("%s/api/v1/node/%d/probes", a.cfg.ControllerAddr, a.cfg.NodeID)
+	req, _ := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	if a.cfg.AdminToken != "" {
+		req.Header.Set("Authorization", a.cfg.AdminToken)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("controller returned status: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// urlTestExit 经内置内核的出站做一次 URL 测试；测试期间持有内核读锁，热重载会等待测试结束再关闭旧内核。
+// 外部内核无法经出站拨号，只做 TCP 探测
+func (a *Agent) urlTestExit(result *models.ExitProbeResult, tag, probeURL string) {
+	a.coreMu.RLock()
+	defer a.coreMu.RUnlock()
+	if a.box == nil {
+		return
+	}
+	outbound, ok := a.box.Outbound().Outbound(tag)
+	if !ok {
+		return
+	}
+	result.URLTested = true
+	ctx, cancel := context.WithTimeout(context.Background(), probeURLTimeout)
+	defer cancel()
+	ms, err := urltest.URLTest(ctx, probeURL, outbound)
+	if err != nil {
+		result.URLError = err.Error()
+	} else {
+		result.URLLatencyMs = float64(ms)
+	}
+}
@@ -0,0 +1,241 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wangn9900/StealthForward/internal/models"
+
+	box "github.com/sagernet/sing-box"
+	"github.com/sagernet/sing-box/common/urltest"
+	"github.com/sagernet/sing-box/include"
+	"github.com/sagernet/sing-box/option"
+	sjson "github.com/sagernet/sing/common/json"
+)
+
+const (
+	reachTCPTimeout   = 5 * time.Second
+	reachTLSTimeout   = 8 * time.Second
+	reachProxyTimeout = 15 * time.Second
+	// reachProbeOutboundTag 完整代理请求使用的出站 tag
+	reachProbeOutboundTag = "probe"
+)
+
+// ProberConfig 探测机模式 (-probe) 的配置
+type ProberConfig struct {
+	ControllerAddr string
+	Token          string // 探测机 Token (在 Controller 创建探测机时生成，只能访问 /api/v1/probe/*)
+	Name           string // 本地日志中的名称，默认主机名 (Controller 以 Token 对应的探测机名称记录结果)
+	ISP            string // 运营商标签
+	Region         string // 地区标签
+	Interval       time.Duration
+	ProbeURL       string // 经入口做完整代理请求的地址 (默认 DefaultProbeURL)
+}
+
+// Prober 部署在受限网络内的探测机：从 Controller 拉取入口列表，
+// 对每个入口端口做 TCP 建连、TLS/Reality 握手与一次完整代理请求，并上报结果
+type Prober struct {
+	cfg    ProberConfig
+	client *http.Client
+}
+
+// NewProber 创建探测机
+func NewProber(cfg ProberConfig) *Prober {
+	if cfg.Name == "" {
+		cfg.Name, _ = os.Hostname()
+	}
+	if cfg.ProbeURL == "" {
+		cfg.ProbeURL = DefaultProbeURL
+	}
+	return &Prober{cfg: cfg, client: &http.Client{Timeout: 15 * time.Second}}
+}
+
+// Run 按间隔循环探测；interval 为 0 时只执行一轮
+func (p *Prober) Run() {
+	log.Printf("StealthForward Prober %s (%s/%s) starting", p.cfg.Name, p.cfg.ISP, p.cfg.Region)
+	for {
+		if err := p.RunOnce(); err != nil {
+			log.Printf("[Prober] 本轮探测失败: %v", err)
+		}
+		if p.cfg.Interval <= 0 {
+			return
+		}
+		time.Sleep(p.cfg.Interval)
+	}
+}
+
+// RunOnce 拉取入口列表，探测一轮并上报
+func (p *Prober) RunOnce() error {
+	targets, err := p.fetchTargets()
+	if err != nil {
+		return fmt.Errorf("fetch targets: %v", err)
+	}
+	if len(targets) == 0 {
+		return nil
+	}
+	probedAt := time.Now()
+	results := make([]models.ReachabilityResult, len(targets))
+	sem := make(chan struct{}, probeConcurrency)
+	var wg sync.WaitGroup
+	for i, t := range targets {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, t models.ReachabilityTarget) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i] = p.probeTarget(t)
+		}(i, t)
+	}
+	wg.Wait()
+
+	failed := 0
+	for _, r := range results {
+		if r.Error != "" {
+			failed++
+		}
+	}
+	log.Printf("[Prober] 探测 %d 个入口端口，%d 个异常", len(results), failed)
+	return p.sendReport(models.ReachabilityReport{
+		Prober:   p.cfg.Name,
+		ISP:      p.cfg.ISP,
+		Region:   p.cfg.Region,
+		ProbedAt: probedAt.Unix(),
+		Results:  results,
+	})
+}
+
+// probeTarget 依次做 TCP 建连、TLS 握手、完整代理请求，前一步失败时不再继续
+func (p *Prober) probeTarget(t models.ReachabilityTarget) models.ReachabilityResult {
+	result := models.ReachabilityResult{EntryNodeID: t.EntryNodeID, Port: t.Port}
+	addr := net.JoinHostPort(t.Host, strconv.Itoa(t.Port))
+
+	start := time.Now()
+	conn, err := net.DialTimeout("tcp", addr, reachTCPTimeout)
+	if err != nil {
+		result.Error = "tcp: " + err.Error()
+		return result
+	}
+	result.TCPOK = true
+	result.TCPMs = msSince(start)
+
+	// TLS / Reality 握手：Reality 使用伪装域名作为 SNI，未通过认证的握手会被转发到伪装站点
+	if t.TLS {
+		result.TLSTested = true
+		conn.SetDeadline(time.Now().Add(reachTLSTimeout))
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: t.ServerName, InsecureSkipVerify: true})
+		start = time.Now()
+		err = tlsConn.Handshake()
+		tlsConn.Close()
+		if err != nil {
+			result.Error = "tls: " + err.Error()
+			return result
+		}
+		result.TLSOK = true
+		result.TLSMs = msSince(start)
+	} else {
+		conn.Close()
+	}
+
+	if t.Outbound != nil {
+		ms, tested, err := p.proxyRequest(t.Outbound)
+		result.ProxyTested = tested
+		if err != nil {
+			result.Error = "proxy: " + err.Error()
+			return result
+		}
+		result.ProxyOK = true
+		result.ProxyMs = float64(ms)
+	}
+	return result
+}
+
+// proxyRequest 以入口为出站启动一个临时内核，经其请求 ProbeURL
+// 本机内核无法创建该出站时 (如 Reality 需要 with_utls 编译) tested 为 false，不计为入口故障
+func (p *Prober) proxyRequest(outbound map[string]interface{}) (ms uint16, tested bool, err error) {
+	out := make(map[string]interface{}, len(outbound)+1)
+	for k, v := range outbound {
+		out[k] = v
+	}
+	out["tag"] = reachProbeOutboundTag
+	configJSON, _ := json.Marshal(map[string]interface{}{
+		"log":       map[string]interface{}{"level": "error"},
+		"outbounds": []interface{}{out},
+	})
+
+	ctx := box.Context(context.Background(), include.InboundRegistry(), include.OutboundRegistry(), include.EndpointRegistry(), include.DNSTransportRegistry(), include.ServiceRegistry())
+	options, err := sjson.UnmarshalExtendedContext[option.Options](ctx, configJSON)
+	if err != nil {
+		return 0, false, fmt.Errorf("outbound config: %v", err)
+	}
+	b, err := box.New(box.Options{Context: ctx, Options: options})
+	if err != nil {
+		return 0, false, fmt.Errorf("create core: %v", err)
+	}
+	defer b.Close()
+	if err := b.Start(); err != nil {
+		return 0, false, fmt.Errorf("start core: %v", err)
+	}
+	ob, ok := b.Outbound().Outbound(reachProbeOutboundTag)
+	if !ok {
+		return 0, false, fmt.Errorf("outbound not found")
+	}
+	testCtx, cancel := context.WithTimeout(context.Background(), reachProxyTimeout)
+	defer cancel()
+	ms, err = urltest.URLTest(testCtx, p.cfg.ProbeURL, ob)
+	return ms, true, err
+}
+
+// msSince 返回距 start 的毫秒数
+func msSince(start time.Time) float64 {
+	return float64(time.Since(start).Microseconds()) / 1000
+}
+
+// fetchTargets 从 Controller 拉取需要探测的入口端口
+func (p *Prober) fetchTargets() ([]models.ReachabilityTarget, error) {
+	url := strings.TrimRight(p.cfg.ControllerAddr, "/") + "/api/v1/probe/targets"
+	req, _ := http.NewRequest("GET", url, nil)
+	req.Header.Set("Authorization", "Bearer "+p.cfg.Token)
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("controller returned status: %d", resp.StatusCode)
+	}
+	var targets []models.ReachabilityTarget
+	if err := json.NewDecoder(resp.Body).Decode(&targets); err != nil {
+		return nil, err
+	}
+	return targets, nil
+}
+
+// sendReport 上报一轮探测结果
+func (p *Prober) sendReport(report models.ReachabilityReport) error {
+	jsonData, _ := json.Marshal(report)
+	url := strings.TrimRight(p.cfg.ControllerAddr, "/") + "/api/v1/probe/report"
+	req, _ := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	req.Header.Set("Authorization", "Bearer "+p.cfg.Token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("controller returned status: %d", resp.StatusCode)
+	}
+	return nil
+}
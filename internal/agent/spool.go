@@ -0,0 +1,195 @@
+package agent
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/wangn9900/StealthForward/internal/models"
+)
+
+const (
+	// spoolFileName 流量暂存文件，位于 LocalConfigDir 下
+	spoolFileName = "traffic_spool.json"
+	// defaultSpoolMaxBytes 暂存文件默认上限
+	defaultSpoolMaxBytes = 16 << 20
+)
+
+// trafficBatch 一个待确认的流量批次，发出后序号与内容不再改变，保证重发时可被去重
+type trafficBatch struct {
+	Seq       uint64               `json:"seq"`
+	Traffic   []models.UserTraffic `json:"traffic"`
+	Upload    int64                `json:"upload"`
+	Download  int64                `json:"download"`
+	Inbounds  []models.TagTraffic  `json:"inbounds,omitempty"`
+	Outbounds []models.TagTraffic  `json:"outbounds,omitempty"`
+	Sent      bool                 `json:"sent"` // 是否已尝试发送 (已发送的批次不能再合并)
+}
+
+// trafficSpool 未确认流量的本地暂存，Agent 重启或内核重载后继续补报
+// 实例 ID 与序号一并持久化，重启后补报的批次依然能被 Controller 去重
+type trafficSpool struct {
+	path     string
+	maxBytes int
+
+	InstanceID string         `json:"instance_id"`
+	Seq        uint64         `json:"seq"`
+	Batches    []trafficBatch `json:"batches"`
+}
+
+// loadTrafficSpool 加载暂存文件，不存在或损坏时新建
+func loadTrafficSpool(dir string, maxBytes int) *trafficSpool {
+	if maxBytes <= 0 {
+		maxBytes = defaultSpoolMaxBytes
+	}
+	s := &trafficSpool{
+		path:     filepath.Join(dir, spoolFileName),
+		maxBytes: maxBytes,
+	}
+
+	data, err := os.ReadFile(s.path)
+	if err == nil {
+		if err := json.Unmarshal(data, s); err != nil {
+			log.Printf("[Spool] 暂存文件损坏，已重建: %v", err)
+			s.InstanceID, s.Seq, s.Batches = "", 0, nil
+		}
+	} else if !os.IsNotExist(err) {
+		log.Printf("[Spool] 读取暂存文件失败: %v", err)
+	}
+
+	if s.InstanceID == "" {
+		s.InstanceID = newInstanceID()
+	}
+	if len(s.Batches) > 0 {
+		up, down := s.totals(s.Batches)
+		log.Printf("[Spool] 恢复 %d 个未确认的流量批次 (↑ %d, ↓ %d bytes)，将继续补报", len(s.Batches), up, down)
+	}
+	return s
+}
+
+// Append 将新产生的流量封装为新批次
+func (s *trafficSpool) Append(batch trafficBatch) {
+	s.Seq++
+	batch.Seq = s.Seq
+	s.Batches = append(s.Batches, batch)
+	s.save()
+}
+
+// MarkSent 标记批次已发出
+func (s *trafficSpool) MarkSent(seq uint64) {
+	for i := range s.Batches {
+		if s.Batches[i].Seq == seq && !s.Batches[i].Sent {
+			s.Batches[i].Sent = true
+			s.save()
+			return
+		}
+	}
+}
+
+// Ack 丢弃 Controller 已确认入账的批次，返回丢弃数量
+func (s *trafficSpool) Ack(seq uint64) int {
+	dropped := 0
+	for dropped < len(s.Batches) && s.Batches[dropped].Seq <= seq {
+		dropped++
+	}
+	if dropped > 0 {
+		s.Batches = s.Batches[dropped:]
+		s.save()
+	}
+	return dropped
+}
+
+// totals 统计批次中的用户流量总和
+func (s *trafficSpool) totals(batches []trafficBatch) (int64, int64) {
+	var up, down int64
+	for _, b := range batches {
+		for _, t := range b.Traffic {
+			up += t.Upload
+			down += t.Download
+		}
+	}
+	return up, down
+}
+
+// compactUnsent 把所有未发出的批次合并为一个 (按用户累加)，控制长时间断连时的体积
+func (s *trafficSpool) compactUnsent() int {
+	first := len(s.Batches)
+	for i, b := range s.Batches {
+		if !b.Sent {
+			first = i
+			break
+		}
+	}
+	unsent := s.Batches[first:]
+	if len(unsent) < 2 {
+		return 0
+	}
+
+	merged := trafficBatch{Seq: unsent[0].Seq}
+	index := make(map[string]int)
+	for _, b := range unsent {
+		merged.Upload += b.Upload
+		merged.Download += b.Download
+		for _, t := range b.Traffic {
+			if i, ok := index[t.UserEmail]; ok {
+				merged.Traffic[i].Upload += t.Upload
+				merged.Traffic[i].Download += t.Download
+				continue
+			}
+			index[t.UserEmail] = len(merged.Traffic)
+			merged.Traffic = append(merged.Traffic, t)
+		}
+		merged.Inbounds = mergeTagTraffic(merged.Inbounds, b.Inbounds)
+		merged.Outbounds = mergeTagTraffic(merged.Outbounds, b.Outbounds)
+	}
+	s.Batches = append(s.Batches[:first:first], merged)
+	return len(unsent)
+}
+
+// mergeTagTraffic 按 tag 累加 inbound / outbound 流量
+func mergeTagTraffic(dst, src []models.TagTraffic) []models.TagTraffic {
+	for _, t := range src {
+		found := false
+		for i := range dst {
+			if dst[i].Tag == t.Tag {
+				dst[i].Upload += t.Upload
+				dst[i].Download += t.Download
+				found = true
+				break
+			}
+		}
+		if !found {
+			dst = append(dst, t)
+		}
+	}
+	return dst
+}
+
+// save 原子写入暂存文件；超过上限时先合并未发出的批次，仍超限则丢弃最旧的批次
+func (s *trafficSpool) save() {
+	data, _ := json.Marshal(s)
+	if len(data) > s.maxBytes {
+		if n := s.compactUnsent(); n > 0 {
+			log.Printf("[Spool] 暂存超过上限 %d bytes，已合并 %d 个未发出的批次", s.maxBytes, n)
+			data, _ = json.Marshal(s)
+		}
+	}
+	for len(data) > s.maxBytes && len(s.Batches) > 1 {
+		oldest := s.Batches[0]
+		s.Batches = s.Batches[1:]
+		up, down := s.totals([]trafficBatch{oldest})
+		log.Printf("!!!! [Spool] 暂存溢出 (上限 %d bytes)，丢弃最旧批次 #%d: %d 个用户，↑ %d, ↓ %d bytes 流量丢失",
+			s.maxBytes, oldest.Seq, len(oldest.Traffic), up, down)
+		data, _ = json.Marshal(s)
+	}
+
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		log.Printf("[Spool] 写入暂存文件失败: %v", err)
+		return
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		log.Printf("[Spool] 写入暂存文件失败: %v", err)
+	}
+}
@@ -2,26 +2,62 @@ package agent
 
 import (
 	"context"
-	"io"
 	"net"
 	"sync"
 	"sync/atomic"
 
 	"github.com/sagernet/sing-box/adapter"
-	"github.com/sagernet/sing/common/buf"
-	M "github.com/sagernet/sing/common/metadata"
+	"github.com/sagernet/sing/common/bufio"
 	N "github.com/sagernet/sing/common/network"
 )
 
-// TrafficStorage 存储单个用户的流量
+// TrafficStorage 存储单个用户 (或单个 inbound/outbound) 的流量
 type TrafficStorage struct {
 	UpCounter   atomic.Int64
 	DownCounter atomic.Int64
 }
 
+// trafficStorages 一条连接需要同时计入的多个计数器 (用户、inbound、outbound)
+type trafficStorages []*TrafficStorage
+
+func (s trafficStorages) addUp(n int64) {
+	for _, storage := range s {
+		storage.UpCounter.Add(n)
+	}
+}
+
+func (s trafficStorages) addDown(n int64) {
+	for _, storage := range s {
+		storage.DownCounter.Add(n)
+	}
+}
+
 // HookServer 实现 sing-box 的 ConnectionTracker 接口
 type HookServer struct {
-	counter sync.Map // map[string]*TrafficStorage
+	counter         sync.Map // map[string]*TrafficStorage  用户
+	inboundCounter  sync.Map // map[string]*TrafficStorage  inbound tag
+	outboundCounter sync.Map // map[string]*TrafficStorage  outbound tag
+	limiters        sync.Map // map[string]*userLimiter     超额限速的用户
+	active          sync.Map // map[string]*atomic.Int64    inbound tag -> 活跃连接数
+}
+
+// storagesFor 返回连接需要计入的计数器：用户 (如有)、inbound、outbound
+// 出入站计数不依赖用户，路由到 direct / 默认落地 / 映射端口的流量都能按实际走向统计
+func (h *HookServer) storagesFor(m adapter.InboundContext, outbound adapter.Outbound) trafficStorages {
+	var storages trafficStorages
+	if m.User != "" {
+		val, _ := h.counter.LoadOrStore(m.User, &TrafficStorage{})
+		storages = append(storages, val.(*TrafficStorage))
+	}
+	if m.Inbound != "" {
+		val, _ := h.inboundCounter.LoadOrStore(m.Inbound, &TrafficStorage{})
+		storages = append(storages, val.(*TrafficStorage))
+	}
+	if outbound != nil {
+		val, _ := h.outboundCounter.LoadOrStore(outbound.Tag(), &TrafficStorage{})
+		storages = append(storages, val.(*TrafficStorage))
+	}
+	return storages
 }
 
 func (h *HookServer) ModeList() []string {
@@ -29,119 +65,67 @@ func (h *HookServer) ModeList() []string {
 }
 
 func (h *HookServer) RoutedConnection(ctx context.Context, conn net.Conn, m adapter.InboundContext, rule adapter.Rule, outbound adapter.Outbound) net.Conn {
-	if m.User == "" {
-		return conn
-	}
-	// log.Printf("[Debug] Hook TCP for User: %s", m.User)
-
-	val, _ := h.counter.LoadOrStore(m.User, &TrafficStorage{})
-	storage := val.(*TrafficStorage)
-
-	// 使用标准 Conn 包装，不透传 SyscallConn，强制禁用 Splice 以捕获在用户态的流量
-	return &ConnCounter{
-		Conn:    conn,
-		storage: storage,
-	}
+	return h.trackConn(m.Inbound, h.countConn(conn, m, outbound))
 }
 
-func (h *HookServer) RoutedPacketConnection(ctx context.Context, conn N.PacketConn, m adapter.InboundContext, rule adapter.Rule, outbound adapter.Outbound) N.PacketConn {
-	if m.User == "" {
+// countConn 为 TCP 连接挂上流量计数与限速
+func (h *HookServer) countConn(conn net.Conn, m adapter.InboundContext, outbound adapter.Outbound) net.Conn {
+	storages := h.storagesFor(m, outbound)
+	if len(storages) == 0 {
 		return conn
 	}
-	// log.Printf("[Debug] Hook UDP for User: %s", m.User)
-
-	val, _ := h.counter.LoadOrStore(m.User, &TrafficStorage{})
-	storage := val.(*TrafficStorage)
+	// log.Printf("[Debug] Hook TCP for User: %s", m.User)
 
-	return &PacketConnCounter{
-		PacketConn: conn,
-		storage:    storage,
+	// 使用 sing 的计数包装：它实现了 N.ReadCounter / N.WriteCounter，
+	// bufio.CopyConn 会剥离包装并把计数函数带到 splice / ReadFrom / WriteTo 零拷贝路径上，内核转发的字节同样被统计
+	counted := bufio.NewCounterConn(conn, []N.CountFunc{storages.addUp}, []N.CountFunc{storages.addDown})
+	if limiter := h.limiterFor(m.User); limiter != nil {
+		return &throttledConn{Conn: counted, limiter: limiter}
 	}
+	return counted
 }
 
-// ConnCounter 包装 net.Conn 以统计流量 (TCP)
-// 显式实现 net.Conn 而不是嵌入，以隐藏 ReaderFrom/WriterTo/SyscallConn 接口
-// 这会强制 Go 使用标准的 Read/Write 循环，从而确保流量被统计到
-type ConnCounter struct {
-	net.Conn
-	storage *TrafficStorage
+func (h *HookServer) RoutedPacketConnection(ctx context.Context, conn N.PacketConn, m adapter.InboundContext, rule adapter.Rule, outbound adapter.Outbound) N.PacketConn {
+	return h.trackPacketConn(m.Inbound, h.countPacketConn(conn, m, outbound))
 }
 
-func (c *ConnCounter) Read(b []byte) (n int, err error) {
-	n, err = c.Conn.Read(b)
-	if n > 0 {
-		c.storage.UpCounter.Add(int64(n))
-		// log.Printf("TCP Read %d", n)
+// countPacketConn 为 UDP 连接挂上流量计数与限速
+func (h *HookServer) countPacketConn(conn N.PacketConn, m adapter.InboundContext, outbound adapter.Outbound) N.PacketConn {
+	storages := h.storagesFor(m, outbound)
+	if len(storages) == 0 {
+		return conn
 	}
-	return
-}
+	// log.Printf("[Debug] Hook UDP for User: %s", m.User)
 
-func (c *ConnCounter) Write(b []byte) (n int, err error) {
-	n, err = c.Conn.Write(b)
-	if n > 0 {
-		c.storage.DownCounter.Add(int64(n))
-		// log.Printf("TCP Write %d", n)
+	// CounterPacketConn 通过 Upstream 暴露底层连接，sing 会据此计算整条链路所需的前置空间 (Mux / VMess / Trojan 头部)，
+	// 不再需要逐包复制到新缓冲区
+	counted := bufio.NewCounterPacketConn(conn, []N.CountFunc{storages.addUp}, []N.CountFunc{storages.addDown})
+	if limiter := h.limiterFor(m.User); limiter != nil {
+		return &throttledPacketConn{PacketConn: counted, limiter: limiter}
 	}
-	return
-}
-
-// 即使没有嵌入接口，也要重写 ReaderFrom 以防万一 (虽然不嵌入就不会被类型断言成功)
-// 但为了保险起见，显式拦截是个好习惯
-func (c *ConnCounter) ReadFrom(r io.Reader) (n int64, err error) {
-	// 强制降级到 copy loop
-	return io.Copy(struct{ io.Writer }{c}, r)
+	return counted
 }
 
-// PacketConnCounter 包装 N.PacketConn 以统计流量 (UDP/QUIC)
-type PacketConnCounter struct {
-	N.PacketConn
-	storage *TrafficStorage
+// GetStats 获取并重置用户流量统计
+func (h *HookServer) GetStats() map[string][2]int64 {
+	return swapCounters(&h.counter)
 }
 
-// ReadPacket captures UDP Upload traffic
-func (c *PacketConnCounter) ReadPacket(buffer *buf.Buffer) (destination M.Socksaddr, err error) {
-	destination, err = c.PacketConn.ReadPacket(buffer)
-	if err == nil {
-		c.storage.UpCounter.Add(int64(buffer.Len()))
-	}
-	return
+// GetTagStats 获取并重置 inbound / outbound 流量统计
+func (h *HookServer) GetTagStats() (inbounds, outbounds map[string][2]int64) {
+	return swapCounters(&h.inboundCounter), swapCounters(&h.outboundCounter)
 }
 
-// WritePacket captures UDP Download traffic
-func (c *PacketConnCounter) WritePacket(buffer *buf.Buffer, destination M.Socksaddr) error {
-	l := int64(buffer.Len())
-
-	// Defensive Copy: Ensure sufficient headroom for VMess/Trojan Mux header extension.
-	// We require at least 32 bytes of headroom to be safe.
-	const neededHeadroom = 32
-	if buffer.Start() < neededHeadroom {
-		newBuf := buf.NewPacket()
-		// Resize sets start=neededHeadroom and end=start+buffer.Len()
-		newBuf.Resize(neededHeadroom, buffer.Len())
-		copy(newBuf.Bytes(), buffer.Bytes())
-
-		buffer.Release()
-		buffer = newBuf
-	}
-
-	err := c.PacketConn.WritePacket(buffer, destination)
-	if err == nil {
-		c.storage.DownCounter.Add(l)
-		// log.Printf("UDP WritePacket (Down) %d", l)
-	}
-	return err
-}
-
-// GetStats 获取并重置流量统计
-func (h *HookServer) GetStats() map[string][2]int64 {
+// swapCounters 读取并清零一组计数器
+func swapCounters(counters *sync.Map) map[string][2]int64 {
 	stats := make(map[string][2]int64)
-	h.counter.Range(func(key, value interface{}) bool {
-		user := key.(string)
+	counters.Range(func(key, value interface{}) bool {
+		tag := key.(string)
 		storage := value.(*TrafficStorage)
 		up := storage.UpCounter.Swap(0)
 		down := storage.DownCounter.Swap(0)
 		if up > 0 || down > 0 {
-			stats[user] = [2]int64{up, down}
+			stats[tag] = [2]int64{up, down}
 		}
 		return true
 	})
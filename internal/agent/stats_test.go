@@ -0,0 +1,203 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/sagernet/sing-box/adapter"
+	"github.com/sagernet/sing/common/buf"
+	"github.com/sagernet/sing/common/bufio"
+	M "github.com/sagernet/sing/common/metadata"
+	N "github.com/sagernet/sing/common/network"
+)
+
+// legacyConnCounter 改用 sing 计数包装前的 TCP 计数实现，仅作为基准对照
+type legacyConnCounter struct {
+	net.Conn
+	storages trafficStorages
+}
+
+func (c *legacyConnCounter) Read(b []byte) (n int, err error) {
+	n, err = c.Conn.Read(b)
+	if n > 0 {
+		c.storages.addUp(int64(n))
+	}
+	return
+}
+
+func (c *legacyConnCounter) Write(b []byte) (n int, err error) {
+	n, err = c.Conn.Write(b)
+	if n > 0 {
+		c.storages.addDown(int64(n))
+	}
+	return
+}
+
+func (c *legacyConnCounter) ReadFrom(r io.Reader) (n int64, err error) {
+	return io.Copy(struct{ io.Writer }{c}, r)
+}
+
+// legacyPacketConnCounter 改用 sing 计数包装前的 UDP 计数实现 (头部空间不足时逐包复制)
+type legacyPacketConnCounter struct {
+	N.PacketConn
+	storages trafficStorages
+}
+
+func (c *legacyPacketConnCounter) ReadPacket(buffer *buf.Buffer) (destination M.Socksaddr, err error) {
+	destination, err = c.PacketConn.ReadPacket(buffer)
+	if err == nil {
+		c.storages.addUp(int64(buffer.Len()))
+	}
+	return
+}
+
+func (c *legacyPacketConnCounter) WritePacket(buffer *buf.Buffer, destination M.Socksaddr) error {
+	l := int64(buffer.Len())
+	const neededHeadroom = 32
+	if buffer.Start() < neededHeadroom {
+		newBuf := buf.NewPacket()
+		newBuf.Resize(neededHeadroom, buffer.Len())
+		copy(newBuf.Bytes(), buffer.Bytes())
+		buffer.Release()
+		buffer = newBuf
+	}
+	err := c.PacketConn.WritePacket(buffer, destination)
+	if err == nil {
+		c.storages.addDown(l)
+	}
+	return err
+}
+
+var benchContext = adapter.InboundContext{User: "bench-user", Inbound: "bench-in"}
+
+// tcpPair 返回一对回环 TCP 连接
+func tcpPair(tb testing.TB) (client, server net.Conn) {
+	tb.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer ln.Close()
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, _ := ln.Accept()
+		accepted <- conn
+	}()
+	client, err = net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		tb.Fatal(err)
+	}
+	server = <-accepted
+	if server == nil {
+		tb.Fatal("accept failed")
+	}
+	tb.Cleanup(func() { client.Close(); server.Close() })
+	return client, server
+}
+
+// benchmarkTCPRelay 模拟 sing-box 的 TCP 转发：从计数包装后的入站连接拷贝到出站连接，每次迭代 32 KiB
+func benchmarkTCPRelay(b *testing.B, wrap func(h *HookServer, conn net.Conn) net.Conn) {
+	const chunk = 32 << 10
+	srcClient, srcServer := tcpPair(b)
+	dstClient, dstServer := tcpPair(b)
+	h := &HookServer{}
+	source := wrap(h, srcServer)
+	total := int64(b.N) * chunk
+
+	go func() {
+		data := bytes.Repeat([]byte{'x'}, chunk)
+		for i := 0; i < b.N; i++ {
+			if _, err := srcClient.Write(data); err != nil {
+				return
+			}
+		}
+		srcClient.Close()
+	}()
+	drained := make(chan int64, 1)
+	go func() {
+		n, _ := io.Copy(io.Discard, dstServer)
+		drained <- n
+	}()
+
+	b.SetBytes(chunk)
+	b.ResetTimer()
+	n, err := bufio.Copy(dstClient, source)
+	dstClient.Close()
+	<-drained
+	b.StopTimer()
+	if err != nil || n != total {
+		b.Fatalf("copied %d of %d bytes: %v", n, total, err)
+	}
+	if up := h.GetStats()[benchContext.User][0]; up != total {
+		b.Fatalf("counted %d of %d bytes", up, total)
+	}
+}
+
+func BenchmarkTCPRelayLegacyCounter(b *testing.B) {
+	benchmarkTCPRelay(b, func(h *HookServer, conn net.Conn) net.Conn {
+		return h.trackConn(benchContext.Inbound, &legacyConnCounter{Conn: conn, storages: h.storagesFor(benchContext, nil)})
+	})
+}
+
+func BenchmarkTCPRelayCounterConn(b *testing.B) {
+	benchmarkTCPRelay(b, func(h *HookServer, conn net.Conn) net.Conn {
+		return h.RoutedConnection(context.Background(), conn, benchContext, nil, nil)
+	})
+}
+
+// headroomPacketConn 需要 32 字节前置空间的出站 (如 VMess / Trojan 头部)，写入后丢弃数据包
+type headroomPacketConn struct {
+	N.PacketConn
+}
+
+func (c *headroomPacketConn) FrontHeadroom() int { return 32 }
+
+func (c *headroomPacketConn) WritePacket(buffer *buf.Buffer, destination M.Socksaddr) error {
+	defer buffer.Release()
+	if buffer.Start() < 32 {
+		return io.ErrShortBuffer
+	}
+	buffer.ExtendHeader(32)
+	return nil
+}
+
+// benchmarkUDPWrite 按 sing 的方式为整条链路预留前置空间后写入 1200 字节的数据包
+func benchmarkUDPWrite(b *testing.B, wrap func(h *HookServer, conn N.PacketConn) N.PacketConn) {
+	const size = 1200
+	h := &HookServer{}
+	conn := wrap(h, &headroomPacketConn{})
+	payload := bytes.Repeat([]byte{'x'}, size)
+	destination := M.ParseSocksaddr("1.1.1.1:53")
+	headroom := N.CalculateFrontHeadroom(conn)
+
+	b.SetBytes(size)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buffer := buf.NewPacket()
+		buffer.Resize(headroom, 0)
+		buffer.Write(payload)
+		if err := conn.WritePacket(buffer, destination); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.StopTimer()
+	if down := h.GetStats()[benchContext.User][1]; down != int64(b.N)*size {
+		b.Fatalf("counted %d of %d bytes", down, int64(b.N)*size)
+	}
+}
+
+func BenchmarkUDPWriteLegacyCounter(b *testing.B) {
+	benchmarkUDPWrite(b, func(h *HookServer, conn N.PacketConn) N.PacketConn {
+		return h.trackPacketConn(benchContext.Inbound, &legacyPacketConnCounter{PacketConn: conn, storages: h.storagesFor(benchContext, nil)})
+	})
+}
+
+func BenchmarkUDPWriteCounterPacketConn(b *testing.B) {
+	benchmarkUDPWrite(b, func(h *HookServer, conn N.PacketConn) N.PacketConn {
+		return h.RoutedPacketConnection(context.Background(), conn, benchContext, nil, nil)
+	})
+}
@@ -1,6 +1,7 @@
 package agent
 
 import (
+	"strings"
 	"time"
 
 	"github.com/shirou/gopsutil/v3/cpu"
@@ -76,5 +77,24 @@ func GetSystemStats() *models.SystemStats {
 		lastCheck = now
 	}
 
+	// 网卡累计流量 (排除回环，云厂商只统计经过物理网卡的流量)
+	stats.NetRxTotal, stats.NetTxTotal = interfaceTotals()
+
 	return stats
 }
+
+// interfaceTotals 汇总除回环外所有网卡的累计收发字节
+func interfaceTotals() (rx, tx int64) {
+	nics, err := net.IOCounters(true)
+	if err != nil {
+		return 0, 0
+	}
+	for _, nic := range nics {
+		if strings.HasPrefix(nic.Name, "lo") {
+			continue
+		}
+		rx += int64(nic.BytesRecv)
+		tx += int64(nic.BytesSent)
+	}
+	return rx, tx
+}
@@ -0,0 +1,122 @@
+package agent
+
+import (
+	"context"
+	"net"
+
+	"github.com/sagernet/sing/common/buf"
+	M "github.com/sagernet/sing/common/metadata"
+	N "github.com/sagernet/sing/common/network"
+	"golang.org/x/time/rate"
+)
+
+// minThrottleBurst 限速令牌桶的最小突发量，保证单次读写不会超过桶容量
+const minThrottleBurst = 64 * 1024
+
+// userLimiter 单个用户的上下行限速
+type userLimiter struct {
+	bytesPerSec int64
+	up          *rate.Limiter
+	down        *rate.Limiter
+}
+
+func newUserLimiter(bytesPerSec int64) *userLimiter {
+	burst := int(bytesPerSec)
+	if burst < minThrottleBurst {
+		burst = minThrottleBurst
+	}
+	return &userLimiter{
+		bytesPerSec: bytesPerSec,
+		up:          rate.NewLimiter(rate.Limit(bytesPerSec), burst),
+		down:        rate.NewLimiter(rate.Limit(bytesPerSec), burst),
+	}
+}
+
+// SetThrottles 更新超额用户的限速 (用户标签 -> 字节/秒)，不在列表中的用户解除限速
+// 只对之后建立的连接生效，已有连接在重连后按新限速
+func (h *HookServer) SetThrottles(throttles map[string]int64) {
+	h.limiters.Range(func(key, value interface{}) bool {
+		if _, ok := throttles[key.(string)]; !ok {
+			h.limiters.Delete(key)
+		}
+		return true
+	})
+	for user, bytesPerSec := range throttles {
+		if bytesPerSec <= 0 {
+			continue
+		}
+		if val, ok := h.limiters.Load(user); ok && val.(*userLimiter).bytesPerSec == bytesPerSec {
+			continue
+		}
+		h.limiters.Store(user, newUserLimiter(bytesPerSec))
+	}
+}
+
+// limiterFor 返回用户当前的限速器，未限速时返回 nil
+func (h *HookServer) limiterFor(user string) *userLimiter {
+	if user == "" {
+		return nil
+	}
+	if val, ok := h.limiters.Load(user); ok {
+		return val.(*userLimiter)
+	}
+	return nil
+}
+
+// throttledConn 限速的 TCP 连接 (会退回用户态拷贝，仅用于超额用户)
+type throttledConn struct {
+	net.Conn
+	limiter *userLimiter
+}
+
+func (c *throttledConn) Read(b []byte) (int, error) {
+	if len(b) > c.limiter.up.Burst() {
+		b = b[:c.limiter.up.Burst()]
+	}
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		c.limiter.up.WaitN(context.Background(), n)
+	}
+	return n, err
+}
+
+func (c *throttledConn) Write(b []byte) (int, error) {
+	written := 0
+	for len(b) > 0 {
+		chunk := b
+		if len(chunk) > c.limiter.down.Burst() {
+			chunk = chunk[:c.limiter.down.Burst()]
+		}
+		c.limiter.down.WaitN(context.Background(), len(chunk))
+		n, err := c.Conn.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		b = b[n:]
+	}
+	return written, nil
+}
+
+// throttledPacketConn 限速的 UDP 连接
+type throttledPacketConn struct {
+	N.PacketConn
+	limiter *userLimiter
+}
+
+func (c *throttledPacketConn) ReadPacket(buffer *buf.Buffer) (M.Socksaddr, error) {
+	destination, err := c.PacketConn.ReadPacket(buffer)
+	if err == nil {
+		c.limiter.up.WaitN(context.Background(), min(buffer.Len(), c.limiter.up.Burst()))
+	}
+	return destination, err
+}
+
+func (c *throttledPacketConn) WritePacket(buffer *buf.Buffer, destination M.Socksaddr) error {
+	c.limiter.down.WaitN(context.Background(), min(buffer.Len(), c.limiter.down.Burst()))
+	return c.PacketConn.WritePacket(buffer, destination)
+}
+
+func (c *throttledPacketConn) Upstream() any {
+	return c.PacketConn
+}
@@ -1,9 +1,12 @@
 package api
 
 import (
+	"fmt"
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"github.com/wangn9900/StealthForward/internal/cloud"
 	"github.com/wangn9900/StealthForward/internal/database"
 	"github.com/wangn9900/StealthForward/internal/models"
 )
@@ -22,6 +25,11 @@ func CreateCloudAccountHandler(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	// 账号池状态与用量从零开始
+	account.ID = 0
+	account.Healthy, account.LimitedUntil = true, nil
+	account.InstanceCount, account.ProvisionCount, account.RotateCount, account.ErrorCount = 0, 0, 0, 0
+	account.LastUsedAt, account.LastError, account.LastErrorAt = nil, "", nil
 	database.DB.Create(&account)
 	c.JSON(http.StatusOK, account)
 }
@@ -34,21 +42,67 @@ func UpdateCloudAccountHandler(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Account not found"})
 		return
 	}
-	if err := c.ShouldBindJSON(&account); err != nil {
+	// 只接受可编辑字段，用量计数与选择依据由账号池维护
+	var req struct {
+		Name      string `json:"name"`
+		Provider  string `json:"provider"`
+		AccessKey string `json:"access_key"`
+		SecretKey string `json:"secret_key"`
+		Endpoint  string `json:"endpoint"`
+		Enabled   *bool  `json:"enabled"` // 未提供时保持不变
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	database.DB.Save(&account)
+	updates := map[string]interface{}{
+		"name":       req.Name,
+		"provider":   req.Provider,
+		"access_key": req.AccessKey,
+		"secret_key": req.SecretKey,
+		"endpoint":   req.Endpoint,
+		// 编辑账号 (通常是更换了密钥或提升了配额) 后重新参与选择
+		"healthy":       true,
+		"limited_until": nil,
+	}
+	if req.Enabled != nil {
+		updates["enabled"] = *req.Enabled
+	}
+	if err := database.DB.Model(&account).Updates(updates).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	database.DB.First(&account, account.ID)
 	c.JSON(http.StatusOK, account)
 }
 
 // DeleteCloudAccountHandler 删除云账号
 func DeleteCloudAccountHandler(c *gin.Context) {
 	id := c.Param("id")
+	var bound int64
+	database.DB.Model(&models.EntryNode{}).Where("cloud_account_id = ?", id).Count(&bound)
+	if bound > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("还有 %d 个入口绑定在该账号上，请先迁移或解绑", bound)})
+		return
+	}
+	database.DB.Model(&models.DNSZone{}).Where("cloud_account_id = ?", id).Count(&bound)
+	if bound > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("还有 %d 个 DNS 域名使用该账号，请先修改域名绑定", bound)})
+		return
+	}
 	database.DB.Delete(&models.CloudAccount{}, id)
 	c.JSON(http.StatusOK, gin.H{"message": "deleted"})
 }
 
+// ListCloudAccountUsageHandler 云账号操作记录 (?account_id=&limit=)
+func ListCloudAccountUsageHandler(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if limit <= 0 || limit > 1000 {
+		limit = 100
+	}
+	c.JSON(http.StatusOK, cloud.GetAccountUsage(queryAccountID(c), limit))
+}
+
 // ListSSHKeysHandler 列出 SSH 密钥
 func ListSSHKeysHandler(c *gin.Context) {
 	var keys []models.SSHKey
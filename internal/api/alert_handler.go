@@ -0,0 +1,202 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wangn9900/StealthForward/internal/database"
+	"github.com/wangn9900/StealthForward/internal/models"
+	"github.com/wangn9900/StealthForward/internal/sync"
+)
+
+// ListNodeStatusHandler 返回各入口的当前状态 (online/degraded/offline/unknown) 与最近一次探针数据
+func ListNodeStatusHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, sync.GetNodeStatuses())
+}
+
+// GetNodeStatusHistoryHandler 返回入口的状态变化历史
+func GetNodeStatusHistoryHandler(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit <= 0 || limit > 1000 {
+		limit = 100
+	}
+	var changes []models.NodeStatusChange
+	database.DB.Where("entry_node_id = ?", c.Param("id")).Order("id DESC").Limit(limit).Find(&changes)
+	c.JSON(http.StatusOK, changes)
+}
+
+// ListAlertRulesHandler 列出所有告警规则
+func ListAlertRulesHandler(c *gin.Context) {
+	var rules []models.AlertRule
+	database.DB.Order("id").Find(&rules)
+	c.JSON(http.StatusOK, rules)
+}
+
+// CreateAlertRuleHandler 创建告警规则
+func CreateAlertRuleHandler(c *gin.Context) {
+	var rule models.AlertRule
+	if err := c.ShouldBindJSON(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := sync.ValidateAlertRule(rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	rule.ID = 0
+	rule.Enabled = true
+	if err := database.DB.Create(&rule).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, rule)
+}
+
+// UpdateAlertRuleHandler 更新告警规则，下一次检查时按新设置生效
+func UpdateAlertRuleHandler(c *gin.Context) {
+	var rule models.AlertRule
+	if err := database.DB.First(&rule, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Rule not found"})
+		return
+	}
+	var req struct {
+		Name        string  `json:"name"`
+		Metric      string  `json:"metric"`
+		Threshold   float64 `json:"threshold"`
+		DurationSec int     `json:"duration_sec"`
+		EntryNodeID uint    `json:"entry_node_id"`
+		ChannelIDs  string  `json:"channel_ids"`
+		Enabled     *bool   `json:"enabled"` // 未提供时保持不变
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	rule.Name = req.Name
+	rule.Metric = req.Metric
+	rule.Threshold = req.Threshold
+	rule.DurationSec = req.DurationSec
+	rule.EntryNodeID = req.EntryNodeID
+	rule.ChannelIDs = req.ChannelIDs
+	if req.Enabled != nil {
+		rule.Enabled = *req.Enabled
+	}
+	if err := sync.ValidateAlertRule(rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	database.DB.Save(&rule)
+	c.JSON(http.StatusOK, rule)
+}
+
+// DeleteAlertRuleHandler 删除告警规则 (遗留的告警在下一次检查时关闭)
+func DeleteAlertRuleHandler(c *gin.Context) {
+	if err := database.DB.Delete(&models.AlertRule{}, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "deleted"})
+}
+
+// ListAlertEventsHandler 列出告警记录，可按 state / entry_id 过滤
+func ListAlertEventsHandler(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit <= 0 || limit > 1000 {
+		limit = 100
+	}
+	query := database.DB.Order("id DESC").Limit(limit)
+	if state := c.Query("state"); state != "" {
+		query = query.Where("state = ?", state)
+	}
+	if entryID := c.Query("entry_id"); entryID != "" {
+		query = query.Where("entry_node_id = ?", entryID)
+	}
+	var events []models.AlertEvent
+	query.Find(&events)
+	c.JSON(http.StatusOK, events)
+}
+
+// ListNotificationChannelsHandler 列出通知渠道 (不返回 bot_token 等密钥)
+func ListNotificationChannelsHandler(c *gin.Context) {
+	var channels []models.NotificationChannel
+	database.DB.Order("id").Find(&channels)
+	for i := range channels {
+		channels[i] = sync.MaskChannelSecrets(channels[i])
+	}
+	c.JSON(http.StatusOK, channels)
+}
+
+// CreateNotificationChannelHandler 创建通知渠道
+func CreateNotificationChannelHandler(c *gin.Context) {
+	var ch models.NotificationChannel
+	if err := c.ShouldBindJSON(&ch); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := sync.ValidateNotificationChannel(ch); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ch.ID = 0
+	ch.Enabled = true
+	if err := database.DB.Create(&ch).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, sync.MaskChannelSecrets(ch))
+}
+
+// UpdateNotificationChannelHandler 更新通知渠道，配置中的密钥为占位符时保留原密钥
+func UpdateNotificationChannelHandler(c *gin.Context) {
+	var ch models.NotificationChannel
+	if err := database.DB.First(&ch, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Channel not found"})
+		return
+	}
+	var req struct {
+		Name    string `json:"name"`
+		Type    string `json:"type"`
+		Config  string `json:"config"`
+		Enabled *bool  `json:"enabled"` // 未提供时保持不变
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ch.Name = req.Name
+	ch.Type = req.Type
+	ch.Config = sync.RestoreChannelSecrets(req.Config, ch.Config)
+	if req.Enabled != nil {
+		ch.Enabled = *req.Enabled
+	}
+	if err := sync.ValidateNotificationChannel(ch); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	database.DB.Save(&ch)
+	c.JSON(http.StatusOK, sync.MaskChannelSecrets(ch))
+}
+
+// DeleteNotificationChannelHandler 删除通知渠道
+func DeleteNotificationChannelHandler(c *gin.Context) {
+	if err := database.DB.Delete(&models.NotificationChannel{}, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "deleted"})
+}
+
+// TestNotificationChannelHandler 向渠道发送一条测试通知
+func TestNotificationChannelHandler(c *gin.Context) {
+	var ch models.NotificationChannel
+	if err := database.DB.First(&ch, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Channel not found"})
+		return
+	}
+	if err := sync.SendNotification(ch, "[测试] StealthForward", "通知渠道 "+ch.Name+" 配置正常"); err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "sent"})
+}
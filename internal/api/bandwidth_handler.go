@@ -0,0 +1,77 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wangn9900/StealthForward/internal/database"
+	"github.com/wangn9900/StealthForward/internal/models"
+	"github.com/wangn9900/StealthForward/internal/sync"
+)
+
+// GetBandwidthStatusHandler 返回各入口本周期的云流量额度用量
+func GetBandwidthStatusHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, sync.GetBandwidthStatus())
+}
+
+// GetBandwidthHistoryHandler 返回入口各周期的网卡用量
+func GetBandwidthHistoryHandler(c *gin.Context) {
+	var usages []models.InterfaceUsage
+	database.DB.Where("entry_node_id = ?", c.Param("id")).Order("cycle_start DESC").Find(&usages)
+	c.JSON(http.StatusOK, usages)
+}
+
+// UpdateBandwidthAllowanceHandler 设置入口的云流量额度 (手动额度或从套餐读取) 与超额动作
+func UpdateBandwidthAllowanceHandler(c *gin.Context) {
+	var entry models.EntryNode
+	if err := database.DB.First(&entry, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Entry not found"})
+		return
+	}
+	var req struct {
+		BandwidthAllowance     int64  `json:"bandwidth_allowance"` // 手动额度 (bytes)，allowance_from_bundle 为 true 时忽略
+		AllowanceFromBundle    bool   `json:"allowance_from_bundle"`
+		AllowanceAction        string `json:"allowance_action"`
+		AllowanceActionPercent int    `json:"allowance_action_percent"`
+		AllowanceShiftEntryID  uint   `json:"allowance_shift_entry_id"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.BandwidthAllowance < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "bandwidth_allowance must not be negative"})
+		return
+	}
+	entry.AllowanceFromBundle = req.AllowanceFromBundle
+	entry.AllowanceAction = req.AllowanceAction
+	entry.AllowanceActionPercent = req.AllowanceActionPercent
+	entry.AllowanceShiftEntryID = req.AllowanceShiftEntryID
+	if err := sync.ValidateAllowanceAction(entry); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	updates := map[string]interface{}{
+		"allowance_from_bundle":    req.AllowanceFromBundle,
+		"allowance_action":         req.AllowanceAction,
+		"allowance_action_percent": req.AllowanceActionPercent,
+		"allowance_shift_entry_id": req.AllowanceShiftEntryID,
+	}
+	if !req.AllowanceFromBundle {
+		updates["bandwidth_allowance"] = req.BandwidthAllowance
+	}
+	if err := database.DB.Model(&entry).Updates(updates).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if req.AllowanceFromBundle {
+		if err := sync.SyncBundleAllowance(&entry); err != nil {
+			c.JSON(http.StatusBadGateway, gin.H{"error": "读取套餐额度失败: " + err.Error()})
+			return
+		}
+	}
+	sync.CheckBandwidthAllowances()
+	database.DB.First(&entry, entry.ID)
+	c.JSON(http.StatusOK, entry)
+}
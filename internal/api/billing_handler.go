@@ -0,0 +1,97 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wangn9900/StealthForward/internal/database"
+	"github.com/wangn9900/StealthForward/internal/models"
+	"github.com/wangn9900/StealthForward/internal/sync"
+)
+
+// GetBillingStatusHandler 返回所有入口/落地节点的当前计费周期用量
+func GetBillingStatusHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, sync.GetBillingStatus())
+}
+
+// ListBillingCyclesHandler 列出已归档的计费周期，可按 scope、node_id 过滤
+func ListBillingCyclesHandler(c *gin.Context) {
+	var cycles []models.BillingCycle
+	query := database.DB.Order("cycle_start DESC, id DESC")
+	if scope := c.Query("scope"); scope != "" {
+		query = query.Where("scope = ?", scope)
+	}
+	if nodeID := c.Query("node_id"); nodeID != "" {
+		query = query.Where("node_id = ?", nodeID)
+	}
+	query.Find(&cycles)
+	c.JSON(http.StatusOK, cycles)
+}
+
+// UpdateBillingHandler 设置入口/落地节点的计费周期 (重置日、时区、流量额度)
+// 修改重置日或时区后当前周期重新对齐，本周期已用流量保留到新周期结束时归档；
+// 首次开启重置日时以当前累计流量为基线，此前的流量不计入本周期
+func UpdateBillingHandler(c *gin.Context) {
+	scope := c.Param("scope")
+	var target interface{}
+	switch scope {
+	case models.BillingScopeEntry:
+		target = &models.EntryNode{}
+	case models.BillingScopeExit:
+		target = &models.ExitNode{}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "scope must be entry or exit"})
+		return
+	}
+	if err := database.DB.First(target, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Node not found"})
+		return
+	}
+
+	var req models.BillingSettings
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := sync.ValidateBillingSettings(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	id, _ := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err := sync.UpdateBillingSettings(scope, uint(id), req); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	sync.CheckBillingCycles()
+	database.DB.First(target)
+	c.JSON(http.StatusOK, target)
+}
+
+// nodeManagedColumns 由流量持久化与计费任务维护的节点列 (以及经 UpdateBillingSettings 保存的计费设置)，
+// 整行保存节点时不写入，避免客户端提交或读取后过期的值覆盖累计流量与当前周期的基线
+var nodeManagedColumns = []string{
+	"total_upload", "total_download",
+	"billing_day", "billing_timezone", "bandwidth_allowance",
+	"cycle_start", "cycle_base_upload", "cycle_base_download",
+}
+
+// saveEditedNode 保存编辑后的入口/落地节点：累计流量与周期状态保持不变，
+// 计费设置经 UpdateBillingSettings 保存 (重置日/时区变化时重新对齐周期)；
+// keepAllowance 时额度由套餐同步维护，保留原值
+func saveEditedNode(scope string, id uint, node interface{}, billing models.BillingSettings, keepAllowance bool) error {
+	if keepAllowance {
+		var current models.BillingSettings
+		database.DB.Model(node).Select("bandwidth_allowance").Where("id = ?", id).Scan(&current)
+		billing.BandwidthAllowance = current.BandwidthAllowance
+	}
+	if err := database.DB.Omit(nodeManagedColumns...).Save(node).Error; err != nil {
+		return err
+	}
+	if err := sync.UpdateBillingSettings(scope, id, billing); err != nil {
+		return err
+	}
+	sync.CheckBillingCycles()
+	return database.DB.First(node, id).Error
+}
@@ -0,0 +1,242 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wangn9900/StealthForward/internal/cloud"
+	"github.com/wangn9900/StealthForward/internal/models"
+)
+
+// 通用云平台接口 (/cloud/providers/:provider/...)，provider 为 aws_ec2, aws_lightsail, vultr, digitalocean, hetzner
+
+// providerInstanceRequest 针对单个实例的操作请求
+type providerInstanceRequest struct {
+	Region     string            `json:"region"`
+	InstanceID string            `json:"instance_id"`
+	AccountID  uint              `json:"account_id"` // 可选：为 0 时使用绑定该实例的入口的账号
+	Ports      []cloud.PortRange `json:"ports"`      // 仅 open-ports 使用
+}
+
+// ListCloudProvidersHandler 列出支持的云平台
+func ListCloudProvidersHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, cloud.Providers())
+}
+
+// providerFromParam 解析路径中的云平台，失败时写入 400
+func providerFromParam(c *gin.Context) (cloud.Provider, bool) {
+	p, err := cloud.GetProvider(c.Param("provider"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	return p, true
+}
+
+// providerQueryContext 只读查询使用的账号 context (?account_id=，未指定时取池中第一个健康账号)
+func providerQueryContext(c *gin.Context, p cloud.Provider) (context.Context, bool) {
+	ctx, err := cloud.PoolContext(c.Request.Context(), cloud.AccountProvider(p.Name()), queryAccountID(c))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	return ctx, true
+}
+
+// ListProviderRegionsHandler 列出云平台区域
+func ListProviderRegionsHandler(c *gin.Context) {
+	p, ok := providerFromParam(c)
+	if !ok {
+		return
+	}
+	ctx, ok := providerQueryContext(c, p)
+	if !ok {
+		return
+	}
+	regions, err := p.ListRegions(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, regions)
+}
+
+// ListProviderImagesHandler 列出云平台系统镜像 (?region=)
+func ListProviderImagesHandler(c *gin.Context) {
+	p, ok := providerFromParam(c)
+	if !ok {
+		return
+	}
+	ctx, ok := providerQueryContext(c, p)
+	if !ok {
+		return
+	}
+	images, err := p.ListImages(ctx, c.Query("region"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, images)
+}
+
+// ListProviderPlansHandler 列出云平台套餐/规格 (?region=)
+func ListProviderPlansHandler(c *gin.Context) {
+	p, ok := providerFromParam(c)
+	if !ok {
+		return
+	}
+	ctx, ok := providerQueryContext(c, p)
+	if !ok {
+		return
+	}
+	plans, err := p.ListPlans(ctx, c.Query("region"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, plans)
+}
+
+// ListProviderInstancesHandler 列出云平台实例 (?region=，为空时列出所有区域)
+func ListProviderInstancesHandler(c *gin.Context) {
+	p, ok := providerFromParam(c)
+	if !ok {
+		return
+	}
+	ctx, ok := providerQueryContext(c, p)
+	if !ok {
+		return
+	}
+	instances, err := p.ListInstances(ctx, c.Query("region"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if instances == nil {
+		instances = []cloud.CloudInstance{}
+	}
+	c.JSON(http.StatusOK, instances)
+}
+
+// ProvisionProviderInstanceHandler 在云平台创建实例 (账号按策略从账号池选择，限额时自动换账号)
+func ProvisionProviderInstanceHandler(c *gin.Context) {
+	if !CheckCloudEnabled(c) {
+		return
+	}
+	p, ok := providerFromParam(c)
+	if !ok {
+		return
+	}
+	var req cloud.ProvisionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Region == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "region is required"})
+		return
+	}
+
+	var res *cloud.ProvisionResult
+	accountID, err := provisionOnAccount(c.Request.Context(), p.Name(), req.AccountID, req.Region, func(ctx context.Context) error {
+		var err error
+		res, err = p.Provision(ctx, req)
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to provision instance: " + err.Error()})
+		return
+	}
+	res.AccountID = accountID
+	c.JSON(http.StatusOK, res)
+}
+
+// bindProviderInstanceRequest 解析并校验单实例操作请求
+func bindProviderInstanceRequest(c *gin.Context) (cloud.Provider, providerInstanceRequest, bool) {
+	var req providerInstanceRequest
+	p, ok := providerFromParam(c)
+	if !ok {
+		return nil, req, false
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, req, false
+	}
+	if req.InstanceID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "instance_id is required"})
+		return nil, req, false
+	}
+	req.AccountID = instanceAccountID(req.AccountID, req.InstanceID)
+	return p, req, true
+}
+
+// TerminateProviderInstanceHandler 销毁云平台实例
+func TerminateProviderInstanceHandler(c *gin.Context) {
+	if !CheckCloudEnabled(c) {
+		return
+	}
+	p, req, ok := bindProviderInstanceRequest(c)
+	if !ok {
+		return
+	}
+	err := cloud.RunOnAccount(c.Request.Context(), req.AccountID, models.CloudAccountOpTerminate, req.Region, func(ctx context.Context) error {
+		return p.Terminate(ctx, req.Region, req.InstanceID)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Terminate failed: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "success"})
+}
+
+// RotateProviderInstanceIPHandler 更换云平台实例的公网 IP (不更新 DNS，入口换 IP 请使用 /cloud/rotate-ip)
+func RotateProviderInstanceIPHandler(c *gin.Context) {
+	p, req, ok := bindProviderInstanceRequest(c)
+	if !ok {
+		return
+	}
+	var newIP string
+	err := cloud.RunOnAccount(c.Request.Context(), req.AccountID, models.CloudAccountOpRotate, req.Region, func(ctx context.Context) error {
+		var err error
+		newIP, err = p.RotateIP(ctx, req.Region, req.InstanceID)
+		return err
+	})
+	if errors.Is(err, cloud.ErrRotateNotSupported) {
+		c.JSON(http.StatusNotImplemented, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "success", "new_ip": newIP})
+}
+
+// OpenProviderInstancePortsHandler 在实例的防火墙/安全组中放行端口
+func OpenProviderInstancePortsHandler(c *gin.Context) {
+	p, req, ok := bindProviderInstanceRequest(c)
+	if !ok {
+		return
+	}
+	if len(req.Ports) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ports is required"})
+		return
+	}
+	for _, port := range req.Ports {
+		if (port.Protocol != "tcp" && port.Protocol != "udp") || port.From < 1 || port.From > 65535 || (port.To != 0 && (port.To < port.From || port.To > 65535)) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid port range (protocol tcp/udp, 1-65535)"})
+			return
+		}
+	}
+	ctx, err := cloud.AccountContext(c.Request.Context(), req.AccountID)
+	if err == nil {
+		err = p.OpenPorts(ctx, req.Region, req.InstanceID, req.Ports)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "success"})
+}
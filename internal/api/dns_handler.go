@@ -0,0 +1,164 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wangn9900/StealthForward/internal/database"
+	"github.com/wangn9900/StealthForward/internal/dns"
+	"github.com/wangn9900/StealthForward/internal/models"
+)
+
+// ListDNSProvidersHandler 列出支持的 DNS 平台
+func ListDNSProvidersHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, dns.Providers())
+}
+
+// ListDNSZonesHandler 列出 DNS 域名绑定
+func ListDNSZonesHandler(c *gin.Context) {
+	var zones []models.DNSZone
+	database.DB.Order("id").Find(&zones)
+	c.JSON(http.StatusOK, zones)
+}
+
+// CreateDNSZoneHandler 创建 DNS 域名绑定
+func CreateDNSZoneHandler(c *gin.Context) {
+	var zone models.DNSZone
+	if err := c.ShouldBindJSON(&zone); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	zone.ID = 0
+	if err := dns.ValidateZone(&zone); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	database.DB.Create(&zone)
+	c.JSON(http.StatusOK, zone)
+}
+
+// UpdateDNSZoneHandler 更新 DNS 域名绑定
+func UpdateDNSZoneHandler(c *gin.Context) {
+	var zone models.DNSZone
+	if err := database.DB.First(&zone, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "DNS zone not found"})
+		return
+	}
+	id := zone.ID
+	if err := c.ShouldBindJSON(&zone); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	zone.ID = id
+	if err := dns.ValidateZone(&zone); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	database.DB.Save(&zone)
+	c.JSON(http.StatusOK, zone)
+}
+
+// DeleteDNSZoneHandler 删除 DNS 域名绑定 (仍有入口绑定时拒绝)
+func DeleteDNSZoneHandler(c *gin.Context) {
+	id := c.Param("id")
+	var bound int64
+	database.DB.Model(&models.EntryNode{}).Where("dns_zone_id = ?", id).Count(&bound)
+	if bound > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("还有 %d 个入口绑定在该域名上，请先迁移或解绑", bound)})
+		return
+	}
+	database.DB.Delete(&models.DNSZone{}, id)
+	c.JSON(http.StatusOK, gin.H{"message": "deleted"})
+}
+
+// zoneFromParam 读取路径中的域名绑定并创建 DNS 平台客户端，失败时写入错误响应
+func zoneFromParam(c *gin.Context) (*models.DNSZone, dns.Provider, bool) {
+	var zone models.DNSZone
+	if err := database.DB.First(&zone, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "DNS zone not found"})
+		return nil, nil, false
+	}
+	p, err := dns.ZoneProvider(&zone)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, nil, false
+	}
+	return &zone, p, true
+}
+
+// ListDNSRecordsHandler 列出域名下的 A/AAAA/CNAME 记录 (?name=&type=)
+func ListDNSRecordsHandler(c *gin.Context) {
+	zone, p, ok := zoneFromParam(c)
+	if !ok {
+		return
+	}
+	records, err := p.ListRecords(c.Request.Context(), zone.Domain, c.Query("name"), c.Query("type"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if records == nil {
+		records = []dns.Record{}
+	}
+	c.JSON(http.StatusOK, records)
+}
+
+// UpsertDNSRecordHandler 创建或更新记录 (按名称+类型，已存在时更新)
+func UpsertDNSRecordHandler(c *gin.Context) {
+	zone, p, ok := zoneFromParam(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		Type    string `json:"type"`
+		Name    string `json:"name"`
+		Content string `json:"content"`
+		TTL     int    `json:"ttl"`     // 0 使用域名绑定中的 TTL (均未设置时沿用已有记录)
+		Proxied *bool  `json:"proxied"` // 为空使用域名绑定中的设置 (均未设置时沿用已有记录)
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	rec := dns.Record{Type: req.Type, Name: req.Name, Content: req.Content, TTL: req.TTL, Proxied: zone.Proxied}
+	if rec.TTL == 0 {
+		rec.TTL = zone.TTL
+	}
+	if req.Proxied != nil {
+		rec.Proxied = req.Proxied
+	}
+	if rec.Proxied != nil && *rec.Proxied && zone.Provider != dns.ProviderCloudflare {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "proxied is only supported by cloudflare"})
+		return
+	}
+	if err := dns.ValidateRecord(rec); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	result, err := dns.Upsert(c.Request.Context(), p, zone.Domain, rec)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// DeleteDNSRecordHandler 删除指定名称与类型的记录 (?name=&type=)
+func DeleteDNSRecordHandler(c *gin.Context) {
+	name, recordType := c.Query("name"), c.Query("type")
+	if name == "" || recordType == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name and type are required"})
+		return
+	}
+	zone, p, ok := zoneFromParam(c)
+	if !ok {
+		return
+	}
+	deleted, err := dns.DeleteByName(c.Request.Context(), p, zone.Domain, name, recordType)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "deleted": deleted})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "deleted", "deleted": deleted})
+}
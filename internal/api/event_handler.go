@@ -0,0 +1,163 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wangn9900/StealthForward/internal/database"
+	"github.com/wangn9900/StealthForward/internal/models"
+	"github.com/wangn9900/StealthForward/internal/sync"
+)
+
+// ListEventsHandler 列出事件，可按 type / subject 过滤
+func ListEventsHandler(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit <= 0 || limit > 1000 {
+		limit = 100
+	}
+	query := database.DB.Order("id DESC").Limit(limit)
+	if typ := c.Query("type"); typ != "" {
+		query = query.Where("type = ?", typ)
+	}
+	if subject := c.Query("subject"); subject != "" {
+		query = query.Where("subject = ?", subject)
+	}
+	var events []models.Event
+	query.Find(&events)
+	c.JSON(http.StatusOK, events)
+}
+
+// webhookView 返回给前端的订阅，不包含签名密钥
+type webhookView struct {
+	models.WebhookSubscription
+	HasSecret bool `json:"has_secret"`
+}
+
+func newWebhookView(sub models.WebhookSubscription) webhookView {
+	return webhookView{WebhookSubscription: sub, HasSecret: sub.Secret != ""}
+}
+
+// webhookRequest 创建/更新订阅的请求；Secret 未提供时保留原密钥，空字符串表示清除
+type webhookRequest struct {
+	Name       string  `json:"name"`
+	URL        string  `json:"url"`
+	Secret     *string `json:"secret"`
+	Events     string  `json:"events"`
+	MaxRetries int     `json:"max_retries"`
+	Enabled    bool    `json:"enabled"`
+}
+
+// ListWebhooksHandler 列出 Webhook 订阅
+func ListWebhooksHandler(c *gin.Context) {
+	var subs []models.WebhookSubscription
+	database.DB.Order("id").Find(&subs)
+	views := make([]webhookView, 0, len(subs))
+	for _, sub := range subs {
+		views = append(views, newWebhookView(sub))
+	}
+	c.JSON(http.StatusOK, views)
+}
+
+// CreateWebhookHandler 创建 Webhook 订阅
+func CreateWebhookHandler(c *gin.Context) {
+	var req webhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	sub := models.WebhookSubscription{Name: req.Name, URL: req.URL, Events: req.Events, MaxRetries: req.MaxRetries, Enabled: true}
+	if req.Secret != nil {
+		sub.Secret = *req.Secret
+	}
+	if err := sync.ValidateWebhookSubscription(sub); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := database.DB.Create(&sub).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, newWebhookView(sub))
+}
+
+// UpdateWebhookHandler 更新 Webhook 订阅
+func UpdateWebhookHandler(c *gin.Context) {
+	var sub models.WebhookSubscription
+	if err := database.DB.First(&sub, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+		return
+	}
+	var req webhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	sub.Name = req.Name
+	sub.URL = req.URL
+	if req.Secret != nil {
+		sub.Secret = *req.Secret
+	}
+	sub.Events = req.Events
+	sub.MaxRetries = req.MaxRetries
+	sub.Enabled = req.Enabled
+	if err := sync.ValidateWebhookSubscription(sub); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	database.DB.Save(&sub)
+	c.JSON(http.StatusOK, newWebhookView(sub))
+}
+
+// DeleteWebhookHandler 删除 Webhook 订阅 (未完成的投递会被标记为失败)
+func DeleteWebhookHandler(c *gin.Context) {
+	if err := database.DB.Delete(&models.WebhookSubscription{}, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "deleted"})
+}
+
+// TestWebhookHandler 向订阅地址同步发送一条 ping 事件
+func TestWebhookHandler(c *gin.Context) {
+	var sub models.WebhookSubscription
+	if err := database.DB.First(&sub, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+		return
+	}
+	code, err := sync.PingWebhook(sub)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error(), "response_code": code})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "delivered", "response_code": code})
+}
+
+// ListWebhookDeliveriesHandler 列出订阅的投递记录，可按 status 过滤
+func ListWebhookDeliveriesHandler(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit <= 0 || limit > 1000 {
+		limit = 100
+	}
+	query := database.DB.Where("subscription_id = ?", c.Param("id")).Order("id DESC").Limit(limit)
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	var deliveries []models.WebhookDelivery
+	query.Find(&deliveries)
+	c.JSON(http.StatusOK, deliveries)
+}
+
+// RetryWebhookDeliveryHandler 立即重新投递一条记录 (重置重试次数)
+func RetryWebhookDeliveryHandler(c *gin.Context) {
+	var delivery models.WebhookDelivery
+	if err := database.DB.Where("subscription_id = ?", c.Param("id")).First(&delivery, c.Param("delivery_id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Delivery not found"})
+		return
+	}
+	if err := sync.RetryDelivery(delivery.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "queued"})
+}
@@ -0,0 +1,49 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wangn9900/StealthForward/internal/sync"
+)
+
+// SwitchMappingExitHandler 手动将映射切到主落地或某个备用落地
+func SwitchMappingExitHandler(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid mapping id"})
+		return
+	}
+	var req struct {
+		ExitID uint   `json:"exit_id"` // 0 表示切回主落地
+		Reason string `json:"reason"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	mapping, err := sync.SwitchMappingExit(uint(id), req.ExitID, req.Reason)
+	switch {
+	case errors.Is(err, sync.ErrMappingNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, sync.ErrExitNotInChain):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusOK, mapping)
+	}
+}
+
+// GetFailoverHistoryHandler 返回映射切换历史 (?mapping_id=&entry_id=&limit=100)
+func GetFailoverHistoryHandler(c *gin.Context) {
+	mappingID, _ := strconv.ParseUint(c.Query("mapping_id"), 10, 32)
+	entryID, _ := strconv.ParseUint(c.Query("entry_id"), 10, 32)
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit <= 0 || limit > 1000 {
+		limit = 100
+	}
+	c.JSON(http.StatusOK, sync.GetFailoverHistory(uint(mappingID), uint(entryID), limit))
+}
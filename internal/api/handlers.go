@@ -4,9 +4,9 @@ import (
 	"encoding/json"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/wangn9900/StealthForward/internal/cloud"
 	"github.com/wangn9900/StealthForward/internal/database"
 	"github.com/wangn9900/StealthForward/internal/generator"
 	"github.com/wangn9900/StealthForward/internal/models"
@@ -30,16 +30,25 @@ func GetConfigHandler(c *gin.Context) {
 		return
 	}
 
-	// 2. 获取该节点下的所有有效转发规则
+	// 2. 获取该节点下的所有有效转发规则 (跳过被暂停的规则)
 	var rules []models.ForwardingRule
-	database.DB.Where("entry_node_id = ? AND enabled = ?", nodeID, true).Find(&rules)
+	database.DB.Where("entry_node_id = ? AND enabled = ? AND suspended = ?", nodeID, true, false).Find(&rules)
 
 	// 3. 获取所有落地节点 (加载全部，确保动态分流时 outbound 标签始终存在)
 	var exits []models.ExitNode
 	database.DB.Find(&exits)
 
-	// 4. 生成配置
-	config, err := generator.GenerateEntryConfig(&entry, rules, exits)
+	// 4. 生成配置 (外部内核的 Agent 会通过 stats_api 请求开启本机统计接口)
+	opts := generator.EntryConfigOptions{
+		StatsAPI:    c.Query("stats_api"),
+		StatsListen: c.Query("stats_listen"),
+		ProbeUsers:  sync.ProbeUsers(),
+	}
+	if !generator.ValidStatsAPI(opts.StatsAPI) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unknown stats_api: " + opts.StatsAPI})
+		return
+	}
+	config, err := generator.GenerateEntryConfigWithOptions(&entry, rules, exits, opts)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate config"})
 		return
@@ -49,6 +58,7 @@ func GetConfigHandler(c *gin.Context) {
 		"config":    config,
 		"cert_task": entry.CertTask,
 		"domain":    entry.Domain,
+		"throttle":  sync.ThrottlesForEntry(entry.ID), // 超额限速的用户标签 -> 字节/秒
 	})
 }
 
@@ -68,8 +78,31 @@ func RegisterNodeHandler(c *gin.Context) {
 	if entry.Protocol != "" && !CheckProtocolAllowed(c, entry.Protocol) {
 		return
 	}
+	if err := sync.ValidateBillingSettings(entry.BillingSettings); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := sync.ValidateAllowanceAction(entry); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := sync.ValidateCloudBinding(entry); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
-	database.DB.Save(&entry)
+	if entry.ID != 0 {
+		if err := saveEditedNode(models.BillingScopeEntry, entry.ID, &entry, entry.BillingSettings, entry.AllowanceFromBundle); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	} else {
+		// 新入口的累计流量从零开始，周期起点与基线由计费任务记录
+		entry.TotalUpload, entry.TotalDownload = 0, 0
+		entry.CycleStart, entry.CycleBaseUpload, entry.CycleBaseDownload = time.Time{}, 0, 0
+		database.DB.Save(&entry)
+	}
+	sync.RefreshRuleIndex()
 	// 保存成功后立即尝试拉取一次 V2Board 数据
 	sync.GlobalSyncNow()
 	c.JSON(http.StatusOK, entry)
@@ -87,6 +120,10 @@ func CreateExitNodeHandler(c *gin.Context) {
 	if !CheckCanAddExit(c) {
 		return
 	}
+	if err := sync.ValidateBillingSettings(exit.BillingSettings); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
 	// 自动从 Config JSON 中提取端口和地址并同步到字段
 	if exit.Config != "" {
@@ -111,7 +148,17 @@ func CreateExitNodeHandler(c *gin.Context) {
 		}
 	}
 
-	database.DB.Save(&exit)
+	if exit.ID != 0 {
+		if err := saveEditedNode(models.BillingScopeExit, exit.ID, &exit, exit.BillingSettings, false); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	} else {
+		exit.TotalUpload, exit.TotalDownload = 0, 0
+		exit.CycleStart, exit.CycleBaseUpload, exit.CycleBaseDownload = time.Time{}, 0, 0
+		database.DB.Save(&exit)
+	}
+	sync.RefreshRuleIndex()
 	c.JSON(http.StatusOK, exit)
 }
 
@@ -166,9 +213,13 @@ func CreateForwardingRuleHandler(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	// 默认设为启用
+	// 默认设为启用，暂停状态由暂停表决定
 	rule.Enabled = true
+	rule.Suspended = false
 	database.DB.Create(&rule)
+	sync.ApplySuspensions()
+	sync.RefreshRuleIndex()
+	database.DB.First(&rule, rule.ID)
 	c.JSON(http.StatusOK, rule)
 }
 
@@ -187,18 +238,21 @@ func ListEntryNodesHandler(c *gin.Context) {
 func DeleteEntryNodeHandler(c *gin.Context) {
 	id := c.Param("id")
 	database.DB.Delete(&models.EntryNode{}, id)
+	sync.RefreshRuleIndex()
 	c.JSON(http.StatusOK, gin.H{"status": "deleted"})
 }
 
 func DeleteExitNodeHandler(c *gin.Context) {
 	id := c.Param("id")
 	database.DB.Delete(&models.ExitNode{}, id)
+	sync.RefreshRuleIndex()
 	c.JSON(http.StatusOK, gin.H{"status": "deleted"})
 }
 
 func DeleteForwardingRuleHandler(c *gin.Context) {
 	id := c.Param("id")
 	database.DB.Delete(&models.ForwardingRule{}, id)
+	sync.RefreshRuleIndex()
 	c.JSON(http.StatusOK, gin.H{"status": "deleted"})
 }
 
@@ -225,7 +279,7 @@ func IssueCertHandler(c *gin.Context) {
 
 	// 标记该节点有待处理的证书任务
 	entry.CertTask = true
-	database.DB.Save(&entry)
+	database.DB.Omit(nodeManagedColumns...).Save(&entry)
 
 	c.JSON(http.StatusOK, gin.H{
 		"message": "申请指令已下发！中转机将在下次同步时（约1分钟内）自动开始申请。申请成功后证书将自动同步回来。",
@@ -258,7 +312,9 @@ func UploadCertHandler(c *gin.Context) {
 	entry.Certificate = "/etc/stealthforward/certs/" + req.Domain + "/cert.crt"
 	entry.Key = "/etc/stealthforward/certs/" + req.Domain + "/cert.key"
 
-	database.DB.Save(&entry)
+	database.DB.Omit(nodeManagedColumns...).Save(&entry)
+	sync.PublishEvent(models.EventCertIssued, "entry:"+strconv.FormatUint(uint64(entry.ID), 10),
+		"入口 "+entry.Name+" 证书已签发: "+req.Domain, gin.H{"entry_id": entry.ID, "domain": req.Domain})
 
 	c.JSON(http.StatusOK, gin.H{"message": "证书备份成功"})
 }
@@ -276,6 +332,12 @@ func CreateNodeMappingHandler(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	// 新映射从主落地开始，切换状态由探测维护
+	mapping.ActiveExitID, mapping.ActiveSince = 0, time.Time{}
+	if err := sync.ValidateMappingFailover(&mapping); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	database.DB.Save(&mapping)
 	// 创建映射后立即尝试同步该节点数据
 	sync.GlobalSyncNow()
@@ -296,10 +358,18 @@ func UpdateNodeMappingHandler(c *gin.Context) {
 		return
 	}
 
+	// 当前生效落地由探测维护，忽略客户端提交的值 (编辑表单可能是旧数据)，
+	// 仅在其不再属于主/备落地时由 ValidateMappingFailover 复位
+	mappingID, activeExitID, activeSince := mapping.ID, mapping.ActiveExitID, mapping.ActiveSince
 	if err := c.ShouldBindJSON(&mapping); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	mapping.ID, mapping.ActiveExitID, mapping.ActiveSince = mappingID, activeExitID, activeSince
+	if err := sync.ValidateMappingFailover(&mapping); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
 	database.DB.Save(&mapping)
 	sync.GlobalSyncNow()
@@ -315,9 +385,14 @@ func ReportTrafficHandler(c *gin.Context) {
 	}
 
 	// 将流量数据存入同步模块进行汇总
-	sync.CollectTraffic(report)
+	ackedSeq, err := sync.CollectTraffic(report)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to persist traffic"})
+		return
+	}
 
-	c.JSON(http.StatusOK, gin.H{"status": "success"})
+	// acked_seq: 该 Agent 实例已入账的最大序号，Agent 可安全丢弃不大于它的批次
+	c.JSON(http.StatusOK, gin.H{"status": "success", "acked_seq": ackedSeq})
 }
 
 // ExportConfigHandler 导出系统核心配置（备份用）
@@ -381,6 +456,7 @@ func ImportConfigHandler(c *gin.Context) {
 	}
 
 	// 触发一次全量同步
+	sync.RefreshRuleIndex()
 	sync.GlobalSyncNow()
 
 	c.JSON(http.StatusOK, gin.H{"message": "配置恢复成功，已触发全量同步"})
@@ -399,7 +475,7 @@ func RotateIPHandler(c *gin.Context) {
 	var req struct {
 		Region     string `json:"region"`
 		InstanceID string `json:"instance_id"`
-		ZoneName   string `json:"zone_name"`
+		ZoneName   string `json:"zone_name"` // 可选：覆盖入口 DNS 域名绑定中的根域名
 		RecordName string `json:"record_name"`
 	}
 	// 可选绑定 JSON
@@ -416,40 +492,20 @@ func RotateIPHandler(c *gin.Context) {
 		req.RecordName = entry.CloudRecordName
 	}
 
-	// 检查 ZoneName
-	if req.ZoneName == "" {
-		var setting models.SystemSetting
-		if err := database.DB.Where("key = ?", "cloudflare.default_zone").First(&setting).Error; err == nil {
-			req.ZoneName = setting.Value
-		}
-	}
-
 	// 最终校验
 	if req.Region == "" || req.InstanceID == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "未绑定云平台区域或实例 ID，请在编辑中绑定"})
 		return
 	}
 
-	var newIP string
-	var err error
-
-	// 执行换 IP 逻辑 (路由)
-	if entry.CloudProvider == "aws_lightsail" {
-		newIP, err = cloud.RotateLightsailIPWithDNS(c.Request.Context(), req.Region, req.InstanceID, req.ZoneName, req.RecordName)
-	} else {
-		// 默认为 AWS EC2
-		newIP, err = cloud.RotateIPForInstance(c.Request.Context(), req.Region, req.InstanceID, req.ZoneName, req.RecordName)
-	}
+	// 执行换 IP 逻辑 (按云平台路由，默认为 AWS EC2)
+	newIP, err := sync.RotateEntryIP(c.Request.Context(), entry, req.Region, req.InstanceID, req.ZoneName, req.RecordName, "manual")
 
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Rotate failed: " + err.Error()})
 		return
 	}
 
-	// 成功后，更新数据库中的 IP 字段
-	entry.IP = newIP
-	database.DB.Save(&entry)
-
 	c.JSON(http.StatusOK, gin.H{
 		"message": "IP 更换成功",
 		"new_ip":  newIP,
@@ -1,15 +1,18 @@
 package api
 
 import (
+	"context"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/wangn9900/StealthForward/internal/cloud"
 	"github.com/wangn9900/StealthForward/internal/database"
 	"github.com/wangn9900/StealthForward/internal/models"
+	"github.com/wangn9900/StealthForward/internal/sync"
 )
 
 // ProvisionInstanceHandler 处理创建 AWS 实例请求
@@ -35,19 +38,55 @@ func ProvisionInstanceHandler(c *gin.Context) {
 
 	// 调用云端逻辑
 	// 这是一个耗时操作，建议异步。但在本阶段为了简单直接同步等待
-	res, err := cloud.ProvisionInstance(c.Request.Context(), req)
+	var res *cloud.CreateInstanceResponse
+	accountID, err := provisionOnAccount(c.Request.Context(), cloud.ProviderAWSEC2, req.AccountID, req.Region, func(ctx context.Context) error {
+		var err error
+		res, err = cloud.ProvisionInstance(ctx, req)
+		return err
+	})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to provision instance: " + err.Error()})
 		return
 	}
 
+	res.AccountID = accountID
 	c.JSON(http.StatusOK, res)
 }
 
+// provisionOnAccount 在指定账号上创建实例；未指定时按策略从账号池选择，遇到限额自动换下一个账号
+// 返回实例所在的账号 ID (账号池为空、使用单一密钥时为 0)
+func provisionOnAccount(ctx context.Context, provider string, accountID uint, region string, fn func(ctx context.Context) error) (uint, error) {
+	if accountID > 0 {
+		return accountID, cloud.RunOnAccount(ctx, accountID, models.CloudAccountOpProvision, region, fn)
+	}
+	account, err := cloud.RunOnPool(ctx, cloud.AccountProvider(provider), models.CloudAccountOpProvision, region, fn)
+	if account == nil {
+		return 0, err
+	}
+	return account.ID, err
+}
+
+// instanceAccountID 返回实例所在的账号：请求中指定的账号，否则取绑定该实例的入口的账号
+func instanceAccountID(accountID uint, instanceID string) uint {
+	if accountID > 0 {
+		return accountID
+	}
+	var entry models.EntryNode
+	database.DB.Where("cloud_instance_id = ?", instanceID).Limit(1).Find(&entry)
+	return entry.CloudAccountID
+}
+
+// queryAccountID 读取查询参数中的 account_id (可选)
+func queryAccountID(c *gin.Context) uint {
+	id, _ := strconv.ParseUint(c.Query("account_id"), 10, 32)
+	return uint(id)
+}
+
 // TerminateInstanceHandler 处理销毁实例请求
 type TerminateInstanceRequest struct {
 	Region     string `json:"region"`
 	InstanceID string `json:"instance_id"`
+	AccountID  uint   `json:"account_id"` // 可选：为 0 时使用绑定该实例的入口的账号
 }
 
 func TerminateInstanceHandler(c *gin.Context) {
@@ -67,7 +106,10 @@ func TerminateInstanceHandler(c *gin.Context) {
 		return
 	}
 
-	if err := cloud.TerminateInstance(c.Request.Context(), req.Region, req.InstanceID); err != nil {
+	err := cloud.RunOnAccount(c.Request.Context(), instanceAccountID(req.AccountID, req.InstanceID), models.CloudAccountOpTerminate, req.Region, func(ctx context.Context) error {
+		return cloud.TerminateInstance(ctx, req.Region, req.InstanceID)
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Terminate failed: " + err.Error()})
 		return
 	}
@@ -129,7 +171,12 @@ func DownloadKeyHandler(c *gin.Context) {
 }
 
 func ListRegionsHandler(c *gin.Context) {
-	regions, err := cloud.ListRegions(c.Request.Context())
+	ctx, err := cloud.PoolContext(c.Request.Context(), "aws", queryAccountID(c))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	regions, err := cloud.ListRegions(ctx)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list regions: " + err.Error()})
 		return
@@ -144,7 +191,12 @@ func ListImagesHandler(c *gin.Context) {
 		return
 	}
 
-	images, err := cloud.ListFeaturedImages(c.Request.Context(), region)
+	ctx, err := cloud.PoolContext(c.Request.Context(), "aws", queryAccountID(c))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	images, err := cloud.ListFeaturedImages(ctx, region)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list images: " + err.Error()})
 		return
@@ -155,7 +207,12 @@ func ListImagesHandler(c *gin.Context) {
 // --- Lightsail Handlers ---
 
 func ListLightsailRegionsHandler(c *gin.Context) {
-	regions, err := cloud.ListLightsailRegions(c.Request.Context())
+	ctx, err := cloud.PoolContext(c.Request.Context(), "aws", queryAccountID(c))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	regions, err := cloud.ListLightsailRegions(ctx)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -168,7 +225,12 @@ func ListLightsailBundlesHandler(c *gin.Context) {
 	if region == "" {
 		region = "us-east-1"
 	}
-	bundles, err := cloud.ListLightsailBundles(c.Request.Context(), region)
+	ctx, err := cloud.PoolContext(c.Request.Context(), "aws", queryAccountID(c))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	bundles, err := cloud.ListLightsailBundles(ctx, region)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -181,7 +243,12 @@ func ListLightsailBlueprintsHandler(c *gin.Context) {
 	if region == "" {
 		region = "us-east-1"
 	}
-	blueprints, err := cloud.ListLightsailBlueprints(c.Request.Context(), region)
+	ctx, err := cloud.PoolContext(c.Request.Context(), "aws", queryAccountID(c))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	blueprints, err := cloud.ListLightsailBlueprints(ctx, region)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -201,11 +268,17 @@ func ProvisionLightsailHandler(c *gin.Context) {
 		return
 	}
 
-	res, err := cloud.ProvisionLightsailInstance(c.Request.Context(), req)
+	var res *cloud.CreateLightsailResponse
+	accountID, err := provisionOnAccount(c.Request.Context(), cloud.ProviderAWSLightsail, req.AccountID, req.Region, func(ctx context.Context) error {
+		var err error
+		res, err = cloud.ProvisionLightsailInstance(ctx, req)
+		return err
+	})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	res.AccountID = accountID
 	c.JSON(http.StatusOK, res)
 }
 
@@ -222,13 +295,17 @@ func TerminateLightsailHandler(c *gin.Context) {
 	var req struct {
 		Region       string `json:"region"`
 		InstanceName string `json:"instance_name"`
+		AccountID    uint   `json:"account_id"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	if err := cloud.TerminateLightsailInstance(c.Request.Context(), req.Region, req.InstanceName); err != nil {
+	err := cloud.RunOnAccount(c.Request.Context(), instanceAccountID(req.AccountID, req.InstanceName), models.CloudAccountOpTerminate, req.Region, func(ctx context.Context) error {
+		return cloud.TerminateLightsailInstance(ctx, req.Region, req.InstanceName)
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -239,13 +316,36 @@ func RotateLightsailIPHandler(c *gin.Context) {
 	var req struct {
 		Region       string `json:"region"`
 		InstanceName string `json:"instance_name"`
+		AccountID    uint   `json:"account_id"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	newIP, err := cloud.RotateLightsailIP(c.Request.Context(), req.Region, req.InstanceName)
+	// 实例已绑定到入口时走入口换 IP 流程：更新入口 IP 与 DNS 解析，并发布换 IP 事件。
+	// 使用入口绑定的云账号，忽略请求中的 account_id，避免用其它账号的凭据操作该实例
+	var entry models.EntryNode
+	if database.DB.Where("cloud_instance_id = ? AND cloud_provider = ?", req.InstanceName, cloud.ProviderAWSLightsail).Limit(1).Find(&entry).RowsAffected > 0 {
+		region := entry.CloudRegion
+		if region == "" {
+			region = req.Region
+		}
+		newIP, err := sync.RotateEntryIP(c.Request.Context(), entry, region, req.InstanceName, "", entry.CloudRecordName, "manual")
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "new_ip": newIP})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"status": "success", "new_ip": newIP, "entry_id": entry.ID})
+		return
+	}
+
+	var newIP string
+	err := cloud.RunOnAccount(c.Request.Context(), instanceAccountID(req.AccountID, req.InstanceName), models.CloudAccountOpRotate, req.Region, func(ctx context.Context) error {
+		var err error
+		newIP, err = cloud.RotateLightsailIP(ctx, req.Region, req.InstanceName)
+		return err
+	})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -263,15 +363,19 @@ func ListCloudInstancesHandler(c *gin.Context) {
 		return
 	}
 
-	var instances []cloud.CloudInstance
-	var err error
-
-	if provider == "aws_lightsail" {
-		instances, err = cloud.ListLightsailInstances(c.Request.Context(), region)
-	} else {
-		instances, err = cloud.ListEC2Instances(c.Request.Context(), region)
+	p, err := cloud.GetProvider(provider)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ctx, err := cloud.PoolContext(c.Request.Context(), cloud.AccountProvider(p.Name()), queryAccountID(c))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
 
+	instances, err := p.ListInstances(ctx, region)
+
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -288,7 +392,7 @@ func AutoDetectInstanceHandler(c *gin.Context) {
 		return
 	}
 
-	provider, region, instanceID, err := cloud.AutoDetectCloudInstance(c.Request.Context(), ip)
+	provider, region, instanceID, accountID, err := cloud.AutoDetectCloudInstance(c.Request.Context(), ip)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "识别失败: " + err.Error()})
 		return
@@ -305,6 +409,7 @@ func AutoDetectInstanceHandler(c *gin.Context) {
 		"provider":    provider,
 		"region":      region,
 		"instance_id": instanceID,
+		"account_id":  accountID,
 		"record_name": recordName,
 	})
 }
@@ -0,0 +1,13 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/wangn9900/StealthForward/internal/metrics"
+	"github.com/wangn9900/StealthForward/internal/sync"
+)
+
+// MetricsHandler 以 Prometheus 文本格式输出 Controller 指标
+func MetricsHandler(c *gin.Context) {
+	c.Header("Content-Type", metrics.ContentType)
+	sync.Metrics.WriteText(c.Writer)
+}
@@ -0,0 +1,107 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wangn9900/StealthForward/internal/models"
+	"github.com/wangn9900/StealthForward/internal/sync"
+)
+
+// ReportProbesHandler 接收 Agent 上报的落地探测结果
+func ReportProbesHandler(c *gin.Context) {
+	var report models.ExitProbeReport
+	if err := c.ShouldBindJSON(&report); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if report.NodeID == 0 {
+		id, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+		report.NodeID = uint(id)
+	}
+	n, err := sync.RecordExitProbes(report)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "success", "recorded": n})
+}
+
+// GetProbeMatrixHandler 返回入口 x 落地 延迟矩阵 (?window=15m)
+func GetProbeMatrixHandler(c *gin.Context) {
+	window, err := time.ParseDuration(c.DefaultQuery("window", "15m"))
+	if err != nil || window <= 0 || window > 7*24*time.Hour {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid window (e.g. 15m, 1h, max 168h)"})
+		return
+	}
+	c.JSON(http.StatusOK, sync.GetProbeMatrix(window))
+}
+
+// GetProbeHistoryHandler 返回探测历史 (?entry_id=&exit_id=&hours=24)
+func GetProbeHistoryHandler(c *gin.Context) {
+	entryID, _ := strconv.ParseUint(c.Query("entry_id"), 10, 32)
+	exitID, _ := strconv.ParseUint(c.Query("exit_id"), 10, 32)
+	hours, err := strconv.Atoi(c.DefaultQuery("hours", "24"))
+	if err != nil || hours <= 0 {
+		hours = 24
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "1000"))
+	if err != nil || limit <= 0 || limit > 10000 {
+		limit = 1000
+	}
+	since := time.Now().Add(-time.Duration(hours) * time.Hour)
+	c.JSON(http.StatusOK, sync.GetProbeHistory(uint(entryID), uint(exitID), since, limit))
+}
+
+// GetReachabilityTargetsHandler 探测机拉取需要检测的入口端口
+func GetReachabilityTargetsHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, sync.ReachabilityTargets(currentProber(c)))
+}
+
+// ReportReachabilityHandler 接收探测机上报的可达性结果 (上报者以鉴权的探测机名称为准)
+func ReportReachabilityHandler(c *gin.Context) {
+	var report models.ReachabilityReport
+	if err := c.ShouldBindJSON(&report); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	report.Prober = currentProber(c).Name
+	n, err := sync.RecordReachability(report)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "success", "recorded": n})
+}
+
+// GetReachabilityMatrixHandler 返回 运营商/地区 x 入口端口 可达性矩阵 (?window=30m)
+func GetReachabilityMatrixHandler(c *gin.Context) {
+	window, err := time.ParseDuration(c.DefaultQuery("window", "30m"))
+	if err != nil || window <= 0 || window > 7*24*time.Hour {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid window (e.g. 30m, 6h, max 168h)"})
+		return
+	}
+	c.JSON(http.StatusOK, sync.GetReachabilityMatrix(window))
+}
+
+// GetReachabilityHistoryHandler 返回可达性探测历史 (?label=ct/gd&entry_id=&hours=24)
+func GetReachabilityHistoryHandler(c *gin.Context) {
+	entryID, _ := strconv.ParseUint(c.Query("entry_id"), 10, 32)
+	hours, err := strconv.Atoi(c.DefaultQuery("hours", "24"))
+	if err != nil || hours <= 0 {
+		hours = 24
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "1000"))
+	if err != nil || limit <= 0 || limit > 10000 {
+		limit = 1000
+	}
+	since := time.Now().Add(-time.Duration(hours) * time.Hour)
+	c.JSON(http.StatusOK, sync.GetReachabilityHistory(c.Query("label"), uint(entryID), since, limit))
+}
+
+// GetReachabilityStatesHandler 返回各 运营商/地区 x 入口端口 的当前状态
+func GetReachabilityStatesHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, sync.GetReachabilityStates())
+}
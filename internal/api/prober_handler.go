@@ -0,0 +1,106 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wangn9900/StealthForward/internal/database"
+	"github.com/wangn9900/StealthForward/internal/models"
+	"github.com/wangn9900/StealthForward/internal/sync"
+)
+
+// proberContextKey gin 上下文中当前探测机的键
+const proberContextKey = "prober"
+
+// ProberAuthMiddleware 探测机鉴权 (Authorization: Bearer <探测机 Token>)，只用于 /api/v1/probe/*。
+// 管理员 Token 在此无效，探测机 Token 也不能访问其他接口
+func ProberAuthMiddleware(c *gin.Context) {
+	token := strings.TrimSpace(strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer "))
+	prober, err := sync.AuthenticateProber(token)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	now := time.Now()
+	if !sync.AllowProberRequest(prober, now) {
+		c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "rate limit exceeded"})
+		return
+	}
+	sync.TouchProber(prober, c.ClientIP(), now)
+	c.Set(proberContextKey, prober)
+	c.Next()
+}
+
+// currentProber 返回 ProberAuthMiddleware 鉴权通过的探测机
+func currentProber(c *gin.Context) *models.Prober {
+	return c.MustGet(proberContextKey).(*models.Prober)
+}
+
+// ListProbersHandler 列出探测机
+func ListProbersHandler(c *gin.Context) {
+	var probers []models.Prober
+	database.DB.Order("id").Find(&probers)
+	c.JSON(http.StatusOK, probers)
+}
+
+// CreateProberHandler 创建探测机，返回的 token 只显示这一次
+func CreateProberHandler(c *gin.Context) {
+	var prober models.Prober
+	if err := c.ShouldBindJSON(&prober); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	token, err := sync.CreateProber(&prober)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"prober": prober, "token": token})
+}
+
+// UpdateProberHandler 更新探测机 (名称、启用状态、限频与每日流量上限)
+func UpdateProberHandler(c *gin.Context) {
+	var prober models.Prober
+	if err := database.DB.First(&prober, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Prober not found"})
+		return
+	}
+	id := prober.ID
+	if err := c.ShouldBindJSON(&prober); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	prober.ID = id
+	prober.Name = strings.TrimSpace(prober.Name)
+	if prober.Name == "" || prober.RequestsPerMinute < 0 || prober.DailyTrafficMB < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name is required and limits must not be negative"})
+		return
+	}
+	if err := database.DB.Save(&prober).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, prober)
+}
+
+// DeleteProberHandler 删除探测机，其代理凭证随各入口下次配置同步失效
+func DeleteProberHandler(c *gin.Context) {
+	id, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+	database.DB.Delete(&models.Prober{}, id)
+	sync.ForgetProber(uint(id))
+	c.JSON(http.StatusOK, gin.H{"message": "deleted"})
+}
+
+// RegenerateProberTokenHandler 重置探测机的 Token 与代理凭证，返回的 token 只显示这一次
+func RegenerateProberTokenHandler(c *gin.Context) {
+	id, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+	prober, token, err := sync.RegenerateProberToken(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"prober": prober, "token": token})
+}
@@ -1,14 +1,14 @@
 package api
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
-	"os"
 
 	"github.com/gin-gonic/gin"
 	"github.com/wangn9900/StealthForward/internal/database"
 	"github.com/wangn9900/StealthForward/internal/models"
-	"github.com/wangn9900/StealthForward/internal/remote"
+	"github.com/wangn9900/StealthForward/internal/sync"
 )
 
 // ReprovisionNodeHandler 触发远程节点的初始化流程 (BBR + 对接)
@@ -20,19 +20,7 @@ func ReprovisionNodeHandler(c *gin.Context) {
 		return
 	}
 
-	if entry.IP == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Node has no IP, please provision it first"})
-		return
-	}
-
-	// 1. 获取 SSH 密钥
-	var sshKey models.SSHKey
-	if err := database.DB.First(&sshKey).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "No SSH Provisioning Key found. Please add one in Settings."})
-		return
-	}
-
-	// 2. 构造对接指令 (由主控地址和 Token 组成)
+	// 构造对接指令的主控地址
 	// 支持 Nginx 反向代理：优先读取 X-Forwarded-Proto 头
 	host := c.Request.Host
 	protocol := "http"
@@ -43,35 +31,19 @@ func ReprovisionNodeHandler(c *gin.Context) {
 	}
 	controllerURL := fmt.Sprintf("%s://%s", protocol, host)
 
-	// 鉴权 Token
-	adminToken := os.Getenv("STEALTH_ADMIN_TOKEN")
-
-	agentVersion := "v3.5.6"
-	_ = agentVersion
-
-	installCmd := fmt.Sprintf(
-		"export CTRL_ADDR='%s' && export NODE_ID='%d' && export CTRL_TOKEN='%s' && export CTRL_DOMAIN='%s' && "+
-			"curl -fsSL https://raw.githubusercontent.com/wangn9900/StealthForward/main/scripts/install.sh | bash -s -- 2 >> /var/log/stealth-init.log 2>&1",
-		controllerURL, entry.ID, adminToken, entry.Domain,
-	)
-
 	// 如果用户有特殊的 install.sh 逻辑，也可以考虑用它
 	// 但为了 BBR 和 RLimit，我们已经在 internal/remote 里写好了
-
-	// 3. 异步执行
-	go func() {
-		cfg := remote.ProvisionConfig{
-			Host:       entry.IP,
-			Port:       22,
-			User:       sshKey.User,
-			PrivateKey: sshKey.KeyContent,
-			AgentCmd:   installCmd,
+	if err := sync.ReprovisionEntry(entry, controllerURL); err != nil {
+		switch {
+		case errors.Is(err, sync.ErrEntryNoIP):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Node has no IP, please provision it first"})
+		case errors.Is(err, sync.ErrNoSSHKey):
+			c.JSON(http.StatusNotFound, gin.H{"error": "No SSH Provisioning Key found. Please add one in Settings."})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		}
-
-		if err := remote.RunProvisioning(cfg); err != nil {
-			fmt.Printf("[Provision] Failed for node %d: %v\n", entry.ID, err)
-		}
-	}()
+		return
+	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"message": "自动化初始化任务已启动，请等待约 1-2 分钟。可在中转机 /var/log/stealth-init.log 查看进度。",
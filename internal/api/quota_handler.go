@@ -0,0 +1,153 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wangn9900/StealthForward/internal/database"
+	"github.com/wangn9900/StealthForward/internal/models"
+	"github.com/wangn9900/StealthForward/internal/sync"
+)
+
+// ListQuotasHandler 列出所有流量配额 (含当前周期用量)
+func ListQuotasHandler(c *gin.Context) {
+	var quotas []models.TrafficQuota
+	query := database.DB.Order("id")
+	if scope := c.Query("scope"); scope != "" {
+		query = query.Where("scope = ?", scope)
+	}
+	query.Find(&quotas)
+	c.JSON(http.StatusOK, quotas)
+}
+
+// CreateQuotaHandler 创建流量配额
+func CreateQuotaHandler(c *gin.Context) {
+	var quota models.TrafficQuota
+	if err := c.ShouldBindJSON(&quota); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := sync.ValidateQuota(quota); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	quota.ID = 0
+	quota.Enabled = true
+	quota.Triggered = false
+	quota.TriggeredAt = nil
+	if err := database.DB.Create(&quota).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	sync.CheckQuotas()
+	database.DB.First(&quota, quota.ID)
+	c.JSON(http.StatusOK, quota)
+}
+
+// UpdateQuotaHandler 更新流量配额，已执行的动作先撤销，再按新设置重新检查
+func UpdateQuotaHandler(c *gin.Context) {
+	var quota models.TrafficQuota
+	if err := database.DB.First(&quota, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Quota not found"})
+		return
+	}
+	var req struct {
+		LimitBytes   int64  `json:"limit_bytes"`
+		Action       string `json:"action"`
+		ThrottleMbps int    `json:"throttle_mbps"`
+		BillingDay   int    `json:"billing_day"`
+		Enabled      bool   `json:"enabled"`
+		Note         string `json:"note"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	quota.LimitBytes = req.LimitBytes
+	quota.Action = req.Action
+	quota.ThrottleMbps = req.ThrottleMbps
+	quota.BillingDay = req.BillingDay
+	quota.Enabled = req.Enabled
+	quota.Note = req.Note
+	if err := sync.ValidateQuota(quota); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	quota.Triggered = false
+	quota.TriggeredAt = nil
+	database.DB.Save(&quota)
+	sync.LiftQuota(quota.ID)
+	sync.CheckQuotas()
+	database.DB.First(&quota, quota.ID)
+	c.JSON(http.StatusOK, quota)
+}
+
+// DeleteQuotaHandler 删除流量配额并解除其触发的暂停
+func DeleteQuotaHandler(c *gin.Context) {
+	var quota models.TrafficQuota
+	if err := database.DB.First(&quota, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Quota not found"})
+		return
+	}
+	database.DB.Delete(&quota)
+	sync.LiftQuota(quota.ID)
+	c.JSON(http.StatusOK, gin.H{"message": "deleted"})
+}
+
+// ListSuspensionsHandler 列出当前生效的暂停
+func ListSuspensionsHandler(c *gin.Context) {
+	var suspensions []models.Suspension
+	database.DB.Order("id").Find(&suspensions)
+	c.JSON(http.StatusOK, suspensions)
+}
+
+// CreateSuspensionHandler 管理员手动暂停 用户/入口/落地 (不随计费周期自动解除)
+func CreateSuspensionHandler(c *gin.Context) {
+	var req struct {
+		Scope    string `json:"scope" binding:"required"`
+		TargetID uint   `json:"target_id" binding:"required"`
+		Reason   string `json:"reason"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Scope != models.QuotaScopeUser && req.Scope != models.QuotaScopeEntry && req.Scope != models.QuotaScopeExit {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unknown scope: " + req.Scope})
+		return
+	}
+
+	var suspension models.Suspension
+	database.DB.Where(&models.Suspension{Scope: req.Scope, TargetID: req.TargetID}).First(&suspension)
+	suspension.Scope = req.Scope
+	suspension.TargetID = req.TargetID
+	suspension.QuotaID = 0 // 转为手动暂停，周期重置不再解除
+	suspension.Source = models.SuspensionSourceManual
+	suspension.Reason = req.Reason
+	if err := database.DB.Save(&suspension).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	sync.ApplySuspensions()
+	c.JSON(http.StatusOK, suspension)
+}
+
+// DeleteSuspensionHandler 解除暂停
+func DeleteSuspensionHandler(c *gin.Context) {
+	var suspension models.Suspension
+	if err := database.DB.First(&suspension, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Suspension not found"})
+		return
+	}
+	if err := database.DB.Delete(&suspension).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	// 入口仍超出云流量额度时先补上额度暂停，避免解除后短暂放行
+	if suspension.Scope == models.QuotaScopeEntry && suspension.Source != models.SuspensionSourceBandwidth {
+		sync.CheckBandwidthAllowances()
+	}
+	sync.ApplySuspensions()
+	c.JSON(http.StatusOK, gin.H{"message": "deleted"})
+}
@@ -0,0 +1,51 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wangn9900/StealthForward/internal/sync"
+)
+
+// GetRotationPolicyHandler 返回自动换 IP 策略
+func GetRotationPolicyHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, sync.GetRotationPolicy())
+}
+
+// UpdateRotationPolicyHandler 更新自动换 IP 策略
+func UpdateRotationPolicyHandler(c *gin.Context) {
+	policy := sync.GetRotationPolicy()
+	if err := c.ShouldBindJSON(&policy); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	saved, err := sync.SaveRotationPolicy(policy)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, saved)
+}
+
+// EvaluateRotationHandler 立即按当前策略检查一轮 (?dry_run=1 只返回决策，不换 IP、不写日志)
+func EvaluateRotationHandler(c *gin.Context) {
+	dryRun := c.Query("dry_run") == "1" || c.Query("dry_run") == "true"
+	policy := sync.GetRotationPolicy()
+	if !policy.Enabled && !dryRun {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "rotation policy is disabled"})
+		return
+	}
+	c.JSON(http.StatusOK, sync.EvaluateAutoRotation(policy, time.Now(), dryRun))
+}
+
+// ListRotationDecisionsHandler 返回自动换 IP 决策日志 (?entry_id=&limit=100)
+func ListRotationDecisionsHandler(c *gin.Context) {
+	entryID, _ := strconv.ParseUint(c.Query("entry_id"), 10, 32)
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit <= 0 || limit > 1000 {
+		limit = 100
+	}
+	c.JSON(http.StatusOK, sync.GetRotationDecisions(uint(entryID), limit))
+}
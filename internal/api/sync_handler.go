@@ -0,0 +1,89 @@
+package api
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wangn9900/StealthForward/internal/database"
+	"github.com/wangn9900/StealthForward/internal/models"
+	"github.com/wangn9900/StealthForward/internal/sync"
+)
+
+// GetSyncStatusHandler 返回同步运行状态及各节点最近一次同步结果
+func GetSyncStatusHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, sync.GetSyncStatus())
+}
+
+// GetSyncHistoryHandler 查询同步历史，支持 entry_id / node_id / limit 过滤
+func GetSyncHistoryHandler(c *gin.Context) {
+	entryID, _ := strconv.ParseUint(c.Query("entry_id"), 10, 32)
+	nodeID, _ := strconv.Atoi(c.Query("node_id"))
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit <= 0 || limit > 1000 {
+		limit = 100
+	}
+
+	c.JSON(http.StatusOK, sync.GetSyncHistory(uint(entryID), nodeID, limit))
+}
+
+// DryRunSyncHandler 拉取面板数据并返回 新增/更新/删除 差异，不写入数据库
+func DryRunSyncHandler(c *gin.Context) {
+	var entryID uint64
+	if idStr := c.Query("entry_id"); idStr != "" {
+		id, err := strconv.ParseUint(idStr, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid entry id"})
+			return
+		}
+		entryID = id
+	}
+
+	diffs := sync.DryRunSync(uint(entryID))
+
+	var adds, updates, removes int
+	for _, d := range diffs {
+		adds += len(d.Add)
+		updates += len(d.Update)
+		removes += len(d.Remove)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"summary": gin.H{
+			"add":    adds,
+			"update": updates,
+			"remove": removes,
+		},
+		"diffs": diffs,
+	})
+}
+
+// SyncWebhookHandler 面板推送入口：用户变更后立即同步指定入口
+// 使用入口的 V2Board 通讯密钥鉴权 (token 参数或 Authorization: Bearer <key>)
+func SyncWebhookHandler(c *gin.Context) {
+	entryID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid entry id"})
+		return
+	}
+
+	token := c.Query("token")
+	if token == "" {
+		token = strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	}
+
+	var entry models.EntryNode
+	if err := database.DB.First(&entry, entryID).Error; err != nil || entry.V2boardKey == "" || entry.V2boardURL == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "entry node not found"})
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(token), []byte(entry.V2boardKey)) != 1 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	sync.SyncEntryNow(entry.ID, sync.SyncTriggerWebhook)
+	c.JSON(http.StatusOK, gin.H{"status": "sync triggered"})
+}
@@ -1,10 +1,15 @@
 package api
 
 import (
+	"encoding/csv"
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/wangn9900/StealthForward/internal/models"
 	"github.com/wangn9900/StealthForward/internal/sync"
 )
 
@@ -14,6 +19,96 @@ func GetTrafficStatsHandler(c *gin.Context) {
 	c.JSON(http.StatusOK, stats)
 }
 
+// GetTrafficOutboxHandler 返回各面板节点待推送的流量积压
+func GetTrafficOutboxHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, sync.GetOutboxBacklog())
+}
+
+// parseHistoryTime 解析 RFC3339 时间或本地日期 (2006-01-02)
+func parseHistoryTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation("2006-01-02", s, time.Local)
+}
+
+// GetTrafficHistoryHandler 查询 小时/天 级流量历史
+// 参数: granularity=hour|day, from, to (RFC3339 或 2006-01-02), group_by=entry,exit,mapping,user,
+// entry_id, exit_id, node_id, tag, format=json|csv
+func GetTrafficHistoryHandler(c *gin.Context) {
+	q := sync.TrafficHistoryQuery{
+		Granularity: c.DefaultQuery("granularity", models.TrafficGranularityHour),
+		To:          time.Now(),
+		Tag:         c.Query("tag"),
+	}
+	if v := c.Query("to"); v != "" {
+		t, err := parseHistoryTime(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid to"})
+			return
+		}
+		q.To = t
+	}
+	q.From = q.To.Add(-24 * time.Hour)
+	if q.Granularity == models.TrafficGranularityDay {
+		q.From = q.To.AddDate(0, 0, -30)
+	}
+	if v := c.Query("from"); v != "" {
+		t, err := parseHistoryTime(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid from"})
+			return
+		}
+		q.From = t
+	}
+	if v := c.Query("group_by"); v != "" {
+		q.GroupBy = strings.Split(v, ",")
+	}
+	entryID, _ := strconv.ParseUint(c.Query("entry_id"), 10, 32)
+	exitID, _ := strconv.ParseUint(c.Query("exit_id"), 10, 32)
+	q.EntryNodeID = uint(entryID)
+	q.ExitNodeID = uint(exitID)
+	q.NodeID, _ = strconv.Atoi(c.Query("node_id"))
+
+	rows, err := sync.QueryTrafficHistory(q)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if c.Query("format") != "csv" {
+		c.JSON(http.StatusOK, rows)
+		return
+	}
+
+	// CSV 导出：列为 bucket_start + 分组列 + upload, download
+	columns, _ := sync.HistoryGroupColumns(q.GroupBy)
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=traffic_%s_%s.csv", q.Granularity, q.From.Format("20060102")))
+	w := csv.NewWriter(c.Writer)
+	w.Write(append(append([]string{"bucket_start"}, columns...), "upload", "download"))
+	for _, r := range rows {
+		record := []string{r.BucketStart.Format(time.RFC3339)}
+		for _, col := range columns {
+			switch col {
+			case "entry_node_id":
+				record = append(record, strconv.FormatUint(uint64(r.EntryNodeID), 10))
+			case "exit_node_id":
+				record = append(record, strconv.FormatUint(uint64(r.ExitNodeID), 10))
+			case "v2board_node_id":
+				record = append(record, strconv.Itoa(r.V2boardNodeID))
+			case "tag":
+				record = append(record, r.Tag)
+			case "v2board_uid":
+				record = append(record, strconv.FormatUint(uint64(r.V2boardUID), 10))
+			}
+		}
+		record = append(record, strconv.FormatInt(r.Upload, 10), strconv.FormatInt(r.Download, 10))
+		w.Write(record)
+	}
+	w.Flush()
+}
+
 // ClearEntryTrafficHandler 清除指定入口节点的流量统计
 func ClearEntryTrafficHandler(c *gin.Context) {
 	idStr := c.Param("id")
@@ -0,0 +1,457 @@
+// Package bot Controller 内置的 Telegram 运维机器人：查询节点状态/流量，触发同步、换 IP、重装节点
+package bot
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wangn9900/StealthForward/internal/database"
+	"github.com/wangn9900/StealthForward/internal/models"
+	stealthsync "github.com/wangn9900/StealthForward/internal/sync"
+	"github.com/wangn9900/StealthForward/internal/telegram"
+)
+
+const (
+	// confirmTTL 待确认操作的有效期
+	confirmTTL = 2 * time.Minute
+	// idleRecheck 未配置 Token 时重新读取设置的间隔
+	idleRecheck = 30 * time.Second
+	// maxMessageLen 单条消息的最大长度 (Telegram 上限 4096)
+	maxMessageLen = 3800
+)
+
+// 角色 (数值越大权限越高)
+const (
+	roleNone = iota
+	roleViewer
+	roleAdmin
+)
+
+// 需要确认的操作
+const (
+	actionRotate      = "rotate"
+	actionReprovision = "reprovision"
+)
+
+// pendingAction 等待内联按钮确认的操作
+type pendingAction struct {
+	chatID  int64
+	userID  int64
+	action  string
+	entryID uint
+	expires time.Time
+}
+
+type telegramBot struct {
+	client *telegram.Client
+
+	mu      sync.Mutex
+	pending map[string]pendingAction
+}
+
+// command 机器人命令
+type command struct {
+	name  string
+	args  string
+	desc  string
+	role  int
+	run   func(b *telegramBot, chatID, userID int64, args []string) (string, *telegram.InlineKeyboard)
+	order int
+}
+
+var commands map[string]command
+
+func init() {
+	commands = make(map[string]command)
+	for i, c := range []command{
+		{name: "/entries", desc: "入口列表 (状态 / 流量)", role: roleViewer, run: (*telegramBot).cmdEntries},
+		{name: "/top", args: "[小时]", desc: "流量最高的用户 (默认 24 小时)", role: roleViewer, run: (*telegramBot).cmdTop},
+		{name: "/sync", desc: "触发面板全量同步", role: roleAdmin, run: (*telegramBot).cmdSync},
+		{name: "/rotate", args: "<入口ID>", desc: "更换入口 IP (需确认)", role: roleAdmin, run: (*telegramBot).cmdRotate},
+		{name: "/reprovision", args: "<入口ID>", desc: "重新初始化入口 (需确认)", role: roleAdmin, run: (*telegramBot).cmdReprovision},
+		{name: "/help", desc: "命令列表", role: roleViewer, run: (*telegramBot).cmdHelp},
+	} {
+		c.order = i
+		commands[c.name] = c
+	}
+	commands["/start"] = commands["/help"]
+}
+
+// StartTelegramBot 启动运维机器人。设置 telegram.bot_token 后生效，修改 Token / API 地址后自动重连
+func StartTelegramBot() {
+	go func() {
+		var b *telegramBot
+		var token, apiBase string
+		var offset int64
+		for {
+			t, base := setting(models.ConfigKeyTelegramBotToken), setting(models.ConfigKeyTelegramAPIBase)
+			if t == "" {
+				if b != nil {
+					log.Println("[Bot] Telegram 机器人已停用")
+					b = nil
+				}
+				time.Sleep(idleRecheck)
+				continue
+			}
+			if b == nil || t != token || base != apiBase {
+				token, apiBase, offset = t, base, 0
+				b = newTelegramBot(t, base)
+				log.Println("[Bot] Telegram 机器人已启动 (长轮询)")
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), telegram.PollTimeout+10*time.Second)
+			updates, err := b.client.GetUpdates(ctx, offset)
+			cancel()
+			if err != nil {
+				log.Printf("[Bot] 获取更新失败: %v", err)
+				time.Sleep(5 * time.Second)
+				continue
+			}
+			for _, u := range updates {
+				offset = u.UpdateID + 1
+				switch {
+				case u.CallbackQuery != nil:
+					b.handleCallback(u.CallbackQuery)
+				case u.Message != nil && u.Message.Text != "":
+					b.handleMessage(u.Message)
+				}
+			}
+		}
+	}()
+}
+
+// newTelegramBot 创建机器人，apiBase 为 telegram.api_base 设置 (为空使用官方地址)
+func newTelegramBot(token, apiBase string) *telegramBot {
+	return &telegramBot{client: telegram.New(token, apiBase), pending: make(map[string]pendingAction)}
+}
+
+// setting 读取系统设置
+func setting(key string) string {
+	var s models.SystemSetting
+	if err := database.DB.Where("key = ?", key).First(&s).Error; err == nil {
+		return strings.TrimSpace(s.Value)
+	}
+	return ""
+}
+
+// chatListed 判断 chat / user ID 是否在逗号分隔的列表中
+func chatListed(list string, ids ...int64) bool {
+	for _, part := range strings.Split(list, ",") {
+		v, err := strconv.ParseInt(strings.TrimSpace(part), 10, 64)
+		if err != nil {
+			continue
+		}
+		for _, id := range ids {
+			if id != 0 && id == v {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// roleOf 按会话 ID 或发送者 ID 匹配白名单，取最高角色
+func roleOf(chatID, userID int64) int {
+	if chatListed(setting(models.ConfigKeyTelegramAdminChats), chatID, userID) {
+		return roleAdmin
+	}
+	if chatListed(setting(models.ConfigKeyTelegramViewChats), chatID, userID) {
+		return roleViewer
+	}
+	return roleNone
+}
+
+func (b *telegramBot) reply(chatID int64, text string, keyboard *telegram.InlineKeyboard) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	if err := b.client.SendMessage(ctx, chatID, text, keyboard); err != nil {
+		log.Printf("[Bot] 发送消息失败 (chat %d): %v", chatID, err)
+	}
+}
+
+func (b *telegramBot) edit(chatID, messageID int64, text string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	if err := b.client.EditMessageText(ctx, chatID, messageID, text); err != nil {
+		log.Printf("[Bot] 修改消息失败 (chat %d): %v", chatID, err)
+	}
+}
+
+func (b *telegramBot) answer(id, text string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	b.client.AnswerCallbackQuery(ctx, id, text)
+}
+
+// handleMessage 处理文本命令，未授权的会话只记录日志不回复
+func (b *telegramBot) handleMessage(m *telegram.Message) {
+	var userID int64
+	if m.From != nil {
+		userID = m.From.ID
+	}
+	role := roleOf(m.Chat.ID, userID)
+	if role == roleNone {
+		log.Printf("[Bot] 忽略未授权的会话 chat=%d user=%d", m.Chat.ID, userID)
+		return
+	}
+
+	fields := strings.Fields(m.Text)
+	if len(fields) == 0 || !strings.HasPrefix(fields[0], "/") {
+		return
+	}
+	name := strings.ToLower(fields[0])
+	if i := strings.Index(name, "@"); i > 0 {
+		name = name[:i] // 群组中的 /cmd@botname
+	}
+	cmd, ok := commands[name]
+	if !ok {
+		b.reply(m.Chat.ID, "未知命令，发送 /help 查看可用命令", nil)
+		return
+	}
+	if role < cmd.role {
+		b.reply(m.Chat.ID, "权限不足", nil)
+		return
+	}
+	log.Printf("[Bot] chat=%d user=%d 执行 %s", m.Chat.ID, userID, strings.Join(fields, " "))
+	text, keyboard := cmd.run(b, m.Chat.ID, userID, fields[1:])
+	b.reply(m.Chat.ID, text, keyboard)
+}
+
+// handleCallback 处理确认/取消按钮，只有发起人可以确认
+func (b *telegramBot) handleCallback(q *telegram.CallbackQuery) {
+	if q.Message == nil {
+		b.answer(q.ID, "")
+		return
+	}
+	chatID, messageID := q.Message.Chat.ID, q.Message.MessageID
+	decision, token, _ := strings.Cut(q.Data, ":")
+
+	b.mu.Lock()
+	p, ok := b.pending[token]
+	valid := ok && p.chatID == chatID && p.userID == q.From.ID && time.Now().Before(p.expires)
+	if valid {
+		delete(b.pending, token)
+	}
+	b.mu.Unlock()
+
+	if !valid {
+		if ok && p.userID != q.From.ID && time.Now().Before(p.expires) {
+			b.answer(q.ID, "只有发起人可以确认")
+			return
+		}
+		b.answer(q.ID, "操作已过期")
+		b.edit(chatID, messageID, "操作已过期，请重新发送命令")
+		return
+	}
+	if decision != "ok" {
+		b.answer(q.ID, "已取消")
+		b.edit(chatID, messageID, "已取消")
+		return
+	}
+	if roleOf(chatID, q.From.ID) < roleAdmin {
+		b.answer(q.ID, "权限不足")
+		return
+	}
+
+	b.answer(q.ID, "执行中")
+	b.edit(chatID, messageID, "执行中...")
+	log.Printf("[Bot] chat=%d user=%d 确认 %s 入口 #%d", chatID, q.From.ID, p.action, p.entryID)
+	go func() {
+		b.edit(chatID, messageID, b.execute(p))
+	}()
+}
+
+// requestConfirm 登记待确认操作并返回带确认按钮的消息
+func (b *telegramBot) requestConfirm(chatID, userID int64, action string, entryID uint, text string) (string, *telegram.InlineKeyboard) {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		log.Printf("[Bot] 生成确认令牌失败: %v", err)
+		return "生成确认令牌失败，请稍后重试", nil
+	}
+	token := hex.EncodeToString(buf)
+
+	now := time.Now()
+	b.mu.Lock()
+	for k, p := range b.pending {
+		if now.After(p.expires) {
+			delete(b.pending, k)
+		}
+	}
+	b.pending[token] = pendingAction{chatID: chatID, userID: userID, action: action, entryID: entryID, expires: now.Add(confirmTTL)}
+	b.mu.Unlock()
+
+	return text + fmt.Sprintf("\n\n请在 %d 分钟内确认", int(confirmTTL.Minutes())), &telegram.InlineKeyboard{
+		InlineKeyboard: [][]telegram.InlineButton{{
+			{Text: "确认", CallbackData: "ok:" + token},
+			{Text: "取消", CallbackData: "no:" + token},
+		}},
+	}
+}
+
+// execute 执行已确认的操作，返回结果文本
+func (b *telegramBot) execute(p pendingAction) string {
+	var entry models.EntryNode
+	if err := database.DB.First(&entry, p.entryID).Error; err != nil {
+		return fmt.Sprintf("入口 #%d 不存在", p.entryID)
+	}
+	switch p.action {
+	case actionRotate:
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+		defer cancel()
+		newIP, err := stealthsync.RotateEntryIP(ctx, entry, entry.CloudRegion, entry.CloudInstanceID, "", entry.CloudRecordName, "telegram")
+		if err != nil {
+			return fmt.Sprintf("入口 #%d (%s) 换 IP 失败: %v", entry.ID, entry.Name, err)
+		}
+		return fmt.Sprintf("入口 #%d (%s) IP 已更换: %s -> %s", entry.ID, entry.Name, entry.IP, newIP)
+	case actionReprovision:
+		if err := stealthsync.ReprovisionEntry(entry, setting(models.ConfigKeyControllerPublicURL)); err != nil {
+			return fmt.Sprintf("入口 #%d (%s) 重装失败: %v", entry.ID, entry.Name, err)
+		}
+		return fmt.Sprintf("入口 #%d (%s) 初始化任务已启动，约 1-2 分钟完成", entry.ID, entry.Name)
+	}
+	return "未知操作"
+}
+
+func (b *telegramBot) cmdHelp(chatID, userID int64, _ []string) (string, *telegram.InlineKeyboard) {
+	role := roleOf(chatID, userID)
+	list := make([]command, 0, len(commands))
+	for name, c := range commands {
+		if name == c.name && role >= c.role {
+			list = append(list, c)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].order < list[j].order })
+
+	var sb strings.Builder
+	sb.WriteString("StealthForward 运维机器人\n")
+	for _, c := range list {
+		sb.WriteString("\n" + c.name)
+		if c.args != "" {
+			sb.WriteString(" " + c.args)
+		}
+		sb.WriteString(" - " + c.desc)
+	}
+	return sb.String(), nil
+}
+
+// statusIcon 节点状态图标
+var statusIcon = map[string]string{
+	models.NodeStatusOnline:   "🟢",
+	models.NodeStatusDegraded: "🟡",
+	models.NodeStatusOffline:  "🔴",
+	models.NodeStatusUnknown:  "⚪",
+}
+
+func (b *telegramBot) cmdEntries(_, _ int64, _ []string) (string, *telegram.InlineKeyboard) {
+	statuses := stealthsync.GetNodeStatuses()
+	if len(statuses) == 0 {
+		return "暂无入口节点", nil
+	}
+	traffic := stealthsync.GetTrafficStatsByEntry().EntryStats
+	var entries []models.EntryNode
+	database.DB.Select("id, ip").Find(&entries)
+	ips := make(map[uint]string, len(entries))
+	for _, e := range entries {
+		ips[e.ID] = e.IP
+	}
+
+	var sb strings.Builder
+	for _, s := range statuses {
+		t := traffic[s.EntryNodeID]
+		line := fmt.Sprintf("%s #%d %s %s\n   ↑%s ↓%s", statusIcon[s.Status], s.EntryNodeID, s.Name, ips[s.EntryNodeID],
+			stealthsync.FormatBytes(t.Upload), stealthsync.FormatBytes(t.Download))
+		if s.Stats != nil && s.Status != models.NodeStatusOffline {
+			line += fmt.Sprintf(" · CPU %.0f%% · MEM %.0f%%", s.Stats.CPU, s.Stats.Mem)
+		}
+		if sb.Len()+len(line) > maxMessageLen {
+			sb.WriteString("\n...")
+			break
+		}
+		if sb.Len() > 0 {
+			sb.WriteString("\n")
+		}
+		sb.WriteString(line)
+	}
+	return sb.String(), nil
+}
+
+func (b *telegramBot) cmdTop(_, _ int64, args []string) (string, *telegram.InlineKeyboard) {
+	hours := 24
+	if len(args) > 0 {
+		h, err := strconv.Atoi(args[0])
+		if err != nil || h <= 0 || h > 24*31 {
+			return "用法: /top [小时] (1-744)", nil
+		}
+		hours = h
+	}
+	users, err := stealthsync.TopUsers(time.Now().Add(-time.Duration(hours)*time.Hour), 10)
+	if err != nil {
+		return "查询失败: " + err.Error(), nil
+	}
+	if len(users) == 0 {
+		return fmt.Sprintf("最近 %d 小时没有流量记录", hours), nil
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "最近 %d 小时流量 Top %d", hours, len(users))
+	for i, u := range users {
+		name := u.Tag
+		if u.V2boardUID > 0 {
+			name = fmt.Sprintf("uid %d", u.V2boardUID)
+		}
+		fmt.Fprintf(&sb, "\n%d. %s  %s (↑%s ↓%s)", i+1, name, stealthsync.FormatBytes(u.Upload+u.Download), stealthsync.FormatBytes(u.Upload), stealthsync.FormatBytes(u.Download))
+	}
+	return sb.String(), nil
+}
+
+func (b *telegramBot) cmdSync(_, _ int64, _ []string) (string, *telegram.InlineKeyboard) {
+	stealthsync.GlobalSyncNow()
+	return "已触发全量同步", nil
+}
+
+// confirmEntry 解析入口 ID 参数
+func confirmEntry(args []string, usage string) (models.EntryNode, string) {
+	var entry models.EntryNode
+	if len(args) == 0 {
+		return entry, "用法: " + usage
+	}
+	id, err := strconv.ParseUint(strings.TrimPrefix(args[0], "#"), 10, 32)
+	if err != nil {
+		return entry, "用法: " + usage
+	}
+	if err := database.DB.First(&entry, id).Error; err != nil {
+		return entry, fmt.Sprintf("入口 #%d 不存在", id)
+	}
+	return entry, ""
+}
+
+func (b *telegramBot) cmdRotate(chatID, userID int64, args []string) (string, *telegram.InlineKeyboard) {
+	entry, errText := confirmEntry(args, "/rotate <入口ID>")
+	if errText != "" {
+		return errText, nil
+	}
+	if entry.CloudRegion == "" || entry.CloudInstanceID == "" {
+		return fmt.Sprintf("入口 #%d (%s) 未绑定云平台区域或实例 ID", entry.ID, entry.Name), nil
+	}
+	return b.requestConfirm(chatID, userID, actionRotate, entry.ID,
+		fmt.Sprintf("确认更换入口 #%d (%s) 的 IP？\n当前 IP: %s\n实例: %s %s", entry.ID, entry.Name, entry.IP, entry.CloudRegion, entry.CloudInstanceID))
+}
+
+func (b *telegramBot) cmdReprovision(chatID, userID int64, args []string) (string, *telegram.InlineKeyboard) {
+	entry, errText := confirmEntry(args, "/reprovision <入口ID>")
+	if errText != "" {
+		return errText, nil
+	}
+	if setting(models.ConfigKeyControllerPublicURL) == "" {
+		return "请先在系统设置中配置 controller.public_url (Agent 回连地址)", nil
+	}
+	return b.requestConfirm(chatID, userID, actionReprovision, entry.ID,
+		fmt.Sprintf("确认重新初始化入口 #%d (%s, %s)？\n将通过 SSH 重新安装 Agent", entry.ID, entry.Name, entry.IP))
+}
@@ -0,0 +1,301 @@
+package bot
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"github.com/wangn9900/StealthForward/internal/database"
+	"github.com/wangn9900/StealthForward/internal/models"
+	"github.com/wangn9900/StealthForward/internal/telegram"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+const (
+	testToken  = "123:secret"
+	adminChat  = int64(1001)
+	viewerChat = int64(2002)
+	adminUser  = int64(11)
+	otherUser  = int64(22)
+)
+
+// apiCall Bot API 替身收到的一次调用
+type apiCall struct {
+	method string
+	params map[string]interface{}
+}
+
+// fakeBotAPI 记录机器人发出的 Bot API 调用
+type fakeBotAPI struct {
+	mu    sync.Mutex
+	calls []apiCall
+}
+
+func (f *fakeBotAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var params map[string]interface{}
+	json.NewDecoder(r.Body).Decode(&params)
+	f.mu.Lock()
+	f.calls = append(f.calls, apiCall{method: strings.TrimPrefix(r.URL.Path, "/bot"+testToken+"/"), params: params})
+	f.mu.Unlock()
+	w.Write([]byte(`{"ok":true,"result":true}`))
+}
+
+// take 取出并清空已记录的调用
+func (f *fakeBotAPI) take() []apiCall {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	calls := f.calls
+	f.calls = nil
+	return calls
+}
+
+// setupBot 初始化临时数据库与白名单，机器人通过 telegram.api_base 设置指向 Bot API 替身
+func setupBot(t *testing.T) (*telegramBot, *fakeBotAPI) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "bot.db")), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.SystemSetting{}, &models.EntryNode{}); err != nil {
+		t.Fatal(err)
+	}
+	database.DB = db
+
+	api := &fakeBotAPI{}
+	srv := httptest.NewServer(api)
+	t.Cleanup(srv.Close)
+
+	setSetting(t, models.ConfigKeyTelegramBotToken, testToken)
+	setSetting(t, models.ConfigKeyTelegramAPIBase, srv.URL)
+	setSetting(t, models.ConfigKeyTelegramAdminChats, "1001")
+	setSetting(t, models.ConfigKeyTelegramViewChats, " 2002 , bad")
+	return newTelegramBot(setting(models.ConfigKeyTelegramBotToken), setting(models.ConfigKeyTelegramAPIBase)), api
+}
+
+func setSetting(t *testing.T, key, value string) {
+	t.Helper()
+	var s models.SystemSetting
+	if err := database.DB.Where(models.SystemSetting{Key: key}).Assign(map[string]interface{}{"value": value}).FirstOrCreate(&s).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func message(chatID, userID int64, text string) *telegram.Message {
+	return &telegram.Message{MessageID: 1, From: &telegram.User{ID: userID}, Chat: telegram.Chat{ID: chatID}, Text: text}
+}
+
+// lastText 返回最后一次 sendMessage 的文本
+func lastText(t *testing.T, calls []apiCall) string {
+	t.Helper()
+	for i := len(calls) - 1; i >= 0; i-- {
+		if calls[i].method == "sendMessage" {
+			text, _ := calls[i].params["text"].(string)
+			return text
+		}
+	}
+	t.Fatalf("no sendMessage in %v", calls)
+	return ""
+}
+
+func TestRoleOf(t *testing.T) {
+	setupBot(t)
+	cases := []struct {
+		chat, user int64
+		want       int
+	}{
+		{adminChat, 0, roleAdmin},
+		{999, adminChat, roleAdmin}, // 私聊中按发送者 ID 匹配
+		{viewerChat, otherUser, roleViewer},
+		{999, otherUser, roleNone},
+		{0, 0, roleNone},
+	}
+	for _, c := range cases {
+		if got := roleOf(c.chat, c.user); got != c.want {
+			t.Errorf("roleOf(%d, %d) = %d, want %d", c.chat, c.user, got, c.want)
+		}
+	}
+}
+
+func TestUnauthorizedChatIgnored(t *testing.T) {
+	b, api := setupBot(t)
+	b.handleMessage(message(999, otherUser, "/help"))
+	if calls := api.take(); len(calls) != 0 {
+		t.Errorf("unauthorized chat got replies: %v", calls)
+	}
+}
+
+func TestViewerCommands(t *testing.T) {
+	b, api := setupBot(t)
+
+	b.handleMessage(message(viewerChat, otherUser, "/help@stealth_bot"))
+	help := lastText(t, api.take())
+	if !strings.Contains(help, "/entries") || strings.Contains(help, "/rotate") || strings.Contains(help, "/sync") {
+		t.Errorf("viewer help lists wrong commands:\n%s", help)
+	}
+
+	for _, cmd := range []string{"/sync", "/rotate 1", "/reprovision 1"} {
+		b.handleMessage(message(viewerChat, otherUser, cmd))
+		if text := lastText(t, api.take()); text != "权限不足" {
+			t.Errorf("%s by viewer: %q", cmd, text)
+		}
+	}
+
+	b.handleMessage(message(viewerChat, otherUser, "/nope"))
+	if text := lastText(t, api.take()); !strings.Contains(text, "未知命令") {
+		t.Errorf("unknown command reply: %q", text)
+	}
+}
+
+func TestAdminHelp(t *testing.T) {
+	b, api := setupBot(t)
+	b.handleMessage(message(adminChat, adminUser, "/start"))
+	help := lastText(t, api.take())
+	for _, cmd := range []string{"/entries", "/top", "/sync", "/rotate", "/reprovision"} {
+		if !strings.Contains(help, cmd) {
+			t.Errorf("admin help misses %s:\n%s", cmd, help)
+		}
+	}
+}
+
+// requestRotate 管理员发起换 IP，返回确认令牌
+func requestRotate(t *testing.T, b *telegramBot, api *fakeBotAPI) string {
+	t.Helper()
+	entry := models.EntryNode{Name: "hk-1", IP: "1.2.3.4", CloudRegion: "ap-east-1", CloudInstanceID: "i-1"}
+	database.DB.Create(&entry)
+	b.handleMessage(message(adminChat, adminUser, "/rotate #1"))
+	calls := api.take()
+	if len(calls) != 1 || calls[0].method != "sendMessage" {
+		t.Fatalf("calls = %v", calls)
+	}
+	markup, _ := calls[0].params["reply_markup"].(map[string]interface{})
+	rows, _ := markup["inline_keyboard"].([]interface{})
+	if len(rows) != 1 {
+		t.Fatalf("no confirm keyboard: %v", calls[0].params)
+	}
+	ok, _ := rows[0].([]interface{})[0].(map[string]interface{})["callback_data"].(string)
+	if !strings.HasPrefix(ok, "ok:") {
+		t.Fatalf("confirm button data = %q", ok)
+	}
+	return strings.TrimPrefix(ok, "ok:")
+}
+
+func callback(userID int64, data string) *telegram.CallbackQuery {
+	return &telegram.CallbackQuery{
+		ID:      "cb",
+		From:    telegram.User{ID: userID},
+		Message: &telegram.Message{MessageID: 7, Chat: telegram.Chat{ID: adminChat}},
+		Data:    data,
+	}
+}
+
+// answerText 返回 answerCallbackQuery 的文本
+func answerText(calls []apiCall) string {
+	for _, c := range calls {
+		if c.method == "answerCallbackQuery" {
+			text, _ := c.params["text"].(string)
+			return text
+		}
+	}
+	return ""
+}
+
+func TestConfirmOnlyByInitiator(t *testing.T) {
+	b, api := setupBot(t)
+	token := requestRotate(t, b, api)
+
+	b.handleCallback(callback(otherUser, "ok:"+token))
+	if text := answerText(api.take()); text != "只有发起人可以确认" {
+		t.Errorf("other user answer = %q", text)
+	}
+	if _, ok := b.pending[token]; !ok {
+		t.Error("pending action consumed by another user")
+	}
+
+	b.handleCallback(callback(adminUser, "no:"+token))
+	if text := answerText(api.take()); text != "已取消" {
+		t.Errorf("cancel answer = %q", text)
+	}
+	// 取消后令牌失效
+	b.handleCallback(callback(adminUser, "ok:"+token))
+	if text := answerText(api.take()); text != "操作已过期" {
+		t.Errorf("reuse answer = %q", text)
+	}
+}
+
+func TestConfirmExpires(t *testing.T) {
+	b, api := setupBot(t)
+	token := requestRotate(t, b, api)
+
+	b.mu.Lock()
+	p := b.pending[token]
+	p.expires = time.Now().Add(-time.Second)
+	b.pending[token] = p
+	b.mu.Unlock()
+
+	b.handleCallback(callback(adminUser, "ok:"+token))
+	calls := api.take()
+	if text := answerText(calls); text != "操作已过期" {
+		t.Errorf("expired answer = %q", text)
+	}
+	edited := false
+	for _, c := range calls {
+		if c.method == "editMessageText" && strings.Contains(c.params["text"].(string), "已过期") {
+			edited = true
+		}
+	}
+	if !edited {
+		t.Errorf("expired confirm did not edit the message: %v", calls)
+	}
+
+	// 过期的待确认操作在下次登记时清理
+	requestRotate(t, b, api)
+	b.mu.Lock()
+	_, stale := b.pending[token]
+	b.mu.Unlock()
+	if stale {
+		t.Error("expired pending action not pruned")
+	}
+}
+
+func TestConfirmRechecksRole(t *testing.T) {
+	b, api := setupBot(t)
+	token := requestRotate(t, b, api)
+
+	// 发起后被移出管理员白名单，确认时拒绝执行
+	setSetting(t, models.ConfigKeyTelegramAdminChats, "")
+	b.handleCallback(callback(adminUser, "ok:"+token))
+	if text := answerText(api.take()); text != "权限不足" {
+		t.Errorf("demoted confirm answer = %q", text)
+	}
+}
+
+func TestConfirmExecutes(t *testing.T) {
+	b, api := setupBot(t)
+	token := requestRotate(t, b, api)
+
+	// 入口在确认前被删除，执行结果写回确认消息
+	database.DB.Delete(&models.EntryNode{}, 1)
+	b.handleCallback(callback(adminUser, "ok:"+token))
+
+	deadline := time.Now().Add(5 * time.Second)
+	var edits []string
+	for time.Now().Before(deadline) {
+		for _, c := range api.take() {
+			if c.method == "editMessageText" {
+				edits = append(edits, c.params["text"].(string))
+			}
+		}
+		if len(edits) > 0 && strings.Contains(edits[len(edits)-1], "不存在") {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Errorf("edits = %q", edits)
+}
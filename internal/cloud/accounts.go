@@ -0,0 +1,272 @@
+package cloud
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wangn9900/StealthForward/internal/database"
+	"github.com/wangn9900/StealthForward/internal/models"
+	"gorm.io/gorm"
+)
+
+const (
+	// accountLimitCooldown 账号遇到配额/限额错误后跳过的时长
+	accountLimitCooldown = 6 * time.Hour
+	accountUsageKeep     = 90 * 24 * time.Hour
+)
+
+var (
+	// ErrNoHealthyAccount 账号池中没有可用 (启用、健康、未限额) 的账号
+	ErrNoHealthyAccount = errors.New("no healthy cloud account available")
+
+	// selectMu 串行化账号选择，保证轮询顺序
+	selectMu sync.Mutex
+
+	// limitErrorMarkers 说明账号配额已满的错误特征 (换一个账号通常可以成功)
+	limitErrorMarkers = []string{"LimitExceeded", "QuotaExceeded", "MaxSpotInstanceCountExceeded", "exceeded the maximum",
+		"resource_limit_exceeded", "maximum number of", "exceed your droplet limit", "reserved IP limit"}
+	// authErrorMarkers 说明凭证失效的错误特征
+	authErrorMarkers = []string{"AuthFailure", "InvalidClientTokenId", "UnrecognizedClientException", "SignatureDoesNotMatch", "AccessDenied", "api error Blocked",
+		"(HTTP 401)", "(HTTP 403)"}
+)
+
+type accountCtxKey struct{}
+
+// WithAccount 返回携带云账号凭证的 context，云平台调用将使用该账号
+func WithAccount(ctx context.Context, account *models.CloudAccount) context.Context {
+	return context.WithValue(ctx, accountCtxKey{}, account)
+}
+
+// accountFrom 取出 context 中的云账号，未指定时返回 nil (使用系统设置中的单一密钥)
+func accountFrom(ctx context.Context) *models.CloudAccount {
+	account, _ := ctx.Value(accountCtxKey{}).(*models.CloudAccount)
+	return account
+}
+
+// AccountProvider 将入口的云平台类型 (aws_ec2, aws_lightsail) 映射为账号池中的平台 (aws)
+func AccountProvider(cloudProvider string) string {
+	if cloudProvider == "" || strings.HasPrefix(cloudProvider, "aws") {
+		return "aws"
+	}
+	return cloudProvider
+}
+
+// IsLimitError 判断错误是否为账号配额/限额错误 (如 AddressLimitExceeded)
+func IsLimitError(err error) bool {
+	// RequestLimitExceeded 是请求频率限制，与账号配额无关
+	return err != nil && containsAny(err.Error(), limitErrorMarkers) && !strings.Contains(err.Error(), "RequestLimitExceeded")
+}
+
+// IsAuthError 判断错误是否为凭证失效/被封禁
+func IsAuthError(err error) bool {
+	return err != nil && containsAny(err.Error(), authErrorMarkers)
+}
+
+func containsAny(s string, markers []string) bool {
+	for _, m := range markers {
+		if strings.Contains(s, m) {
+			return true
+		}
+	}
+	return false
+}
+
+// accountPolicy 返回系统设置的账号选择策略
+func accountPolicy() string {
+	var setting models.SystemSetting
+	if database.DB.Where("key = ?", models.ConfigKeyCloudAccountPolicy).Limit(1).Find(&setting); setting.Value == models.CloudAccountPolicyRoundRobin {
+		return models.CloudAccountPolicyRoundRobin
+	}
+	return models.CloudAccountPolicyLeastUsed
+}
+
+// poolConfigured 判断账号池中是否配置了该平台的启用账号；未配置时沿用系统设置中的单一密钥
+func poolConfigured(provider string) bool {
+	var count int64
+	database.DB.Model(&models.CloudAccount{}).Where("provider = ? AND enabled = ?", provider, true).Count(&count)
+	return count > 0
+}
+
+// healthyAccounts 返回可参与选择的账号，按策略排序 (最优在前)
+func healthyAccounts(provider string, now time.Time) []models.CloudAccount {
+	var accounts []models.CloudAccount
+	database.DB.Where("provider = ? AND enabled = ? AND healthy = ? AND (limited_until IS NULL OR limited_until < ?)",
+		provider, true, true, now).Order("id").Find(&accounts)
+
+	lastUsed := func(a models.CloudAccount) time.Time {
+		if a.LastUsedAt == nil {
+			return time.Time{}
+		}
+		return *a.LastUsedAt
+	}
+	roundRobin := accountPolicy() == models.CloudAccountPolicyRoundRobin
+	sort.SliceStable(accounts, func(i, j int) bool {
+		if !roundRobin && accounts[i].InstanceCount != accounts[j].InstanceCount {
+			return accounts[i].InstanceCount < accounts[j].InstanceCount
+		}
+		return lastUsed(accounts[i]).Before(lastUsed(accounts[j]))
+	})
+	return accounts
+}
+
+// SelectAccount 按策略从账号池中选出一个健康账号 (跳过 exclude 中的账号)，并记为最近使用
+func SelectAccount(provider string, exclude map[uint]bool) (*models.CloudAccount, error) {
+	selectMu.Lock()
+	defer selectMu.Unlock()
+	now := time.Now()
+	for _, a := range healthyAccounts(provider, now) {
+		if exclude[a.ID] {
+			continue
+		}
+		account := a
+		account.LastUsedAt = &now
+		database.DB.Model(&models.CloudAccount{}).Where("id = ?", account.ID).Update("last_used_at", now)
+		return &account, nil
+	}
+	return nil, ErrNoHealthyAccount
+}
+
+// AccountContext 返回使用指定账号的 context；accountID 为 0 时沿用系统设置中的单一密钥
+func AccountContext(ctx context.Context, accountID uint) (context.Context, error) {
+	if accountID == 0 {
+		return ctx, nil
+	}
+	var account models.CloudAccount
+	if err := database.DB.First(&account, accountID).Error; err != nil {
+		return ctx, fmt.Errorf("cloud account #%d not found", accountID)
+	}
+	if !account.Enabled {
+		return ctx, fmt.Errorf("cloud account #%d (%s) is disabled", account.ID, account.Name)
+	}
+	return WithAccount(ctx, &account), nil
+}
+
+// PoolContext 用于只读查询 (区域/镜像/实例列表)：指定 accountID 时使用该账号，
+// 否则使用池中排序第一的健康账号；账号池为空时沿用单一密钥
+func PoolContext(ctx context.Context, provider string, accountID uint) (context.Context, error) {
+	if accountID > 0 || !poolConfigured(provider) {
+		return AccountContext(ctx, accountID)
+	}
+	accounts := healthyAccounts(provider, time.Now())
+	if len(accounts) == 0 {
+		return ctx, ErrNoHealthyAccount
+	}
+	return WithAccount(ctx, &accounts[0]), nil
+}
+
+// RunOnAccount 在指定账号上执行一次写操作并记录用量；accountID 为 0 时使用单一密钥 (不记录)
+// 绑定在入口上的实例只能在其所在账号上操作，因此这里不做故障转移
+func RunOnAccount(ctx context.Context, accountID uint, op, region string, fn func(ctx context.Context) error) error {
+	ctx, err := AccountContext(ctx, accountID)
+	if err != nil {
+		return err
+	}
+	err = fn(ctx)
+	if account := accountFrom(ctx); account != nil {
+		recordAccountUsage(account, op, region, err, false)
+	}
+	return err
+}
+
+// RunOnPool 按策略选择账号执行创建类操作；遇到限额或鉴权错误时标记该账号并尝试下一个账号。
+// 账号池为空时使用单一密钥执行，返回的账号为 nil
+func RunOnPool(ctx context.Context, provider, op, region string, fn func(ctx context.Context) error) (*models.CloudAccount, error) {
+	if !poolConfigured(provider) {
+		return nil, fn(ctx)
+	}
+	tried := make(map[uint]bool)
+	var lastErr error
+	for {
+		account, err := SelectAccount(provider, tried)
+		if err != nil {
+			if lastErr != nil {
+				return nil, fmt.Errorf("all cloud accounts failed, last error: %v", lastErr)
+			}
+			return nil, err
+		}
+		tried[account.ID] = true
+
+		err = fn(WithAccount(ctx, account))
+		failover := IsLimitError(err) || IsAuthError(err)
+		recordAccountUsage(account, op, region, err, failover)
+		if !failover {
+			return account, err
+		}
+		log.Printf("[Cloud] 账号 #%d (%s) %s 失败，尝试下一个账号: %v", account.ID, account.Name, op, err)
+		lastErr = err
+	}
+}
+
+// recordAccountUsage 更新账号用量计数与健康状态，并写入操作记录
+func recordAccountUsage(account *models.CloudAccount, op, region string, opErr error, failedOver bool) {
+	now := time.Now()
+	updates := map[string]interface{}{"last_used_at": now}
+	usage := models.CloudAccountUsage{
+		CloudAccountID: account.ID,
+		Operation:      op,
+		Region:         region,
+		Success:        opErr == nil,
+		FailedOver:     failedOver,
+		CreatedAt:      now,
+	}
+
+	if opErr != nil {
+		usage.Error = opErr.Error()
+		updates["error_count"] = gorm.Expr("error_count + 1")
+		updates["last_error"] = opErr.Error()
+		updates["last_error_at"] = now
+		switch {
+		case IsLimitError(opErr):
+			updates["limited_until"] = now.Add(accountLimitCooldown)
+			log.Printf("[Cloud] 账号 #%d (%s) 达到配额限制，%v 内不再选择", account.ID, account.Name, accountLimitCooldown)
+		case IsAuthError(opErr):
+			updates["healthy"] = false
+			log.Printf("[Cloud] 账号 #%d (%s) 凭证失效，已标记为不健康", account.ID, account.Name)
+		}
+	} else {
+		switch op {
+		case models.CloudAccountOpProvision:
+			updates["provision_count"] = gorm.Expr("provision_count + 1")
+			updates["instance_count"] = gorm.Expr("instance_count + 1")
+		case models.CloudAccountOpTerminate:
+			updates["instance_count"] = gorm.Expr("CASE WHEN instance_count > 0 THEN instance_count - 1 ELSE 0 END")
+		case models.CloudAccountOpRotate:
+			updates["rotate_count"] = gorm.Expr("rotate_count + 1")
+		}
+	}
+
+	database.DB.Model(&models.CloudAccount{}).Where("id = ?", account.ID).Updates(updates)
+	database.DB.Create(&usage)
+	database.DB.Where("created_at < ?", now.Add(-accountUsageKeep)).Delete(&models.CloudAccountUsage{})
+}
+
+// GetAccountUsage 返回账号操作记录 (按时间倒序)，accountID 为 0 时返回全部账号
+func GetAccountUsage(accountID uint, limit int) []models.CloudAccountUsage {
+	query := database.DB.Order("id DESC").Limit(limit)
+	if accountID > 0 {
+		query = query.Where("cloud_account_id = ?", accountID)
+	}
+	usage := []models.CloudAccountUsage{}
+	query.Find(&usage)
+	return usage
+}
+
+// poolAccounts 返回该平台所有启用的账号；账号池为空时返回单个 nil (表示单一密钥)
+func poolAccounts(provider string) []*models.CloudAccount {
+	var accounts []models.CloudAccount
+	database.DB.Where("provider = ? AND enabled = ? AND healthy = ?", provider, true, true).Order("id").Find(&accounts)
+	if len(accounts) == 0 {
+		return []*models.CloudAccount{nil}
+	}
+	result := make([]*models.CloudAccount, len(accounts))
+	for i := range accounts {
+		result[i] = &accounts[i]
+	}
+	return result
+}
@@ -0,0 +1,391 @@
+package cloud
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const digitalOceanAPI = "https://api.digitalocean.com/v2"
+
+// digitalOceanProvider DigitalOcean (换 IP 使用 Reserved IP，入站流量经 Reserved IP 进入 Droplet)
+type digitalOceanProvider struct{}
+
+type doDroplet struct {
+	ID     int    `json:"id"`
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Region struct {
+		Slug string `json:"slug"`
+	} `json:"region"`
+	Networks struct {
+		V4 []struct {
+			IPAddress string `json:"ip_address"`
+			Type      string `json:"type"`
+		} `json:"v4"`
+	} `json:"networks"`
+}
+
+// publicIP 返回 Droplet 的公网 IPv4
+func (d doDroplet) publicIP() string {
+	for _, n := range d.Networks.V4 {
+		if n.Type == "public" {
+			return n.IPAddress
+		}
+	}
+	return ""
+}
+
+type doLinks struct {
+	Pages struct {
+		Next string `json:"next"`
+	} `json:"pages"`
+}
+
+func (digitalOceanProvider) Name() string { return ProviderDigitalOcean }
+
+func (digitalOceanProvider) client(ctx context.Context) (*restClient, error) {
+	return newRESTClient(ctx, ProviderDigitalOcean, digitalOceanAPI, "DIGITALOCEAN_TOKEN")
+}
+
+func (p digitalOceanProvider) ListRegions(ctx context.Context) ([]string, error) {
+	c, err := p.client(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var out struct {
+		Regions []struct {
+			Slug      string `json:"slug"`
+			Available bool   `json:"available"`
+		} `json:"regions"`
+	}
+	if err := c.do(ctx, "GET", "/regions?per_page=200", nil, &out); err != nil {
+		return nil, err
+	}
+	var regions []string
+	for _, r := range out.Regions {
+		if r.Available {
+			regions = append(regions, r.Slug)
+		}
+	}
+	sort.Strings(regions)
+	return regions, nil
+}
+
+// ListImages 列出 Debian / Ubuntu 发行版镜像
+func (p digitalOceanProvider) ListImages(ctx context.Context, region string) ([]ImageInfo, error) {
+	c, err := p.client(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var out struct {
+		Images []struct {
+			Slug         string   `json:"slug"`
+			Name         string   `json:"name"`
+			Distribution string   `json:"distribution"`
+			Description  string   `json:"description"`
+			Regions      []string `json:"regions"`
+		} `json:"images"`
+	}
+	if err := c.do(ctx, "GET", "/images?type=distribution&per_page=200", nil, &out); err != nil {
+		return nil, err
+	}
+	var images []ImageInfo
+	for _, img := range out.Images {
+		if img.Slug == "" || (img.Distribution != "Debian" && img.Distribution != "Ubuntu") {
+			continue
+		}
+		if region != "" && len(img.Regions) > 0 && !containsString(img.Regions, region) {
+			continue
+		}
+		images = append(images, ImageInfo{ID: img.Slug, Name: img.Distribution + " " + img.Name, Description: img.Description})
+	}
+	sort.Slice(images, func(i, j int) bool { return images[i].Name < images[j].Name })
+	return images, nil
+}
+
+func (p digitalOceanProvider) ListPlans(ctx context.Context, region string) ([]PlanInfo, error) {
+	c, err := p.client(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var out struct {
+		Sizes []struct {
+			Slug         string   `json:"slug"`
+			Description  string   `json:"description"`
+			Memory       int      `json:"memory"`
+			VCPUs        int      `json:"vcpus"`
+			Disk         int      `json:"disk"`
+			Transfer     float64  `json:"transfer"` // TB
+			PriceMonthly float64  `json:"price_monthly"`
+			Regions      []string `json:"regions"`
+			Available    bool     `json:"available"`
+		} `json:"sizes"`
+	}
+	if err := c.do(ctx, "GET", "/sizes?per_page=200", nil, &out); err != nil {
+		return nil, err
+	}
+	var plans []PlanInfo
+	for _, s := range out.Sizes {
+		if !s.Available || (region != "" && !containsString(s.Regions, region)) {
+			continue
+		}
+		name := s.Slug
+		if s.Description != "" {
+			name = s.Description + " " + s.Slug
+		}
+		plans = append(plans, PlanInfo{
+			ID:           s.Slug,
+			Name:         name,
+			CPU:          s.VCPUs,
+			MemoryMB:     s.Memory,
+			DiskGB:       s.Disk,
+			TransferGB:   int(s.Transfer * 1000),
+			PriceMonthly: s.PriceMonthly,
+		})
+	}
+	sort.SliceStable(plans, func(i, j int) bool { return plans[i].PriceMonthly < plans[j].PriceMonthly })
+	return plans, nil
+}
+
+// ListInstances 列出 Droplet；已绑定 Reserved IP 的 Droplet 以 Reserved IP 作为公网 IP (换 IP 后入口使用的地址)
+func (p digitalOceanProvider) ListInstances(ctx context.Context, region string) ([]CloudInstance, error) {
+	c, err := p.client(ctx)
+	if err != nil {
+		return nil, err
+	}
+	reserved, err := p.reservedIPs(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	var instances []CloudInstance
+	for page := 1; ; page++ {
+		var out struct {
+			Droplets []doDroplet `json:"droplets"`
+			Links    doLinks     `json:"links"`
+		}
+		if err := c.do(ctx, "GET", fmt.Sprintf("/droplets?per_page=200&page=%d", page), nil, &out); err != nil {
+			return nil, err
+		}
+		for _, d := range out.Droplets {
+			if region != "" && d.Region.Slug != region {
+				continue
+			}
+			ip := reserved[d.ID]
+			if ip == "" {
+				ip = d.publicIP()
+			}
+			instances = append(instances, CloudInstance{ID: strconv.Itoa(d.ID), Name: d.Name, PublicIP: ip, Region: d.Region.Slug})
+		}
+		if out.Links.Pages.Next == "" || len(out.Droplets) == 0 {
+			return instances, nil
+		}
+	}
+}
+
+func (p digitalOceanProvider) getDroplet(ctx context.Context, c *restClient, id string) (*doDroplet, error) {
+	var out struct {
+		Droplet doDroplet `json:"droplet"`
+	}
+	if err := c.do(ctx, "GET", "/droplets/"+id, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out.Droplet, nil
+}
+
+func (p digitalOceanProvider) Provision(ctx context.Context, req ProvisionRequest) (*ProvisionResult, error) {
+	c, err := p.client(ctx)
+	if err != nil {
+		return nil, err
+	}
+	size, image := req.Plan, req.Image
+	if size == "" {
+		size = "s-1vcpu-1gb"
+	}
+	if image == "" {
+		image = "debian-12-x64"
+	}
+	name := req.Name
+	if name == "" {
+		name = fmt.Sprintf("Stealth-DO-%s-%d", req.Region, time.Now().Unix()%10000)
+	}
+
+	var out struct {
+		Droplet doDroplet `json:"droplet"`
+	}
+	err = c.do(ctx, "POST", "/droplets", map[string]interface{}{
+		"name":      name,
+		"region":    req.Region,
+		"size":      size,
+		"image":     image,
+		"user_data": generateUserData(req.RootPassword),
+		"tags":      []string{"StealthForward"},
+	}, &out)
+	if err != nil {
+		return nil, err
+	}
+	id := strconv.Itoa(out.Droplet.ID)
+	log.Printf("[Cloud-DO] Droplet creating: %s (%s)", name, id)
+
+	ip := ""
+	err = waitFor(ctx, 60, "digitalocean droplet active", func() (bool, error) {
+		d, err := p.getDroplet(ctx, c, id)
+		if err != nil {
+			return false, err
+		}
+		ip = d.publicIP()
+		return d.Status == "active" && ip != "", nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &ProvisionResult{InstanceID: id, PublicIP: ip}, nil
+}
+
+func (p digitalOceanProvider) Terminate(ctx context.Context, region, instanceID string) error {
+	c, err := p.client(ctx)
+	if err != nil {
+		return err
+	}
+	return c.do(ctx, "DELETE", "/droplets/"+instanceID, nil, nil)
+}
+
+// waitAction 等待 DigitalOcean 异步操作完成
+func (p digitalOceanProvider) waitAction(ctx context.Context, c *restClient, actionID int) error {
+	return waitFor(ctx, 40, "digitalocean action", func() (bool, error) {
+		var out struct {
+			Action struct {
+				Status string `json:"status"`
+			} `json:"action"`
+		}
+		if err := c.do(ctx, "GET", fmt.Sprintf("/actions/%d", actionID), nil, &out); err != nil {
+			return false, err
+		}
+		if out.Action.Status == "errored" {
+			return false, fmt.Errorf("digitalocean action %d errored", actionID)
+		}
+		return out.Action.Status == "completed", nil
+	})
+}
+
+// reservedIPs 返回 Droplet ID -> 已绑定的 Reserved IP
+func (p digitalOceanProvider) reservedIPs(ctx context.Context, c *restClient) (map[int]string, error) {
+	var list struct {
+		ReservedIPs []struct {
+			IP      string `json:"ip"`
+			Droplet *struct {
+				ID int `json:"id"`
+			} `json:"droplet"`
+		} `json:"reserved_ips"`
+	}
+	if err := c.do(ctx, "GET", "/reserved_ips?per_page=200", nil, &list); err != nil {
+		return nil, err
+	}
+	reserved := make(map[int]string)
+	for _, rip := range list.ReservedIPs {
+		if rip.Droplet != nil {
+			reserved[rip.Droplet.ID] = rip.IP
+		}
+	}
+	return reserved, nil
+}
+
+// RotateIP 解绑 Droplet 当前的 Reserved IP，创建并绑定新的 Reserved IP，再删除旧的
+func (p digitalOceanProvider) RotateIP(ctx context.Context, region, instanceID string) (string, error) {
+	c, err := p.client(ctx)
+	if err != nil {
+		return "", err
+	}
+	dropletID, err := strconv.Atoi(instanceID)
+	if err != nil {
+		return "", fmt.Errorf("invalid droplet id: %s", instanceID)
+	}
+
+	reserved, err := p.reservedIPs(ctx, c)
+	if err != nil {
+		return "", err
+	}
+	oldIP := reserved[dropletID]
+
+	// 一个 Droplet 只能绑定一个 Reserved IP，先解绑旧的
+	if oldIP != "" {
+		var action struct {
+			Action struct {
+				ID int `json:"id"`
+			} `json:"action"`
+		}
+		if err := c.do(ctx, "POST", "/reserved_ips/"+oldIP+"/actions", map[string]string{"type": "unassign"}, &action); err != nil {
+			return "", fmt.Errorf("unassign old reserved ip: %v", err)
+		}
+		if err := p.waitAction(ctx, c, action.Action.ID); err != nil {
+			return "", err
+		}
+	}
+
+	var created struct {
+		ReservedIP struct {
+			IP string `json:"ip"`
+		} `json:"reserved_ip"`
+	}
+	if err := c.do(ctx, "POST", "/reserved_ips", map[string]int{"droplet_id": dropletID}, &created); err != nil {
+		if oldIP != "" {
+			// 回滚：重新绑定旧 IP
+			c.do(ctx, "POST", "/reserved_ips/"+oldIP+"/actions", map[string]interface{}{"type": "assign", "droplet_id": dropletID}, nil)
+		}
+		return "", err
+	}
+	log.Printf("[Cloud-DO] Assigned reserved IP %s to droplet %s", created.ReservedIP.IP, instanceID)
+
+	if oldIP != "" {
+		if err := c.do(ctx, "DELETE", "/reserved_ips/"+oldIP, nil, nil); err != nil {
+			log.Printf("[Cloud-DO] Warning: failed to delete old reserved IP %s: %v", oldIP, err)
+		}
+	}
+	return created.ReservedIP.IP, nil
+}
+
+// OpenPorts 在作用于该 Droplet 的云防火墙中添加入站规则；未应用防火墙的 Droplet 默认放行全部端口
+func (p digitalOceanProvider) OpenPorts(ctx context.Context, region, instanceID string, ports []PortRange) error {
+	c, err := p.client(ctx)
+	if err != nil {
+		return err
+	}
+	dropletID, err := strconv.Atoi(instanceID)
+	if err != nil {
+		return fmt.Errorf("invalid droplet id: %s", instanceID)
+	}
+	var out struct {
+		Firewalls []struct {
+			ID         string `json:"id"`
+			DropletIDs []int  `json:"droplet_ids"`
+		} `json:"firewalls"`
+	}
+	if err := c.do(ctx, "GET", "/firewalls?per_page=200", nil, &out); err != nil {
+		return err
+	}
+
+	rules := make([]map[string]interface{}, 0, len(ports))
+	for _, port := range ports {
+		rules = append(rules, map[string]interface{}{
+			"protocol": port.Protocol,
+			"ports":    portSpec(port, "-"),
+			"sources":  map[string][]string{"addresses": {"0.0.0.0/0", "::/0"}},
+		})
+	}
+	for _, fw := range out.Firewalls {
+		applied := false
+		for _, id := range fw.DropletIDs {
+			applied = applied || id == dropletID
+		}
+		if !applied {
+			continue
+		}
+		if err := c.do(ctx, "POST", "/firewalls/"+fw.ID+"/rules", map[string]interface{}{"inbound_rules": rules}, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package cloud
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestDigitalOceanProvision(t *testing.T) {
+	f, ctx := newFakeCloudAPI(t)
+	f.reply("POST /droplets", http.StatusAccepted, `{"droplet":{"id":42,"name":"edge-1","status":"new"}}`)
+	f.sequence("GET /droplets/42",
+		`{"droplet":{"id":42,"status":"new","networks":{"v4":[]}}}`,
+		`{"droplet":{"id":42,"status":"active","networks":{"v4":[{"ip_address":"10.1.0.5","type":"private"},{"ip_address":"159.65.1.2","type":"public"}]}}}`)
+
+	res, err := (digitalOceanProvider{}).Provision(ctx, ProvisionRequest{Region: "sgp1", Name: "edge-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.InstanceID != "42" || res.PublicIP != "159.65.1.2" {
+		t.Errorf("result = %+v", res)
+	}
+	body := f.body("POST /droplets")
+	if body["region"] != "sgp1" || body["size"] != "s-1vcpu-1gb" || body["image"] != "debian-12-x64" || body["user_data"] == "" {
+		t.Errorf("create body = %v", body)
+	}
+
+	f.reply("POST /droplets", http.StatusUnprocessableEntity, `{"id":"unprocessable_entity","message":"You specified an invalid size."}`)
+	_, err = (digitalOceanProvider{}).Provision(ctx, ProvisionRequest{Region: "sgp1", Plan: "huge"})
+	if err == nil || !strings.Contains(err.Error(), "HTTP 422") || !strings.Contains(err.Error(), "invalid size") {
+		t.Errorf("api error = %v", err)
+	}
+}
+
+func TestDigitalOceanListInstances(t *testing.T) {
+	f, ctx := newFakeCloudAPI(t)
+	f.reply("GET /reserved_ips", http.StatusOK, `{"reserved_ips":[{"ip":"174.138.0.9","droplet":{"id":2}},{"ip":"174.138.0.10","droplet":null}]}`)
+	f.on("GET /droplets", func(r *http.Request, _ map[string]interface{}) (int, string) {
+		if r.URL.Query().Get("page") == "1" {
+			return http.StatusOK, `{"droplets":[
+				{"id":1,"name":"a","region":{"slug":"sgp1"},"networks":{"v4":[{"ip_address":"1.1.1.1","type":"public"}]}},
+				{"id":3,"name":"c","region":{"slug":"nyc1"},"networks":{"v4":[{"ip_address":"3.3.3.3","type":"public"}]}}],
+				"links":{"pages":{"next":"https://api.digitalocean.com/v2/droplets?page=2"}}}`
+		}
+		return http.StatusOK, `{"droplets":[{"id":2,"name":"b","region":{"slug":"sgp1"},"networks":{"v4":[{"ip_address":"2.2.2.2","type":"public"}]}}],"links":{}}`
+	})
+
+	instances, err := (digitalOceanProvider{}).ListInstances(ctx, "sgp1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 按区域过滤，已绑定 Reserved IP 的 Droplet 以 Reserved IP 作为公网 IP
+	if len(instances) != 2 || instances[0].PublicIP != "1.1.1.1" || instances[1].ID != "2" || instances[1].PublicIP != "174.138.0.9" {
+		t.Errorf("instances = %+v", instances)
+	}
+
+	f.reply("GET /reserved_ips", http.StatusUnauthorized, `{"id":"unauthorized","message":"Unable to authenticate you"}`)
+	if _, err := (digitalOceanProvider{}).ListInstances(ctx, ""); err == nil || !strings.Contains(err.Error(), "Unable to authenticate") {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestDigitalOceanRotateIP(t *testing.T) {
+	f, ctx := newFakeCloudAPI(t)
+	f.reply("GET /reserved_ips", http.StatusOK, `{"reserved_ips":[{"ip":"174.138.0.9","droplet":{"id":42}}]}`)
+	f.reply("POST /reserved_ips/174.138.0.9/actions", http.StatusCreated, `{"action":{"id":7,"status":"in-progress"}}`)
+	f.sequence("GET /actions/7", `{"action":{"status":"in-progress"}}`, `{"action":{"status":"completed"}}`)
+	f.reply("POST /reserved_ips", http.StatusAccepted, `{"reserved_ip":{"ip":"174.138.0.20"}}`)
+	f.reply("DELETE /reserved_ips/174.138.0.9", http.StatusNoContent, ``)
+
+	ip, err := (digitalOceanProvider{}).RotateIP(ctx, "sgp1", "42")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ip != "174.138.0.20" {
+		t.Errorf("new ip = %s", ip)
+	}
+	if body := f.body("POST /reserved_ips/174.138.0.9/actions"); body["type"] != "unassign" {
+		t.Errorf("unassign body = %v", body)
+	}
+	if body := f.body("POST /reserved_ips"); body["droplet_id"] != float64(42) {
+		t.Errorf("create body = %v", body)
+	}
+	// 等解绑完成后再创建新 IP，最后删除旧 IP
+	if f.called("GET /actions/7") != 2 || f.order("GET /actions/7") > f.order("POST /reserved_ips") || f.called("DELETE /reserved_ips/174.138.0.9") != 1 {
+		t.Error("rotation steps out of order")
+	}
+
+	if _, err := (digitalOceanProvider{}).RotateIP(ctx, "sgp1", "droplet-42"); err == nil || !strings.Contains(err.Error(), "invalid droplet id") {
+		t.Errorf("bad id error = %v", err)
+	}
+}
+
+func TestDigitalOceanRotateIPRollback(t *testing.T) {
+	f, ctx := newFakeCloudAPI(t)
+	f.reply("GET /reserved_ips", http.StatusOK, `{"reserved_ips":[{"ip":"174.138.0.9","droplet":{"id":42}}]}`)
+	var actions []string
+	f.on("POST /reserved_ips/174.138.0.9/actions", func(_ *http.Request, body map[string]interface{}) (int, string) {
+		actions = append(actions, body["type"].(string))
+		return http.StatusCreated, `{"action":{"id":7,"status":"completed"}}`
+	})
+	f.reply("GET /actions/7", http.StatusOK, `{"action":{"status":"completed"}}`)
+	f.reply("POST /reserved_ips", http.StatusUnprocessableEntity, `{"id":"unprocessable_entity","message":"reserved ip limit reached"}`)
+
+	if _, err := (digitalOceanProvider{}).RotateIP(ctx, "sgp1", "42"); err == nil || !strings.Contains(err.Error(), "limit reached") {
+		t.Fatalf("err = %v", err)
+	}
+	// 创建新 IP 失败时重新绑定旧 IP
+	if strings.Join(actions, ",") != "unassign,assign" {
+		t.Errorf("actions = %v", actions)
+	}
+
+	f.reply("GET /actions/7", http.StatusOK, `{"action":{"status":"errored"}}`)
+	if _, err := (digitalOceanProvider{}).RotateIP(ctx, "sgp1", "42"); err == nil || !strings.Contains(err.Error(), "errored") {
+		t.Errorf("errored action = %v", err)
+	}
+}
+
+func TestDigitalOceanOpenPorts(t *testing.T) {
+	f, ctx := newFakeCloudAPI(t)
+	f.reply("GET /firewalls", http.StatusOK, `{"firewalls":[{"id":"fw-a","droplet_ids":[1,42]},{"id":"fw-b","droplet_ids":[7]}]}`)
+	f.reply("POST /firewalls/fw-a/rules", http.StatusNoContent, ``)
+
+	err := (digitalOceanProvider{}).OpenPorts(ctx, "sgp1", "42", []PortRange{{Protocol: "tcp", From: 443}, {Protocol: "udp", From: 20000, To: 20100}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules, _ := f.body("POST /firewalls/fw-a/rules")["inbound_rules"].([]interface{})
+	if len(rules) != 2 || rules[1].(map[string]interface{})["ports"] != "20000-20100" {
+		t.Errorf("inbound_rules = %v", rules)
+	}
+	if f.called("POST /firewalls/fw-b/rules") != 0 {
+		t.Error("rules added to a firewall not applied to the droplet")
+	}
+
+	f.reply("POST /firewalls/fw-a/rules", http.StatusBadRequest, `{"id":"bad_request","message":"invalid port"}`)
+	if err := (digitalOceanProvider{}).OpenPorts(ctx, "sgp1", "42", []PortRange{{Protocol: "tcp", From: 0}}); err == nil || !strings.Contains(err.Error(), "invalid port") {
+		t.Errorf("err = %v", err)
+	}
+}
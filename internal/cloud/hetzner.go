@@ -0,0 +1,413 @@
+package cloud
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const hetznerAPI = "https://api.hetzner.cloud/v1"
+
+// hetznerProvider Hetzner Cloud (换 IP 使用 Primary IP，更换时需要短暂关机)
+type hetznerProvider struct{}
+
+type hetznerServer struct {
+	ID        int    `json:"id"`
+	Name      string `json:"name"`
+	Status    string `json:"status"`
+	PublicNet struct {
+		IPv4 *struct {
+			ID int    `json:"id"`
+			IP string `json:"ip"`
+		} `json:"ipv4"`
+	} `json:"public_net"`
+	Datacenter struct {
+		Name     string `json:"name"`
+		Location struct {
+			Name string `json:"name"`
+		} `json:"location"`
+	} `json:"datacenter"`
+}
+
+func (s hetznerServer) publicIP() string {
+	if s.PublicNet.IPv4 == nil {
+		return ""
+	}
+	return s.PublicNet.IPv4.IP
+}
+
+type hetznerAction struct {
+	ID     int    `json:"id"`
+	Status string `json:"status"`
+	Error  *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (hetznerProvider) Name() string { return ProviderHetzner }
+
+func (hetznerProvider) client(ctx context.Context) (*restClient, error) {
+	return newRESTClient(ctx, ProviderHetzner, hetznerAPI, "HCLOUD_TOKEN")
+}
+
+func (p hetznerProvider) ListRegions(ctx context.Context) ([]string, error) {
+	c, err := p.client(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var out struct {
+		Locations []struct {
+			Name string `json:"name"`
+		} `json:"locations"`
+	}
+	if err := c.do(ctx, "GET", "/locations", nil, &out); err != nil {
+		return nil, err
+	}
+	regions := make([]string, 0, len(out.Locations))
+	for _, l := range out.Locations {
+		regions = append(regions, l.Name)
+	}
+	sort.Strings(regions)
+	return regions, nil
+}
+
+// ListImages 列出 x86 的 Debian / Ubuntu 系统镜像
+func (p hetznerProvider) ListImages(ctx context.Context, region string) ([]ImageInfo, error) {
+	c, err := p.client(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var out struct {
+		Images []struct {
+			Name         string `json:"name"`
+			Description  string `json:"description"`
+			OSFlavor     string `json:"os_flavor"`
+			Architecture string `json:"architecture"`
+		} `json:"images"`
+	}
+	if err := c.do(ctx, "GET", "/images?type=system&architecture=x86&per_page=50", nil, &out); err != nil {
+		return nil, err
+	}
+	var images []ImageInfo
+	for _, img := range out.Images {
+		if img.OSFlavor != "debian" && img.OSFlavor != "ubuntu" {
+			continue
+		}
+		images = append(images, ImageInfo{ID: img.Name, Name: img.Description, Description: img.OSFlavor})
+	}
+	sort.Slice(images, func(i, j int) bool { return images[i].Name < images[j].Name })
+	return images, nil
+}
+
+// ListPlans 列出在该位置有定价的服务器类型 (价格为含税月价，流量额度换算为 GB)
+func (p hetznerProvider) ListPlans(ctx context.Context, region string) ([]PlanInfo, error) {
+	c, err := p.client(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var out struct {
+		ServerTypes []struct {
+			Name         string  `json:"name"`
+			Description  string  `json:"description"`
+			Cores        int     `json:"cores"`
+			Memory       float64 `json:"memory"` // GB
+			Disk         int     `json:"disk"`
+			Architecture string  `json:"architecture"`
+			Deprecated   bool    `json:"deprecated"`
+			Prices       []struct {
+				Location        string `json:"location"`
+				IncludedTraffic int64  `json:"included_traffic"` // bytes
+				PriceMonthly    struct {
+					Gross string `json:"gross"`
+				} `json:"price_monthly"`
+			} `json:"prices"`
+		} `json:"server_types"`
+	}
+	if err := c.do(ctx, "GET", "/server_types?per_page=50", nil, &out); err != nil {
+		return nil, err
+	}
+	var plans []PlanInfo
+	for _, st := range out.ServerTypes {
+		if st.Deprecated || st.Architecture == "arm" {
+			continue
+		}
+		for _, price := range st.Prices {
+			if region != "" && price.Location != region {
+				continue
+			}
+			monthly, _ := strconv.ParseFloat(price.PriceMonthly.Gross, 64)
+			plans = append(plans, PlanInfo{
+				ID:           st.Name,
+				Name:         st.Description,
+				CPU:          st.Cores,
+				MemoryMB:     int(st.Memory * 1024),
+				DiskGB:       st.Disk,
+				TransferGB:   int(price.IncludedTraffic >> 30),
+				PriceMonthly: monthly,
+			})
+			break
+		}
+	}
+	sort.SliceStable(plans, func(i, j int) bool { return plans[i].PriceMonthly < plans[j].PriceMonthly })
+	return plans, nil
+}
+
+func (p hetznerProvider) ListInstances(ctx context.Context, region string) ([]CloudInstance, error) {
+	c, err := p.client(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var instances []CloudInstance
+	page := 1
+	for page > 0 {
+		var out struct {
+			Servers []hetznerServer `json:"servers"`
+			Meta    struct {
+				Pagination struct {
+					NextPage int `json:"next_page"`
+				} `json:"pagination"`
+			} `json:"meta"`
+		}
+		if err := c.do(ctx, "GET", fmt.Sprintf("/servers?per_page=50&page=%d", page), nil, &out); err != nil {
+			return nil, err
+		}
+		for _, s := range out.Servers {
+			location := s.Datacenter.Location.Name
+			if region != "" && location != region {
+				continue
+			}
+			instances = append(instances, CloudInstance{ID: strconv.Itoa(s.ID), Name: s.Name, PublicIP: s.publicIP(), Region: location})
+		}
+		page = out.Meta.Pagination.NextPage
+	}
+	return instances, nil
+}
+
+func (p hetznerProvider) getServer(ctx context.Context, c *restClient, id string) (*hetznerServer, error) {
+	var out struct {
+		Server hetznerServer `json:"server"`
+	}
+	if err := c.do(ctx, "GET", "/servers/"+id, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out.Server, nil
+}
+
+func (p hetznerProvider) Provision(ctx context.Context, req ProvisionRequest) (*ProvisionResult, error) {
+	c, err := p.client(ctx)
+	if err != nil {
+		return nil, err
+	}
+	serverType, image := req.Plan, req.Image
+	if serverType == "" {
+		serverType = "cx22"
+	}
+	if image == "" {
+		image = "debian-12"
+	}
+	name := req.Name
+	if name == "" {
+		name = fmt.Sprintf("stealth-hz-%s-%d", req.Region, time.Now().Unix()%10000)
+	}
+
+	var out struct {
+		Server hetznerServer `json:"server"`
+	}
+	err = c.do(ctx, "POST", "/servers", map[string]interface{}{
+		"name":        name,
+		"server_type": serverType,
+		"image":       image,
+		"location":    req.Region,
+		"user_data":   generateUserData(req.RootPassword),
+		"labels":      map[string]string{"created_by": "stealthforward"},
+	}, &out)
+	if err != nil {
+		return nil, err
+	}
+	id := strconv.Itoa(out.Server.ID)
+	log.Printf("[Cloud-Hetzner] Server creating: %s (%s)", name, id)
+
+	ip := out.Server.publicIP()
+	if ip == "" {
+		err = waitFor(ctx, 60, "hetzner server ip", func() (bool, error) {
+			s, err := p.getServer(ctx, c, id)
+			if err != nil {
+				return false, err
+			}
+			ip = s.publicIP()
+			return ip != "", nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &ProvisionResult{InstanceID: id, PublicIP: ip}, nil
+}
+
+func (p hetznerProvider) Terminate(ctx context.Context, region, instanceID string) error {
+	c, err := p.client(ctx)
+	if err != nil {
+		return err
+	}
+	return c.do(ctx, "DELETE", "/servers/"+instanceID, nil, nil)
+}
+
+// action 调用异步操作接口并等待完成
+func (p hetznerProvider) action(ctx context.Context, c *restClient, path string, body interface{}) error {
+	var out struct {
+		Action *hetznerAction `json:"action"`
+	}
+	if err := c.do(ctx, "POST", path, body, &out); err != nil {
+		return err
+	}
+	if out.Action == nil {
+		return nil
+	}
+	return p.waitAction(ctx, c, *out.Action)
+}
+
+func (p hetznerProvider) waitAction(ctx context.Context, c *restClient, action hetznerAction) error {
+	return waitFor(ctx, 40, "hetzner action", func() (bool, error) {
+		if action.Status == "running" {
+			var out struct {
+				Action hetznerAction `json:"action"`
+			}
+			if err := c.do(ctx, "GET", fmt.Sprintf("/actions/%d", action.ID), nil, &out); err != nil {
+				return false, err
+			}
+			action = out.Action
+		}
+		if action.Status == "error" {
+			msg := "unknown error"
+			if action.Error != nil {
+				msg = action.Error.Message
+			}
+			return false, fmt.Errorf("hetzner action %d failed: %s", action.ID, msg)
+		}
+		return action.Status == "success", nil
+	})
+}
+
+// RotateIP 关机后解绑旧的 Primary IP，创建并绑定新的 Primary IP，开机后删除旧 IP
+func (p hetznerProvider) RotateIP(ctx context.Context, region, instanceID string) (string, error) {
+	c, err := p.client(ctx)
+	if err != nil {
+		return "", err
+	}
+	server, err := p.getServer(ctx, c, instanceID)
+	if err != nil {
+		return "", err
+	}
+	serverID := server.ID
+
+	if err := p.action(ctx, c, "/servers/"+instanceID+"/actions/poweroff", nil); err != nil {
+		return "", fmt.Errorf("power off: %v", err)
+	}
+	defer func() {
+		if err := p.action(ctx, c, "/servers/"+instanceID+"/actions/poweron", nil); err != nil {
+			log.Printf("[Cloud-Hetzner] Warning: failed to power on server %s: %v", instanceID, err)
+		}
+	}()
+
+	oldID := 0
+	if server.PublicNet.IPv4 != nil {
+		oldID = server.PublicNet.IPv4.ID
+		if err := p.action(ctx, c, fmt.Sprintf("/primary_ips/%d/actions/unassign", oldID), nil); err != nil {
+			return "", fmt.Errorf("unassign old primary ip: %v", err)
+		}
+	}
+
+	var created struct {
+		PrimaryIP struct {
+			ID int    `json:"id"`
+			IP string `json:"ip"`
+		} `json:"primary_ip"`
+		Action *hetznerAction `json:"action"`
+	}
+	err = c.do(ctx, "POST", "/primary_ips", map[string]interface{}{
+		"name":          fmt.Sprintf("AutoRotated-%s-%d", instanceID, time.Now().Unix()),
+		"type":          "ipv4",
+		"assignee_type": "server",
+		"assignee_id":   serverID,
+		"auto_delete":   true,
+	}, &created)
+	if err == nil && created.Action != nil {
+		err = p.waitAction(ctx, c, *created.Action)
+	}
+	if err != nil {
+		if oldID > 0 {
+			// 回滚：重新绑定旧 IP
+			p.action(ctx, c, fmt.Sprintf("/primary_ips/%d/actions/assign", oldID), map[string]interface{}{"assignee_id": serverID, "assignee_type": "server"})
+		}
+		return "", err
+	}
+	log.Printf("[Cloud-Hetzner] Assigned primary IP %s to server %s", created.PrimaryIP.IP, instanceID)
+
+	if oldID > 0 {
+		if err := c.do(ctx, "DELETE", fmt.Sprintf("/primary_ips/%d", oldID), nil, nil); err != nil {
+			log.Printf("[Cloud-Hetzner] Warning: failed to delete old primary IP %d: %v", oldID, err)
+		}
+	}
+	return created.PrimaryIP.IP, nil
+}
+
+// OpenPorts 在作用于该服务器的防火墙中追加入站规则；未应用防火墙的服务器默认放行全部端口
+func (p hetznerProvider) OpenPorts(ctx context.Context, region, instanceID string, ports []PortRange) error {
+	c, err := p.client(ctx)
+	if err != nil {
+		return err
+	}
+	serverID, err := strconv.Atoi(instanceID)
+	if err != nil {
+		return fmt.Errorf("invalid server id: %s", instanceID)
+	}
+	var out struct {
+		Firewalls []struct {
+			ID        int                      `json:"id"`
+			Rules     []map[string]interface{} `json:"rules"`
+			AppliedTo []struct {
+				Type   string `json:"type"`
+				Server *struct {
+					ID int `json:"id"`
+				} `json:"server"`
+			} `json:"applied_to"`
+		} `json:"firewalls"`
+	}
+	if err := c.do(ctx, "GET", "/firewalls?per_page=50", nil, &out); err != nil {
+		return err
+	}
+
+	for _, fw := range out.Firewalls {
+		applied := false
+		for _, a := range fw.AppliedTo {
+			applied = applied || (a.Server != nil && a.Server.ID == serverID)
+		}
+		if !applied {
+			continue
+		}
+		// set_rules 会替换全部规则，因此在现有规则上追加
+		rules := fw.Rules
+		for _, port := range ports {
+			spec := portSpec(port, "-")
+			exists := false
+			for _, r := range rules {
+				exists = exists || (r["direction"] == "in" && r["protocol"] == port.Protocol && r["port"] == spec)
+			}
+			if !exists {
+				rules = append(rules, map[string]interface{}{
+					"direction":  "in",
+					"protocol":   port.Protocol,
+					"port":       spec,
+					"source_ips": []string{"0.0.0.0/0", "::/0"},
+				})
+			}
+		}
+		if err := p.action(ctx, c, fmt.Sprintf("/firewalls/%d/actions/set_rules", fw.ID), map[string]interface{}{"rules": rules}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
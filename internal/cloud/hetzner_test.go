@@ -0,0 +1,157 @@
+package cloud
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestHetznerProvision(t *testing.T) {
+	f, ctx := newFakeCloudAPI(t)
+	// 创建响应中已带公网 IP 时无需轮询
+	f.reply("POST /servers", http.StatusCreated, `{"server":{"id":9,"name":"edge-1","public_net":{"ipv4":{"id":100,"ip":"49.12.0.1"}}}}`)
+
+	res, err := (hetznerProvider{}).Provision(ctx, ProvisionRequest{Region: "fsn1", Name: "edge-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.InstanceID != "9" || res.PublicIP != "49.12.0.1" {
+		t.Errorf("result = %+v", res)
+	}
+	body := f.body("POST /servers")
+	if body["location"] != "fsn1" || body["server_type"] != "cx22" || body["image"] != "debian-12" {
+		t.Errorf("create body = %v", body)
+	}
+	if f.called("GET /servers/9") != 0 {
+		t.Error("polled although the create response had an ip")
+	}
+
+	f.reply("POST /servers", http.StatusCreated, `{"server":{"id":10,"public_net":{"ipv4":null}}}`)
+	f.sequence("GET /servers/10", `{"server":{"id":10,"public_net":{"ipv4":null}}}`, `{"server":{"id":10,"public_net":{"ipv4":{"id":101,"ip":"49.12.0.2"}}}}`)
+	if res, err = (hetznerProvider{}).Provision(ctx, ProvisionRequest{Region: "fsn1"}); err != nil || res.PublicIP != "49.12.0.2" {
+		t.Errorf("polled provision = %+v, %v", res, err)
+	}
+
+	f.reply("POST /servers", http.StatusConflict, `{"error":{"code":"uniqueness_error","message":"server name is already used"}}`)
+	_, err = (hetznerProvider{}).Provision(ctx, ProvisionRequest{Region: "fsn1", Name: "edge-1"})
+	if err == nil || !strings.Contains(err.Error(), "HTTP 409") || !strings.Contains(err.Error(), "uniqueness_error: server name is already used") {
+		t.Errorf("api error = %v", err)
+	}
+}
+
+func TestHetznerListInstances(t *testing.T) {
+	f, ctx := newFakeCloudAPI(t)
+	f.on("GET /servers", func(r *http.Request, _ map[string]interface{}) (int, string) {
+		if r.URL.Query().Get("page") == "1" {
+			return http.StatusOK, `{"servers":[
+				{"id":1,"name":"a","public_net":{"ipv4":{"ip":"1.1.1.1"}},"datacenter":{"location":{"name":"fsn1"}}},
+				{"id":2,"name":"b","public_net":{"ipv4":{"ip":"2.2.2.2"}},"datacenter":{"location":{"name":"hel1"}}}],
+				"meta":{"pagination":{"next_page":2}}}`
+		}
+		return http.StatusOK, `{"servers":[{"id":3,"name":"c","public_net":{"ipv4":null},"datacenter":{"location":{"name":"fsn1"}}}],"meta":{"pagination":{"next_page":null}}}`
+	})
+
+	instances, err := (hetznerProvider{}).ListInstances(ctx, "fsn1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(instances) != 2 || instances[0].ID != "1" || instances[1].ID != "3" || instances[1].PublicIP != "" {
+		t.Errorf("instances = %+v", instances)
+	}
+}
+
+// hetznerRotateRoutes 注册换 IP 流程的公共路由 (关机 -> 解绑旧 IP -> 创建新 IP -> 开机)
+func hetznerRotateRoutes(f *fakeCloudAPI) {
+	f.reply("GET /servers/9", http.StatusOK, `{"server":{"id":9,"public_net":{"ipv4":{"id":100,"ip":"49.12.0.1"}}}}`)
+	f.reply("POST /servers/9/actions/poweroff", http.StatusCreated, `{"action":{"id":1,"status":"running"}}`)
+	f.sequence("GET /actions/1", `{"action":{"id":1,"status":"running"}}`, `{"action":{"id":1,"status":"success"}}`)
+	f.reply("POST /primary_ips/100/actions/unassign", http.StatusCreated, `{"action":{"id":2,"status":"success"}}`)
+	f.reply("POST /servers/9/actions/poweron", http.StatusCreated, `{"action":{"id":3,"status":"success"}}`)
+}
+
+func TestHetznerRotateIP(t *testing.T) {
+	f, ctx := newFakeCloudAPI(t)
+	hetznerRotateRoutes(f)
+	f.reply("POST /primary_ips", http.StatusCreated, `{"primary_ip":{"id":101,"ip":"49.12.0.9"},"action":{"id":4,"status":"success"}}`)
+	f.reply("DELETE /primary_ips/100", http.StatusNoContent, ``)
+
+	ip, err := (hetznerProvider{}).RotateIP(ctx, "fsn1", "9")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ip != "49.12.0.9" {
+		t.Errorf("new ip = %s", ip)
+	}
+	body := f.body("POST /primary_ips")
+	if body["assignee_id"] != float64(9) || body["assignee_type"] != "server" || body["type"] != "ipv4" {
+		t.Errorf("create body = %v", body)
+	}
+	if f.called("GET /actions/1") != 2 {
+		t.Error("did not wait for power off")
+	}
+	steps := []string{"POST /servers/9/actions/poweroff", "POST /primary_ips/100/actions/unassign", "POST /primary_ips", "DELETE /primary_ips/100", "POST /servers/9/actions/poweron"}
+	for i := 1; i < len(steps); i++ {
+		if f.order(steps[i-1]) < 0 || f.order(steps[i-1]) > f.order(steps[i]) {
+			t.Errorf("%s should come before %s", steps[i-1], steps[i])
+		}
+	}
+}
+
+func TestHetznerRotateIPRollback(t *testing.T) {
+	f, ctx := newFakeCloudAPI(t)
+	hetznerRotateRoutes(f)
+	f.reply("POST /primary_ips", http.StatusUnprocessableEntity, `{"error":{"code":"resource_limit_exceeded","message":"primary ip limit exceeded"}}`)
+	f.reply("POST /primary_ips/100/actions/assign", http.StatusCreated, `{"action":{"id":5,"status":"success"}}`)
+
+	_, err := (hetznerProvider{}).RotateIP(ctx, "fsn1", "9")
+	if err == nil || !strings.Contains(err.Error(), "resource_limit_exceeded") {
+		t.Fatalf("err = %v", err)
+	}
+	// 失败时重新绑定旧 IP，且服务器仍会开机
+	if body := f.body("POST /primary_ips/100/actions/assign"); body["assignee_id"] != float64(9) {
+		t.Errorf("rollback body = %v", body)
+	}
+	if f.called("POST /servers/9/actions/poweron") != 1 || f.called("DELETE /primary_ips/100") != 0 {
+		t.Error("failed rotation must power the server back on and keep the old ip")
+	}
+}
+
+func TestHetznerActionError(t *testing.T) {
+	f, ctx := newFakeCloudAPI(t)
+	f.reply("GET /servers/9", http.StatusOK, `{"server":{"id":9}}`)
+	f.reply("POST /servers/9/actions/poweroff", http.StatusCreated, `{"action":{"id":1,"status":"error","error":{"message":"server is locked"}}}`)
+	f.reply("POST /servers/9/actions/poweron", http.StatusCreated, `{"action":{"id":3,"status":"success"}}`)
+
+	if _, err := (hetznerProvider{}).RotateIP(ctx, "fsn1", "9"); err == nil || !strings.Contains(err.Error(), "server is locked") {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestHetznerOpenPorts(t *testing.T) {
+	f, ctx := newFakeCloudAPI(t)
+	f.reply("GET /firewalls", http.StatusOK, `{"firewalls":[
+		{"id":5,"rules":[{"direction":"in","protocol":"tcp","port":"443","source_ips":["0.0.0.0/0"]}],"applied_to":[{"type":"server","server":{"id":9}}]},
+		{"id":6,"rules":[],"applied_to":[{"type":"label_selector"}]}]}`)
+	f.reply("POST /firewalls/5/actions/set_rules", http.StatusCreated, `{"actions":[]}`)
+
+	err := (hetznerProvider{}).OpenPorts(ctx, "fsn1", "9", []PortRange{{Protocol: "tcp", From: 443}, {Protocol: "udp", From: 20000, To: 20100}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// set_rules 替换全部规则：保留已有规则，已存在的端口不重复添加
+	rules, _ := f.body("POST /firewalls/5/actions/set_rules")["rules"].([]interface{})
+	if len(rules) != 2 || rules[1].(map[string]interface{})["port"] != "20000-20100" {
+		t.Errorf("rules = %v", rules)
+	}
+	if f.called("POST /firewalls/6/actions/set_rules") != 0 {
+		t.Error("rules set on a firewall not applied to the server")
+	}
+
+	if err := (hetznerProvider{}).OpenPorts(ctx, "fsn1", "srv-9", nil); err == nil || !strings.Contains(err.Error(), "invalid server id") {
+		t.Errorf("bad id error = %v", err)
+	}
+	f.reply("POST /firewalls/5/actions/set_rules", http.StatusUnprocessableEntity, `{"error":{"code":"invalid_input","message":"invalid port"}}`)
+	if err := (hetznerProvider{}).OpenPorts(ctx, "fsn1", "9", []PortRange{{Protocol: "tcp", From: 8443}}); err == nil || !strings.Contains(err.Error(), "invalid_input") {
+		t.Errorf("err = %v", err)
+	}
+}
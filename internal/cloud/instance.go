@@ -23,11 +23,13 @@ type CreateInstanceRequest struct {
 	InstanceType string `json:"instance_type"` // e.g. t3.micro
 	ImageID      string `json:"image_id"`      // Optional: Specific AMI ID
 	RootPassword string `json:"root_password"`
+	AccountID    uint   `json:"account_id"` // 可选：指定云账号，为 0 时按策略从账号池选择
 }
 
 type CreateInstanceResponse struct {
 	InstanceID string `json:"instance_id"`
 	PublicIP   string `json:"public_ip"`
+	AccountID  uint   `json:"account_id"` // 实例所在的云账号 (需绑定到入口)
 }
 
 // ProvisionInstance 创建新实例 (Debian 12 + Root Login)
@@ -158,7 +160,12 @@ func TerminateInstance(ctx context.Context, region, instanceID string) error {
 
 // Helper: Load AWS Config
 func loadAWSConfig(ctx context.Context, region string) (aws.Config, error) {
-	// DB -> Env
+	// 账号池: context 中指定的账号
+	if account := accountFrom(ctx); account != nil {
+		return staticAWSConfig(ctx, region, account.AccessKey, account.SecretKey)
+	}
+
+	// 单一密钥: DB -> Env
 	var settings []models.SystemSetting
 	configMap := make(map[string]string)
 	if err := database.DB.Find(&settings).Error; err == nil {
@@ -174,7 +181,11 @@ func loadAWSConfig(ctx context.Context, region string) (aws.Config, error) {
 		// Fallback to Env or Shared Config
 		return config.LoadDefaultConfig(ctx, config.WithRegion(region))
 	}
+	return staticAWSConfig(ctx, region, ak, sk)
+}
 
+// staticAWSConfig 使用静态 AK/SK 构造 AWS 配置
+func staticAWSConfig(ctx context.Context, region, ak, sk string) (aws.Config, error) {
 	return config.LoadDefaultConfig(ctx,
 		config.WithRegion(region),
 		config.WithCredentialsProvider(aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
@@ -243,14 +254,8 @@ func ListRegions(ctx context.Context) ([]string, error) {
 	return regions, nil
 }
 
-type AMIInfo struct {
-	ID          string `json:"id"`
-	Name        string `json:"name"`
-	Description string `json:"description"`
-}
-
 // ListFeaturedImages 获取指定区域的推荐镜像
-func ListFeaturedImages(ctx context.Context, region string) ([]AMIInfo, error) {
+func ListFeaturedImages(ctx context.Context, region string) ([]ImageInfo, error) {
 	cfg, err := loadAWSConfig(ctx, region)
 	if err != nil {
 		return nil, err
@@ -306,13 +311,13 @@ func ListFeaturedImages(ctx context.Context, region string) ([]AMIInfo, error) {
 		}
 	}
 
-	var result []AMIInfo
+	var result []ImageInfo
 	for k, img := range latestMap {
 		desc := ""
 		if img.Description != nil {
 			desc = *img.Description
 		}
-		result = append(result, AMIInfo{
+		result = append(result, ImageInfo{
 			ID:          *img.ImageId,
 			Name:        k,    // Use Friendly Name
 			Description: desc, // Raw desc
@@ -423,6 +428,7 @@ func ListEC2Instances(ctx context.Context, region string) ([]CloudInstance, erro
 				ID:       *inst.InstanceId,
 				Name:     name,
 				PublicIP: publicIP,
+				Region:   region,
 			})
 		}
 	}
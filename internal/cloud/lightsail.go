@@ -164,11 +164,13 @@ type CreateLightsailRequest struct {
 	BlueprintID  string `json:"blueprint_id"`  // e.g. debian_12
 	InstanceName string `json:"instance_name"` // optional
 	RootPassword string `json:"root_password"`
+	AccountID    uint   `json:"account_id"` // 可选：指定云账号，为 0 时按策略从账号池选择
 }
 
 type CreateLightsailResponse struct {
 	InstanceName string `json:"instance_name"`
 	PublicIP     string `json:"public_ip"`
+	AccountID    uint   `json:"account_id"` // 实例所在的云账号 (需绑定到入口)
 }
 
 // ProvisionLightsailInstance 创建光帆实例
@@ -430,23 +432,6 @@ func RotateLightsailIP(ctx context.Context, region, instanceName string) (string
 	return "", fmt.Errorf("ip allocated but failed to fetch address")
 }
 
-// RotateLightsailIPWithDNS 换 IP 并更新 DNS
-func RotateLightsailIPWithDNS(ctx context.Context, region, instanceName, zoneName, recordName string) (string, error) {
-	newIP, err := RotateLightsailIP(ctx, region, instanceName)
-	if err != nil {
-		return "", err
-	}
-
-	if zoneName != "" && recordName != "" {
-		if err := UpdateCloudflareDNS(ctx, zoneName, recordName, newIP); err != nil {
-			log.Printf("[Cloud-LS] DNS update failed for %s: %v", instanceName, err)
-			return newIP, fmt.Errorf("ip rotated to %s but dns update failed: %v", newIP, err)
-		}
-	}
-
-	return newIP, nil
-}
-
 // ListLightsailInstances 列出指定区域的所有 Lightsail 实例
 func ListLightsailInstances(ctx context.Context, region string) ([]CloudInstance, error) {
 	client, err := GetLightsailClient(ctx, region)
@@ -465,7 +450,41 @@ func ListLightsailInstances(ctx context.Context, region string) ([]CloudInstance
 			ID:       aws.ToString(inst.Name),
 			Name:     aws.ToString(inst.Name),
 			PublicIP: aws.ToString(inst.PublicIpAddress),
+			Region:   region,
 		})
 	}
 	return instances, nil
 }
+
+// GetLightsailTransferAllowance 返回光帆实例每月的流量额度 (GB)
+// 优先读取实例上的额度，取不到时按实例套餐在套餐列表中查找
+func GetLightsailTransferAllowance(ctx context.Context, region, instanceName string) (int64, error) {
+	client, err := GetLightsailClient(ctx, region)
+	if err != nil {
+		return 0, err
+	}
+	out, err := client.GetInstance(ctx, &lightsail.GetInstanceInput{InstanceName: aws.String(instanceName)})
+	if err != nil {
+		return 0, fmt.Errorf("instance not found: %v", err)
+	}
+	inst := out.Instance
+	if inst == nil {
+		return 0, fmt.Errorf("instance not found: %s", instanceName)
+	}
+	if inst.Networking != nil && inst.Networking.MonthlyTransfer != nil {
+		if gb := aws.ToInt32(inst.Networking.MonthlyTransfer.GbPerMonthAllocated); gb > 0 {
+			return int64(gb), nil
+		}
+	}
+
+	bundles, err := ListLightsailBundles(ctx, region)
+	if err != nil {
+		return 0, err
+	}
+	for _, b := range bundles {
+		if b.ID == aws.ToString(inst.BundleId) {
+			return int64(b.Transfer), nil
+		}
+	}
+	return 0, fmt.Errorf("bundle %s not found", aws.ToString(inst.BundleId))
+}
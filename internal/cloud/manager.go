@@ -4,61 +4,17 @@ import (
 	"context"
 	"fmt"
 	"log"
-	"os"
-	"strings"
 	"sync"
-	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
 	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
-	"github.com/cloudflare/cloudflare-go"
-	"github.com/wangn9900/StealthForward/internal/database"
-	"github.com/wangn9900/StealthForward/internal/models"
 )
 
-// RotateIPForInstance 核心业务逻辑：换 EC2 IP 并更新 Cloudflare DNS
-// 返回新 IP，或者错误
-func RotateIPForInstance(ctx context.Context, region, instanceID, zoneName, recordName string) (string, error) {
-	// 0. 读取 AWS 配置 (DB -> Env)
-	var settings []models.SystemSetting
-	configMap := make(map[string]string)
-	if err := database.DB.Find(&settings).Error; err == nil {
-		for _, s := range settings {
-			configMap[s.Key] = s.Value
-		}
-	}
-
-	ak := configMap[models.ConfigKeyAwsAccessKeyID]
-	if ak == "" {
-		ak = os.Getenv("AWS_ACCESS_KEY_ID")
-	}
-	sk := configMap[models.ConfigKeyAwsSecretAccessKey]
-	if sk == "" {
-		sk = os.Getenv("AWS_SECRET_ACCESS_KEY")
-	}
-
-	// 1. 初始化 AWS
-	var cfg aws.Config
-	var err error
-
-	if ak != "" && sk != "" {
-		// 使用静态凭证
-		cfg, err = config.LoadDefaultConfig(ctx,
-			config.WithRegion(region),
-			config.WithCredentialsProvider(aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
-				return aws.Credentials{
-					AccessKeyID:     ak,
-					SecretAccessKey: sk,
-				}, nil
-			})),
-		)
-	} else {
-		// 回退到默认链
-		cfg, err = config.LoadDefaultConfig(ctx, config.WithRegion(region))
-	}
-
+// rotateEC2Address 为 EC2 实例申请并绑定新的弹性 IP，释放旧的弹性 IP，返回新 IP
+func rotateEC2Address(ctx context.Context, region, instanceID string) (string, error) {
+	// 1. 初始化 AWS (账号池中的账号或单一密钥)
+	cfg, err := loadAWSConfig(ctx, region)
 	if err != nil {
 		return "", fmt.Errorf("aws load config error: %v", err)
 	}
@@ -71,7 +27,7 @@ func RotateIPForInstance(ctx context.Context, region, instanceID, zoneName, reco
 			{
 				ResourceType: types.ResourceTypeElasticIp,
 				Tags: []types.Tag{
-					{Key: aws.String("Name"), Value: aws.String("AutoRotated-" + recordName)},
+					{Key: aws.String("Name"), Value: aws.String("AutoRotated-" + instanceID)},
 					{Key: aws.String("CreatedBy"), Value: aws.String("StealthController")},
 				},
 			},
@@ -133,174 +89,64 @@ func RotateIPForInstance(ctx context.Context, region, instanceID, zoneName, reco
 		log.Printf("[Cloud] Review: No old EIP found to release. Was using standard public IP?")
 	}
 
-	// 6. 更新 Cloudflare DNS
-	if zoneName != "" && recordName != "" {
-		err = UpdateCloudflareDNS(ctx, zoneName, recordName, newPublicIP)
-		if err != nil {
-			log.Printf("[Cloud] Error updating DNS (but IP rotated): %v", err)
-			return newPublicIP, fmt.Errorf("ip rotated to %s but dns update failed: %v", newPublicIP, err)
-		}
-		log.Printf("[Cloud] Updated Cloudflare DNS %s.%s -> %s", recordName, zoneName, newPublicIP)
-	}
-
 	return newPublicIP, nil
 }
 
-// UpdateCloudflareDNS 更新 A 记录
-func UpdateCloudflareDNS(ctx context.Context, zoneName, recordName, newIP string) error {
-	// 读取 CF Token
-	var setting models.SystemSetting
-	var apiToken string
-	if err := database.DB.Where("key = ?", models.ConfigKeyCfApiToken).First(&setting).Error; err == nil {
-		apiToken = setting.Value
-	}
-	if apiToken == "" {
-		apiToken = os.Getenv("CF_API_TOKEN")
-	}
-
-	if apiToken == "" {
-		return fmt.Errorf("CF_API_TOKEN environment variable not set (or not in db)")
-	}
-
-	api, err := cloudflare.NewWithAPIToken(apiToken)
-	if err != nil {
-		return err
-	}
-
-	// 获取 Zone ID
-	zoneID, err := api.ZoneIDByName(zoneName)
-	if err != nil {
-		return fmt.Errorf("cf get zone id error: %v", err)
-	}
-
-	// 查找 A 记录
-	// 不同的库版本 ListDNSRecords 参数可能不同，这里尝试通用写法
-	// recordName 通常是子域名，比如 "transitnodeawjp"
-	// Full name = transitnodeawjp.2233006.xyz
-	fullRecordName := recordName
-	if !strings.HasSuffix(recordName, zoneName) {
-		fullRecordName = fmt.Sprintf("%s.%s", recordName, zoneName)
-	}
-
-	stats, _, err := api.ListDNSRecords(ctx, cloudflare.ZoneIdentifier(zoneID), cloudflare.ListDNSRecordsParams{
-		Type: "A",
-		Name: fullRecordName,
-	})
-	if err != nil {
-		return fmt.Errorf("cf list records error: %v", err)
-	}
-
-	if len(stats) == 0 {
-		return fmt.Errorf("dns record %s not found", fullRecordName)
-	}
-
-	recordID := stats[0].ID
-
-	// 更新记录
-	_, err = api.UpdateDNSRecord(ctx, cloudflare.ZoneIdentifier(zoneID), cloudflare.UpdateDNSRecordParams{
-		ID:      recordID,
-		Content: newIP,
-		Type:    "A",
-		Name:    fullRecordName,
-		Proxied: stats[0].Proxied, // 保持原有的 Proxy 状态 (通常为 false)
-		TTL:     stats[0].TTL,
-		Comment: aws.String("Auto rotated by StealthController at " + time.Now().Format(time.RFC3339)),
-	})
-
-	return err
-}
-
 // CloudInstance 代表通用的云实例信息，用于前端选择
 type CloudInstance struct {
 	ID       string `json:"id"`
 	Name     string `json:"name"`
 	PublicIP string `json:"public_ip"`
+	Region   string `json:"region,omitempty"`
 }
 
-// AutoDetectCloudInstance 根据公网 IP 自动检测云平台、区域和实例 ID
-func AutoDetectCloudInstance(ctx context.Context, ip string) (string, string, string, error) {
-	// 1. 获取所有区域 (EC2)
-	regions, err := ListRegions(ctx)
-	if err != nil {
-		return "", "", "", fmt.Errorf("failed to list regions: %v", err)
-	}
-
-	type detectResult struct {
-		provider   string
-		region     string
-		instanceID string
-	}
-
-	resChan := make(chan detectResult, 1)
-	ctx, cancel := context.WithCancel(ctx)
-	defer cancel()
-
-	var wg sync.WaitGroup
-
-	// 并发搜索所有 EC2 区域
-	for _, r := range regions {
-		wg.Add(1)
-		go func(reg string) {
-			defer wg.Done()
-			insts, err := ListEC2Instances(ctx, reg)
-			if err != nil {
-				return
+// AutoDetectCloudInstance 根据公网 IP 在各云平台、账号池的各个账号中检测实例所在的平台、区域、实例 ID 与账号
+// 账号池为空的平台使用单一密钥，此时返回的账号 ID 为 0
+func AutoDetectCloudInstance(ctx context.Context, ip string) (provider, region, instanceID string, accountID uint, err error) {
+	for _, name := range Providers() {
+		p := providers[name]
+		for _, account := range poolAccounts(AccountProvider(name)) {
+			actx, id := ctx, uint(0)
+			if account != nil {
+				actx, id = WithAccount(ctx, account), account.ID
 			}
-			for _, inst := range insts {
+			instances, listErr := p.ListInstances(actx, "")
+			if listErr != nil {
+				continue
+			}
+			for _, inst := range instances {
 				if inst.PublicIP == ip {
-					select {
-					case resChan <- detectResult{"aws_ec2", reg, inst.ID}:
-						cancel()
-					default:
-					}
-					return
+					return name, inst.Region, inst.ID, id, nil
 				}
 			}
-		}(r)
+		}
+		if ctx.Err() != nil {
+			return "", "", "", 0, ctx.Err()
+		}
 	}
+	return "", "", "", 0, fmt.Errorf("在所有云平台账号中未找到 IP 为 %s 的云实例", ip)
+}
 
-	// 并发搜索所有 Lightsail 区域 (Lightsail 区域列表可能与 EC2 不同)
-	lsRegions, _ := ListLightsailRegions(ctx)
-	for _, r := range lsRegions {
+// listAllRegions 并发列出所有区域的实例 (单个区域失败时忽略)，用于 AWS 这类按区域调用的平台
+func listAllRegions(ctx context.Context, regions []string, list func(ctx context.Context, region string) ([]CloudInstance, error)) []CloudInstance {
+	var (
+		mu        sync.Mutex
+		wg        sync.WaitGroup
+		instances []CloudInstance
+	)
+	for _, r := range regions {
 		wg.Add(1)
-		go func(reg string) {
+		go func(region string) {
 			defer wg.Done()
-			insts, err := ListLightsailInstances(ctx, reg)
+			insts, err := list(ctx, region)
 			if err != nil {
 				return
 			}
-			for _, inst := range insts {
-				if inst.PublicIP == ip {
-					select {
-					case resChan <- detectResult{"aws_lightsail", reg, inst.ID}:
-						cancel()
-					default:
-					}
-					return
-				}
-			}
+			mu.Lock()
+			instances = append(instances, insts...)
+			mu.Unlock()
 		}(r)
 	}
-
-	// 等待所有扫描完成或找到结果
-	done := make(chan struct{})
-	go func() {
-		wg.Wait()
-		close(done)
-	}()
-
-	select {
-	case res := <-resChan:
-		return res.provider, res.region, res.instanceID, nil
-	case <-done:
-		return "", "", "", fmt.Errorf("在所有账户区域中未找到 IP 为 %s 的云实例", ip)
-	case <-ctx.Done():
-		// 如果是通过 cancel() 触发的，可能已经有结果在 channel 里
-		select {
-		case res := <-resChan:
-			return res.provider, res.region, res.instanceID, nil
-		default:
-			return "", "", "", ctx.Err()
-		}
-	}
+	wg.Wait()
+	return instances
 }
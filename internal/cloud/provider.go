@@ -0,0 +1,131 @@
+package cloud
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrRotateNotSupported 云平台无法为已有实例更换可达的公网 IP
+var ErrRotateNotSupported = errors.New("ip rotation is not supported")
+
+// 云平台类型 (与 EntryNode.CloudProvider 一致)
+const (
+	ProviderAWSEC2       = "aws_ec2"
+	ProviderAWSLightsail = "aws_lightsail"
+	ProviderVultr        = "vultr"
+	ProviderDigitalOcean = "digitalocean"
+	ProviderHetzner      = "hetzner"
+)
+
+// Provider 云平台接口：创建/销毁/列出实例、换 IP、查询区域/镜像/套餐、开放端口。
+// 凭证由 context 中的云账号提供 (见 WithAccount)，region 为空时 ListInstances 返回所有区域的实例
+type Provider interface {
+	Name() string
+	ListRegions(ctx context.Context) ([]string, error)
+	ListImages(ctx context.Context, region string) ([]ImageInfo, error)
+	ListPlans(ctx context.Context, region string) ([]PlanInfo, error)
+	ListInstances(ctx context.Context, region string) ([]CloudInstance, error)
+	Provision(ctx context.Context, req ProvisionRequest) (*ProvisionResult, error)
+	Terminate(ctx context.Context, region, instanceID string) error
+	// RotateIP 为实例更换公网 IP，返回新 IP (不更新 DNS)；无法更换时返回 ErrRotateNotSupported
+	RotateIP(ctx context.Context, region, instanceID string) (string, error)
+	// OpenPorts 在实例的防火墙/安全组中放行端口；实例未启用防火墙时不做任何操作
+	OpenPorts(ctx context.Context, region, instanceID string, ports []PortRange) error
+}
+
+// ImageInfo 系统镜像
+type ImageInfo struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// PlanInfo 实例套餐/规格
+type PlanInfo struct {
+	ID           string  `json:"id"`
+	Name         string  `json:"name"`
+	CPU          int     `json:"cpu"`
+	MemoryMB     int     `json:"memory_mb"`
+	DiskGB       int     `json:"disk_gb"`
+	TransferGB   int     `json:"transfer_gb"`   // 每月流量额度，0 表示未知或按量计费
+	PriceMonthly float64 `json:"price_monthly"` // 美元/欧元，0 表示未知
+}
+
+// ProvisionRequest 通用的创建实例请求
+type ProvisionRequest struct {
+	Region       string `json:"region"`
+	Plan         string `json:"plan"`  // 套餐/规格，为空使用各平台默认的最小规格
+	Image        string `json:"image"` // 镜像，为空使用 Debian 12
+	Name         string `json:"name"`  // 实例名，为空自动生成
+	RootPassword string `json:"root_password"`
+	AccountID    uint   `json:"account_id"` // 可选：指定云账号，为 0 时按策略从账号池选择
+}
+
+// ProvisionResult 创建实例的结果
+type ProvisionResult struct {
+	InstanceID string `json:"instance_id"`
+	PublicIP   string `json:"public_ip"`
+	AccountID  uint   `json:"account_id"` // 实例所在的云账号 (需绑定到入口)
+}
+
+// PortRange 需要放行的端口范围
+type PortRange struct {
+	Protocol string `json:"protocol"` // tcp, udp
+	From     int    `json:"from"`
+	To       int    `json:"to"` // 为 0 时等于 From
+}
+
+func (p PortRange) to() int {
+	if p.To == 0 {
+		return p.From
+	}
+	return p.To
+}
+
+var (
+	providers     = make(map[string]Provider)
+	providerOrder []string
+)
+
+// Register 注册云平台实现
+func Register(p Provider) {
+	if _, ok := providers[p.Name()]; !ok {
+		providerOrder = append(providerOrder, p.Name())
+	}
+	providers[p.Name()] = p
+}
+
+// GetProvider 按名称返回云平台实现；为空时为 aws_ec2 (早期入口未记录平台类型)
+func GetProvider(name string) (Provider, error) {
+	if name == "" {
+		name = ProviderAWSEC2
+	}
+	p, ok := providers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown cloud provider: %s", name)
+	}
+	return p, nil
+}
+
+// Providers 返回已注册的云平台名称 (按注册顺序)
+func Providers() []string {
+	return append([]string(nil), providerOrder...)
+}
+
+func init() {
+	Register(ec2Provider{})
+	Register(lightsailProvider{})
+	Register(vultrProvider{})
+	Register(digitalOceanProvider{})
+	Register(hetznerProvider{})
+}
+
+// RotateIP 按云平台类型更换实例 IP (DNS 解析由调用方更新)
+func RotateIP(ctx context.Context, provider, region, instanceID string) (string, error) {
+	p, err := GetProvider(provider)
+	if err != nil {
+		return "", err
+	}
+	return p.RotateIP(ctx, region, instanceID)
+}
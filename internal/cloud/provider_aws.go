@@ -0,0 +1,242 @@
+package cloud
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/lightsail"
+	lstypes "github.com/aws/aws-sdk-go-v2/service/lightsail/types"
+)
+
+// ec2Provider AWS EC2 (换 IP 使用弹性 IP)
+type ec2Provider struct{}
+
+func (ec2Provider) Name() string { return ProviderAWSEC2 }
+
+func (ec2Provider) ListRegions(ctx context.Context) ([]string, error) {
+	return ListRegions(ctx)
+}
+
+func (ec2Provider) ListImages(ctx context.Context, region string) ([]ImageInfo, error) {
+	return ListFeaturedImages(ctx, region)
+}
+
+// ListPlans 列出当前一代的突发性能实例规格 (t2/t3/t3a，x86_64)
+func (ec2Provider) ListPlans(ctx context.Context, region string) ([]PlanInfo, error) {
+	cfg, err := loadAWSConfig(ctx, region)
+	if err != nil {
+		return nil, err
+	}
+	client := ec2.NewFromConfig(cfg)
+
+	var plans []PlanInfo
+	paginator := ec2.NewDescribeInstanceTypesPaginator(client, &ec2.DescribeInstanceTypesInput{
+		Filters: []ec2types.Filter{
+			{Name: aws.String("instance-type"), Values: []string{"t2.*", "t3.*", "t3a.*"}},
+			{Name: aws.String("processor-info.supported-architecture"), Values: []string{"x86_64"}},
+		},
+	})
+	for paginator.HasMorePages() {
+		out, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, it := range out.InstanceTypes {
+			plan := PlanInfo{ID: string(it.InstanceType), Name: string(it.InstanceType)}
+			if it.VCpuInfo != nil {
+				plan.CPU = int(aws.ToInt32(it.VCpuInfo.DefaultVCpus))
+			}
+			if it.MemoryInfo != nil {
+				plan.MemoryMB = int(aws.ToInt64(it.MemoryInfo.SizeInMiB))
+			}
+			plans = append(plans, plan)
+		}
+	}
+	sort.Slice(plans, func(i, j int) bool {
+		if plans[i].MemoryMB != plans[j].MemoryMB {
+			return plans[i].MemoryMB < plans[j].MemoryMB
+		}
+		return plans[i].ID < plans[j].ID
+	})
+	return plans, nil
+}
+
+func (ec2Provider) ListInstances(ctx context.Context, region string) ([]CloudInstance, error) {
+	if region != "" {
+		return ListEC2Instances(ctx, region)
+	}
+	regions, err := ListRegions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return listAllRegions(ctx, regions, ListEC2Instances), nil
+}
+
+func (ec2Provider) Provision(ctx context.Context, req ProvisionRequest) (*ProvisionResult, error) {
+	instanceType := req.Plan
+	if instanceType == "" {
+		instanceType = "t3.micro"
+	}
+	res, err := ProvisionInstance(ctx, CreateInstanceRequest{
+		Region:       req.Region,
+		InstanceType: instanceType,
+		ImageID:      req.Image,
+		RootPassword: req.RootPassword,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &ProvisionResult{InstanceID: res.InstanceID, PublicIP: res.PublicIP}, nil
+}
+
+func (ec2Provider) Terminate(ctx context.Context, region, instanceID string) error {
+	return TerminateInstance(ctx, region, instanceID)
+}
+
+func (ec2Provider) RotateIP(ctx context.Context, region, instanceID string) (string, error) {
+	return rotateEC2Address(ctx, region, instanceID)
+}
+
+// OpenPorts 在实例的第一个安全组中放行端口 (已存在的规则忽略)
+func (ec2Provider) OpenPorts(ctx context.Context, region, instanceID string, ports []PortRange) error {
+	cfg, err := loadAWSConfig(ctx, region)
+	if err != nil {
+		return err
+	}
+	client := ec2.NewFromConfig(cfg)
+
+	desc, err := client.DescribeInstances(ctx, &ec2.DescribeInstancesInput{InstanceIds: []string{instanceID}})
+	if err != nil {
+		return err
+	}
+	if len(desc.Reservations) == 0 || len(desc.Reservations[0].Instances) == 0 {
+		return fmt.Errorf("instance %s not found", instanceID)
+	}
+	groups := desc.Reservations[0].Instances[0].SecurityGroups
+	if len(groups) == 0 {
+		return fmt.Errorf("instance %s has no security group", instanceID)
+	}
+
+	for _, p := range ports {
+		_, err := client.AuthorizeSecurityGroupIngress(ctx, &ec2.AuthorizeSecurityGroupIngressInput{
+			GroupId: groups[0].GroupId,
+			IpPermissions: []ec2types.IpPermission{{
+				IpProtocol: aws.String(p.Protocol),
+				FromPort:   aws.Int32(int32(p.From)),
+				ToPort:     aws.Int32(int32(p.to())),
+				IpRanges:   []ec2types.IpRange{{CidrIp: aws.String("0.0.0.0/0")}},
+			}},
+		})
+		if err != nil && !strings.Contains(err.Error(), "InvalidPermission.Duplicate") {
+			return err
+		}
+	}
+	return nil
+}
+
+// lightsailProvider AWS Lightsail (换 IP 使用静态 IP)
+type lightsailProvider struct{}
+
+func (lightsailProvider) Name() string { return ProviderAWSLightsail }
+
+func (lightsailProvider) ListRegions(ctx context.Context) ([]string, error) {
+	return ListLightsailRegions(ctx)
+}
+
+func (lightsailProvider) ListImages(ctx context.Context, region string) ([]ImageInfo, error) {
+	blueprints, err := ListLightsailBlueprints(ctx, region)
+	if err != nil {
+		return nil, err
+	}
+	images := make([]ImageInfo, 0, len(blueprints))
+	for _, b := range blueprints {
+		images = append(images, ImageInfo{ID: b.ID, Name: b.Name, Description: b.Description})
+	}
+	return images, nil
+}
+
+func (lightsailProvider) ListPlans(ctx context.Context, region string) ([]PlanInfo, error) {
+	bundles, err := ListLightsailBundles(ctx, region)
+	if err != nil {
+		return nil, err
+	}
+	plans := make([]PlanInfo, 0, len(bundles))
+	for _, b := range bundles {
+		plans = append(plans, PlanInfo{
+			ID:           b.ID,
+			Name:         b.Name,
+			CPU:          int(b.CpuCount),
+			MemoryMB:     int(b.RamSize * 1024),
+			DiskGB:       int(b.DiskSize),
+			TransferGB:   int(b.Transfer),
+			PriceMonthly: float64(b.Price),
+		})
+	}
+	return plans, nil
+}
+
+func (lightsailProvider) ListInstances(ctx context.Context, region string) ([]CloudInstance, error) {
+	if region != "" {
+		return ListLightsailInstances(ctx, region)
+	}
+	regions, err := ListLightsailRegions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return listAllRegions(ctx, regions, ListLightsailInstances), nil
+}
+
+func (lightsailProvider) Provision(ctx context.Context, req ProvisionRequest) (*ProvisionResult, error) {
+	bundle, blueprint := req.Plan, req.Image
+	if bundle == "" {
+		bundle = "nano_3_0"
+	}
+	if blueprint == "" {
+		blueprint = "debian_12"
+	}
+	res, err := ProvisionLightsailInstance(ctx, CreateLightsailRequest{
+		Region:       req.Region,
+		BundleID:     bundle,
+		BlueprintID:  blueprint,
+		InstanceName: req.Name,
+		RootPassword: req.RootPassword,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &ProvisionResult{InstanceID: res.InstanceName, PublicIP: res.PublicIP}, nil
+}
+
+func (lightsailProvider) Terminate(ctx context.Context, region, instanceID string) error {
+	return TerminateLightsailInstance(ctx, region, instanceID)
+}
+
+func (lightsailProvider) RotateIP(ctx context.Context, region, instanceID string) (string, error) {
+	return RotateLightsailIP(ctx, region, instanceID)
+}
+
+func (lightsailProvider) OpenPorts(ctx context.Context, region, instanceID string, ports []PortRange) error {
+	client, err := GetLightsailClient(ctx, region)
+	if err != nil {
+		return err
+	}
+	for _, p := range ports {
+		_, err := client.OpenInstancePublicPorts(ctx, &lightsail.OpenInstancePublicPortsInput{
+			InstanceName: aws.String(instanceID),
+			PortInfo: &lstypes.PortInfo{
+				FromPort: int32(p.From),
+				ToPort:   int32(p.to()),
+				Protocol: lstypes.NetworkProtocol(p.Protocol),
+			},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package cloud
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+var (
+	restHTTPClient = &http.Client{Timeout: 60 * time.Second}
+	// pollInterval 等待实例就绪/异步操作完成的轮询间隔
+	pollInterval = 3 * time.Second
+)
+
+// restClient 基于 Bearer Token 的云平台 HTTP API 客户端 (Vultr, DigitalOcean, Hetzner)
+type restClient struct {
+	name    string // 平台名，用于错误信息
+	baseURL string
+	token   string
+}
+
+// newRESTClient 使用 context 中云账号的 AccessKey 作为 API Token、Endpoint 作为 API 地址；
+// 未指定账号时读取环境变量 tokenEnv
+func newRESTClient(ctx context.Context, name, defaultBase, tokenEnv string) (*restClient, error) {
+	c := &restClient{name: name, baseURL: defaultBase, token: os.Getenv(tokenEnv)}
+	if account := accountFrom(ctx); account != nil {
+		c.token = account.AccessKey
+		if account.Endpoint != "" {
+			c.baseURL = strings.TrimRight(account.Endpoint, "/")
+		}
+	}
+	if c.token == "" {
+		return nil, fmt.Errorf("%s api token not configured (add a %s account to the cloud account pool or set %s)", name, name, tokenEnv)
+	}
+	return c, nil
+}
+
+// do 发送请求；body 不为 nil 时编码为 JSON，out 不为 nil 时解码响应
+func (c *restClient) do(ctx context.Context, method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := restHTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s api %s %s: %v", c.name, method, path, err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 8<<20))
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s api error (HTTP %d) %s %s: %s", c.name, resp.StatusCode, method, path, restErrorMessage(data))
+	}
+	if out != nil && len(bytes.TrimSpace(data)) > 0 {
+		if err := json.Unmarshal(data, out); err != nil {
+			return fmt.Errorf("%s api %s %s: decode response: %v", c.name, method, path, err)
+		}
+	}
+	return nil
+}
+
+// restErrorMessage 提取各平台错误响应中的信息：
+// Vultr {"error": "..."}；DigitalOcean {"id": "...", "message": "..."}；Hetzner {"error": {"code": "...", "message": "..."}}
+func restErrorMessage(data []byte) string {
+	var body struct {
+		Error   json.RawMessage `json:"error"`
+		ID      string          `json:"id"`
+		Message string          `json:"message"`
+	}
+	if json.Unmarshal(data, &body) == nil {
+		var text string
+		var obj struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		}
+		switch {
+		case json.Unmarshal(body.Error, &text) == nil && text != "":
+			return text
+		case json.Unmarshal(body.Error, &obj) == nil && obj.Message != "":
+			return obj.Code + ": " + obj.Message
+		case body.Message != "":
+			return body.ID + ": " + body.Message
+		}
+	}
+	msg := strings.TrimSpace(string(data))
+	if len(msg) > 300 {
+		msg = msg[:300]
+	}
+	return msg
+}
+
+// waitFor 轮询 check 直到返回 true、出错或超过 attempts 次
+func waitFor(ctx context.Context, attempts int, what string, check func() (bool, error)) error {
+	for i := 0; i < attempts; i++ {
+		done, err := check()
+		if err != nil {
+			return err
+		}
+		if done {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(pollInterval):
+		}
+	}
+	return fmt.Errorf("timeout waiting for %s", what)
+}
+
+// portSpec 端口范围的字符串形式 ("443" 或 "1000-2000")
+func portSpec(p PortRange, sep string) string {
+	if p.to() == p.From {
+		return fmt.Sprint(p.From)
+	}
+	return fmt.Sprintf("%d%s%d", p.From, sep, p.to())
+}
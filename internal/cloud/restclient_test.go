@@ -0,0 +1,160 @@
+package cloud
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/wangn9900/StealthForward/internal/models"
+)
+
+const testAPIToken = "test-token"
+
+// fakeHandler 处理一条路由，返回状态码与 JSON 响应体
+type fakeHandler func(r *http.Request, body map[string]interface{}) (int, string)
+
+// fakeCloudAPI 云平台 HTTP API 替身，按 "METHOD /path" 路由并记录请求
+type fakeCloudAPI struct {
+	t      *testing.T
+	url    string
+	mu     sync.Mutex
+	routes map[string]fakeHandler
+	calls  []string
+	bodies map[string]map[string]interface{}
+}
+
+// newFakeCloudAPI 启动替身，返回的 context 携带指向替身的云账号 (Endpoint + AccessKey)
+func newFakeCloudAPI(t *testing.T) (*fakeCloudAPI, context.Context) {
+	t.Helper()
+	old := pollInterval
+	pollInterval = time.Millisecond
+	t.Cleanup(func() { pollInterval = old })
+
+	f := &fakeCloudAPI{t: t, routes: make(map[string]fakeHandler), bodies: make(map[string]map[string]interface{})}
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	f.url = srv.URL
+	account := &models.CloudAccount{Name: "test", AccessKey: testAPIToken, Endpoint: srv.URL + "/"}
+	return f, WithAccount(context.Background(), account)
+}
+
+func (f *fakeCloudAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer "+testAPIToken {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"error":"unauthorized"}`))
+		return
+	}
+	route := r.Method + " " + r.URL.Path
+	var body map[string]interface{}
+	if r.Body != nil {
+		json.NewDecoder(r.Body).Decode(&body)
+	}
+	f.mu.Lock()
+	f.calls = append(f.calls, route)
+	if body != nil {
+		f.bodies[route] = body
+	}
+	h, ok := f.routes[route]
+	f.mu.Unlock()
+	if !ok {
+		f.t.Errorf("unexpected request %s", route)
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"error":"not found"}`))
+		return
+	}
+	status, resp := h(r, body)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write([]byte(resp))
+}
+
+// on 注册路由
+func (f *fakeCloudAPI) on(route string, h fakeHandler) {
+	f.mu.Lock()
+	f.routes[route] = h
+	f.mu.Unlock()
+}
+
+// reply 注册固定响应的路由
+func (f *fakeCloudAPI) reply(route string, status int, resp string) {
+	f.on(route, func(*http.Request, map[string]interface{}) (int, string) { return status, resp })
+}
+
+// sequence 注册按调用次数依次返回的路由，超出后重复最后一个响应
+func (f *fakeCloudAPI) sequence(route string, resps ...string) {
+	n := 0
+	f.on(route, func(*http.Request, map[string]interface{}) (int, string) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		resp := resps[n]
+		if n < len(resps)-1 {
+			n++
+		}
+		return http.StatusOK, resp
+	})
+}
+
+// called 返回路由被调用的次数
+func (f *fakeCloudAPI) called(route string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n := 0
+	for _, c := range f.calls {
+		if c == route {
+			n++
+		}
+	}
+	return n
+}
+
+// body 返回路由最近一次的请求体
+func (f *fakeCloudAPI) body(route string) map[string]interface{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.bodies[route]
+}
+
+// order 返回路由首次调用的序号，未调用时为 -1
+func (f *fakeCloudAPI) order(route string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i, c := range f.calls {
+		if c == route {
+			return i
+		}
+	}
+	return -1
+}
+
+func TestRESTClientCredentials(t *testing.T) {
+	t.Setenv("VULTR_API_KEY", "")
+	if _, err := (vultrProvider{}).ListRegions(context.Background()); err == nil || !strings.Contains(err.Error(), "VULTR_API_KEY") {
+		t.Errorf("missing token error = %v", err)
+	}
+
+	f, _ := newFakeCloudAPI(t)
+	f.reply("GET /regions", http.StatusOK, `{"regions":[{"id":"nrt"}]}`)
+	ctx := WithAccount(context.Background(), &models.CloudAccount{AccessKey: "wrong", Endpoint: f.url})
+	if _, err := (vultrProvider{}).ListRegions(ctx); err == nil || !strings.Contains(err.Error(), "HTTP 401") || !strings.Contains(err.Error(), "unauthorized") {
+		t.Errorf("wrong token error = %v", err)
+	}
+}
+
+func TestRESTErrorMessage(t *testing.T) {
+	cases := map[string]string{
+		`{"error":"Invalid plan","status":400}`:                                  "Invalid plan",
+		`{"id":"unprocessable_entity","message":"Region is not available"}`:      "unprocessable_entity: Region is not available",
+		`{"error":{"code":"uniqueness_error","message":"name is already used"}}`: "uniqueness_error: name is already used",
+		"  <html>bad gateway</html> ":                                            "<html>bad gateway</html>",
+	}
+	for body, want := range cases {
+		if got := restErrorMessage([]byte(body)); got != want {
+			t.Errorf("restErrorMessage(%s) = %q, want %q", body, got, want)
+		}
+	}
+}
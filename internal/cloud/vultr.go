@@ -0,0 +1,280 @@
+package cloud
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	vultrAPI = "https://api.vultr.com/v2"
+	// vultrDebian12 Vultr 的 Debian 12 x64 os_id
+	vultrDebian12 = 2136
+)
+
+// vultrProvider Vultr (不支持换 IP，见 RotateIP)
+type vultrProvider struct{}
+
+type vultrInstance struct {
+	ID              string `json:"id"`
+	Label           string `json:"label"`
+	MainIP          string `json:"main_ip"`
+	Region          string `json:"region"`
+	Status          string `json:"status"`
+	FirewallGroupID string `json:"firewall_group_id"`
+}
+
+type vultrMeta struct {
+	Links struct {
+		Next string `json:"next"`
+	} `json:"links"`
+}
+
+func (vultrProvider) Name() string { return ProviderVultr }
+
+func (vultrProvider) client(ctx context.Context) (*restClient, error) {
+	return newRESTClient(ctx, ProviderVultr, vultrAPI, "VULTR_API_KEY")
+}
+
+func (p vultrProvider) ListRegions(ctx context.Context) ([]string, error) {
+	c, err := p.client(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var out struct {
+		Regions []struct {
+			ID string `json:"id"`
+		} `json:"regions"`
+	}
+	if err := c.do(ctx, "GET", "/regions?per_page=500", nil, &out); err != nil {
+		return nil, err
+	}
+	regions := make([]string, 0, len(out.Regions))
+	for _, r := range out.Regions {
+		regions = append(regions, r.ID)
+	}
+	sort.Strings(regions)
+	return regions, nil
+}
+
+// ListImages 列出 x64 的 Debian / Ubuntu 系统
+func (p vultrProvider) ListImages(ctx context.Context, region string) ([]ImageInfo, error) {
+	c, err := p.client(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var out struct {
+		OS []struct {
+			ID     int    `json:"id"`
+			Name   string `json:"name"`
+			Arch   string `json:"arch"`
+			Family string `json:"family"`
+		} `json:"os"`
+	}
+	if err := c.do(ctx, "GET", "/os?per_page=500", nil, &out); err != nil {
+		return nil, err
+	}
+	var images []ImageInfo
+	for _, o := range out.OS {
+		if o.Arch != "x64" || (o.Family != "debian" && o.Family != "ubuntu") {
+			continue
+		}
+		images = append(images, ImageInfo{ID: strconv.Itoa(o.ID), Name: o.Name, Description: o.Family})
+	}
+	sort.Slice(images, func(i, j int) bool { return images[i].Name < images[j].Name })
+	return images, nil
+}
+
+func (p vultrProvider) ListPlans(ctx context.Context, region string) ([]PlanInfo, error) {
+	c, err := p.client(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var out struct {
+		Plans []struct {
+			ID          string   `json:"id"`
+			VCPUCount   int      `json:"vcpu_count"`
+			RAM         int      `json:"ram"`
+			Disk        int      `json:"disk"`
+			Bandwidth   int      `json:"bandwidth"`
+			MonthlyCost float64  `json:"monthly_cost"`
+			Type        string   `json:"type"`
+			Locations   []string `json:"locations"`
+		} `json:"plans"`
+	}
+	if err := c.do(ctx, "GET", "/plans?per_page=500", nil, &out); err != nil {
+		return nil, err
+	}
+	var plans []PlanInfo
+	for _, pl := range out.Plans {
+		if region != "" && !containsString(pl.Locations, region) {
+			continue
+		}
+		plans = append(plans, PlanInfo{
+			ID:           pl.ID,
+			Name:         pl.ID,
+			CPU:          pl.VCPUCount,
+			MemoryMB:     pl.RAM,
+			DiskGB:       pl.Disk,
+			TransferGB:   pl.Bandwidth,
+			PriceMonthly: pl.MonthlyCost,
+		})
+	}
+	sort.SliceStable(plans, func(i, j int) bool { return plans[i].PriceMonthly < plans[j].PriceMonthly })
+	return plans, nil
+}
+
+func (p vultrProvider) ListInstances(ctx context.Context, region string) ([]CloudInstance, error) {
+	c, err := p.client(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var instances []CloudInstance
+	cursor := ""
+	for {
+		query := url.Values{"per_page": {"500"}}
+		if region != "" {
+			query.Set("region", region)
+		}
+		if cursor != "" {
+			query.Set("cursor", cursor)
+		}
+		var out struct {
+			Instances []vultrInstance `json:"instances"`
+			Meta      vultrMeta       `json:"meta"`
+		}
+		if err := c.do(ctx, "GET", "/instances?"+query.Encode(), nil, &out); err != nil {
+			return nil, err
+		}
+		for _, inst := range out.Instances {
+			instances = append(instances, CloudInstance{ID: inst.ID, Name: inst.Label, PublicIP: inst.MainIP, Region: inst.Region})
+		}
+		if cursor = out.Meta.Links.Next; cursor == "" {
+			return instances, nil
+		}
+	}
+}
+
+func (p vultrProvider) getInstance(ctx context.Context, c *restClient, id string) (*vultrInstance, error) {
+	var out struct {
+		Instance vultrInstance `json:"instance"`
+	}
+	if err := c.do(ctx, "GET", "/instances/"+url.PathEscape(id), nil, &out); err != nil {
+		return nil, err
+	}
+	return &out.Instance, nil
+}
+
+func (p vultrProvider) Provision(ctx context.Context, req ProvisionRequest) (*ProvisionResult, error) {
+	c, err := p.client(ctx)
+	if err != nil {
+		return nil, err
+	}
+	plan := req.Plan
+	if plan == "" {
+		plan = "vc2-1c-1gb"
+	}
+	osID := vultrDebian12
+	if req.Image != "" {
+		if osID, err = strconv.Atoi(req.Image); err != nil {
+			return nil, fmt.Errorf("invalid vultr os id: %s", req.Image)
+		}
+	}
+	name := req.Name
+	if name == "" {
+		name = fmt.Sprintf("Stealth-VU-%s-%d", req.Region, time.Now().Unix()%10000)
+	}
+
+	var out struct {
+		Instance vultrInstance `json:"instance"`
+	}
+	err = c.do(ctx, "POST", "/instances", map[string]interface{}{
+		"region":    req.Region,
+		"plan":      plan,
+		"os_id":     osID,
+		"label":     name,
+		"hostname":  name,
+		"user_data": base64.StdEncoding.EncodeToString([]byte(generateUserData(req.RootPassword))),
+		"tags":      []string{"StealthForward"},
+	}, &out)
+	if err != nil {
+		return nil, err
+	}
+	id := out.Instance.ID
+	log.Printf("[Cloud-Vultr] Instance creating: %s (%s)", name, id)
+
+	// 创建后 main_ip 为 0.0.0.0，分配完成后才有公网 IP
+	ip := ""
+	err = waitFor(ctx, 60, "vultr instance ip", func() (bool, error) {
+		inst, err := p.getInstance(ctx, c, id)
+		if err != nil {
+			return false, err
+		}
+		if inst.MainIP != "" && inst.MainIP != "0.0.0.0" {
+			ip = inst.MainIP
+			return true, nil
+		}
+		return false, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &ProvisionResult{InstanceID: id, PublicIP: ip}, nil
+}
+
+func (p vultrProvider) Terminate(ctx context.Context, region, instanceID string) error {
+	c, err := p.client(ctx)
+	if err != nil {
+		return err
+	}
+	return c.do(ctx, "DELETE", "/instances/"+url.PathEscape(instanceID), nil, nil)
+}
+
+// RotateIP Vultr 无法更换已有实例的主 IP：Reserved IP 绑定到实例后只是附加 IP，需要在系统内另行配置，
+// 主 IP 仍在使用且不会释放，解析切过去后节点并不在新地址上提供服务，因此明确返回不支持
+func (p vultrProvider) RotateIP(ctx context.Context, region, instanceID string) (string, error) {
+	return "", fmt.Errorf("vultr: %w: a reserved ip attached to an existing instance is only an additional ip and the main ip stays in use, recreate the instance to get a new ip", ErrRotateNotSupported)
+}
+
+// OpenPorts 在实例绑定的防火墙组中添加规则；未绑定防火墙组的实例默认放行全部端口
+func (p vultrProvider) OpenPorts(ctx context.Context, region, instanceID string, ports []PortRange) error {
+	c, err := p.client(ctx)
+	if err != nil {
+		return err
+	}
+	inst, err := p.getInstance(ctx, c, instanceID)
+	if err != nil {
+		return err
+	}
+	if inst.FirewallGroupID == "" {
+		return nil
+	}
+	for _, port := range ports {
+		err := c.do(ctx, "POST", "/firewalls/"+inst.FirewallGroupID+"/rules", map[string]interface{}{
+			"ip_type":     "v4",
+			"protocol":    port.Protocol,
+			"port":        portSpec(port, ":"),
+			"subnet":      "0.0.0.0",
+			"subnet_size": 0,
+		}, nil)
+		if err != nil && !strings.Contains(err.Error(), "exist") {
+			return err
+		}
+	}
+	return nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,127 @@
+package cloud
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestVultrProvision(t *testing.T) {
+	f, ctx := newFakeCloudAPI(t)
+	f.reply("POST /instances", http.StatusAccepted, `{"instance":{"id":"vu-1","main_ip":"0.0.0.0","region":"nrt"}}`)
+	// 创建后需轮询到公网 IP 分配完成
+	f.sequence("GET /instances/vu-1",
+		`{"instance":{"id":"vu-1","main_ip":"0.0.0.0"}}`,
+		`{"instance":{"id":"vu-1","main_ip":"45.76.1.2"}}`)
+
+	res, err := (vultrProvider{}).Provision(ctx, ProvisionRequest{Region: "nrt", Name: "edge-1", RootPassword: "pw"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.InstanceID != "vu-1" || res.PublicIP != "45.76.1.2" {
+		t.Errorf("result = %+v", res)
+	}
+	if n := f.called("GET /instances/vu-1"); n != 2 {
+		t.Errorf("polled %d times", n)
+	}
+	body := f.body("POST /instances")
+	if body["region"] != "nrt" || body["plan"] != "vc2-1c-1gb" || body["os_id"] != float64(vultrDebian12) || body["label"] != "edge-1" {
+		t.Errorf("create body = %v", body)
+	}
+	if _, err := base64.StdEncoding.DecodeString(body["user_data"].(string)); err != nil {
+		t.Errorf("user_data is not base64: %v", err)
+	}
+}
+
+func TestVultrProvisionErrors(t *testing.T) {
+	f, ctx := newFakeCloudAPI(t)
+	if _, err := (vultrProvider{}).Provision(ctx, ProvisionRequest{Region: "nrt", Image: "debian"}); err == nil || !strings.Contains(err.Error(), "invalid vultr os id") {
+		t.Errorf("bad image error = %v", err)
+	}
+
+	f.reply("POST /instances", http.StatusBadRequest, `{"error":"Invalid plan chosen.","status":400}`)
+	_, err := (vultrProvider{}).Provision(ctx, ProvisionRequest{Region: "nrt", Plan: "nope"})
+	if err == nil || !strings.Contains(err.Error(), "HTTP 400") || !strings.Contains(err.Error(), "Invalid plan chosen.") {
+		t.Errorf("api error = %v", err)
+	}
+}
+
+func TestVultrListInstances(t *testing.T) {
+	f, ctx := newFakeCloudAPI(t)
+	f.on("GET /instances", func(r *http.Request, _ map[string]interface{}) (int, string) {
+		if r.URL.Query().Get("region") != "nrt" {
+			t.Errorf("region filter = %q", r.URL.Query().Get("region"))
+		}
+		if r.URL.Query().Get("cursor") == "" {
+			return http.StatusOK, `{"instances":[{"id":"a","label":"A","main_ip":"1.1.1.1","region":"nrt"}],"meta":{"links":{"next":"c2"}}}`
+		}
+		return http.StatusOK, `{"instances":[{"id":"b","label":"B","main_ip":"2.2.2.2","region":"nrt"}],"meta":{"links":{"next":""}}}`
+	})
+
+	instances, err := (vultrProvider{}).ListInstances(ctx, "nrt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(instances) != 2 || instances[0].ID != "a" || instances[1].PublicIP != "2.2.2.2" || instances[1].Name != "B" {
+		t.Errorf("instances = %+v", instances)
+	}
+}
+
+func TestVultrRotateIPNotSupported(t *testing.T) {
+	f, ctx := newFakeCloudAPI(t)
+	f.reply("GET /instances", http.StatusOK, `{"instances":[{"id":"vu-1","main_ip":"45.76.1.2","region":"nrt"}],"meta":{"links":{"next":""}}}`)
+
+	// Reserved IP 绑定到已有实例不会替换主 IP，换 IP 必须明确失败，且不能创建/绑定任何 IP
+	ip, err := (vultrProvider{}).RotateIP(ctx, "nrt", "vu-1")
+	if !errors.Is(err, ErrRotateNotSupported) || ip != "" {
+		t.Fatalf("rotate = %q, %v", ip, err)
+	}
+	if len(f.calls) != 0 {
+		t.Errorf("rotate called the api: %v", f.calls)
+	}
+	// 实例可达的地址仍是原来的主 IP
+	instances, err := (vultrProvider{}).ListInstances(ctx, "nrt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(instances) != 1 || instances[0].PublicIP != "45.76.1.2" {
+		t.Errorf("instances after rotate = %+v", instances)
+	}
+}
+
+func TestVultrOpenPorts(t *testing.T) {
+	f, ctx := newFakeCloudAPI(t)
+	f.reply("GET /instances/vu-1", http.StatusOK, `{"instance":{"id":"vu-1","firewall_group_id":"fw-1"}}`)
+	var ports []string
+	f.on("POST /firewalls/fw-1/rules", func(_ *http.Request, body map[string]interface{}) (int, string) {
+		ports = append(ports, body["protocol"].(string)+"/"+body["port"].(string))
+		if body["port"] == "443" {
+			return http.StatusBadRequest, `{"error":"This rule already exists"}`
+		}
+		return http.StatusCreated, `{}`
+	})
+
+	err := (vultrProvider{}).OpenPorts(ctx, "nrt", "vu-1", []PortRange{{Protocol: "tcp", From: 443}, {Protocol: "udp", From: 20000, To: 20100}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(ports, ",") != "tcp/443,udp/20000:20100" {
+		t.Errorf("rules = %v", ports)
+	}
+
+	// 未绑定防火墙组时不做任何操作
+	f.reply("GET /instances/vu-2", http.StatusOK, `{"instance":{"id":"vu-2"}}`)
+	if err := (vultrProvider{}).OpenPorts(ctx, "nrt", "vu-2", []PortRange{{Protocol: "tcp", From: 443}}); err != nil {
+		t.Fatal(err)
+	}
+	if len(ports) != 2 {
+		t.Errorf("rules added without a firewall group: %v", ports)
+	}
+
+	f.reply("POST /firewalls/fw-1/rules", http.StatusForbidden, `{"error":"forbidden"}`)
+	if err := (vultrProvider{}).OpenPorts(ctx, "nrt", "vu-1", []PortRange{{Protocol: "tcp", From: 8443}}); err == nil || !strings.Contains(err.Error(), "HTTP 403") {
+		t.Errorf("err = %v", err)
+	}
+}
@@ -27,8 +27,17 @@ func InitDB() {
 		&models.ForwardingRule{},
 		&models.NodeMapping{},
 		&models.SystemSetting{},
-		&models.CloudAccount{},
+		&models.CloudAccount{}, &models.CloudAccountUsage{}, &models.DNSZone{},
 		&models.SSHKey{},
+		&models.SyncRun{},
+		&models.UserIdentity{}, &models.TrafficOutbox{}, &models.AgentReportCursor{}, &models.TrafficBucket{},
+		&models.TrafficQuota{}, &models.Suspension{},
+		&models.BillingCycle{}, &models.InterfaceUsage{},
+		&models.NodeStatus{}, &models.NodeStatusChange{}, &models.AlertRule{}, &models.AlertEvent{}, &models.NotificationChannel{},
+		&models.Event{}, &models.WebhookSubscription{}, &models.WebhookDelivery{},
+		&models.ExitProbe{}, &models.MappingFailover{},
+		&models.ReachabilityProbe{}, &models.ReachabilityState{}, &models.Prober{},
+		&models.RotationPolicy{}, &models.RotationDecision{},
 	)
 	if err != nil {
 		log.Fatalf("failed to migrate database: %v", err)
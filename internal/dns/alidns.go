@@ -0,0 +1,195 @@
+package dns
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	aliDNSAPI     = "https://alidns.aliyuncs.com"
+	aliDNSVersion = "2015-01-09"
+	// aliDNSDefaultTTL 免费版最低 TTL 为 600
+	aliDNSDefaultTTL = 600
+)
+
+// aliDNSProvider 阿里云云解析 DNS (凭证为 AccessKey ID / Secret，RPC 风格 API，HMAC-SHA1 签名)
+type aliDNSProvider struct {
+	cred Credentials
+}
+
+func newAliDNS(cred Credentials) Provider { return &aliDNSProvider{cred: cred} }
+
+func (p *aliDNSProvider) Name() string { return ProviderAliDNS }
+
+type aliDNSRecord struct {
+	RecordID string `json:"RecordId"`
+	RR       string `json:"RR"`
+	Type     string `json:"Type"`
+	Value    string `json:"Value"`
+	TTL      int    `json:"TTL"`
+}
+
+// aliPercentEncode 阿里云签名要求的 RFC 3986 编码
+func aliPercentEncode(s string) string {
+	s = url.QueryEscape(s)
+	return strings.NewReplacer("+", "%20", "*", "%2A", "%7E", "~").Replace(s)
+}
+
+// call 调用 RPC API，params 为业务参数
+func (p *aliDNSProvider) call(ctx context.Context, action string, params map[string]string, out interface{}) error {
+	if p.cred.AccessKey == "" || p.cred.SecretKey == "" {
+		return fmt.Errorf("alidns access key not configured")
+	}
+	nonce := make([]byte, 16)
+	rand.Read(nonce)
+	query := map[string]string{
+		"Action":           action,
+		"Format":           "JSON",
+		"Version":          aliDNSVersion,
+		"AccessKeyId":      p.cred.AccessKey,
+		"SignatureMethod":  "HMAC-SHA1",
+		"SignatureVersion": "1.0",
+		"SignatureNonce":   hex.EncodeToString(nonce),
+		"Timestamp":        time.Now().UTC().Format("2006-01-02T15:04:05Z"),
+	}
+	for k, v := range params {
+		query[k] = v
+	}
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = aliPercentEncode(k) + "=" + aliPercentEncode(query[k])
+	}
+	canonical := strings.Join(pairs, "&")
+	mac := hmac.New(sha1.New, []byte(p.cred.SecretKey+"&"))
+	mac.Write([]byte("GET&%2F&" + aliPercentEncode(canonical)))
+	signature := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+	base := aliDNSAPI
+	if p.cred.Endpoint != "" {
+		base = strings.TrimRight(p.cred.Endpoint, "/")
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", base+"/?"+canonical+"&Signature="+aliPercentEncode(signature), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("alidns api %s: %v", action, err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 8<<20))
+	if resp.StatusCode >= 300 {
+		var e struct {
+			Code    string `json:"Code"`
+			Message string `json:"Message"`
+		}
+		msg := truncate(string(data))
+		if json.Unmarshal(data, &e) == nil && e.Code != "" {
+			msg = e.Code + ": " + e.Message
+		}
+		return fmt.Errorf("alidns api error (HTTP %d) %s: %s", resp.StatusCode, action, msg)
+	}
+	if out != nil {
+		if err := json.Unmarshal(data, out); err != nil {
+			return fmt.Errorf("alidns api %s: decode response: %v", action, err)
+		}
+	}
+	return nil
+}
+
+func (p *aliDNSProvider) ListRecords(ctx context.Context, zone, name, recordType string) ([]Record, error) {
+	var records []Record
+	for page := 1; ; page++ {
+		params := map[string]string{
+			"DomainName": zone,
+			"PageNumber": strconv.Itoa(page),
+			"PageSize":   "500",
+		}
+		if name != "" {
+			params["RRKeyWord"] = RelativeName(zone, name)
+		}
+		if recordType != "" {
+			params["Type"] = recordType
+		}
+		var out struct {
+			TotalCount    int `json:"TotalCount"`
+			DomainRecords struct {
+				Record []aliDNSRecord `json:"Record"`
+			} `json:"DomainRecords"`
+		}
+		if err := p.call(ctx, "DescribeDomainRecords", params, &out); err != nil {
+			return nil, err
+		}
+		for _, r := range out.DomainRecords.Record {
+			// RRKeyWord 为模糊匹配
+			if name != "" && r.RR != RelativeName(zone, name) {
+				continue
+			}
+			if r.Type != TypeA && r.Type != TypeAAAA && r.Type != TypeCNAME {
+				continue
+			}
+			records = append(records, Record{ID: r.RecordID, Type: r.Type, Name: r.RR, Content: r.Value, TTL: r.TTL})
+		}
+		if len(out.DomainRecords.Record) == 0 || page*500 >= out.TotalCount {
+			return records, nil
+		}
+	}
+}
+
+// aliDNSParams 记录的请求参数，同时补全 rec 的主机记录与默认 TTL
+func aliDNSParams(zone string, rec *Record) map[string]string {
+	rec.Name = RelativeName(zone, rec.Name)
+	rec.TTL = ttlOrDefault(rec.TTL, aliDNSDefaultTTL)
+	rec.Proxied = nil
+	return map[string]string{
+		"DomainName": zone,
+		"RR":         rec.Name,
+		"Type":       rec.Type,
+		"Value":      rec.Content,
+		"TTL":        strconv.Itoa(rec.TTL),
+	}
+}
+
+func (p *aliDNSProvider) CreateRecord(ctx context.Context, zone string, rec Record) (*Record, error) {
+	var out struct {
+		RecordID string `json:"RecordId"`
+	}
+	if err := p.call(ctx, "AddDomainRecord", aliDNSParams(zone, &rec), &out); err != nil {
+		return nil, err
+	}
+	rec.ID = out.RecordID
+	return &rec, nil
+}
+
+func (p *aliDNSProvider) UpdateRecord(ctx context.Context, zone string, rec Record) (*Record, error) {
+	params := aliDNSParams(zone, &rec)
+	delete(params, "DomainName")
+	params["RecordId"] = rec.ID
+	// 记录内容未变化时阿里云返回 DomainRecordDuplicate
+	if err := p.call(ctx, "UpdateDomainRecord", params, nil); err != nil && !strings.Contains(err.Error(), "DomainRecordDuplicate") {
+		return nil, err
+	}
+	return &rec, nil
+}
+
+func (p *aliDNSProvider) DeleteRecord(ctx context.Context, zone string, rec Record) error {
+	return p.call(ctx, "DeleteDomainRecord", map[string]string{"RecordId": rec.ID}, nil)
+}
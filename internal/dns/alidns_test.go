@@ -0,0 +1,191 @@
+package dns
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+const (
+	testAliKeyID  = "ali-key"
+	testAliSecret = "ali-secret"
+)
+
+// fakeAliDNS 阿里云 DNS RPC API 替身，独立校验 HMAC-SHA1 签名 (记录名称为主机记录)
+type fakeAliDNS struct {
+	t       *testing.T
+	store   recordStore
+	actions []string
+}
+
+func newFakeAliDNS(t *testing.T) (*fakeAliDNS, Provider) {
+	f := &fakeAliDNS{t: t}
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	return f, newAliDNS(Credentials{AccessKey: testAliKeyID, SecretKey: testAliSecret, Endpoint: srv.URL})
+}
+
+func (f *fakeAliDNS) reply(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func (f *fakeAliDNS) fail(w http.ResponseWriter, status int, code, msg string) {
+	f.reply(w, status, map[string]string{"RequestId": "req-1", "Code": code, "Message": msg})
+}
+
+func (f *fakeAliDNS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		if k != "Signature" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = aliPercentEncode(k) + "=" + aliPercentEncode(q.Get(k))
+	}
+	mac := hmac.New(sha1.New, []byte(testAliSecret+"&"))
+	mac.Write([]byte("GET&%2F&" + aliPercentEncode(strings.Join(pairs, "&"))))
+	if q.Get("AccessKeyId") != testAliKeyID || q.Get("Signature") != base64.StdEncoding.EncodeToString(mac.Sum(nil)) {
+		f.fail(w, http.StatusBadRequest, "SignatureDoesNotMatch", "Specified signature is not matched with our calculation.")
+		return
+	}
+	if q.Get("Version") != aliDNSVersion || q.Get("SignatureNonce") == "" || q.Get("Timestamp") == "" {
+		f.fail(w, http.StatusBadRequest, "MissingParameter", "common parameter missing")
+		return
+	}
+
+	action := q.Get("Action")
+	f.actions = append(f.actions, action)
+	if d := q.Get("DomainName"); d != "" && d != "example.com" {
+		f.fail(w, http.StatusBadRequest, "InvalidDomainName.NoExist", "The specified domain name does not exist.")
+		return
+	}
+	ttl, _ := strconv.Atoi(q.Get("TTL"))
+	switch action {
+	case "DescribeDomainRecords":
+		var list []map[string]interface{}
+		for _, rec := range f.store.match("", q.Get("Type")) {
+			// RRKeyWord 为模糊匹配
+			if strings.Contains(rec.Name, q.Get("RRKeyWord")) {
+				list = append(list, map[string]interface{}{"RecordId": rec.ID, "RR": rec.Name, "Type": rec.Type, "Value": rec.Content, "TTL": rec.TTL})
+			}
+		}
+		page, _ := strconv.Atoi(q.Get("PageNumber"))
+		size, _ := strconv.Atoi(q.Get("PageSize"))
+		total := len(list)
+		if from := (page - 1) * size; from < len(list) {
+			list = list[from:min(from+size, len(list))]
+		} else {
+			list = nil
+		}
+		f.reply(w, http.StatusOK, map[string]interface{}{"TotalCount": total, "DomainRecords": map[string]interface{}{"Record": list}})
+	case "AddDomainRecord":
+		if len(f.store.match(q.Get("RR"), q.Get("Type"))) > 0 && f.store.contents(q.Get("RR"), q.Get("Type")) == q.Get("Value") {
+			f.fail(w, http.StatusConflict, "DomainRecordDuplicate", "The DNS record already exists.")
+			return
+		}
+		rec := f.store.add(q.Get("RR"), q.Get("Type"), q.Get("Value"), ttl, false)
+		f.reply(w, http.StatusOK, map[string]string{"RecordId": rec.ID})
+	case "UpdateDomainRecord":
+		rec := f.store.find(q.Get("RecordId"))
+		if rec == nil {
+			f.fail(w, http.StatusBadRequest, "DomainRecordNotBelongToUser", "The DNS record does not exist.")
+			return
+		}
+		if rec.Content == q.Get("Value") && rec.TTL == ttl {
+			f.fail(w, http.StatusConflict, "DomainRecordDuplicate", "The DNS record already exists.")
+			return
+		}
+		rec.Name, rec.Type, rec.Content, rec.TTL = q.Get("RR"), q.Get("Type"), q.Get("Value"), ttl
+		f.reply(w, http.StatusOK, map[string]string{"RecordId": rec.ID})
+	case "DeleteDomainRecord":
+		if !f.store.remove(q.Get("RecordId")) {
+			f.fail(w, http.StatusBadRequest, "DomainRecordNotBelongToUser", "The DNS record does not exist.")
+			return
+		}
+		f.reply(w, http.StatusOK, map[string]string{"RecordId": q.Get("RecordId")})
+	default:
+		f.t.Errorf("unexpected action %s", action)
+		f.fail(w, http.StatusNotFound, "InvalidAction.NotFound", "action not found")
+	}
+}
+
+func TestAliDNSUpsert(t *testing.T) {
+	f, p := newFakeAliDNS(t)
+	ctx := context.Background()
+	// 模糊匹配会返回 hk2，必须在客户端精确过滤
+	f.store.add("hk2", TypeA, "9.9.9.9", 600, false)
+
+	rec, err := Upsert(ctx, p, "example.com", Record{Type: TypeA, Name: "hk.example.com", Content: "1.1.1.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.ID == "" || rec.Name != "hk" || rec.TTL != aliDNSDefaultTTL || f.store.contents("hk", TypeA) != "1.1.1.1" {
+		t.Errorf("created %+v", rec)
+	}
+
+	// 更新保留原 TTL 并删除重复记录
+	f.store.match("hk", TypeA)[0].TTL = 1200
+	f.store.add("hk", TypeA, "1.1.1.2", 600, false)
+	if _, err := Upsert(ctx, p, "example.com", Record{Type: TypeA, Name: "hk", Content: "2.2.2.2"}); err != nil {
+		t.Fatal(err)
+	}
+	if list := f.store.match("hk", TypeA); len(list) != 1 || list[0].Content != "2.2.2.2" || list[0].TTL != 1200 {
+		t.Errorf("records after upsert = %+v", list)
+	}
+	if f.store.contents("hk2", TypeA) != "9.9.9.9" {
+		t.Error("fuzzy match deleted another record")
+	}
+
+	// 内容未变化时忽略 DomainRecordDuplicate
+	if _, err := Upsert(ctx, p, "example.com", Record{Type: TypeA, Name: "hk", Content: "2.2.2.2"}); err != nil {
+		t.Errorf("unchanged upsert = %v", err)
+	}
+	if got := strings.Join(f.actions, ","); !strings.HasSuffix(got, "DescribeDomainRecords,UpdateDomainRecord") {
+		t.Errorf("actions = %s", got)
+	}
+}
+
+func TestAliDNSPaging(t *testing.T) {
+	f, p := newFakeAliDNS(t)
+	for i := 0; i < 501; i++ {
+		f.store.add("n"+strconv.Itoa(i), TypeA, "10.0.0.1", 600, false)
+	}
+	records, err := p.ListRecords(context.Background(), "example.com", "", TypeA)
+	if err != nil || len(records) != 501 {
+		t.Errorf("listed %d records, %v", len(records), err)
+	}
+}
+
+func TestAliDNSErrors(t *testing.T) {
+	_, p := newFakeAliDNS(t)
+	ctx := context.Background()
+
+	if _, err := p.ListRecords(ctx, "other.com", "", ""); err == nil || !strings.Contains(err.Error(), "HTTP 400") || !strings.Contains(err.Error(), "InvalidDomainName.NoExist") {
+		t.Errorf("unknown domain error = %v", err)
+	}
+	if err := p.DeleteRecord(ctx, "example.com", Record{ID: "404"}); err == nil || !strings.Contains(err.Error(), "DomainRecordNotBelongToUser") {
+		t.Errorf("delete error = %v", err)
+	}
+
+	wrong := newAliDNS(Credentials{AccessKey: testAliKeyID, SecretKey: "wrong", Endpoint: p.(*aliDNSProvider).cred.Endpoint})
+	if _, err := wrong.ListRecords(ctx, "example.com", "", ""); err == nil || !strings.Contains(err.Error(), "SignatureDoesNotMatch") {
+		t.Errorf("bad signature error = %v", err)
+	}
+	if _, err := newAliDNS(Credentials{SecretKey: testAliSecret}).ListRecords(ctx, "example.com", "", ""); err == nil || !strings.Contains(err.Error(), "not configured") {
+		t.Errorf("missing key error = %v", err)
+	}
+}
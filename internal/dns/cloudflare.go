@@ -0,0 +1,127 @@
+package dns
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cloudflare/cloudflare-go"
+)
+
+// cloudflareProvider Cloudflare (凭证为 API Token，需 Zone.DNS 编辑权限)
+type cloudflareProvider struct {
+	cred Credentials
+}
+
+func newCloudflare(cred Credentials) Provider { return &cloudflareProvider{cred: cred} }
+
+func (p *cloudflareProvider) Name() string { return ProviderCloudflare }
+
+func (p *cloudflareProvider) api() (*cloudflare.API, error) {
+	if p.cred.AccessKey == "" {
+		return nil, fmt.Errorf("cloudflare api token not configured")
+	}
+	var opts []cloudflare.Option
+	if p.cred.Endpoint != "" {
+		opts = append(opts, cloudflare.BaseURL(strings.TrimRight(p.cred.Endpoint, "/")))
+	}
+	return cloudflare.NewWithAPIToken(p.cred.AccessKey, opts...)
+}
+
+// zone 返回 API 客户端与 Zone 的资源标识
+func (p *cloudflareProvider) zone(zone string) (*cloudflare.API, *cloudflare.ResourceContainer, error) {
+	api, err := p.api()
+	if err != nil {
+		return nil, nil, err
+	}
+	zoneID, err := api.ZoneIDByName(zone)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cf get zone id error: %v", err)
+	}
+	return api, cloudflare.ZoneIdentifier(zoneID), nil
+}
+
+func (p *cloudflareProvider) toRecord(zone string, r cloudflare.DNSRecord) Record {
+	return Record{ID: r.ID, Type: r.Type, Name: RelativeName(zone, r.Name), Content: r.Content, TTL: r.TTL, Proxied: r.Proxied}
+}
+
+func (p *cloudflareProvider) ListRecords(ctx context.Context, zone, name, recordType string) ([]Record, error) {
+	api, rc, err := p.zone(zone)
+	if err != nil {
+		return nil, err
+	}
+	params := cloudflare.ListDNSRecordsParams{Type: recordType}
+	if name != "" {
+		params.Name = FQDN(zone, name)
+	}
+	list, _, err := api.ListDNSRecords(ctx, rc, params)
+	if err != nil {
+		return nil, fmt.Errorf("cf list records error: %v", err)
+	}
+	records := make([]Record, 0, len(list))
+	for _, r := range list {
+		records = append(records, p.toRecord(zone, r))
+	}
+	return records, nil
+}
+
+// cloudflareTTL 0 表示自动 (Cloudflare 中为 1)
+func cloudflareTTL(ttl int) int {
+	if ttl <= 0 {
+		return 1
+	}
+	return ttl
+}
+
+func (p *cloudflareProvider) CreateRecord(ctx context.Context, zone string, rec Record) (*Record, error) {
+	api, rc, err := p.zone(zone)
+	if err != nil {
+		return nil, err
+	}
+	created, err := api.CreateDNSRecord(ctx, rc, cloudflare.CreateDNSRecordParams{
+		Type:    rec.Type,
+		Name:    FQDN(zone, rec.Name),
+		Content: rec.Content,
+		TTL:     cloudflareTTL(rec.TTL),
+		Proxied: rec.Proxied,
+		Comment: "Created by StealthController at " + time.Now().Format(time.RFC3339),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cf create record error: %v", err)
+	}
+	result := p.toRecord(zone, created)
+	return &result, nil
+}
+
+func (p *cloudflareProvider) UpdateRecord(ctx context.Context, zone string, rec Record) (*Record, error) {
+	api, rc, err := p.zone(zone)
+	if err != nil {
+		return nil, err
+	}
+	updated, err := api.UpdateDNSRecord(ctx, rc, cloudflare.UpdateDNSRecordParams{
+		ID:      rec.ID,
+		Type:    rec.Type,
+		Name:    FQDN(zone, rec.Name),
+		Content: rec.Content,
+		TTL:     cloudflareTTL(rec.TTL),
+		Proxied: rec.Proxied,
+		Comment: cloudflare.StringPtr("Updated by StealthController at " + time.Now().Format(time.RFC3339)),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cf update record error: %v", err)
+	}
+	result := p.toRecord(zone, updated)
+	return &result, nil
+}
+
+func (p *cloudflareProvider) DeleteRecord(ctx context.Context, zone string, rec Record) error {
+	api, rc, err := p.zone(zone)
+	if err != nil {
+		return err
+	}
+	if err := api.DeleteDNSRecord(ctx, rc, rec.ID); err != nil {
+		return fmt.Errorf("cf delete record error: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+package dns
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const (
+	testCFToken  = "cf-token"
+	testCFZoneID = "zone-1"
+)
+
+// fakeCloudflare Cloudflare v4 API 替身 (记录名称为完整域名)
+type fakeCloudflare struct {
+	t     *testing.T
+	store recordStore
+}
+
+func newFakeCloudflare(t *testing.T) (*fakeCloudflare, Provider) {
+	f := &fakeCloudflare{t: t}
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	return f, newCloudflare(Credentials{AccessKey: testCFToken, Endpoint: srv.URL + "/"})
+}
+
+func (f *fakeCloudflare) reply(w http.ResponseWriter, status int, result interface{}) {
+	resp := map[string]interface{}{"success": status < 300, "errors": []interface{}{}, "messages": []interface{}{}, "result": result}
+	if status >= 300 {
+		resp["errors"] = []interface{}{map[string]interface{}{"code": 10000, "message": result}}
+		resp["result"] = nil
+	}
+	if list, ok := result.([]map[string]interface{}); ok {
+		resp["result_info"] = map[string]int{"page": 1, "per_page": 100, "count": len(list), "total_count": len(list), "total_pages": 1}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
+
+func cfRecordJSON(r *fakeRecord) map[string]interface{} {
+	return map[string]interface{}{"id": r.ID, "type": r.Type, "name": r.Name, "content": r.Content, "ttl": r.TTL, "proxied": r.Proxied}
+}
+
+func (f *fakeCloudflare) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer "+testCFToken {
+		f.reply(w, http.StatusForbidden, "Authentication error")
+		return
+	}
+	var body struct {
+		Type    string `json:"type"`
+		Name    string `json:"name"`
+		Content string `json:"content"`
+		TTL     int    `json:"ttl"`
+		Proxied *bool  `json:"proxied"`
+	}
+	json.NewDecoder(r.Body).Decode(&body)
+	records := "/zones/" + testCFZoneID + "/dns_records"
+	switch {
+	case r.Method == "GET" && r.URL.Path == "/zones":
+		zones := []map[string]interface{}{}
+		if r.URL.Query().Get("name") == "example.com" {
+			zones = append(zones, map[string]interface{}{"id": testCFZoneID, "name": "example.com"})
+		}
+		f.reply(w, http.StatusOK, zones)
+	case r.Method == "GET" && r.URL.Path == records:
+		list := []map[string]interface{}{}
+		for _, rec := range f.store.match(r.URL.Query().Get("name"), r.URL.Query().Get("type")) {
+			list = append(list, cfRecordJSON(rec))
+		}
+		f.reply(w, http.StatusOK, list)
+	case r.Method == "POST" && r.URL.Path == records:
+		if body.Type == TypeA && strings.Contains(body.Content, ":") {
+			f.reply(w, http.StatusBadRequest, "Content for A record is invalid.")
+			return
+		}
+		rec := f.store.add(body.Name, body.Type, body.Content, body.TTL, body.Proxied != nil && *body.Proxied)
+		f.reply(w, http.StatusOK, cfRecordJSON(rec))
+	case strings.HasPrefix(r.URL.Path, records+"/"):
+		rec := f.store.find(strings.TrimPrefix(r.URL.Path, records+"/"))
+		if rec == nil {
+			f.reply(w, http.StatusNotFound, "Record does not exist.")
+			return
+		}
+		switch r.Method {
+		case "PATCH":
+			// PATCH 只修改请求中出现的字段
+			rec.Content, rec.TTL = body.Content, body.TTL
+			if body.Proxied != nil {
+				rec.Proxied = *body.Proxied
+			}
+			f.reply(w, http.StatusOK, cfRecordJSON(rec))
+		case "DELETE":
+			f.store.remove(rec.ID)
+			f.reply(w, http.StatusOK, map[string]string{"id": rec.ID})
+		}
+	default:
+		f.t.Errorf("unexpected request %s %s", r.Method, r.URL)
+		f.reply(w, http.StatusNotFound, "not found")
+	}
+}
+
+func TestCloudflareUpsert(t *testing.T) {
+	f, p := newFakeCloudflare(t)
+	ctx := context.Background()
+
+	rec, err := Upsert(ctx, p, "example.com", Record{Type: TypeA, Name: "hk", Content: "1.1.1.1", Proxied: boolPtr(true)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.Name != "hk" || rec.TTL != 1 || rec.Proxied == nil || !*rec.Proxied {
+		t.Errorf("created %+v", rec)
+	}
+	if f.store.contents("hk.example.com", TypeA) != "1.1.1.1" {
+		t.Errorf("records = %q", f.store.contents("hk.example.com", TypeA))
+	}
+
+	// 未指定代理设置时保留记录原有的橙色云
+	f.store.add("hk.example.com", TypeA, "1.1.1.2", 1, false)
+	if _, err := Upsert(ctx, p, "example.com", Record{Type: TypeA, Name: "hk.example.com", Content: "2.2.2.2"}); err != nil {
+		t.Fatal(err)
+	}
+	list := f.store.match("hk.example.com", TypeA)
+	if len(list) != 1 || list[0].Content != "2.2.2.2" || !list[0].Proxied {
+		t.Errorf("records after upsert = %+v", list)
+	}
+
+	records, err := p.ListRecords(ctx, "example.com", "", "")
+	if err != nil || len(records) != 1 || records[0].Name != "hk" {
+		t.Errorf("list = %+v, %v", records, err)
+	}
+}
+
+func TestCloudflareErrors(t *testing.T) {
+	_, p := newFakeCloudflare(t)
+	ctx := context.Background()
+
+	if _, err := p.ListRecords(ctx, "other.com", "hk", TypeA); err == nil || !strings.Contains(err.Error(), "zone could not be found") {
+		t.Errorf("unknown zone error = %v", err)
+	}
+	if _, err := p.CreateRecord(ctx, "example.com", Record{Type: TypeA, Name: "hk", Content: "::1"}); err == nil || !strings.Contains(err.Error(), "Content for A record is invalid") {
+		t.Errorf("api error = %v", err)
+	}
+
+	wrong := newCloudflare(Credentials{AccessKey: "wrong", Endpoint: p.(*cloudflareProvider).cred.Endpoint})
+	if _, err := wrong.ListRecords(ctx, "example.com", "", ""); err == nil || !strings.Contains(err.Error(), "Authentication error") {
+		t.Errorf("wrong token error = %v", err)
+	}
+	if _, err := newCloudflare(Credentials{}).ListRecords(ctx, "example.com", "", ""); err == nil || !strings.Contains(err.Error(), "not configured") {
+		t.Errorf("missing token error = %v", err)
+	}
+}
@@ -0,0 +1,210 @@
+package dns
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	dnspodAPI     = "https://dnspod.tencentcloudapi.com"
+	dnspodVersion = "2021-03-23"
+	// dnspodDefaultTTL 免费版最低 TTL 为 600
+	dnspodDefaultTTL = 600
+	dnspodLine       = "默认"
+)
+
+// dnspodProvider 腾讯云 DNSPod (凭证为 SecretId / SecretKey，API 3.0，TC3-HMAC-SHA256 签名)
+type dnspodProvider struct {
+	cred Credentials
+}
+
+func newDNSPod(cred Credentials) Provider { return &dnspodProvider{cred: cred} }
+
+func (p *dnspodProvider) Name() string { return ProviderDNSPod }
+
+type dnspodRecord struct {
+	RecordID uint64 `json:"RecordId"`
+	Name     string `json:"Name"`
+	Type     string `json:"Type"`
+	Value    string `json:"Value"`
+	TTL      int    `json:"TTL"`
+}
+
+func hmacSHA256(key []byte, msg string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(msg))
+	return mac.Sum(nil)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// call 调用 API 3.0，out 解码 Response 字段
+func (p *dnspodProvider) call(ctx context.Context, action string, params map[string]interface{}, out interface{}) error {
+	if p.cred.AccessKey == "" || p.cred.SecretKey == "" {
+		return fmt.Errorf("dnspod secret id/key not configured")
+	}
+	base := dnspodAPI
+	if p.cred.Endpoint != "" {
+		base = strings.TrimRight(p.cred.Endpoint, "/")
+	}
+	u, err := url.Parse(base)
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+
+	// TC3-HMAC-SHA256 签名
+	const contentType = "application/json; charset=utf-8"
+	now := time.Now().UTC()
+	date := now.Format("2006-01-02")
+	scope := date + "/dnspod/tc3_request"
+	canonical := "POST\n/\n\ncontent-type:" + contentType + "\nhost:" + u.Host + "\n\ncontent-type;host\n" + sha256Hex(payload)
+	stringToSign := "TC3-HMAC-SHA256\n" + strconv.FormatInt(now.Unix(), 10) + "\n" + scope + "\n" + sha256Hex([]byte(canonical))
+	key := hmacSHA256(hmacSHA256(hmacSHA256([]byte("TC3"+p.cred.SecretKey), date), "dnspod"), "tc3_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req, err := http.NewRequestWithContext(ctx, "POST", base+"/", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("X-TC-Action", action)
+	req.Header.Set("X-TC-Version", dnspodVersion)
+	req.Header.Set("X-TC-Timestamp", strconv.FormatInt(now.Unix(), 10))
+	req.Header.Set("Authorization", "TC3-HMAC-SHA256 Credential="+p.cred.AccessKey+"/"+scope+", SignedHeaders=content-type;host, Signature="+signature)
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("dnspod api %s: %v", action, err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 8<<20))
+	// API 3.0 的错误在 HTTP 200 的 Response.Error 中返回
+	var body struct {
+		Response json.RawMessage `json:"Response"`
+	}
+	var e struct {
+		Error *struct {
+			Code    string `json:"Code"`
+			Message string `json:"Message"`
+		} `json:"Error"`
+	}
+	if err := json.Unmarshal(data, &body); err != nil || len(body.Response) == 0 {
+		return fmt.Errorf("dnspod api error (HTTP %d) %s: %s", resp.StatusCode, action, truncate(string(data)))
+	}
+	if json.Unmarshal(body.Response, &e) == nil && e.Error != nil {
+		return fmt.Errorf("dnspod api error %s: %s: %s", action, e.Error.Code, e.Error.Message)
+	}
+	if out != nil {
+		if err := json.Unmarshal(body.Response, out); err != nil {
+			return fmt.Errorf("dnspod api %s: decode response: %v", action, err)
+		}
+	}
+	return nil
+}
+
+func (p *dnspodProvider) ListRecords(ctx context.Context, zone, name, recordType string) ([]Record, error) {
+	var records []Record
+	for offset := 0; ; {
+		params := map[string]interface{}{"Domain": zone, "Offset": offset, "Limit": 3000}
+		if name != "" {
+			params["Subdomain"] = RelativeName(zone, name)
+		}
+		if recordType != "" {
+			params["RecordType"] = recordType
+		}
+		var out struct {
+			RecordCountInfo struct {
+				TotalCount int `json:"TotalCount"`
+			} `json:"RecordCountInfo"`
+			RecordList []dnspodRecord `json:"RecordList"`
+		}
+		if err := p.call(ctx, "DescribeRecordList", params, &out); err != nil {
+			// 没有匹配记录时返回该错误
+			if strings.Contains(err.Error(), "ResourceNotFound.NoDataOfRecord") {
+				return records, nil
+			}
+			return nil, err
+		}
+		for _, r := range out.RecordList {
+			if r.Type != TypeA && r.Type != TypeAAAA && r.Type != TypeCNAME {
+				continue
+			}
+			records = append(records, Record{
+				ID:      strconv.FormatUint(r.RecordID, 10),
+				Type:    r.Type,
+				Name:    r.Name,
+				Content: strings.TrimSuffix(r.Value, "."),
+				TTL:     r.TTL,
+			})
+		}
+		offset += len(out.RecordList)
+		if len(out.RecordList) == 0 || offset >= out.RecordCountInfo.TotalCount {
+			return records, nil
+		}
+	}
+}
+
+// dnspodParams 记录的请求参数，同时补全 rec 的主机记录与默认 TTL
+func dnspodParams(zone string, rec *Record) map[string]interface{} {
+	rec.Name = RelativeName(zone, rec.Name)
+	rec.TTL = ttlOrDefault(rec.TTL, dnspodDefaultTTL)
+	rec.Proxied = nil
+	return map[string]interface{}{
+		"Domain":     zone,
+		"SubDomain":  rec.Name,
+		"RecordType": rec.Type,
+		"RecordLine": dnspodLine,
+		"Value":      rec.Content,
+		"TTL":        rec.TTL,
+	}
+}
+
+func (p *dnspodProvider) CreateRecord(ctx context.Context, zone string, rec Record) (*Record, error) {
+	var out struct {
+		RecordID uint64 `json:"RecordId"`
+	}
+	if err := p.call(ctx, "CreateRecord", dnspodParams(zone, &rec), &out); err != nil {
+		return nil, err
+	}
+	rec.ID = strconv.FormatUint(out.RecordID, 10)
+	return &rec, nil
+}
+
+func (p *dnspodProvider) UpdateRecord(ctx context.Context, zone string, rec Record) (*Record, error) {
+	id, err := strconv.ParseUint(rec.ID, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid dnspod record id: %q", rec.ID)
+	}
+	params := dnspodParams(zone, &rec)
+	params["RecordId"] = id
+	if err := p.call(ctx, "ModifyRecord", params, nil); err != nil {
+		return nil, err
+	}
+	return &rec, nil
+}
+
+func (p *dnspodProvider) DeleteRecord(ctx context.Context, zone string, rec Record) error {
+	id, err := strconv.ParseUint(rec.ID, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid dnspod record id: %q", rec.ID)
+	}
+	return p.call(ctx, "DeleteRecord", map[string]interface{}{"Domain": zone, "RecordId": id}, nil)
+}
@@ -0,0 +1,195 @@
+package dns
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	testDNSPodID  = "AKIDdnspod"
+	testDNSPodKey = "dnspod-secret"
+)
+
+// fakeDNSPod DNSPod API 3.0 替身，独立校验 TC3-HMAC-SHA256 签名 (记录名称为主机记录)
+type fakeDNSPod struct {
+	t       *testing.T
+	store   recordStore
+	actions []string
+}
+
+func newFakeDNSPod(t *testing.T) (*fakeDNSPod, Provider) {
+	f := &fakeDNSPod{t: t}
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	return f, newDNSPod(Credentials{AccessKey: testDNSPodID, SecretKey: testDNSPodKey, Endpoint: srv.URL})
+}
+
+// verifyTC3 按腾讯云 API 3.0 签名规范重新计算签名并与 Authorization 比对
+func verifyTC3(r *http.Request, payload []byte) error {
+	ts, err := strconv.ParseInt(r.Header.Get("X-TC-Timestamp"), 10, 64)
+	if err != nil {
+		return fmt.Errorf("bad X-TC-Timestamp")
+	}
+	date := time.Unix(ts, 0).UTC().Format("2006-01-02")
+	scope := date + "/dnspod/tc3_request"
+	contentType := r.Header.Get("Content-Type")
+	canonical := "POST\n/\n\ncontent-type:" + contentType + "\nhost:" + r.Host + "\n\ncontent-type;host\n" + sha256Hex(payload)
+	stringToSign := "TC3-HMAC-SHA256\n" + strconv.FormatInt(ts, 10) + "\n" + scope + "\n" + sha256Hex([]byte(canonical))
+	key := hmacSHA256(hmacSHA256(hmacSHA256([]byte("TC3"+testDNSPodKey), date), "dnspod"), "tc3_request")
+	want := "TC3-HMAC-SHA256 Credential=" + testDNSPodID + "/" + scope + ", SignedHeaders=content-type;host, Signature=" + hex.EncodeToString(hmacSHA256(key, stringToSign))
+	if r.Header.Get("Authorization") != want {
+		return fmt.Errorf("signature mismatch")
+	}
+	return nil
+}
+
+// reply 以 API 3.0 格式返回，错误同样为 HTTP 200
+func (f *fakeDNSPod) reply(w http.ResponseWriter, resp map[string]interface{}) {
+	resp["RequestId"] = "req-1"
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"Response": resp})
+}
+
+func (f *fakeDNSPod) fail(w http.ResponseWriter, code, msg string) {
+	f.reply(w, map[string]interface{}{"Error": map[string]string{"Code": code, "Message": msg}})
+}
+
+func (f *fakeDNSPod) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	payload, _ := io.ReadAll(r.Body)
+	if err := verifyTC3(r, payload); err != nil {
+		f.fail(w, "AuthFailure.SignatureFailure", "The provided credentials could not be validated.")
+		return
+	}
+	if r.Header.Get("X-TC-Version") != dnspodVersion {
+		f.fail(w, "InvalidParameter", "bad version")
+		return
+	}
+	var params struct {
+		Domain     string
+		Subdomain  string
+		SubDomain  string
+		RecordType string
+		RecordLine string
+		Value      string
+		TTL        int
+		RecordID   uint64 `json:"RecordId"`
+		Offset     int
+		Limit      int
+	}
+	json.Unmarshal(payload, &params)
+	action := r.Header.Get("X-TC-Action")
+	f.actions = append(f.actions, action)
+	if params.Domain != "" && params.Domain != "example.com" {
+		f.fail(w, "ResourceNotFound.NoDataOfDomain", "The domain does not exist.")
+		return
+	}
+	id := strconv.FormatUint(params.RecordID, 10)
+	switch action {
+	case "DescribeRecordList":
+		var list []map[string]interface{}
+		for _, rec := range f.store.match(params.Subdomain, params.RecordType) {
+			recID, _ := strconv.ParseUint(rec.ID, 10, 64)
+			list = append(list, map[string]interface{}{"RecordId": recID, "Name": rec.Name, "Type": rec.Type, "Value": rec.Content, "TTL": rec.TTL, "Line": dnspodLine})
+		}
+		if len(list) == 0 {
+			f.fail(w, "ResourceNotFound.NoDataOfRecord", "The record list is empty.")
+			return
+		}
+		total := len(list)
+		list = list[min(params.Offset, total):min(params.Offset+params.Limit, total)]
+		f.reply(w, map[string]interface{}{"RecordCountInfo": map[string]int{"TotalCount": total}, "RecordList": list})
+	case "CreateRecord", "ModifyRecord":
+		if params.RecordLine != dnspodLine {
+			f.fail(w, "InvalidParameter.RecordLineInvalid", "The record line is invalid.")
+			return
+		}
+		if params.RecordType == TypeA && strings.Contains(params.Value, ":") {
+			f.fail(w, "InvalidParameter.RecordValueInvalid", "The record value is invalid.")
+			return
+		}
+		if action == "CreateRecord" {
+			rec := f.store.add(params.SubDomain, params.RecordType, params.Value, params.TTL, false)
+			recID, _ := strconv.ParseUint(rec.ID, 10, 64)
+			f.reply(w, map[string]interface{}{"RecordId": recID})
+			return
+		}
+		rec := f.store.find(id)
+		if rec == nil {
+			f.fail(w, "ResourceNotFound.NoDataOfRecord", "The record does not exist.")
+			return
+		}
+		rec.Name, rec.Type, rec.Content, rec.TTL = params.SubDomain, params.RecordType, params.Value, params.TTL
+		f.reply(w, map[string]interface{}{"RecordId": params.RecordID})
+	case "DeleteRecord":
+		if !f.store.remove(id) {
+			f.fail(w, "ResourceNotFound.NoDataOfRecord", "The record does not exist.")
+			return
+		}
+		f.reply(w, map[string]interface{}{})
+	default:
+		f.t.Errorf("unexpected action %s", action)
+		f.fail(w, "InvalidAction", "action not found")
+	}
+}
+
+func TestDNSPodUpsert(t *testing.T) {
+	f, p := newFakeDNSPod(t)
+	ctx := context.Background()
+
+	// 没有记录时 DescribeRecordList 返回 NoDataOfRecord 错误，视为空列表
+	rec, err := Upsert(ctx, p, "example.com", Record{Type: TypeA, Name: "hk.example.com", Content: "1.1.1.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.ID == "" || rec.Name != "hk" || rec.TTL != dnspodDefaultTTL || f.store.contents("hk", TypeA) != "1.1.1.1" {
+		t.Errorf("created %+v", rec)
+	}
+
+	f.store.match("hk", TypeA)[0].TTL = 1200
+	f.store.add("hk", TypeA, "1.1.1.2", 600, false)
+	f.store.add("jp", TypeA, "9.9.9.9", 600, false)
+	if _, err := Upsert(ctx, p, "example.com", Record{Type: TypeA, Name: "hk", Content: "2.2.2.2"}); err != nil {
+		t.Fatal(err)
+	}
+	if list := f.store.match("hk", TypeA); len(list) != 1 || list[0].Content != "2.2.2.2" || list[0].TTL != 1200 {
+		t.Errorf("records after upsert = %+v", list)
+	}
+	if f.store.contents("jp", TypeA) != "9.9.9.9" {
+		t.Error("upsert touched another record")
+	}
+	if got := strings.Join(f.actions, ","); got != "DescribeRecordList,CreateRecord,DescribeRecordList,ModifyRecord,DeleteRecord" {
+		t.Errorf("actions = %s", got)
+	}
+}
+
+func TestDNSPodErrors(t *testing.T) {
+	_, p := newFakeDNSPod(t)
+	ctx := context.Background()
+
+	if _, err := p.CreateRecord(ctx, "example.com", Record{Type: TypeA, Name: "hk", Content: "::1"}); err == nil || !strings.Contains(err.Error(), "InvalidParameter.RecordValueInvalid") {
+		t.Errorf("api error = %v", err)
+	}
+	if _, err := p.ListRecords(ctx, "other.com", "", ""); err == nil || !strings.Contains(err.Error(), "NoDataOfDomain") {
+		t.Errorf("unknown domain error = %v", err)
+	}
+	if _, err := p.UpdateRecord(ctx, "example.com", Record{ID: "abc", Type: TypeA, Name: "hk", Content: "1.1.1.1"}); err == nil || !strings.Contains(err.Error(), "invalid dnspod record id") {
+		t.Errorf("bad id error = %v", err)
+	}
+
+	wrong := newDNSPod(Credentials{AccessKey: testDNSPodID, SecretKey: "wrong", Endpoint: p.(*dnspodProvider).cred.Endpoint})
+	if _, err := wrong.ListRecords(ctx, "example.com", "", ""); err == nil || !strings.Contains(err.Error(), "AuthFailure.SignatureFailure") {
+		t.Errorf("bad signature error = %v", err)
+	}
+	if _, err := newDNSPod(Credentials{AccessKey: testDNSPodID}).ListRecords(ctx, "example.com", "", ""); err == nil || !strings.Contains(err.Error(), "not configured") {
+		t.Errorf("missing key error = %v", err)
+	}
+}
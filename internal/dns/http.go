@@ -0,0 +1,26 @@
+package dns
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+var httpClient = &http.Client{Timeout: 30 * time.Second}
+
+// ttlOrDefault TTL 为 0 时使用平台默认值
+func ttlOrDefault(ttl, def int) int {
+	if ttl <= 0 {
+		return def
+	}
+	return ttl
+}
+
+// truncate 截断无法解析的错误响应
+func truncate(s string) string {
+	s = strings.TrimSpace(s)
+	if len(s) > 300 {
+		s = s[:300]
+	}
+	return s
+}
@@ -0,0 +1,204 @@
+package dns
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// 支持的 DNS 平台
+const (
+	ProviderCloudflare = "cloudflare"
+	ProviderRoute53    = "route53"
+	ProviderAliDNS     = "alidns"
+	ProviderDNSPod     = "dnspod"
+)
+
+// 支持的记录类型
+const (
+	TypeA     = "A"
+	TypeAAAA  = "AAAA"
+	TypeCNAME = "CNAME"
+)
+
+// Record DNS 记录
+type Record struct {
+	ID      string `json:"id"`      // 平台记录 ID (Route53 无记录 ID，为 "名称/类型")
+	Type    string `json:"type"`    // A, AAAA, CNAME
+	Name    string `json:"name"`    // 相对于域名的主机记录 ("www"，根域名为 "@")
+	Content string `json:"content"` // IP 或 CNAME 目标
+	TTL     int    `json:"ttl"`     // 0 使用平台默认值 (Upsert 更新已有记录时沿用原 TTL)
+	Proxied *bool  `json:"proxied"` // 仅 Cloudflare：是否开启代理 (橙色云)，为空时新记录不开启、Upsert 更新时沿用原设置
+}
+
+// Credentials DNS 平台凭证
+type Credentials struct {
+	AccessKey string // API Token (Cloudflare) 或 AccessKey ID / SecretId
+	SecretKey string // Secret Access Key / AccessKey Secret / SecretKey
+	Endpoint  string // 自定义 API 地址，为空使用官方地址
+}
+
+// Provider DNS 平台的统一接口，zone 为根域名 (example.com)
+type Provider interface {
+	Name() string
+	// ListRecords 列出记录，name / recordType 为空时不过滤
+	ListRecords(ctx context.Context, zone, name, recordType string) ([]Record, error)
+	CreateRecord(ctx context.Context, zone string, rec Record) (*Record, error)
+	// UpdateRecord 按 rec.ID 更新记录
+	UpdateRecord(ctx context.Context, zone string, rec Record) (*Record, error)
+	DeleteRecord(ctx context.Context, zone string, rec Record) error
+}
+
+type factory func(cred Credentials) Provider
+
+var (
+	factories     = map[string]factory{}
+	providerOrder []string
+)
+
+func register(name string, f factory) {
+	factories[name] = f
+	providerOrder = append(providerOrder, name)
+}
+
+func init() {
+	register(ProviderCloudflare, newCloudflare)
+	register(ProviderRoute53, newRoute53)
+	register(ProviderAliDNS, newAliDNS)
+	register(ProviderDNSPod, newDNSPod)
+}
+
+// New 创建 DNS 平台客户端
+func New(name string, cred Credentials) (Provider, error) {
+	f, ok := factories[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown dns provider: %s", name)
+	}
+	return f(cred), nil
+}
+
+// Providers 返回支持的 DNS 平台 (按注册顺序)
+func Providers() []string {
+	return append([]string(nil), providerOrder...)
+}
+
+// AccountProvider DNS 平台凭证在账号池中对应的平台
+func AccountProvider(name string) string {
+	switch name {
+	case ProviderRoute53:
+		return "aws"
+	case ProviderAliDNS:
+		return "aliyun"
+	case ProviderDNSPod:
+		return "tencentcloud"
+	}
+	return name
+}
+
+// Upsert 按名称与类型写入记录：已存在时更新第一条并删除其余同名同类型记录，否则创建。
+// 更新时 rec 未指定的 TTL (0) 与代理设置 (nil) 沿用已有记录，避免换 IP 时重置手动调整过的设置
+func Upsert(ctx context.Context, p Provider, zone string, rec Record) (*Record, error) {
+	if err := ValidateRecord(rec); err != nil {
+		return nil, err
+	}
+	rec.Name = RelativeName(zone, rec.Name)
+	existing, err := p.ListRecords(ctx, zone, rec.Name, rec.Type)
+	if err != nil {
+		return nil, err
+	}
+	if len(existing) == 0 {
+		return p.CreateRecord(ctx, zone, rec)
+	}
+	rec.ID = existing[0].ID
+	if rec.TTL == 0 {
+		rec.TTL = existing[0].TTL
+	}
+	if rec.Proxied == nil {
+		rec.Proxied = existing[0].Proxied
+	}
+	updated, err := p.UpdateRecord(ctx, zone, rec)
+	if err != nil {
+		return nil, err
+	}
+	// 多余的同名记录会让解析轮询到旧 IP
+	for _, old := range existing[1:] {
+		if err := p.DeleteRecord(ctx, zone, old); err != nil {
+			return updated, fmt.Errorf("record updated but failed to delete duplicate %s: %v", old.Content, err)
+		}
+	}
+	return updated, nil
+}
+
+// DeleteByName 删除指定名称与类型的全部记录，返回删除的条数
+func DeleteByName(ctx context.Context, p Provider, zone, name, recordType string) (int, error) {
+	existing, err := p.ListRecords(ctx, zone, RelativeName(zone, name), recordType)
+	if err != nil {
+		return 0, err
+	}
+	for i, rec := range existing {
+		if err := p.DeleteRecord(ctx, zone, rec); err != nil {
+			return i, err
+		}
+	}
+	return len(existing), nil
+}
+
+// ValidateRecord 校验记录类型与内容
+func ValidateRecord(rec Record) error {
+	if rec.Name == "" {
+		return fmt.Errorf("record name is required")
+	}
+	if rec.TTL < 0 {
+		return fmt.Errorf("ttl must not be negative")
+	}
+	ip := net.ParseIP(rec.Content)
+	switch rec.Type {
+	case TypeA:
+		if ip == nil || ip.To4() == nil {
+			return fmt.Errorf("A record needs an IPv4 address: %q", rec.Content)
+		}
+	case TypeAAAA:
+		if ip == nil || ip.To4() != nil {
+			return fmt.Errorf("AAAA record needs an IPv6 address: %q", rec.Content)
+		}
+	case TypeCNAME:
+		if rec.Content == "" || ip != nil {
+			return fmt.Errorf("CNAME record needs a host name: %q", rec.Content)
+		}
+	default:
+		return fmt.Errorf("unsupported record type: %q (A, AAAA, CNAME)", rec.Type)
+	}
+	return nil
+}
+
+// IPRecordType 根据 IP 返回 A 或 AAAA
+func IPRecordType(ip string) string {
+	if parsed := net.ParseIP(ip); parsed != nil && parsed.To4() == nil {
+		return TypeAAAA
+	}
+	return TypeA
+}
+
+// RelativeName 将完整域名转换为相对于 zone 的主机记录 ("transitnode.example.com" -> "transitnode")
+func RelativeName(zone, name string) string {
+	zone = strings.ToLower(strings.TrimSuffix(zone, "."))
+	name = strings.TrimSuffix(name, ".")
+	lower := strings.ToLower(name)
+	switch {
+	case name == "" || name == "@" || lower == zone:
+		return "@"
+	case strings.HasSuffix(lower, "."+zone):
+		return name[:len(name)-len(zone)-1]
+	}
+	return name
+}
+
+// FQDN 返回主机记录的完整域名 (不含末尾的点)
+func FQDN(zone, name string) string {
+	zone = strings.TrimSuffix(zone, ".")
+	if rel := RelativeName(zone, name); rel != "@" {
+		return rel + "." + zone
+	}
+	return zone
+}
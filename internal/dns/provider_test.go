@@ -0,0 +1,245 @@
+package dns
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeRecord DNS 平台替身中保存的记录 (Name 为各平台原生格式)
+type fakeRecord struct {
+	ID      string
+	Name    string
+	Type    string
+	Content string
+	TTL     int
+	Proxied bool
+}
+
+// recordStore 平台替身共用的内存记录表
+type recordStore struct {
+	mu      sync.Mutex
+	next    int
+	records []*fakeRecord
+}
+
+func (s *recordStore) add(name, recordType, content string, ttl int, proxied bool) *fakeRecord {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.next++
+	r := &fakeRecord{ID: strconv.Itoa(100 + s.next), Name: name, Type: recordType, Content: content, TTL: ttl, Proxied: proxied}
+	s.records = append(s.records, r)
+	return r
+}
+
+func (s *recordStore) find(id string) *fakeRecord {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, r := range s.records {
+		if r.ID == id {
+			return r
+		}
+	}
+	return nil
+}
+
+func (s *recordStore) remove(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, r := range s.records {
+		if r.ID == id {
+			s.records = append(s.records[:i], s.records[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// match 按名称与类型精确过滤，空值不过滤
+func (s *recordStore) match(name, recordType string) []*fakeRecord {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []*fakeRecord
+	for _, r := range s.records {
+		if (name == "" || r.Name == name) && (recordType == "" || r.Type == recordType) {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// contents 返回指定名称与类型的记录内容 (排序后以逗号连接)
+func (s *recordStore) contents(name, recordType string) string {
+	var values []string
+	for _, r := range s.match(name, recordType) {
+		values = append(values, r.Content)
+	}
+	sort.Strings(values)
+	return strings.Join(values, ",")
+}
+
+// memProvider 直接读写 recordStore 的 Provider，用于测试 Upsert / DeleteByName 的逻辑
+type memProvider struct {
+	store      *recordStore
+	failDelete bool
+	updates    []Record
+}
+
+func (p *memProvider) Name() string { return "mem" }
+
+func (p *memProvider) ListRecords(_ context.Context, zone, name, recordType string) ([]Record, error) {
+	var out []Record
+	for _, r := range p.store.match(name, recordType) {
+		proxied := r.Proxied
+		out = append(out, Record{ID: r.ID, Type: r.Type, Name: r.Name, Content: r.Content, TTL: r.TTL, Proxied: &proxied})
+	}
+	return out, nil
+}
+
+func (p *memProvider) CreateRecord(_ context.Context, zone string, rec Record) (*Record, error) {
+	r := p.store.add(rec.Name, rec.Type, rec.Content, rec.TTL, rec.Proxied != nil && *rec.Proxied)
+	rec.ID = r.ID
+	return &rec, nil
+}
+
+func (p *memProvider) UpdateRecord(_ context.Context, zone string, rec Record) (*Record, error) {
+	p.updates = append(p.updates, rec)
+	r := p.store.find(rec.ID)
+	if r == nil {
+		return nil, fmt.Errorf("record %s not found", rec.ID)
+	}
+	r.Content, r.TTL = rec.Content, rec.TTL
+	if rec.Proxied != nil {
+		r.Proxied = *rec.Proxied
+	}
+	return &rec, nil
+}
+
+func (p *memProvider) DeleteRecord(_ context.Context, zone string, rec Record) error {
+	if p.failDelete {
+		return fmt.Errorf("delete denied")
+	}
+	p.store.remove(rec.ID)
+	return nil
+}
+
+func boolPtr(b bool) *bool { return &b }
+
+func TestUpsertCreates(t *testing.T) {
+	p := &memProvider{store: &recordStore{}}
+	rec, err := Upsert(context.Background(), p, "example.com", Record{Type: TypeA, Name: "hk.example.com", Content: "1.2.3.4"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.ID == "" || rec.Name != "hk" || p.store.contents("hk", TypeA) != "1.2.3.4" {
+		t.Errorf("created %+v, store %q", rec, p.store.contents("hk", TypeA))
+	}
+}
+
+func TestUpsertKeepsTTLAndProxied(t *testing.T) {
+	store := &recordStore{}
+	store.add("hk", TypeA, "1.1.1.1", 120, true)
+	p := &memProvider{store: store}
+
+	// 未指定 TTL 与代理设置 (如未绑定域名时的默认 Cloudflare 配置) 时沿用已有记录
+	if _, err := Upsert(context.Background(), p, "example.com", Record{Type: TypeA, Name: "hk", Content: "2.2.2.2"}); err != nil {
+		t.Fatal(err)
+	}
+	r := store.match("hk", TypeA)[0]
+	if r.Content != "2.2.2.2" || r.TTL != 120 || !r.Proxied {
+		t.Errorf("record after upsert = %+v", *r)
+	}
+
+	// 显式指定时覆盖
+	if _, err := Upsert(context.Background(), p, "example.com", Record{Type: TypeA, Name: "hk", Content: "3.3.3.3", TTL: 600, Proxied: boolPtr(false)}); err != nil {
+		t.Fatal(err)
+	}
+	if r.Content != "3.3.3.3" || r.TTL != 600 || r.Proxied {
+		t.Errorf("record after explicit upsert = %+v", *r)
+	}
+}
+
+func TestUpsertDeletesDuplicates(t *testing.T) {
+	store := &recordStore{}
+	first := store.add("hk", TypeA, "1.1.1.1", 60, false)
+	store.add("hk", TypeA, "1.1.1.2", 60, false)
+	store.add("hk", TypeA, "1.1.1.3", 60, false)
+	store.add("hk", TypeAAAA, "2001:db8::1", 60, false)
+	store.add("jp", TypeA, "9.9.9.9", 60, false)
+	p := &memProvider{store: store}
+
+	if _, err := Upsert(context.Background(), p, "example.com", Record{Type: TypeA, Name: "hk", Content: "5.5.5.5"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(p.updates) != 1 || p.updates[0].ID != first.ID {
+		t.Errorf("updates = %+v", p.updates)
+	}
+	if got := store.contents("hk", TypeA); got != "5.5.5.5" {
+		t.Errorf("hk A = %q", got)
+	}
+	if store.contents("hk", TypeAAAA) != "2001:db8::1" || store.contents("jp", TypeA) != "9.9.9.9" {
+		t.Error("upsert touched records of another name or type")
+	}
+
+	store.add("hk", TypeA, "1.1.1.9", 60, false)
+	p.failDelete = true
+	rec, err := Upsert(context.Background(), p, "example.com", Record{Type: TypeA, Name: "hk", Content: "6.6.6.6"})
+	if err == nil || !strings.Contains(err.Error(), "duplicate 1.1.1.9") || rec == nil || rec.Content != "6.6.6.6" {
+		t.Errorf("duplicate delete failure = %+v, %v", rec, err)
+	}
+}
+
+func TestUpsertValidates(t *testing.T) {
+	p := &memProvider{store: &recordStore{}}
+	for _, rec := range []Record{
+		{Type: TypeA, Name: "hk", Content: "2001:db8::1"},
+		{Type: TypeAAAA, Name: "hk", Content: "1.2.3.4"},
+		{Type: "MX", Name: "hk", Content: "mail.example.com"},
+		{Type: TypeA, Name: "", Content: "1.2.3.4"},
+		{Type: TypeA, Name: "hk", Content: "1.2.3.4", TTL: -1},
+	} {
+		if _, err := Upsert(context.Background(), p, "example.com", rec); err == nil {
+			t.Errorf("Upsert(%+v) accepted an invalid record", rec)
+		}
+	}
+	if len(p.store.records) != 0 {
+		t.Error("invalid records were written")
+	}
+}
+
+func TestDeleteByName(t *testing.T) {
+	store := &recordStore{}
+	store.add("hk", TypeA, "1.1.1.1", 60, false)
+	store.add("hk", TypeA, "1.1.1.2", 60, false)
+	store.add("hk", TypeAAAA, "2001:db8::1", 60, false)
+	p := &memProvider{store: store}
+
+	n, err := DeleteByName(context.Background(), p, "example.com", "hk.example.com", TypeA)
+	if err != nil || n != 2 {
+		t.Fatalf("deleted %d, %v", n, err)
+	}
+	if store.contents("hk", TypeA) != "" || store.contents("hk", TypeAAAA) == "" {
+		t.Error("wrong records deleted")
+	}
+}
+
+func TestNames(t *testing.T) {
+	cases := []struct{ zone, name, rel, fqdn string }{
+		{"example.com", "hk", "hk", "hk.example.com"},
+		{"example.com", "hk.example.com.", "hk", "hk.example.com"},
+		{"example.com", "@", "@", "example.com"},
+		{"example.com", "example.com", "@", "example.com"},
+	}
+	for _, c := range cases {
+		if got := RelativeName(c.zone, c.name); got != c.rel {
+			t.Errorf("RelativeName(%q, %q) = %q, want %q", c.zone, c.name, got, c.rel)
+		}
+		if got := FQDN(c.zone, c.name); got != c.fqdn {
+			t.Errorf("FQDN(%q, %q) = %q, want %q", c.zone, c.name, got, c.fqdn)
+		}
+	}
+}
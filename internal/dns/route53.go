@@ -0,0 +1,240 @@
+package dns
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+)
+
+const (
+	route53API   = "https://route53.amazonaws.com/2013-04-01"
+	route53XMLNS = "https://route53.amazonaws.com/doc/2013-04-01/"
+	// route53DefaultTTL Route53 的记录必须带 TTL
+	route53DefaultTTL = 300
+)
+
+// route53Provider AWS Route53 (凭证为 Access Key，使用 SigV4 签名的 REST API)。
+// Route53 以 "名称 + 类型" 的记录集为单位，记录 ID 为 "名称/类型"，多值记录集只取第一个值
+type route53Provider struct {
+	cred Credentials
+}
+
+func newRoute53(cred Credentials) Provider { return &route53Provider{cred: cred} }
+
+func (p *route53Provider) Name() string { return ProviderRoute53 }
+
+type route53RecordSet struct {
+	Name            string `xml:"Name"`
+	Type            string `xml:"Type"`
+	TTL             int    `xml:"TTL,omitempty"`
+	ResourceRecords struct {
+		Values []string `xml:"ResourceRecord>Value"`
+	} `xml:"ResourceRecords"`
+}
+
+type route53Change struct {
+	Action string           `xml:"Action"`
+	Set    route53RecordSet `xml:"ResourceRecordSet"`
+}
+
+type route53ChangeRequest struct {
+	XMLName xml.Name        `xml:"ChangeResourceRecordSetsRequest"`
+	XMLNS   string          `xml:"xmlns,attr"`
+	Changes []route53Change `xml:"ChangeBatch>Changes>Change"`
+}
+
+func (p *route53Provider) do(ctx context.Context, method, path string, body, out interface{}) error {
+	if p.cred.AccessKey == "" || p.cred.SecretKey == "" {
+		return fmt.Errorf("route53 access key not configured")
+	}
+	var payload []byte
+	if body != nil {
+		data, err := xml.Marshal(body)
+		if err != nil {
+			return err
+		}
+		payload = append([]byte(xml.Header), data...)
+	}
+	base := route53API
+	if p.cred.Endpoint != "" {
+		base = strings.TrimRight(p.cred.Endpoint, "/")
+	}
+	req, err := http.NewRequestWithContext(ctx, method, base+path, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/xml")
+	}
+	sum := sha256.Sum256(payload)
+	creds := aws.Credentials{AccessKeyID: p.cred.AccessKey, SecretAccessKey: p.cred.SecretKey}
+	if err := v4.NewSigner().SignHTTP(ctx, creds, req, hex.EncodeToString(sum[:]), "route53", "us-east-1", time.Now()); err != nil {
+		return err
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("route53 api %s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 8<<20))
+	if resp.StatusCode >= 300 {
+		var e struct {
+			Code    string `xml:"Error>Code"`
+			Message string `xml:"Error>Message"`
+		}
+		msg := truncate(string(data))
+		if xml.Unmarshal(data, &e) == nil && e.Code != "" {
+			msg = e.Code + ": " + e.Message
+		}
+		return fmt.Errorf("route53 api error (HTTP %d) %s %s: %s", resp.StatusCode, method, path, msg)
+	}
+	if out != nil {
+		if err := xml.Unmarshal(data, out); err != nil {
+			return fmt.Errorf("route53 api %s %s: decode response: %v", method, path, err)
+		}
+	}
+	return nil
+}
+
+// hostedZoneID 按域名查找托管区域 ID (不含 /hostedzone/ 前缀)
+func (p *route53Provider) hostedZoneID(ctx context.Context, zone string) (string, error) {
+	var out struct {
+		Zones []struct {
+			ID   string `xml:"Id"`
+			Name string `xml:"Name"`
+		} `xml:"HostedZones>HostedZone"`
+	}
+	fqdn := strings.TrimSuffix(zone, ".") + "."
+	if err := p.do(ctx, "GET", "/hostedzonesbyname?"+url.Values{"dnsname": {fqdn}, "maxitems": {"1"}}.Encode(), nil, &out); err != nil {
+		return "", err
+	}
+	if len(out.Zones) == 0 || !strings.EqualFold(out.Zones[0].Name, fqdn) {
+		return "", fmt.Errorf("route53 hosted zone %s not found", zone)
+	}
+	return strings.TrimPrefix(out.Zones[0].ID, "/hostedzone/"), nil
+}
+
+func (p *route53Provider) ListRecords(ctx context.Context, zone, name, recordType string) ([]Record, error) {
+	zoneID, err := p.hostedZoneID(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+	sets, err := p.listSets(ctx, zoneID, zone, name, recordType)
+	if err != nil {
+		return nil, err
+	}
+	records := make([]Record, 0, len(sets))
+	for _, s := range sets {
+		rec := Record{ID: RelativeName(zone, s.Name) + "/" + s.Type, Type: s.Type, Name: RelativeName(zone, s.Name), TTL: s.TTL}
+		if len(s.ResourceRecords.Values) > 0 {
+			rec.Content = strings.TrimSuffix(s.ResourceRecords.Values[0], ".")
+		}
+		records = append(records, rec)
+	}
+	return records, nil
+}
+
+// listSets 列出 A/AAAA/CNAME 记录集；指定名称时从该名称开始列出并精确过滤
+func (p *route53Provider) listSets(ctx context.Context, zoneID, zone, name, recordType string) ([]route53RecordSet, error) {
+	var sets []route53RecordSet
+	query := url.Values{"maxitems": {"300"}}
+	if name != "" {
+		query.Set("name", FQDN(zone, name)+".")
+		if recordType != "" {
+			query.Set("type", recordType)
+		}
+	}
+	for {
+		var out struct {
+			Sets        []route53RecordSet `xml:"ResourceRecordSets>ResourceRecordSet"`
+			IsTruncated bool               `xml:"IsTruncated"`
+			NextName    string             `xml:"NextRecordName"`
+			NextType    string             `xml:"NextRecordType"`
+		}
+		if err := p.do(ctx, "GET", "/hostedzone/"+zoneID+"/rrset?"+query.Encode(), nil, &out); err != nil {
+			return nil, err
+		}
+		for _, s := range out.Sets {
+			if name != "" && RelativeName(zone, s.Name) != RelativeName(zone, name) {
+				// 记录按名称排序，越过目标名称后不会再有匹配
+				return sets, nil
+			}
+			if s.Type != TypeA && s.Type != TypeAAAA && s.Type != TypeCNAME {
+				continue
+			}
+			if recordType == "" || s.Type == recordType {
+				sets = append(sets, s)
+			}
+		}
+		if !out.IsTruncated {
+			return sets, nil
+		}
+		query.Set("name", out.NextName)
+		query.Set("type", out.NextType)
+	}
+}
+
+func (p *route53Provider) change(ctx context.Context, zone, action string, rec Record) (*Record, error) {
+	zoneID, err := p.hostedZoneID(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+	rec.TTL = ttlOrDefault(rec.TTL, route53DefaultTTL)
+	rec.Name = RelativeName(zone, rec.Name)
+	set := route53RecordSet{Name: FQDN(zone, rec.Name) + ".", Type: rec.Type, TTL: rec.TTL}
+	set.ResourceRecords.Values = []string{rec.Content}
+	err = p.do(ctx, "POST", "/hostedzone/"+zoneID+"/rrset", route53ChangeRequest{
+		XMLNS:   route53XMLNS,
+		Changes: []route53Change{{Action: action, Set: set}},
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+	rec.ID = rec.Name + "/" + rec.Type
+	rec.Proxied = nil
+	return &rec, nil
+}
+
+func (p *route53Provider) CreateRecord(ctx context.Context, zone string, rec Record) (*Record, error) {
+	return p.change(ctx, zone, "CREATE", rec)
+}
+
+// UpdateRecord 使用 UPSERT 覆盖记录集 (名称/类型取自 rec)
+func (p *route53Provider) UpdateRecord(ctx context.Context, zone string, rec Record) (*Record, error) {
+	return p.change(ctx, zone, "UPSERT", rec)
+}
+
+// DeleteRecord 删除记录集 (Route53 要求提交与当前完全一致的记录集)
+func (p *route53Provider) DeleteRecord(ctx context.Context, zone string, rec Record) error {
+	zoneID, err := p.hostedZoneID(ctx, zone)
+	if err != nil {
+		return err
+	}
+	name, recordType := rec.Name, rec.Type
+	if i := strings.LastIndex(rec.ID, "/"); i > 0 {
+		name, recordType = rec.ID[:i], rec.ID[i+1:]
+	}
+	sets, err := p.listSets(ctx, zoneID, zone, name, recordType)
+	if err != nil {
+		return err
+	}
+	if len(sets) == 0 {
+		return nil
+	}
+	return p.do(ctx, "POST", "/hostedzone/"+zoneID+"/rrset", route53ChangeRequest{
+		XMLNS:   route53XMLNS,
+		Changes: []route53Change{{Action: "DELETE", Set: sets[0]}},
+	}, nil)
+}
@@ -0,0 +1,262 @@
+package dns
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"testing"
+)
+
+const (
+	testAWSKeyID  = "AKIDEXAMPLE"
+	testAWSSecret = "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"
+)
+
+// fakeRoute53 Route53 REST API 替身，独立校验 SigV4 签名 (记录名称为带点的完整域名)
+type fakeRoute53 struct {
+	t       *testing.T
+	store   recordStore
+	changes []string
+}
+
+func newFakeRoute53(t *testing.T) (*fakeRoute53, Provider) {
+	f := &fakeRoute53{t: t}
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	return f, newRoute53(Credentials{AccessKey: testAWSKeyID, SecretKey: testAWSSecret, Endpoint: srv.URL})
+}
+
+func awsEscape(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
+
+// verifySigV4 按 SigV4 规范重新计算签名并与 Authorization 比对
+func verifySigV4(r *http.Request, payload []byte) error {
+	auth := r.Header.Get("Authorization")
+	date := r.Header.Get("X-Amz-Date")
+	if len(date) < 8 {
+		return fmt.Errorf("missing X-Amz-Date")
+	}
+	scope := date[:8] + "/us-east-1/route53/aws4_request"
+	prefix := "AWS4-HMAC-SHA256 Credential=" + testAWSKeyID + "/" + scope + ", SignedHeaders="
+	if !strings.HasPrefix(auth, prefix) {
+		return fmt.Errorf("bad authorization header %q", auth)
+	}
+	parts := strings.SplitN(strings.TrimPrefix(auth, prefix), ", Signature=", 2)
+	if len(parts) != 2 {
+		return fmt.Errorf("bad authorization header %q", auth)
+	}
+	signed := strings.Split(parts[0], ";")
+	if !sort.StringsAreSorted(signed) || !strings.Contains(parts[0], "host") || !strings.Contains(parts[0], "x-amz-date") {
+		return fmt.Errorf("bad signed headers %q", parts[0])
+	}
+
+	var headers strings.Builder
+	for _, h := range signed {
+		value := r.Header.Get(h)
+		switch h {
+		case "host":
+			value = r.Host
+		case "content-length":
+			value = fmt.Sprint(r.ContentLength)
+		}
+		headers.WriteString(h + ":" + strings.TrimSpace(value) + "\n")
+	}
+	query := r.URL.Query()
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = awsEscape(k) + "=" + awsEscape(query.Get(k))
+	}
+	sum := sha256.Sum256(payload)
+	canonical := strings.Join([]string{r.Method, r.URL.EscapedPath(), strings.Join(pairs, "&"), headers.String(), parts[0], hex.EncodeToString(sum[:])}, "\n")
+	canonicalSum := sha256.Sum256([]byte(canonical))
+	stringToSign := "AWS4-HMAC-SHA256\n" + date + "\n" + scope + "\n" + hex.EncodeToString(canonicalSum[:])
+
+	key := []byte("AWS4" + testAWSSecret)
+	for _, part := range []string{date[:8], "us-east-1", "route53", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	if want := hex.EncodeToString(hmacSHA256(key, stringToSign)); !hmac.Equal([]byte(want), []byte(parts[1])) {
+		return fmt.Errorf("signature mismatch")
+	}
+	return nil
+}
+
+func (f *fakeRoute53) fail(w http.ResponseWriter, status int, code, msg string) {
+	w.WriteHeader(status)
+	fmt.Fprintf(w, `<?xml version="1.0"?><ErrorResponse><Error><Type>Sender</Type><Code>%s</Code><Message>%s</Message></Error></ErrorResponse>`, code, msg)
+}
+
+func (f *fakeRoute53) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	payload, _ := io.ReadAll(r.Body)
+	if err := verifySigV4(r, payload); err != nil {
+		f.fail(w, http.StatusForbidden, "SignatureDoesNotMatch", err.Error())
+		return
+	}
+	switch {
+	case r.Method == "GET" && r.URL.Path == "/hostedzonesbyname":
+		// 与真实 API 相同，返回按名称排序的下一个托管区域
+		fmt.Fprint(w, `<ListHostedZonesByNameResponse><HostedZones><HostedZone><Id>/hostedzone/Z1</Id><Name>example.com.</Name></HostedZone></HostedZones><IsTruncated>false</IsTruncated></ListHostedZonesByNameResponse>`)
+	case r.Method == "GET" && r.URL.Path == "/hostedzone/Z1/rrset":
+		f.listSets(w, r.URL.Query().Get("name"), r.URL.Query().Get("type"))
+	case r.Method == "POST" && r.URL.Path == "/hostedzone/Z1/rrset":
+		f.change(w, payload)
+	default:
+		f.t.Errorf("unexpected request %s %s", r.Method, r.URL)
+		f.fail(w, http.StatusNotFound, "NoSuchHostedZone", "not found")
+	}
+}
+
+// listSets 从 name/type 开始按名称顺序返回记录集 (每页 2 个，用于覆盖分页)
+func (f *fakeRoute53) listSets(w http.ResponseWriter, name, recordType string) {
+	f.store.mu.Lock()
+	sorted := make([]*fakeRecord, len(f.store.records))
+	copy(sorted, f.store.records)
+	f.store.mu.Unlock()
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Name != sorted[j].Name {
+			return sorted[i].Name < sorted[j].Name
+		}
+		return sorted[i].Type < sorted[j].Type
+	})
+	var start []*fakeRecord
+	for _, r := range sorted {
+		if r.Name > name || (r.Name == name && r.Type >= recordType) {
+			start = append(start, r)
+		}
+	}
+	var b strings.Builder
+	b.WriteString(`<ListResourceRecordSetsResponse><ResourceRecordSets>`)
+	for i, r := range start {
+		if i == 2 {
+			break
+		}
+		fmt.Fprintf(&b, `<ResourceRecordSet><Name>%s</Name><Type>%s</Type><TTL>%d</TTL><ResourceRecords><ResourceRecord><Value>%s</Value></ResourceRecord></ResourceRecords></ResourceRecordSet>`, r.Name, r.Type, r.TTL, r.Content)
+	}
+	b.WriteString(`</ResourceRecordSets>`)
+	if len(start) > 2 {
+		fmt.Fprintf(&b, `<IsTruncated>true</IsTruncated><NextRecordName>%s</NextRecordName><NextRecordType>%s</NextRecordType>`, start[2].Name, start[2].Type)
+	} else {
+		b.WriteString(`<IsTruncated>false</IsTruncated>`)
+	}
+	b.WriteString(`<MaxItems>300</MaxItems></ListResourceRecordSetsResponse>`)
+	fmt.Fprint(w, b.String())
+}
+
+func (f *fakeRoute53) change(w http.ResponseWriter, payload []byte) {
+	var req route53ChangeRequest
+	if err := xml.Unmarshal(payload, &req); err != nil || req.XMLName.Space != route53XMLNS || len(req.Changes) != 1 {
+		f.fail(w, http.StatusBadRequest, "InvalidInput", "bad change batch")
+		return
+	}
+	c := req.Changes[0]
+	f.changes = append(f.changes, c.Action+" "+c.Set.Name+" "+c.Set.Type)
+	existing := f.store.match(c.Set.Name, c.Set.Type)
+	content := ""
+	if len(c.Set.ResourceRecords.Values) > 0 {
+		content = c.Set.ResourceRecords.Values[0]
+	}
+	switch c.Action {
+	case "CREATE":
+		if len(existing) > 0 {
+			f.fail(w, http.StatusBadRequest, "InvalidChangeBatch", "record set already exists")
+			return
+		}
+		f.store.add(c.Set.Name, c.Set.Type, content, c.Set.TTL, false)
+	case "UPSERT":
+		if len(existing) == 0 {
+			f.store.add(c.Set.Name, c.Set.Type, content, c.Set.TTL, false)
+		} else {
+			existing[0].Content, existing[0].TTL = content, c.Set.TTL
+		}
+	case "DELETE":
+		if len(existing) == 0 || existing[0].Content != content || existing[0].TTL != c.Set.TTL {
+			f.fail(w, http.StatusBadRequest, "InvalidChangeBatch", "record set not found or values do not match")
+			return
+		}
+		f.store.remove(existing[0].ID)
+	}
+	fmt.Fprint(w, `<ChangeResourceRecordSetsResponse><ChangeInfo><Id>/change/C1</Id><Status>PENDING</Status></ChangeInfo></ChangeResourceRecordSetsResponse>`)
+}
+
+func TestRoute53Upsert(t *testing.T) {
+	f, p := newFakeRoute53(t)
+	ctx := context.Background()
+	f.store.add("a.example.com.", TypeA, "9.9.9.9", 60, false)
+	f.store.add("b.example.com.", "TXT", "\"v=spf1\"", 60, false)
+
+	rec, err := Upsert(ctx, p, "example.com", Record{Type: TypeA, Name: "hk", Content: "1.1.1.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.ID != "hk/A" || rec.TTL != route53DefaultTTL || f.store.contents("hk.example.com.", TypeA) != "1.1.1.1" {
+		t.Errorf("created %+v", rec)
+	}
+
+	// 已有记录时使用 UPSERT 并保留原 TTL
+	f.store.match("hk.example.com.", TypeA)[0].TTL = 120
+	if _, err := Upsert(ctx, p, "example.com", Record{Type: TypeA, Name: "hk.example.com", Content: "2.2.2.2"}); err != nil {
+		t.Fatal(err)
+	}
+	r := f.store.match("hk.example.com.", TypeA)[0]
+	if r.Content != "2.2.2.2" || r.TTL != 120 {
+		t.Errorf("record after upsert = %+v", *r)
+	}
+	if got := strings.Join(f.changes, ","); got != "CREATE hk.example.com. A,UPSERT hk.example.com. A" {
+		t.Errorf("changes = %s", got)
+	}
+
+	// 列表跨越分页，且忽略非 A/AAAA/CNAME 记录
+	f.store.add("z.example.com.", TypeCNAME, "target.example.net", 60, false)
+	records, err := p.ListRecords(ctx, "example.com", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, rec := range records {
+		names = append(names, rec.ID)
+	}
+	if strings.Join(names, ",") != "a/A,hk/A,z/CNAME" {
+		t.Errorf("list = %v", names)
+	}
+
+	n, err := DeleteByName(ctx, p, "example.com", "hk", TypeA)
+	if err != nil || n != 1 || f.store.contents("hk.example.com.", TypeA) != "" {
+		t.Errorf("delete = %d, %v", n, err)
+	}
+}
+
+func TestRoute53Errors(t *testing.T) {
+	f, p := newFakeRoute53(t)
+	ctx := context.Background()
+
+	if _, err := p.ListRecords(ctx, "other.com", "", ""); err == nil || !strings.Contains(err.Error(), "hosted zone other.com not found") {
+		t.Errorf("unknown zone error = %v", err)
+	}
+	f.store.add("hk.example.com.", TypeA, "1.1.1.1", 60, false)
+	if _, err := p.CreateRecord(ctx, "example.com", Record{Type: TypeA, Name: "hk", Content: "2.2.2.2"}); err == nil || !strings.Contains(err.Error(), "HTTP 400") || !strings.Contains(err.Error(), "InvalidChangeBatch: record set already exists") {
+		t.Errorf("api error = %v", err)
+	}
+
+	wrong := newRoute53(Credentials{AccessKey: testAWSKeyID, SecretKey: "wrong", Endpoint: p.(*route53Provider).cred.Endpoint})
+	if _, err := wrong.ListRecords(ctx, "example.com", "", ""); err == nil || !strings.Contains(err.Error(), "SignatureDoesNotMatch") {
+		t.Errorf("bad signature error = %v", err)
+	}
+	if _, err := newRoute53(Credentials{AccessKey: testAWSKeyID}).ListRecords(ctx, "example.com", "", ""); err == nil || !strings.Contains(err.Error(), "not configured") {
+		t.Errorf("missing key error = %v", err)
+	}
+}
@@ -0,0 +1,151 @@
+package dns
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/wangn9900/StealthForward/internal/database"
+	"github.com/wangn9900/StealthForward/internal/models"
+)
+
+// 未绑定云账号时读取的环境变量 (AccessKey, SecretKey)
+var credentialEnv = map[string][2]string{
+	ProviderCloudflare: {"CF_API_TOKEN", ""},
+	ProviderRoute53:    {"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY"},
+	ProviderAliDNS:     {"ALICLOUD_ACCESS_KEY_ID", "ALICLOUD_ACCESS_KEY_SECRET"},
+	ProviderDNSPod:     {"TENCENTCLOUD_SECRET_ID", "TENCENTCLOUD_SECRET_KEY"},
+}
+
+// DefaultZone 返回系统设置中的 Cloudflare 默认域名 (未绑定 DNS 域名的入口使用)
+func DefaultZone() string {
+	var setting models.SystemSetting
+	if err := database.DB.Where("key = ?", models.ConfigKeyCfDefaultZone).Limit(1).Find(&setting).Error; err == nil {
+		return setting.Value
+	}
+	return ""
+}
+
+// zoneCredentials 域名绑定的凭证：绑定的云账号 > (Cloudflare 系统设置中的 Token) > 账号池中第一个可用账号 > 环境变量
+func zoneCredentials(zone *models.DNSZone) (Credentials, error) {
+	want := AccountProvider(zone.Provider)
+	var account models.CloudAccount
+	if zone.CloudAccountID != 0 {
+		if err := database.DB.First(&account, zone.CloudAccountID).Error; err != nil {
+			return Credentials{}, fmt.Errorf("cloud account #%d not found", zone.CloudAccountID)
+		}
+		if !account.Enabled {
+			return Credentials{}, fmt.Errorf("cloud account #%d (%s) is disabled", account.ID, account.Name)
+		}
+		if account.Provider != want {
+			return Credentials{}, fmt.Errorf("cloud account #%d is a %s account, dns provider %s needs %s", account.ID, account.Provider, zone.Provider, want)
+		}
+		return Credentials{AccessKey: account.AccessKey, SecretKey: account.SecretKey, Endpoint: account.Endpoint}, nil
+	}
+
+	if zone.Provider == ProviderCloudflare {
+		var setting models.SystemSetting
+		database.DB.Where("key = ?", models.ConfigKeyCfApiToken).Limit(1).Find(&setting)
+		if setting.Value != "" {
+			return Credentials{AccessKey: setting.Value}, nil
+		}
+	}
+	database.DB.Where("provider = ? AND enabled = ? AND healthy = ?", want, true, true).Order("id").Limit(1).Find(&account)
+	if account.ID != 0 {
+		return Credentials{AccessKey: account.AccessKey, SecretKey: account.SecretKey, Endpoint: account.Endpoint}, nil
+	}
+	env := credentialEnv[zone.Provider]
+	cred := Credentials{AccessKey: os.Getenv(env[0])}
+	if env[1] != "" {
+		cred.SecretKey = os.Getenv(env[1])
+	}
+	if cred.AccessKey == "" {
+		return cred, fmt.Errorf("%s credentials not configured (add a %s account to the cloud account pool or set %s)", zone.Provider, want, env[0])
+	}
+	return cred, nil
+}
+
+// ZoneProvider 创建域名绑定对应的 DNS 平台客户端
+func ZoneProvider(zone *models.DNSZone) (Provider, error) {
+	if _, ok := factories[zone.Provider]; !ok {
+		return nil, fmt.Errorf("unknown dns provider: %s", zone.Provider)
+	}
+	cred, err := zoneCredentials(zone)
+	if err != nil {
+		return nil, err
+	}
+	return New(zone.Provider, cred)
+}
+
+// EntryZone 返回入口绑定的 DNS 域名；未绑定时使用系统设置中的 Cloudflare 默认域名
+func EntryZone(entry models.EntryNode) (*models.DNSZone, error) {
+	if entry.DNSZoneID != 0 {
+		var zone models.DNSZone
+		if err := database.DB.First(&zone, entry.DNSZoneID).Error; err != nil {
+			return nil, fmt.Errorf("dns zone #%d not found", entry.DNSZoneID)
+		}
+		return &zone, nil
+	}
+	domain := DefaultZone()
+	if domain == "" {
+		return nil, fmt.Errorf("entry has no dns zone binding and %s is not set", models.ConfigKeyCfDefaultZone)
+	}
+	return &models.DNSZone{Provider: ProviderCloudflare, Domain: domain}, nil
+}
+
+// UpdateEntryRecord 将入口的子域名解析到 ip (A/AAAA，记录不存在时创建)。
+// domain 不为空时覆盖绑定中的根域名
+func UpdateEntryRecord(ctx context.Context, entry models.EntryNode, domain, recordName, ip string) error {
+	zone, err := EntryZone(entry)
+	if err != nil {
+		return err
+	}
+	if domain != "" {
+		zone.Domain = domain
+	}
+	p, err := ZoneProvider(zone)
+	if err != nil {
+		return err
+	}
+	rec, err := Upsert(ctx, p, zone.Domain, Record{
+		Type:    IPRecordType(ip),
+		Name:    recordName,
+		Content: ip,
+		TTL:     zone.TTL,
+		Proxied: zone.Proxied,
+	})
+	if err != nil {
+		return err
+	}
+	log.Printf("[DNS] Updated %s record %s -> %s (%s)", rec.Type, FQDN(zone.Domain, rec.Name), ip, zone.Provider)
+	return nil
+}
+
+// ValidateZone 校验并规范化域名绑定
+func ValidateZone(zone *models.DNSZone) error {
+	if _, ok := factories[zone.Provider]; !ok {
+		return fmt.Errorf("unknown dns provider: %q (%s)", zone.Provider, strings.Join(Providers(), ", "))
+	}
+	zone.Domain = strings.ToLower(strings.Trim(strings.TrimSpace(zone.Domain), "."))
+	if zone.Domain == "" {
+		return fmt.Errorf("domain is required")
+	}
+	if zone.TTL < 0 {
+		return fmt.Errorf("ttl must not be negative")
+	}
+	if zone.Proxied != nil && *zone.Proxied && zone.Provider != ProviderCloudflare {
+		return fmt.Errorf("proxied is only supported by cloudflare")
+	}
+	if zone.CloudAccountID != 0 {
+		var account models.CloudAccount
+		if err := database.DB.First(&account, zone.CloudAccountID).Error; err != nil {
+			return fmt.Errorf("cloud account #%d not found", zone.CloudAccountID)
+		}
+		if want := AccountProvider(zone.Provider); account.Provider != want {
+			return fmt.Errorf("cloud account #%d is a %s account, dns provider %s needs %s", account.ID, account.Provider, zone.Provider, want)
+		}
+	}
+	return nil
+}
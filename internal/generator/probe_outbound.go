@@ -0,0 +1,170 @@
+package generator
+
+import (
+	"crypto/ecdh"
+	"encoding/base64"
+	"strconv"
+	"strings"
+
+	"github.com/wangn9900/StealthForward/internal/models"
+)
+
+// ProbeUserTagPrefix 可达性探测用户在入口配置中的名称前缀，后接探测机 ID (流量不归属任何面板用户)
+const ProbeUserTagPrefix = "stealth-probe-"
+
+// ProbeUser 写入入口配置的探测用户 (每台探测机一个)
+type ProbeUser struct {
+	Tag  string
+	UUID string
+}
+
+// ProbeUserTag 返回探测机在入口配置中的用户名称
+func ProbeUserTag(proberID uint) string {
+	return ProbeUserTagPrefix + strconv.FormatUint(uint64(proberID), 10)
+}
+
+// ProberIDFromTag 从用户名称解析探测机 ID，非探测用户返回 false
+func ProberIDFromTag(tag string) (uint, bool) {
+	if !strings.HasPrefix(tag, ProbeUserTagPrefix) {
+		return 0, false
+	}
+	id, err := strconv.ParseUint(strings.TrimPrefix(tag, ProbeUserTagPrefix), 10, 32)
+	if err != nil || id == 0 {
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// ReachabilityTargets 列出入口的所有监听端口 (默认端口 + 映射独立端口) 及探测机使用的客户端出站
+func ReachabilityTargets(entry *models.EntryNode, mappings []models.NodeMapping, probeUserID string) []models.ReachabilityTarget {
+	host := entry.IP
+	if host == "" {
+		host = entry.Domain
+	}
+	if host == "" || entry.Port <= 0 {
+		return nil
+	}
+
+	defaultProtocol := entry.Protocol
+	if defaultProtocol == "" {
+		defaultProtocol = "vless"
+	}
+	targets := []models.ReachabilityTarget{probeTarget(entry, host, entry.Port, defaultProtocol, probeUserID)}
+	seen := map[int]bool{entry.Port: true}
+	for _, m := range mappings {
+		if m.Port <= 0 || seen[m.Port] {
+			continue
+		}
+		seen[m.Port] = true
+		protocol := "vless"
+		if m.V2boardType != "" {
+			protocol = m.V2boardType
+		}
+		targets = append(targets, probeTarget(entry, host, m.Port, protocol, probeUserID))
+	}
+	return targets
+}
+
+// probeTarget 按入口配置的生成规则构造与 inbound 对应的客户端出站
+func probeTarget(entry *models.EntryNode, host string, port int, protocol, probeUserID string) models.ReachabilityTarget {
+	protocolType := protocol
+	if protocolType == "v2ray" {
+		protocolType = "vmess"
+	} else if protocolType == "ss" {
+		protocolType = "shadowsocks"
+	}
+	target := models.ReachabilityTarget{
+		EntryNodeID: entry.ID,
+		EntryName:   entry.Name,
+		Host:        host,
+		Port:        port,
+		Protocol:    protocolType,
+		TLS:         protocolType != "shadowsocks",
+		Reality:     entry.RealityEnabled,
+		ServerName:  entry.Domain,
+	}
+	if entry.RealityEnabled {
+		target.ServerName = entry.RealityServerName
+	}
+	if !target.TLS || probeUserID == "" {
+		return target
+	}
+
+	outbound := map[string]interface{}{
+		"type":        protocolType,
+		"server":      host,
+		"server_port": port,
+	}
+	isTcpTransport := entry.Transport == "" || entry.Transport == "tcp"
+	switch protocolType {
+	case "trojan", "anytls":
+		outbound["password"] = probeUserID
+	case "vmess":
+		outbound["uuid"] = probeUserID
+		outbound["security"] = "auto"
+	case "vless":
+		outbound["uuid"] = probeUserID
+		// 与 generateUsers 一致：VLESS 在 TCP 传输下带 flow
+		if isTcpTransport {
+			outbound["flow"] = "xtls-rprx-vision"
+		}
+	default:
+		// hysteria2 等 UDP 协议暂不支持完整代理探测
+		return target
+	}
+
+	// 证书有效性不影响可达性判断，跳过校验
+	tls := map[string]interface{}{
+		"enabled":     true,
+		"server_name": target.ServerName,
+		"insecure":    true,
+	}
+	if entry.RealityEnabled {
+		publicKey, ok := realityPublicKey(entry.RealityPrivateKey)
+		if !ok {
+			return target
+		}
+		fingerprint := entry.RealityFingerprint
+		if fingerprint == "" {
+			fingerprint = "chrome"
+		}
+		tls["utls"] = map[string]interface{}{"enabled": true, "fingerprint": fingerprint}
+		tls["reality"] = map[string]interface{}{
+			"enabled":    true,
+			"public_key": publicKey,
+			"short_id":   entry.RealityShortID,
+		}
+	}
+	outbound["tls"] = tls
+
+	// 传输层只配置在默认端口的 inbound 上
+	if port == entry.Port && protocol != "anytls" {
+		switch entry.Transport {
+		case "grpc":
+			serviceName := entry.GrpcService
+			if serviceName == "" {
+				serviceName = "grpc"
+			}
+			outbound["transport"] = map[string]interface{}{"type": "grpc", "service_name": serviceName}
+		case "ws":
+			outbound["transport"] = map[string]interface{}{"type": "ws", "path": "/"}
+		case "h2":
+			outbound["transport"] = map[string]interface{}{"type": "http"}
+		}
+	}
+	target.Outbound = outbound
+	return target
+}
+
+// realityPublicKey 由 Reality 私钥推导公钥 (base64 raw url)
+func realityPublicKey(privateKey string) (string, bool) {
+	raw, err := base64.RawURLEncoding.DecodeString(privateKey)
+	if err != nil {
+		return "", false
+	}
+	key, err := ecdh.X25519().NewPrivateKey(raw)
+	if err != nil {
+		return "", false
+	}
+	return base64.RawURLEncoding.EncodeToString(key.PublicKey().Bytes()), true
+}
@@ -12,16 +12,28 @@ import (
 	"github.com/wangn9900/StealthForward/internal/models"
 )
 
+// ExitOutboundTag 落地节点在入口配置中的 outbound tag，Controller 据此将 Agent 上报的 outbound 流量归属到落地
+func ExitOutboundTag(name string) string {
+	return "out-" + name
+}
+
 // SingBoxConfig 绝不包含任何会让魔改内核崩溃的 experimental 或 hosts 字段
+// 唯一例外：外部内核的 Agent 显式请求统计接口时才写入 experimental (仅含 v2ray_api / clash_api)
 type SingBoxConfig struct {
-	Log       interface{}   `json:"log"`
-	DNS       interface{}   `json:"dns,omitempty"`
-	Route     interface{}   `json:"route"`
-	Outbounds []interface{} `json:"outbounds"`
-	Inbounds  []interface{} `json:"inbounds"`
+	Log          interface{}   `json:"log"`
+	DNS          interface{}   `json:"dns,omitempty"`
+	Route        interface{}   `json:"route"`
+	Outbounds    []interface{} `json:"outbounds"`
+	Inbounds     []interface{} `json:"inbounds"`
+	Experimental interface{}   `json:"experimental,omitempty"`
 }
 
 func GenerateEntryConfig(entry *models.EntryNode, rules []models.ForwardingRule, exits []models.ExitNode) (string, error) {
+	return GenerateEntryConfigWithOptions(entry, rules, exits, EntryConfigOptions{})
+}
+
+// GenerateEntryConfigWithOptions 生成入口配置，可按需为外部内核开启本机统计接口
+func GenerateEntryConfigWithOptions(entry *models.EntryNode, rules []models.ForwardingRule, exits []models.ExitNode, opts EntryConfigOptions) (string, error) {
 	config := SingBoxConfig{
 		Log: map[string]interface{}{
 			"level": "error",
@@ -79,18 +91,23 @@ func GenerateEntryConfig(entry *models.EntryNode, rules []models.ForwardingRule,
 	portToUsers := make(map[int][]models.ForwardingRule)
 	defaultPortUsers := []models.ForwardingRule{}
 
+	// 身份表：标签 -> V2Board 节点 ID
+	var identities []models.UserIdentity
+	database.DB.Where("entry_node_id = ?", entry.ID).Find(&identities)
+	tagNodeIDs := make(map[string]int)
+	for _, identity := range identities {
+		tagNodeIDs[identity.Tag] = identity.V2boardNodeID
+	}
+
 	for _, rule := range rules {
-		// 从 UserEmail (n20-xxx) 提取节点 ID，找到对应的端口
+		// 通过身份表找到用户所属的 V2Board 节点，再找到对应的端口
 		assignedPort := entry.Port // 默认端口
-		if strings.HasPrefix(rule.UserEmail, "n") && strings.Contains(rule.UserEmail, "-") {
-			idPart := strings.Split(rule.UserEmail, "-")[0][1:]
-			if v2bNodeID, err := strconv.Atoi(idPart); err == nil {
-				// 查找这个节点 ID 对应的 Mapping
-				for _, m := range mappings {
-					if m.V2boardNodeID == v2bNodeID && m.Port > 0 {
-						assignedPort = m.Port
-						break
-					}
+		if v2bNodeID, ok := tagNodeIDs[rule.UserEmail]; ok {
+			// 查找这个节点 ID 对应的 Mapping
+			for _, m := range mappings {
+				if m.V2boardNodeID == v2bNodeID && m.Port > 0 {
+					assignedPort = m.Port
+					break
 				}
 			}
 		}
@@ -102,6 +119,17 @@ func GenerateEntryConfig(entry *models.EntryNode, rules []models.ForwardingRule,
 		}
 	}
 
+	// 探测用户加入每个监听端口，供探测机做完整代理请求 (映射端口即使暂无用户也会监听)
+	for _, u := range opts.ProbeUsers {
+		probe := models.ForwardingRule{UserID: u.UUID, UserEmail: u.Tag}
+		defaultPortUsers = append(defaultPortUsers, probe)
+		for port := range portToMapping {
+			if port != entry.Port {
+				portToUsers[port] = append(portToUsers[port], probe)
+			}
+		}
+	}
+
 	// 辅助函数：根据协议生成 User 配置
 	generateUsers := func(protocol string, ruleList []models.ForwardingRule) []map[string]interface{} {
 		var users []map[string]interface{}
@@ -392,7 +420,7 @@ func GenerateEntryConfig(entry *models.EntryNode, rules []models.ForwardingRule,
 			delete(exitOutbound, "tcp_multi_path")
 		}
 
-		exitOutbound["tag"] = "out-" + exit.Name
+		exitOutbound["tag"] = ExitOutboundTag(exit.Name)
 		config.Outbounds = append(config.Outbounds, exitOutbound)
 	}
 
@@ -414,8 +442,9 @@ func GenerateEntryConfig(entry *models.EntryNode, rules []models.ForwardingRule,
 		m := portToMapping[port]
 		inboundTag := fmt.Sprintf("node_%d_port_%d", entry.ID, port)
 		var exitName string
+		exitID := m.EffectiveExitID()
 		for _, e := range exits {
-			if e.ID == m.TargetExitID {
+			if e.ID == exitID {
 				exitName = e.Name
 				break
 			}
@@ -423,7 +452,7 @@ func GenerateEntryConfig(entry *models.EntryNode, rules []models.ForwardingRule,
 		if exitName != "" {
 			routingRules = append(routingRules, map[string]interface{}{
 				"inbound":  []string{inboundTag},
-				"outbound": "out-" + exitName,
+				"outbound": ExitOutboundTag(exitName),
 			})
 		}
 	}
@@ -432,7 +461,7 @@ func GenerateEntryConfig(entry *models.EntryNode, rules []models.ForwardingRule,
 	if entry.TargetExitID != 0 {
 		for _, e := range exits {
 			if e.ID == entry.TargetExitID {
-				defaultExitTag = "out-" + e.Name
+				defaultExitTag = ExitOutboundTag(e.Name)
 				break
 			}
 		}
@@ -443,6 +472,10 @@ func GenerateEntryConfig(entry *models.EntryNode, rules []models.ForwardingRule,
 		"final": defaultExitTag,
 	}
 
+	if opts.StatsAPI != "" {
+		config.Experimental = statsExperimental(opts, &config)
+	}
+
 	res, _ := json.MarshalIndent(config, "", "  ")
 	return string(res), nil
 }
@@ -0,0 +1,116 @@
+package generator
+
+import (
+	"net"
+	"sort"
+)
+
+const (
+	// StatsAPIV2Ray 外部内核启用 V2Ray Stats API (gRPC)，可统计到用户级流量，内核需以 with_v2ray_api 编译
+	StatsAPIV2Ray = "v2ray"
+	// StatsAPIClash 外部内核启用 Clash API，只能统计节点总流量
+	StatsAPIClash = "clash"
+
+	DefaultV2RayAPIListen = "127.0.0.1:10085"
+	DefaultClashAPIListen = "127.0.0.1:9090"
+)
+
+// EntryConfigOptions 入口配置的可选项 (由 Agent 拉取配置时携带)
+type EntryConfigOptions struct {
+	// StatsAPI 外部内核的统计接口：""(关闭)、v2ray、clash。内置内核直接挂钩统计，无需开启
+	StatsAPI string
+	// StatsListen 统计接口监听地址，只允许本机回环地址
+	StatsListen string
+	// ProbeUsers 可达性探测用户 (每台探测机独立凭证)，加入每个监听端口
+	ProbeUsers []ProbeUser
+}
+
+// ValidStatsAPI 判断统计接口类型是否受支持
+func ValidStatsAPI(api string) bool {
+	return api == "" || api == StatsAPIV2Ray || api == StatsAPIClash
+}
+
+// StatsListenAddr 返回统计接口实际监听的地址：非回环地址一律改为 127.0.0.1，避免统计接口暴露到公网
+func StatsListenAddr(api, listen string) string {
+	def := DefaultV2RayAPIListen
+	if api == StatsAPIClash {
+		def = DefaultClashAPIListen
+	}
+	if listen == "" {
+		return def
+	}
+	host, port, err := net.SplitHostPort(listen)
+	if err != nil || port == "" {
+		return def
+	}
+	if host == "localhost" {
+		return listen
+	}
+	if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+		return net.JoinHostPort("127.0.0.1", port)
+	}
+	return listen
+}
+
+// statsExperimental 生成统计接口的 experimental 配置
+// V2Ray Stats API 只统计显式列出的 inbound / outbound / 用户，因此从已生成的配置中收集全部 tag
+func statsExperimental(opts EntryConfigOptions, config *SingBoxConfig) map[string]interface{} {
+	listen := StatsListenAddr(opts.StatsAPI, opts.StatsListen)
+	switch opts.StatsAPI {
+	case StatsAPIV2Ray:
+		return map[string]interface{}{
+			"v2ray_api": map[string]interface{}{
+				"listen": listen,
+				"stats": map[string]interface{}{
+					"enabled":   true,
+					"inbounds":  collectTags(config.Inbounds),
+					"outbounds": collectTags(config.Outbounds),
+					"users":     collectUsers(config.Inbounds),
+				},
+			},
+		}
+	case StatsAPIClash:
+		return map[string]interface{}{
+			"clash_api": map[string]interface{}{
+				"external_controller": listen,
+			},
+		}
+	}
+	return nil
+}
+
+// collectTags 收集 inbound / outbound 的 tag
+func collectTags(items []interface{}) []string {
+	tags := []string{}
+	for _, item := range items {
+		if m, ok := item.(map[string]interface{}); ok {
+			if tag, ok := m["tag"].(string); ok && tag != "" {
+				tags = append(tags, tag)
+			}
+		}
+	}
+	return tags
+}
+
+// collectUsers 收集所有 inbound 中的用户名 (去重排序，保证配置稳定)
+func collectUsers(inbounds []interface{}) []string {
+	seen := make(map[string]bool)
+	for _, item := range inbounds {
+		m, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		users, _ := m["users"].([]map[string]interface{})
+		for _, u := range users {
+			if name, ok := u["name"].(string); ok && name != "" {
+				seen[name] = true
+			}
+		}
+	}
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,274 @@
+// Package metrics 极简的 Prometheus 指标注册表 (文本格式 0.0.4)，Controller 与 Agent 共用，不依赖 client_golang
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ContentType Prometheus 文本格式的 Content-Type
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefaultBuckets 耗时类直方图的默认分桶 (秒)
+var DefaultBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// series 一组标签值对应的数据
+type series struct {
+	labelValues []string
+	value       float64  // counter / gauge
+	buckets     []uint64 // histogram 各分桶计数 (非累计)
+	sum         float64
+	count       uint64
+}
+
+// family 同名指标
+type family struct {
+	name       string
+	help       string
+	typ        string // counter, gauge, histogram
+	labelNames []string
+	bounds     []float64
+
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+func (f *family) get(labelValues []string) *series {
+	if len(labelValues) != len(f.labelNames) {
+		panic(fmt.Sprintf("metrics: %s expects %d labels, got %d", f.name, len(f.labelNames), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{labelValues: append([]string(nil), labelValues...)}
+		if f.typ == "histogram" {
+			s.buckets = make([]uint64, len(f.bounds))
+		}
+		f.series[key] = s
+	}
+	return s
+}
+
+// Counter 只增不减的计数
+type Counter struct{ f *family }
+
+// Add 累加计数
+func (c *Counter) Add(v float64, labelValues ...string) {
+	c.f.mu.Lock()
+	c.f.get(labelValues).value += v
+	c.f.mu.Unlock()
+}
+
+// Inc 计数加一
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Gauge 可增可减的瞬时值
+type Gauge struct{ f *family }
+
+// Set 设置当前值
+func (g *Gauge) Set(v float64, labelValues ...string) {
+	g.f.mu.Lock()
+	g.f.get(labelValues).value = v
+	g.f.mu.Unlock()
+}
+
+// Add 增减当前值
+func (g *Gauge) Add(v float64, labelValues ...string) {
+	g.f.mu.Lock()
+	g.f.get(labelValues).value += v
+	g.f.mu.Unlock()
+}
+
+// Reset 清空所有序列 (抓取时重建快照类指标，避免已删除的对象残留)
+func (g *Gauge) Reset() {
+	g.f.mu.Lock()
+	g.f.series = make(map[string]*series)
+	g.f.mu.Unlock()
+}
+
+// Histogram 分桶统计
+type Histogram struct{ f *family }
+
+// Observe 记录一次观测值
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	h.f.mu.Lock()
+	defer h.f.mu.Unlock()
+	s := h.f.get(labelValues)
+	for i, bound := range h.f.bounds {
+		if v <= bound {
+			s.buckets[i]++
+			break
+		}
+	}
+	s.sum += v
+	s.count++
+}
+
+// Registry 指标注册表
+type Registry struct {
+	mu         sync.Mutex
+	families   []*family
+	collectors []func()
+}
+
+// NewRegistry 创建注册表
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (r *Registry) register(name, help, typ string, bounds []float64, labelNames []string) *family {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, f := range r.families {
+		if f.name == name {
+			panic("metrics: duplicate metric " + name)
+		}
+	}
+	f := &family{name: name, help: help, typ: typ, labelNames: labelNames, bounds: bounds, series: make(map[string]*series)}
+	r.families = append(r.families, f)
+	return f
+}
+
+// Counter 注册计数指标
+func (r *Registry) Counter(name, help string, labelNames ...string) *Counter {
+	return &Counter{r.register(name, help, "counter", nil, labelNames)}
+}
+
+// Gauge 注册瞬时值指标
+func (r *Registry) Gauge(name, help string, labelNames ...string) *Gauge {
+	return &Gauge{r.register(name, help, "gauge", nil, labelNames)}
+}
+
+// Histogram 注册直方图指标，buckets 为升序的分桶上界
+func (r *Registry) Histogram(name, help string, buckets []float64, labelNames ...string) *Histogram {
+	bounds := append([]float64(nil), buckets...)
+	sort.Float64s(bounds)
+	return &Histogram{r.register(name, help, "histogram", bounds, labelNames)}
+}
+
+// OnCollect 注册抓取前执行的回调，用于刷新从数据库或内存快照计算的 Gauge
+func (r *Registry) OnCollect(fn func()) {
+	r.mu.Lock()
+	r.collectors = append(r.collectors, fn)
+	r.mu.Unlock()
+}
+
+// WriteText 以 Prometheus 文本格式输出所有指标
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	collectors := append([]func(){}, r.collectors...)
+	families := append([]*family{}, r.families...)
+	r.mu.Unlock()
+	for _, fn := range collectors {
+		fn()
+	}
+
+	bw := bufio.NewWriter(w)
+	for _, f := range families {
+		f.mu.Lock()
+		keys := make([]string, 0, len(f.series))
+		for key := range f.series {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		fmt.Fprintf(bw, "# HELP %s %s\n", f.name, escapeHelp(f.help))
+		fmt.Fprintf(bw, "# TYPE %s %s\n", f.name, f.typ)
+		for _, key := range keys {
+			s := f.series[key]
+			if f.typ != "histogram" {
+				fmt.Fprintf(bw, "%s%s %s\n", f.name, formatLabels(f.labelNames, s.labelValues, "", ""), formatValue(s.value))
+				continue
+			}
+			var cumulative uint64
+			for i, bound := range f.bounds {
+				cumulative += s.buckets[i]
+				fmt.Fprintf(bw, "%s_bucket%s %d\n", f.name, formatLabels(f.labelNames, s.labelValues, "le", formatValue(bound)), cumulative)
+			}
+			fmt.Fprintf(bw, "%s_bucket%s %d\n", f.name, formatLabels(f.labelNames, s.labelValues, "le", "+Inf"), s.count)
+			fmt.Fprintf(bw, "%s_sum%s %s\n", f.name, formatLabels(f.labelNames, s.labelValues, "", ""), formatValue(s.sum))
+			fmt.Fprintf(bw, "%s_count%s %d\n", f.name, formatLabels(f.labelNames, s.labelValues, "", ""), s.count)
+		}
+		f.mu.Unlock()
+	}
+	return bw.Flush()
+}
+
+// ServeHTTP 实现 http.Handler
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", ContentType)
+	r.WriteText(w)
+}
+
+// IsLoopbackAddr 判断监听地址是否只绑定本机回环
+func IsLoopbackAddr(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func formatLabels(names, values []string, extraName, extraValue string) string {
+	if len(names) == 0 && extraName == "" {
+		return ""
+	}
+	var sb strings.Builder
+	sb.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(name)
+		sb.WriteString(`="`)
+		sb.WriteString(escapeLabel(values[i]))
+		sb.WriteByte('"')
+	}
+	if extraName != "" {
+		if len(names) > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(extraName)
+		sb.WriteString(`="`)
+		sb.WriteString(extraValue)
+		sb.WriteByte('"')
+	}
+	sb.WriteByte('}')
+	return sb.String()
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	case v == math.Trunc(v) && math.Abs(v) < 1e15:
+		return strconv.FormatInt(int64(v), 10)
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+func escapeLabel(s string) string { return labelEscaper.Replace(s) }
+func escapeHelp(s string) string  { return helpEscaper.Replace(s) }
@@ -0,0 +1,91 @@
+package models
+
+import "time"
+
+// 节点状态
+const (
+	NodeStatusUnknown  = "unknown"  // 从未上报
+	NodeStatusOnline   = "online"   // 上报正常
+	NodeStatusDegraded = "degraded" // 上报延迟
+	NodeStatusOffline  = "offline"  // 超时未上报
+)
+
+// NodeStatus 入口节点的当前状态 (按上报新鲜度计算)，同时持久化最近一次探针数据，Controller 重启后恢复
+type NodeStatus struct {
+	EntryNodeID  uint       `json:"entry_node_id" gorm:"primaryKey;autoIncrement:false"`
+	Status       string     `json:"status"`
+	Since        time.Time  `json:"since"` // 进入当前状态的时间
+	LastReportAt *time.Time `json:"last_report_at"`
+	LastStats    string     `json:"-"` // 最近一次探针数据 (JSON)
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+// NodeStatusChange 节点状态变化历史
+type NodeStatusChange struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	EntryNodeID uint      `json:"entry_node_id" gorm:"index"`
+	From        string    `json:"from"`
+	To          string    `json:"to"`
+	Reason      string    `json:"reason"`
+	CreatedAt   time.Time `json:"created_at" gorm:"index"`
+}
+
+// 告警指标
+const (
+	AlertMetricOffline = "offline" // 离线时长 (分钟)
+	AlertMetricCPU     = "cpu"     // CPU 使用率 (%)
+	AlertMetricMem     = "mem"     // 内存使用率 (%)
+	AlertMetricDisk    = "disk"    // 硬盘使用率 (%)
+	AlertMetricLoad1   = "load1"   // 1 分钟负载
+	AlertMetricLoad5   = "load5"   // 5 分钟负载
+)
+
+// AlertRule 告警规则：指标 >= 阈值 并持续 DurationSec 秒后触发，恢复后发送恢复通知
+type AlertRule struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	Name        string    `json:"name"`
+	Metric      string    `json:"metric"`        // offline, cpu, mem, disk, load1, load5
+	Threshold   float64   `json:"threshold"`     // offline 为分钟，其余为指标值
+	DurationSec int       `json:"duration_sec"`  // 持续时间 (秒)，0 表示立即触发，offline 规则忽略
+	EntryNodeID uint      `json:"entry_node_id"` // 0 表示所有入口
+	ChannelIDs  string    `json:"channel_ids"`   // 通知渠道 ID (逗号分隔)，为空发送到所有启用的渠道
+	Enabled     bool      `json:"enabled" gorm:"default:true"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// 告警状态
+const (
+	AlertStateFiring   = "firing"
+	AlertStateResolved = "resolved"
+)
+
+// AlertEvent 告警记录 (触发与恢复)
+type AlertEvent struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	RuleID      uint       `json:"rule_id" gorm:"index"`
+	RuleName    string     `json:"rule_name"`
+	EntryNodeID uint       `json:"entry_node_id" gorm:"index"`
+	State       string     `json:"state" gorm:"index"` // firing, resolved
+	Value       float64    `json:"value"`              // 触发时的指标值
+	Message     string     `json:"message"`
+	FiredAt     time.Time  `json:"fired_at" gorm:"index"`
+	ResolvedAt  *time.Time `json:"resolved_at"`
+}
+
+// 通知渠道类型
+const (
+	NotifyChannelWebhook  = "webhook"  // POST JSON {"title","message","time"} 到 URL
+	NotifyChannelTelegram = "telegram" // Telegram Bot sendMessage
+)
+
+// NotificationChannel 告警通知渠道
+type NotificationChannel struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	Name      string    `json:"name"`
+	Type      string    `json:"type"`   // webhook, telegram
+	Config    string    `json:"config"` // webhook: {"url": "..."}；telegram: {"bot_token": "...", "chat_id": "..."}
+	Enabled   bool      `json:"enabled" gorm:"default:true"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// 云流量额度达到动作阈值后的动作
+const (
+	AllowanceActionRotate = "rotate" // 更换 IP
+	AllowanceActionPause  = "pause"  // 暂停入口下所有规则，周期结束后恢复
+	AllowanceActionShift  = "shift"  // 域名解析切到另一个入口，周期结束后切回
+)
+
+// InterfaceUsage 入口节点每个流量额度周期的网卡用量 (来自 Agent 上报的网卡累计计数)
+type InterfaceUsage struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	EntryNodeID uint      `json:"entry_node_id" gorm:"uniqueIndex:idx_iface_cycle"`
+	CycleStart  time.Time `json:"cycle_start" gorm:"uniqueIndex:idx_iface_cycle"`
+	RxBytes     int64     `json:"rx_bytes"`
+	TxBytes     int64     `json:"tx_bytes"`
+	Allowance   int64     `json:"allowance"` // 最近一次检查时的额度 (bytes)
+
+	// Agent 上次上报的原始计数，用于计算增量 (Agent 重启后计数归零)
+	LastRx int64 `json:"-"`
+	LastTx int64 `json:"-"`
+
+	// 告警与动作状态
+	AlertedPercent int        `json:"alerted_percent"` // 本周期已告警的最高阈值
+	Action         string     `json:"action"`          // 本周期已执行的动作
+	ActionAt       *time.Time `json:"action_at"`
+	Reverted       bool       `json:"reverted"` // pause/shift 是否已在周期结束后撤销
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+// 计费周期作用对象
+const (
+	BillingScopeEntry = "entry"
+	BillingScopeExit  = "exit"
+)
+
+// BillingSettings 入口/落地节点的计费周期设置 (对应云厂商的账单周期)
+type BillingSettings struct {
+	BillingDay         int       `json:"billing_day"`         // 每月重置日 (1-28)，0 表示不自动重置
+	BillingTimezone    string    `json:"billing_timezone"`    // 计费时区 (IANA 名称，如 "Asia/Shanghai")，为空使用服务器时区
+	BandwidthAllowance int64     `json:"bandwidth_allowance"` // 每个周期的流量额度 (bytes)，0 表示不限
+	CycleStart         time.Time `json:"cycle_start"`         // 当前周期起点 (由计费任务维护)
+	// 首次对齐周期起点时的累计流量 (由计费任务维护)，本周期用量 = 累计流量 - 基线；归档清零后基线归零
+	CycleBaseUpload   int64 `json:"cycle_base_upload"`
+	CycleBaseDownload int64 `json:"cycle_base_download"`
+}
+
+// BillingCycle 已结束计费周期的流量归档
+type BillingCycle struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	Scope      string    `json:"scope" gorm:"uniqueIndex:idx_billing_cycle"` // entry, exit
+	NodeID     uint      `json:"node_id" gorm:"uniqueIndex:idx_billing_cycle"`
+	NodeName   string    `json:"node_name"` // 归档时的节点名称 (节点删除后仍可辨认)
+	CycleStart time.Time `json:"cycle_start" gorm:"uniqueIndex:idx_billing_cycle"`
+	CycleEnd   time.Time `json:"cycle_end"`
+	Upload     int64     `json:"upload"`
+	Download   int64     `json:"download"`
+	Allowance  int64     `json:"allowance"` // 归档时的周期额度 (bytes)，0 表示不限
+	CreatedAt  time.Time `json:"created_at"`
+}
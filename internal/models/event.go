@@ -0,0 +1,70 @@
+package models
+
+import "time"
+
+// 事件类型
+const (
+	EventRotationSucceeded = "rotation.succeeded" // 换 IP 成功
+	EventRotationFailed    = "rotation.failed"    // 换 IP 失败
+	EventCertIssued        = "cert.issued"        // Agent 回传证书
+	EventSyncFailed        = "sync.failed"        // 拉取面板用户失败
+	EventSyncRolledBack    = "sync.rolled_back"   // 规则写入失败，事务已回滚
+	EventNodeOnline        = "node.online"        // 节点状态变化 (node.<status>)
+	EventNodeDegraded      = "node.degraded"
+	EventNodeOffline       = "node.offline"
+	EventAlertFiring       = "alert.firing"
+	EventAlertResolved     = "alert.resolved"
+	EventLicenseExpiring   = "license.expiring"      // 授权即将过期
+	EventFailoverSwitched  = "failover.switched"     // 映射切换到备用落地
+	EventFailoverRestored  = "failover.restored"     // 映射切回主落地
+	EventReachBlocked      = "reachability.blocked"  // 探测机所在网络无法访问入口端口
+	EventReachFlapping     = "reachability.flapping" // 入口端口在探测机网络中时通时断
+	EventReachRestored     = "reachability.restored" // 入口端口恢复可达
+	EventBandwidthAlert    = "bandwidth.threshold"   // 入口云流量用量跨过告警阈值
+	EventBandwidthAction   = "bandwidth.action"      // 入口云流量达到动作阈值，已执行额度动作
+)
+
+// Event 事件总线记录
+type Event struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	Type      string    `json:"type" gorm:"index"`
+	Subject   string    `json:"subject"` // 事件对象，如 entry:1
+	Message   string    `json:"message"`
+	Data      string    `json:"data"` // 附加数据 (JSON)
+	CreatedAt time.Time `json:"created_at" gorm:"index"`
+}
+
+// WebhookSubscription 事件 Webhook 订阅
+type WebhookSubscription struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	Name       string    `json:"name"`
+	URL        string    `json:"url"`
+	Secret     string    `json:"-"`           // HMAC-SHA256 签名密钥，为空不签名；不在接口中返回
+	Events     string    `json:"events"`      // 事件过滤 (逗号分隔)，支持 * 与 node.* 前缀匹配，为空表示全部
+	MaxRetries int       `json:"max_retries"` // 失败重试次数，0 使用默认值
+	Enabled    bool      `json:"enabled" gorm:"default:true"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// 投递状态
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed" // 重试耗尽
+)
+
+// WebhookDelivery 单个事件对单个订阅的投递记录
+type WebhookDelivery struct {
+	ID             uint      `json:"id" gorm:"primaryKey"`
+	SubscriptionID uint      `json:"subscription_id" gorm:"index"`
+	EventID        uint      `json:"event_id" gorm:"index"`
+	EventType      string    `json:"event_type"`
+	Status         string    `json:"status" gorm:"index"`
+	Attempts       int       `json:"attempts"`
+	ResponseCode   int       `json:"response_code"`
+	LastError      string    `json:"last_error"`
+	NextAttemptAt  time.Time `json:"next_attempt_at" gorm:"index"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// 故障切换触发方式
+const (
+	FailoverTriggerAuto   = "auto"   // 探测结果触发
+	FailoverTriggerManual = "manual" // 管理员手动切换
+)
+
+// MappingFailover 映射的落地切换记录
+type MappingFailover struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	MappingID   uint      `json:"mapping_id" gorm:"index"`
+	EntryNodeID uint      `json:"entry_node_id" gorm:"index"`
+	FromExitID  uint      `json:"from_exit_id"`
+	ToExitID    uint      `json:"to_exit_id"`
+	Restored    bool      `json:"restored"` // 是否为切回主落地
+	Trigger     string    `json:"trigger"`
+	Reason      string    `json:"reason"`
+	CreatedAt   time.Time `json:"created_at" gorm:"index"`
+}
@@ -27,14 +27,23 @@ type EntryNode struct {
 	V2boardKey    string `json:"v2board_key"`     // 通讯密钥
 	V2boardNodeID int    `json:"v2board_node_id"` // 默认节点 ID
 	V2boardType   string `json:"v2board_type"`    // v2ray, shadowsocks, trojan
+	SyncInterval  int    `json:"sync_interval"`   // 用户同步间隔 (秒)，0 表示默认 120 秒
 
 	// 云平台绑定 (用于一键换 IP)
-	CloudProvider   string `json:"cloud_provider"`    // "aws_ec2", "aws_lightsail", "none"
+	CloudProvider   string `json:"cloud_provider"`    // "aws_ec2", "aws_lightsail", "vultr", "digitalocean", "hetzner", "none"
+	CloudAccountID  uint   `json:"cloud_account_id"`  // 实例所在的云账号 (账号池)，0 表示使用系统设置中的单一密钥
 	CloudRegion     string `json:"cloud_region"`      // "ap-northeast-1"
 	CloudInstanceID string `json:"cloud_instance_id"` // EC2: "i-0123..." / Lightsail: "stealth-xxx"
-	CloudRecordName string `json:"cloud_record_name"` // Cloudflare 子域名 (如 "transitnode")
+	CloudRecordName string `json:"cloud_record_name"` // DNS 子域名 (如 "transitnode")，换 IP 后自动更新解析
+	DNSZoneID       uint   `json:"dns_zone_id"`       // 子域名所在的 DNS 域名绑定，0 表示使用系统设置中的 Cloudflare 默认域名
 	AutoRotateIP    bool   `json:"auto_rotate_ip"`    // 是否启用自动换 IP
 
+	// 云流量额度 (额度为计费设置中的 bandwidth_allowance，用量取 Agent 上报的网卡计数)
+	AllowanceFromBundle    bool   `json:"allowance_from_bundle"`    // 从 Lightsail 实例套餐自动读取额度
+	AllowanceAction        string `json:"allowance_action"`         // 达到动作阈值后执行: rotate, pause, shift，为空仅告警
+	AllowanceActionPercent int    `json:"allowance_action_percent"` // 动作阈值 (%)，0 表示 100
+	AllowanceShiftEntryID  uint   `json:"allowance_shift_entry_id"` // shift 动作: 将本入口的域名解析切到该入口 (需服务同一面板节点)
+
 	// Reality 配置
 	RealityEnabled     bool   `json:"reality_enabled"`     // 是否启用 Reality
 	RealityServerName  string `json:"reality_server_name"` // SNI / ServerName (e.g. www.samsung.com)
@@ -47,18 +56,39 @@ type EntryNode struct {
 	TotalUpload   int64 `json:"total_upload"`   // 累计上行流量 (bytes)
 	TotalDownload int64 `json:"total_download"` // 累计下行流量 (bytes)
 
+	// 计费周期 (到期自动归档并清零累计流量)
+	BillingSettings
+
 	CreatedAt time.Time `json:"created_at"`
 }
 
 // NodeMapping 定义了同一入口下不同 V2Board 节点到不同落地机的映射关系
 type NodeMapping struct {
-	ID            uint      `json:"id" gorm:"primaryKey"`
-	EntryNodeID   uint      `json:"entry_node_id"`   // 关联入口节点
-	V2boardNodeID int       `json:"v2board_node_id"` // V2Board 那边的节点 ID
-	TargetExitID  uint      `json:"target_exit_id"`  // 对应的落地节点 ID
-	V2boardType   string    `json:"v2board_type"`    // 节点类型
-	Port          int       `json:"port"`            // 该映射独立监听的端口（为 0 时使用入口默认端口）
-	CreatedAt     time.Time `json:"created_at"`
+	ID            uint   `json:"id" gorm:"primaryKey"`
+	EntryNodeID   uint   `json:"entry_node_id"`   // 关联入口节点
+	V2boardNodeID int    `json:"v2board_node_id"` // V2Board 那边的节点 ID
+	TargetExitID  uint   `json:"target_exit_id"`  // 对应的落地节点 ID
+	V2boardType   string `json:"v2board_type"`    // 节点类型
+	Port          int    `json:"port"`            // 该映射独立监听的端口（为 0 时使用入口默认端口）
+
+	// 故障切换策略：主落地 (TargetExitID) 探测连续失败时按顺序切到健康的备用落地
+	BackupExitIDs    string    `json:"backup_exit_ids"`   // 备用落地 ID (逗号分隔，按优先级排列)
+	FailoverEnabled  bool      `json:"failover_enabled"`  // 是否启用自动切换
+	FailureThreshold int       `json:"failure_threshold"` // 连续失败多少轮探测判定故障 (0 使用默认 3)
+	MinDwellSeconds  int       `json:"min_dwell_seconds"` // 切换后至少停留多久才允许再次切换 (0 使用默认 300)
+	FailBack         bool      `json:"fail_back"`         // 主落地恢复后自动切回
+	ActiveExitID     uint      `json:"active_exit_id"`    // 当前生效的落地 (0 表示主落地)
+	ActiveSince      time.Time `json:"active_since"`      // 最近一次切换时间
+
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// EffectiveExitID 返回映射当前实际使用的落地 (故障切换后为备用落地)
+func (m NodeMapping) EffectiveExitID() uint {
+	if m.ActiveExitID != 0 {
+		return m.ActiveExitID
+	}
+	return m.TargetExitID
 }
 
 // ExitNode 代表落地服务器（小鸡）
@@ -74,6 +104,9 @@ type ExitNode struct {
 	TotalUpload   int64 `json:"total_upload"`   // 累计上行流量 (bytes)
 	TotalDownload int64 `json:"total_download"` // 累计下行流量 (bytes)
 
+	// 计费周期 (到期自动归档并清零累计流量)
+	BillingSettings
+
 	CreatedAt time.Time `json:"created_at"`
 }
 
@@ -86,6 +119,7 @@ type ForwardingRule struct {
 	EntryNodeID uint   `json:"entry_node_id"`
 	ExitNodeID  uint   `json:"exit_node_id"`
 	Enabled     bool   `json:"enabled"`
+	Suspended   bool   `json:"suspended"` // 被配额或管理员暂停 (由暂停表维护，面板同步不会覆盖)
 }
 
 // UserTraffic 代表单个用户的流量统计
@@ -95,6 +129,13 @@ type UserTraffic struct {
 	Download  int64  `json:"download"`
 }
 
+// TagTraffic 单个 inbound / outbound 的流量
+type TagTraffic struct {
+	Tag      string `json:"tag"`
+	Upload   int64  `json:"upload"`
+	Download int64  `json:"download"`
+}
+
 // SystemStats 代表服务器状态探针数据
 type SystemStats struct {
 	CPU      float64 `json:"cpu"`       // CPU 使用率 (%)
@@ -108,6 +149,13 @@ type SystemStats struct {
 	Load15   float64 `json:"load15"`    // 负载 15min
 	Uptime   int64   `json:"uptime"`    // 在线时间 (秒)
 	ReportAt int64   `json:"report_at"` // 上报时间戳
+
+	// 网卡累计流量 (bytes，开机以来，不含回环)，用于对照云厂商的流量额度
+	NetRxTotal int64 `json:"net_rx_total"`
+	NetTxTotal int64 `json:"net_tx_total"`
+
+	// 内置内核当前的活跃连接数 (外部内核不上报)，用于区分断流与用户全部下线
+	ActiveConns int64 `json:"active_conns,omitempty"`
 }
 
 // NodeTrafficReport 节点上报的流量汇总
@@ -117,6 +165,16 @@ type NodeTrafficReport struct {
 	TotalUpload   int64         `json:"total_upload"`
 	TotalDownload int64         `json:"total_download"`
 	Stats         *SystemStats  `json:"stats,omitempty"` // 探针数据
+
+	// 按 sing-box inbound / outbound tag 实测的流量 (内置内核才有)
+	// 存在时 Controller 以此计算入口/落地总量，而不是按规则推断
+	Inbounds  []TagTraffic `json:"inbounds,omitempty"`
+	Outbounds []TagTraffic `json:"outbounds,omitempty"`
+
+	// 幂等上报：同一 Agent 实例内序号单调递增，Controller 据此去重
+	// Seq 为 0 表示本次不携带流量批次 (仅探针心跳或旧版 Agent)
+	InstanceID string `json:"instance_id,omitempty"`
+	Seq        uint64 `json:"seq,omitempty"`
 }
 
 type TrafficStat struct {
@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+// ExitProbeResult Agent 对单个落地出站的一次探测结果
+type ExitProbeResult struct {
+	Tag          string  `json:"tag"` // 出站 tag (out-<落地名>)
+	Server       string  `json:"server"`
+	TCPAttempts  int     `json:"tcp_attempts"`
+	TCPFailures  int     `json:"tcp_failures"`
+	TCPLatencyMs float64 `json:"tcp_ms"` // 成功连接的平均耗时
+	TCPError     string  `json:"tcp_error,omitempty"`
+	URLTested    bool    `json:"url_tested"` // 经出站的真实 URL 测试 (仅内置内核)
+	URLLatencyMs float64 `json:"url_ms"`
+	URLError     string  `json:"url_error,omitempty"`
+}
+
+// ExitProbeReport Agent 上报的一轮探测
+type ExitProbeReport struct {
+	NodeID   uint              `json:"node_id"`
+	ProbedAt int64             `json:"probed_at"` // Unix 秒
+	Results  []ExitProbeResult `json:"results"`
+}
+
+// ExitProbe 入口 -> 落地 的探测历史，延迟矩阵据此计算
+type ExitProbe struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	EntryNodeID  uint      `json:"entry_node_id" gorm:"index:idx_probe_pair"`
+	ExitNodeID   uint      `json:"exit_node_id" gorm:"index:idx_probe_pair"`
+	TCPLatencyMs float64   `json:"tcp_ms"`
+	TCPLoss      float64   `json:"tcp_loss"` // 0-1
+	URLTested    bool      `json:"url_tested"`
+	URLOK        bool      `json:"url_ok"`
+	URLLatencyMs float64   `json:"url_ms"`
+	Error        string    `json:"error"`
+	ProbedAt     time.Time `json:"probed_at" gorm:"index"`
+}
@@ -0,0 +1,57 @@
+package models
+
+import "time"
+
+// 配额作用对象
+const (
+	QuotaScopeUser  = "user"  // V2Board 用户 (跨入口合计)
+	QuotaScopeEntry = "entry" // 入口节点
+	QuotaScopeExit  = "exit"  // 落地节点
+)
+
+// 超额后的动作
+const (
+	QuotaActionWarn     = "warn"     // 仅告警
+	QuotaActionThrottle = "throttle" // 限速 (仅内置内核生效)
+	QuotaActionSuspend  = "suspend"  // 暂停，规则被禁用直到周期重置或手动解除
+)
+
+// TrafficQuota 管理员设置的流量配额，按计费日每月重置
+type TrafficQuota struct {
+	ID           uint   `json:"id" gorm:"primaryKey"`
+	Scope        string `json:"scope" gorm:"index:idx_quota_target"`     // user, entry, exit
+	TargetID     uint   `json:"target_id" gorm:"index:idx_quota_target"` // user 为 V2Board 用户 ID，entry/exit 为节点 ID
+	LimitBytes   int64  `json:"limit_bytes"`                             // 每个周期允许的流量 (上行 + 下行)
+	Action       string `json:"action"`                                  // warn, throttle, suspend
+	ThrottleMbps int    `json:"throttle_mbps"`                           // throttle 动作的限速 (Mbps)
+	BillingDay   int    `json:"billing_day"`                             // 每月重置日 (1-28)，0 使用全局配置 quota.billing_day
+	Enabled      bool   `json:"enabled" gorm:"default:true"`
+	Note         string `json:"note"`
+
+	// 运行状态 (由配额任务维护)
+	PeriodStart time.Time  `json:"period_start"` // 当前计费周期起点
+	UsedBytes   int64      `json:"used_bytes"`   // 当前周期已用流量 (最近一次检查时)
+	Triggered   bool       `json:"triggered"`    // 本周期是否已超额并执行动作
+	TriggeredAt *time.Time `json:"triggered_at"`
+	CheckedAt   time.Time  `json:"checked_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// 暂停来源
+const (
+	SuspensionSourceQuota     = "quota"     // 配额超额
+	SuspensionSourceManual    = "manual"    // 管理员手动
+	SuspensionSourceBandwidth = "bandwidth" // 云流量额度动作，周期结束后自动解除
+)
+
+// Suspension 持久化的暂停标记，同步时据此禁用规则，面板同步不会再把规则重新启用
+type Suspension struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	Scope     string    `json:"scope" gorm:"uniqueIndex:idx_suspension_target"` // user, entry, exit
+	TargetID  uint      `json:"target_id" gorm:"uniqueIndex:idx_suspension_target"`
+	QuotaID   uint      `json:"quota_id" gorm:"index"` // 触发的配额，0 表示非配额触发 (不随配额周期重置解除)
+	Source    string    `json:"source"`                // quota, manual, bandwidth
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"created_at"`
+}
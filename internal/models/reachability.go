@@ -0,0 +1,96 @@
+package models
+
+import "time"
+
+// 可达性状态 (按 探测标签 x 入口端口 计算)
+const (
+	ReachabilityOK       = "ok"
+	ReachabilityDegraded = "degraded" // 最近一轮失败，尚未达到封锁判定
+	ReachabilityBlocked  = "blocked"  // 连续多轮失败
+	ReachabilityFlapping = "flapping" // 窗口内成功/失败反复切换
+	ReachabilityUnknown  = "unknown"
+)
+
+// ReachabilityTarget 探测机需要检测的一个入口端口
+type ReachabilityTarget struct {
+	EntryNodeID uint                   `json:"entry_node_id"`
+	EntryName   string                 `json:"entry_name"`
+	Host        string                 `json:"host"`
+	Port        int                    `json:"port"`
+	Protocol    string                 `json:"protocol"`
+	TLS         bool                   `json:"tls"`         // 是否做 TLS 握手
+	ServerName  string                 `json:"server_name"` // TLS 握手使用的 SNI (Reality 为伪装域名)
+	Reality     bool                   `json:"reality"`
+	Outbound    map[string]interface{} `json:"outbound,omitempty"` // 完整代理请求使用的 sing-box 客户端出站，协议不支持时为空
+}
+
+// ReachabilityResult 探测机对单个入口端口的一次探测
+type ReachabilityResult struct {
+	EntryNodeID uint    `json:"entry_node_id"`
+	Port        int     `json:"port"`
+	TCPOK       bool    `json:"tcp_ok"`
+	TCPMs       float64 `json:"tcp_ms"`
+	TLSTested   bool    `json:"tls_tested"`
+	TLSOK       bool    `json:"tls_ok"`
+	TLSMs       float64 `json:"tls_ms"`
+	ProxyTested bool    `json:"proxy_tested"`
+	ProxyOK     bool    `json:"proxy_ok"`
+	ProxyMs     float64 `json:"proxy_ms"`
+	Error       string  `json:"error,omitempty"`
+}
+
+// ReachabilityReport 探测机上报的一轮探测
+type ReachabilityReport struct {
+	Prober   string               `json:"prober"` // 探测机名称
+	ISP      string               `json:"isp"`    // 运营商标签，如 ct / cu / cm
+	Region   string               `json:"region"` // 地区标签，如 gd / sh
+	ProbedAt int64                `json:"probed_at"`
+	Results  []ReachabilityResult `json:"results"`
+}
+
+// ReachabilityProbe 探测机 -> 入口端口 的探测历史
+type ReachabilityProbe struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	Prober      string    `json:"prober"`
+	Label       string    `json:"label" gorm:"index:idx_reach_cell"` // <运营商>/<地区>
+	EntryNodeID uint      `json:"entry_node_id" gorm:"index:idx_reach_cell"`
+	Port        int       `json:"port" gorm:"index:idx_reach_cell"`
+	TCPOK       bool      `json:"tcp_ok"`
+	TCPMs       float64   `json:"tcp_ms"`
+	TLSTested   bool      `json:"tls_tested"`
+	TLSOK       bool      `json:"tls_ok"`
+	TLSMs       float64   `json:"tls_ms"`
+	ProxyTested bool      `json:"proxy_tested"`
+	ProxyOK     bool      `json:"proxy_ok"`
+	ProxyMs     float64   `json:"proxy_ms"`
+	Error       string    `json:"error"`
+	ProbedAt    time.Time `json:"probed_at" gorm:"index"`
+}
+
+// ReachabilityState 每个 探测标签 x 入口端口 最近一次判定的状态，用于检测状态变化
+type ReachabilityState struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	Label       string    `json:"label" gorm:"uniqueIndex:idx_reach_state"`
+	EntryNodeID uint      `json:"entry_node_id" gorm:"uniqueIndex:idx_reach_state"`
+	Port        int       `json:"port" gorm:"uniqueIndex:idx_reach_state"`
+	Status      string    `json:"status"`
+	BlockedAt   string    `json:"blocked_at"` // 封锁发生的阶段: tcp, tls, proxy
+	Since       time.Time `json:"since"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Prober 可达性探测机 (stealth-agent -probe)。每台探测机有独立的接口 Token (只能访问 /api/v1/probe/*)
+// 与独立的代理凭证 (写入各入口配置)，停用或删除后凭证随下次配置同步失效
+type Prober struct {
+	ID                uint       `json:"id" gorm:"primaryKey"`
+	Name              string     `json:"name" gorm:"uniqueIndex"`
+	TokenHash         string     `json:"-" gorm:"index"` // 接口 Token 的 SHA-256，Token 只在创建/重置时返回一次
+	ProxyUUID         string     `json:"-"`              // 代理凭证，只下发给本探测机
+	Enabled           bool       `json:"enabled" gorm:"default:true"`
+	RequestsPerMinute int        `json:"requests_per_minute"` // 接口限频，0 为默认 30
+	DailyTrafficMB    int64      `json:"daily_traffic_mb"`    // 每日代理流量上限 (MB)，0 为默认 100；超出后当天不再下发代理凭证
+	LastSeenAt        *time.Time `json:"last_seen_at"`
+	LastIP            string     `json:"last_ip"`
+	CreatedAt         time.Time  `json:"created_at"`
+	UpdatedAt         time.Time  `json:"updated_at"`
+}
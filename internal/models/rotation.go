@@ -0,0 +1,56 @@
+package models
+
+import "time"
+
+// RotationPolicy 自动换 IP 策略 (全局唯一，仅对开启 AutoRotateIP 且绑定云实例的入口生效)
+type RotationPolicy struct {
+	ID      uint `json:"id" gorm:"primaryKey"`
+	Enabled bool `json:"enabled"`
+	DryRun  bool `json:"dry_run"` // 只记录决策，不实际换 IP
+
+	// 触发信号，0 表示关闭该信号
+	ProbeBlockedLabels   int `json:"probe_blocked_labels"`   // 至少多少个探测标签 (运营商/地区) 判定入口在 TCP/TLS 阶段被封锁
+	ZeroTrafficMinutes   int `json:"zero_traffic_minutes"`   // Agent 在线但此前活跃的用户持续多少分钟没有流量
+	HeartbeatLossMinutes int `json:"heartbeat_loss_minutes"` // 节点离线 (无心跳) 持续多少分钟
+
+	CooldownMinutes  int    `json:"cooldown_minutes"`  // 同一入口两次换 IP 的最小间隔 (0 使用默认 60)
+	DailyBudget      int    `json:"daily_budget"`      // 每个 云账号/区域 每天最多自动换 IP 次数 (0 不限制)
+	MaintenanceStart string `json:"maintenance_start"` // 维护窗口 HH:MM (本地时间)，为空表示任何时间都可换 IP
+	MaintenanceEnd   string `json:"maintenance_end"`   // 可跨午夜，如 23:00 - 06:00
+
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// 自动换 IP 决策结果
+const (
+	RotationActionRotated    = "rotated"
+	RotationActionFailed     = "failed"
+	RotationActionDryRun     = "dry_run"
+	RotationActionCooldown   = "skipped_cooldown"
+	RotationActionBudget     = "skipped_budget"
+	RotationActionWindow     = "skipped_window"
+	RotationActionNoInstance = "skipped_no_instance"
+)
+
+// 自动换 IP 触发信号
+const (
+	RotationSignalProbeBlocked  = "probe_blocked"
+	RotationSignalZeroTraffic   = "zero_traffic"
+	RotationSignalHeartbeatLoss = "heartbeat_loss"
+)
+
+// RotationDecision 自动换 IP 的决策日志
+type RotationDecision struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	EntryNodeID uint      `json:"entry_node_id" gorm:"index"`
+	Signal      string    `json:"signal"` // probe_blocked, zero_traffic, heartbeat_loss
+	Detail      string    `json:"detail"`
+	Action      string    `json:"action" gorm:"index"`
+	Provider    string    `json:"provider"`
+	AccountID   uint      `json:"account_id" gorm:"default:0"` // 入口绑定的云账号，0 表示未绑定账号 (使用单一密钥)
+	Region      string    `json:"region"`
+	OldIP       string    `json:"old_ip"`
+	NewIP       string    `json:"new_ip"`
+	Error       string    `json:"error"`
+	CreatedAt   time.Time `json:"created_at" gorm:"index"`
+}
@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// SyncRun 记录一次 V2Board 用户同步的执行结果 (按 入口 + V2Board 节点 维度)
+type SyncRun struct {
+	ID            uint      `json:"id" gorm:"primaryKey"`
+	EntryNodeID   uint      `json:"entry_node_id" gorm:"index"`
+	V2boardNodeID int       `json:"v2board_node_id" gorm:"index"`
+	Trigger       string    `json:"trigger"` // timer, api
+	StartedAt     time.Time `json:"started_at" gorm:"index"`
+	FinishedAt    time.Time `json:"finished_at"`
+	UsersFetched  int       `json:"users_fetched"` // 从面板拉取到的用户数
+	RulesCreated  int       `json:"rules_created"`
+	RulesUpdated  int       `json:"rules_updated"`
+	RulesDeleted  int       `json:"rules_deleted"`
+	Unchanged     bool      `json:"unchanged"` // 面板用户列表未变化，跳过了比对
+	Error         string    `json:"error"`     // 为空表示成功
+}
+
+// UserIdentity 将 (入口, V2Board 节点, V2Board 用户) 映射为全局唯一的不透明身份标签
+// 标签写入 sing-box 用户名 (ForwardingRule.UserEmail)，流量归属只依据此表，不再解析标签字符串
+type UserIdentity struct {
+	ID            uint      `json:"id" gorm:"primaryKey"`
+	EntryNodeID   uint      `json:"entry_node_id" gorm:"uniqueIndex:idx_identity_owner"`
+	V2boardNodeID int       `json:"v2board_node_id" gorm:"uniqueIndex:idx_identity_owner"`
+	V2boardUID    uint      `json:"v2board_uid" gorm:"uniqueIndex:idx_identity_owner"`
+	Tag           string    `json:"tag" gorm:"uniqueIndex"`
+	CreatedAt     time.Time `json:"created_at"`
+}
@@ -13,17 +13,68 @@ type SystemSetting struct {
 
 // CloudAccount 存储多个云账号信息
 type CloudAccount struct {
-	ID        uint      `json:"id" gorm:"primaryKey"`
-	Name      string    `json:"name"`                        // 账号备注名
-	Provider  string    `json:"provider"`                    // aws, cloudflare
-	AccessKey string    `json:"access_key"`                  // AWS Access Key ID 或 CF Token
-	SecretKey string    `json:"secret_key"`                  // AWS Secret Access Key (CF 可为空)
-	UsageHash string    `json:"usage_hash" gorm:"index"`     // 用于简单去重或查找
-	Enabled   bool      `json:"enabled" gorm:"default:true"` // 是否启用
+	ID        uint   `json:"id" gorm:"primaryKey"`
+	Name      string `json:"name"`                        // 账号备注名
+	Provider  string `json:"provider"`                    // aws, cloudflare, vultr, digitalocean, hetzner, aliyun, tencentcloud
+	AccessKey string `json:"access_key"`                  // AWS/阿里云 AccessKey ID、腾讯云 SecretId 或 API Token (CF/Vultr/DO/Hetzner)
+	SecretKey string `json:"secret_key"`                  // AWS/阿里云/腾讯云 Secret (Token 类账号为空)
+	UsageHash string `json:"usage_hash" gorm:"index"`     // 用于简单去重或查找
+	Enabled   bool   `json:"enabled" gorm:"default:true"` // 是否启用
+	Endpoint  string `json:"endpoint"`                    // 自定义 API 地址 (Vultr/DO/Hetzner/DNS)，为空使用官方地址
+
+	// 账号池状态与用量 (由系统维护，编辑账号时重置健康状态)
+	Healthy        bool       `json:"healthy" gorm:"default:true"` // 凭证失效 (鉴权失败) 时置为 false，不再参与选择
+	LimitedUntil   *time.Time `json:"limited_until"`               // 遇到配额/限额错误后，在此之前跳过该账号
+	InstanceCount  int        `json:"instance_count"`              // 通过本系统创建且尚未销毁的实例数 (least_used 依据)
+	ProvisionCount int        `json:"provision_count"`             // 累计创建实例次数
+	RotateCount    int        `json:"rotate_count"`                // 累计换 IP 次数
+	ErrorCount     int        `json:"error_count"`                 // 累计失败次数
+	LastUsedAt     *time.Time `json:"last_used_at"`                // 最近一次被选中/使用的时间 (round_robin 依据)
+	LastError      string     `json:"last_error"`
+	LastErrorAt    *time.Time `json:"last_error_at"`
+
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
 
+// 云账号池的选择策略
+const (
+	CloudAccountPolicyLeastUsed  = "least_used"  // 优先选择实例最少的账号 (默认)
+	CloudAccountPolicyRoundRobin = "round_robin" // 按最近使用时间轮流选择
+)
+
+// 云账号操作类型
+const (
+	CloudAccountOpProvision = "provision"
+	CloudAccountOpTerminate = "terminate"
+	CloudAccountOpRotate    = "rotate"
+)
+
+// CloudAccountUsage 云账号的操作记录 (创建/销毁/换 IP)
+type CloudAccountUsage struct {
+	ID             uint      `json:"id" gorm:"primaryKey"`
+	CloudAccountID uint      `json:"cloud_account_id" gorm:"index"`
+	Operation      string    `json:"operation"`
+	Region         string    `json:"region"`
+	Success        bool      `json:"success"`
+	Error          string    `json:"error"`
+	FailedOver     bool      `json:"failed_over"` // 因限额/鉴权错误跳过该账号，改用下一个账号
+	CreatedAt      time.Time `json:"created_at" gorm:"index"`
+}
+
+// DNSZone DNS 域名绑定：入口的子域名在哪个 DNS 平台、哪个根域名下维护
+type DNSZone struct {
+	ID             uint      `json:"id" gorm:"primaryKey"`
+	Name           string    `json:"name"`                // 备注名
+	Provider       string    `json:"provider"`            // cloudflare, route53, alidns, dnspod
+	Domain         string    `json:"domain" gorm:"index"` // 根域名 (如 example.com)
+	CloudAccountID uint      `json:"cloud_account_id"`    // 凭证所在的云账号 (cloudflare/aws/aliyun/tencentcloud)，0 表示使用账号池中第一个可用账号
+	TTL            int       `json:"ttl"`                 // 记录 TTL (秒)，0 表示更新时沿用记录原 TTL、新记录使用平台默认值
+	Proxied        *bool     `json:"proxied"`             // 仅 Cloudflare：是否开启代理 (入口直连时应关闭)，为空表示沿用记录原设置
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
 // SSHKey 存储用于拉起 Agent 的全局 SSH 私钥
 type SSHKey struct {
 	ID         uint      `json:"id" gorm:"primaryKey"`
@@ -39,5 +90,29 @@ const (
 	ConfigKeyAwsSecretAccessKey = "aws.secret_access_key"
 	ConfigKeyAwsDefaultRegion   = "aws.default_region" // 默认区域
 	ConfigKeyCfApiToken         = "cloudflare.api_token"
-	ConfigKeyCfDefaultZone      = "cloudflare.default_zone" // 默认域名 (2233006.xyz)
+	ConfigKeyCfDefaultZone      = "cloudflare.default_zone" // 默认域名 (2233006.xyz)，仅用于未绑定 DNS 域名的入口
+
+	ConfigKeyCloudAccountPolicy = "cloud.account_policy" // 新实例的账号选择策略: least_used (默认), round_robin
+
+	ConfigKeyTrafficOutboxRetention = "traffic.outbox_retention_hours" // 已推送流量记录保留时长 (小时，0 为推送后立即删除)
+	ConfigKeyTrafficOutboxMaxAge    = "traffic.outbox_max_age_hours"   // 待推送流量最长保留 (小时)，超期丢弃
+	ConfigKeyTrafficHourlyRetention = "traffic.history_hourly_days"    // 小时级流量历史保留天数
+	ConfigKeyTrafficDailyRetention  = "traffic.history_daily_days"     // 天级流量历史保留天数
+
+	ConfigKeyQuotaBillingDay = "quota.billing_day" // 配额默认的每月重置日 (1-28)
+
+	ConfigKeyBandwidthAlertThresholds = "bandwidth.alert_thresholds" // 云流量额度告警阈值 (%，逗号分隔，默认 "80,90,100")
+	ConfigKeyBandwidthAlertChannels   = "bandwidth.alert_channels"   // 云流量额度告警的通知渠道 ID (逗号分隔)，为空发送到所有启用的渠道
+
+	ConfigKeyNodeDegradedAfter = "node.degraded_after_seconds" // 超过该时长未上报视为延迟 (默认 90 秒)
+	ConfigKeyNodeOfflineAfter  = "node.offline_after_seconds"  // 超过该时长未上报视为离线 (默认 300 秒)
+
+	ConfigKeyProbeRetentionDays = "probe.history_days" // 落地探测与可达性探测历史保留天数 (默认 7)
+
+	ConfigKeyControllerPublicURL = "controller.public_url" // Agent 回连的主控地址 (如 https://ctrl.example.com)，机器人重装节点时使用
+
+	ConfigKeyTelegramBotToken   = "telegram.bot_token"       // 运维机器人 Token，为空不启用
+	ConfigKeyTelegramAPIBase    = "telegram.api_base"        // Bot API 地址 (默认 https://api.telegram.org)
+	ConfigKeyTelegramAdminChats = "telegram.admin_chat_ids"  // 管理员 chat ID (逗号分隔)，可执行全部命令
+	ConfigKeyTelegramViewChats  = "telegram.viewer_chat_ids" // 只读 chat ID (逗号分隔)，仅可查询
 )
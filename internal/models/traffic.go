@@ -0,0 +1,49 @@
+package models
+
+import "time"
+
+// TrafficOutbox 待上报面板的用户流量 (持久化发件箱)
+// Agent 上报的流量先落库再确认，推送面板成功后才标记完成，重启/崩溃不丢流量
+type TrafficOutbox struct {
+	ID            uint       `json:"id" gorm:"primaryKey"`
+	EntryNodeID   uint       `json:"entry_node_id" gorm:"index:idx_outbox_node"`
+	V2boardNodeID int        `json:"v2board_node_id" gorm:"index:idx_outbox_node"`
+	V2boardUID    uint       `json:"v2board_uid"`
+	Tag           string     `json:"tag"` // 身份标签
+	Upload        int64      `json:"upload"`
+	Download      int64      `json:"download"`
+	Attempts      int        `json:"attempts"`               // 已失败的推送次数
+	NextAttemptAt time.Time  `json:"next_attempt_at"`        // 退避期间不参与推送
+	LastError     string     `json:"last_error"`             // 最近一次推送失败原因
+	PushedAt      *time.Time `json:"pushed_at" gorm:"index"` // 为空表示待推送
+	CreatedAt     time.Time  `json:"created_at" gorm:"index"`
+}
+
+// AgentReportCursor 记录每个 Agent 实例最后一次已入账的上报序号，用于去重
+type AgentReportCursor struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	EntryNodeID uint      `json:"entry_node_id" gorm:"uniqueIndex:idx_agent_instance"`
+	InstanceID  string    `json:"instance_id" gorm:"uniqueIndex:idx_agent_instance"`
+	LastSeq     uint64    `json:"last_seq"`
+	UpdatedAt   time.Time `json:"updated_at" gorm:"index"`
+}
+
+// 流量历史粒度
+const (
+	TrafficGranularityHour = "hour"
+	TrafficGranularityDay  = "day"
+)
+
+// TrafficBucket 按 小时/天 汇总的用户流量，入口、落地、映射 (入口 + V2Board 节点) 维度均由此表聚合得出
+type TrafficBucket struct {
+	ID            uint      `json:"id" gorm:"primaryKey"`
+	Granularity   string    `json:"granularity" gorm:"uniqueIndex:idx_bucket_key;index:idx_bucket_time"`
+	BucketStart   time.Time `json:"bucket_start" gorm:"uniqueIndex:idx_bucket_key;index:idx_bucket_time"` // UTC
+	EntryNodeID   uint      `json:"entry_node_id" gorm:"uniqueIndex:idx_bucket_key"`
+	ExitNodeID    uint      `json:"exit_node_id" gorm:"uniqueIndex:idx_bucket_key"`
+	V2boardNodeID int       `json:"v2board_node_id" gorm:"uniqueIndex:idx_bucket_key"`
+	Tag           string    `json:"tag" gorm:"uniqueIndex:idx_bucket_key"`
+	V2boardUID    uint      `json:"v2board_uid"`
+	Upload        int64     `json:"upload"`
+	Download      int64     `json:"download"`
+}
@@ -0,0 +1,184 @@
+package sync
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/wangn9900/StealthForward/internal/database"
+	"github.com/wangn9900/StealthForward/internal/models"
+)
+
+// ValidateAlertRule 校验告警规则
+func ValidateAlertRule(rule models.AlertRule) error {
+	switch rule.Metric {
+	case models.AlertMetricOffline, models.AlertMetricLoad1, models.AlertMetricLoad5:
+	case models.AlertMetricCPU, models.AlertMetricMem, models.AlertMetricDisk:
+		if rule.Threshold > 100 {
+			return fmt.Errorf("%s threshold is a percentage (0-100)", rule.Metric)
+		}
+	default:
+		return fmt.Errorf("unknown metric: %s", rule.Metric)
+	}
+	if rule.Threshold < 0 || rule.DurationSec < 0 {
+		return fmt.Errorf("threshold and duration_sec must not be negative")
+	}
+	if rule.EntryNodeID > 0 {
+		var count int64
+		database.DB.Model(&models.EntryNode{}).Where("id = ?", rule.EntryNodeID).Count(&count)
+		if count == 0 {
+			return fmt.Errorf("entry node %d not found", rule.EntryNodeID)
+		}
+	}
+	return nil
+}
+
+// alertValue 计算规则指标的当前值，ok=false 表示暂无可用数据 (不触发也不恢复)
+func alertValue(metric string, status models.NodeStatus, now time.Time) (float64, bool) {
+	if metric == models.AlertMetricOffline {
+		switch status.Status {
+		case models.NodeStatusOffline:
+			if status.LastReportAt == nil {
+				return 0, false
+			}
+			return now.Sub(*status.LastReportAt).Minutes(), true
+		case models.NodeStatusOnline, models.NodeStatusDegraded:
+			return 0, true
+		}
+		return 0, false
+	}
+
+	// 资源类指标只看仍在上报的节点，离线节点的旧数据不参与判断
+	if status.Status != models.NodeStatusOnline && status.Status != models.NodeStatusDegraded {
+		return 0, false
+	}
+	stats := latestNodeStats(status.EntryNodeID)
+	if stats == nil {
+		return 0, false
+	}
+	switch metric {
+	case models.AlertMetricCPU:
+		return stats.CPU, true
+	case models.AlertMetricMem:
+		return stats.Mem, true
+	case models.AlertMetricDisk:
+		return stats.Disk, true
+	case models.AlertMetricLoad1:
+		return stats.Load1, true
+	case models.AlertMetricLoad5:
+		return stats.Load5, true
+	}
+	return 0, false
+}
+
+// alertUnit 指标单位 (用于通知内容)
+func alertUnit(metric string) string {
+	switch metric {
+	case models.AlertMetricOffline:
+		return " min"
+	case models.AlertMetricCPU, models.AlertMetricMem, models.AlertMetricDisk:
+		return "%"
+	}
+	return ""
+}
+
+// evaluateAlertRules 检查所有启用的规则，触发或恢复告警并发送通知 (调用方持有 livenessMu)
+func evaluateAlertRules(now time.Time, entries []models.EntryNode, statuses map[uint]models.NodeStatus) {
+	var rules []models.AlertRule
+	database.DB.Where("enabled = ?", true).Find(&rules)
+	var firing []models.AlertEvent
+	database.DB.Where("state = ?", models.AlertStateFiring).Find(&firing)
+	type alertKey struct{ rule, entry uint }
+	open := make(map[alertKey]models.AlertEvent, len(firing))
+	for _, ev := range firing {
+		open[alertKey{ev.RuleID, ev.EntryNodeID}] = ev
+	}
+
+	active := make(map[uint]bool, len(rules))
+	for _, rule := range rules {
+		active[rule.ID] = true
+		pending := alertPending[rule.ID]
+		if pending == nil {
+			pending = make(map[uint]time.Time)
+			alertPending[rule.ID] = pending
+		}
+		hold := time.Duration(rule.DurationSec) * time.Second
+		if rule.Metric == models.AlertMetricOffline {
+			hold = 0
+		}
+
+		for _, entry := range entries {
+			if rule.EntryNodeID > 0 && rule.EntryNodeID != entry.ID {
+				continue
+			}
+			value, ok := alertValue(rule.Metric, statuses[entry.ID], now)
+			if !ok {
+				continue
+			}
+			key := alertKey{rule.ID, entry.ID}
+			ev, isFiring := open[key]
+			unit := alertUnit(rule.Metric)
+
+			breach := value >= rule.Threshold
+			if rule.Metric == models.AlertMetricOffline {
+				breach = breach && statuses[entry.ID].Status == models.NodeStatusOffline
+			}
+			if !breach {
+				delete(pending, entry.ID)
+				if isFiring {
+					resolvedAt := now
+					database.DB.Model(&ev).Updates(map[string]interface{}{"state": models.AlertStateResolved, "resolved_at": &resolvedAt})
+					msg := fmt.Sprintf("入口 #%d (%s) %s 已恢复: %.1f%s (阈值 %.1f%s)，持续 %s",
+						entry.ID, entry.Name, rule.Metric, value, unit, rule.Threshold, unit, now.Sub(ev.FiredAt).Round(time.Second))
+					log.Printf("[Alert] %s: %s", rule.Name, msg)
+					Notify(parseIDList(rule.ChannelIDs), "[恢复] "+rule.Name, msg)
+					PublishEvent(models.EventAlertResolved, entrySubject(entry.ID), msg,
+						map[string]interface{}{"rule_id": rule.ID, "rule": rule.Name, "metric": rule.Metric, "value": value, "threshold": rule.Threshold, "alert_id": ev.ID})
+				}
+				continue
+			}
+
+			since, seen := pending[entry.ID]
+			if !seen {
+				since = now
+				pending[entry.ID] = now
+			}
+			if isFiring || now.Sub(since) < hold {
+				continue
+			}
+			msg := fmt.Sprintf("入口 #%d (%s) %s = %.1f%s (阈值 %.1f%s)",
+				entry.ID, entry.Name, rule.Metric, value, unit, rule.Threshold, unit)
+			alert := models.AlertEvent{
+				RuleID:      rule.ID,
+				RuleName:    rule.Name,
+				EntryNodeID: entry.ID,
+				State:       models.AlertStateFiring,
+				Value:       value,
+				Message:     msg,
+				FiredAt:     now,
+			}
+			database.DB.Create(&alert)
+			log.Printf("[Alert] %s: %s", rule.Name, msg)
+			Notify(parseIDList(rule.ChannelIDs), "[告警] "+rule.Name, msg)
+			PublishEvent(models.EventAlertFiring, entrySubject(entry.ID), msg,
+				map[string]interface{}{"rule_id": rule.ID, "rule": rule.Name, "metric": rule.Metric, "value": value, "threshold": rule.Threshold, "alert_id": alert.ID})
+		}
+	}
+
+	// 规则被删除/停用或入口被删除后，关闭其遗留的告警 (不发送通知)
+	entryExists := make(map[uint]bool, len(entries))
+	for _, entry := range entries {
+		entryExists[entry.ID] = true
+	}
+	for key, ev := range open {
+		if !active[key.rule] || !entryExists[key.entry] {
+			resolvedAt := now
+			database.DB.Model(&ev).Updates(map[string]interface{}{"state": models.AlertStateResolved, "resolved_at": &resolvedAt})
+		}
+	}
+	for ruleID := range alertPending {
+		if !active[ruleID] {
+			delete(alertPending, ruleID)
+		}
+	}
+}
@@ -0,0 +1,280 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wangn9900/StealthForward/internal/database"
+	"github.com/wangn9900/StealthForward/internal/models"
+)
+
+const (
+	// autoRotateTick 自动换 IP 策略的检查间隔
+	autoRotateTick         = time.Minute
+	defaultRotateCooldown  = 60 // 分钟
+	autoRotateTimeout      = 5 * time.Minute
+	rotationDecisionRepeat = 30 * time.Minute // 相同的跳过决策在该时间内不重复记录
+	rotationDecisionKeep   = 90 * 24 * time.Hour
+)
+
+var (
+	// autoRotateMu 串行化策略检查，避免同一入口被并发换 IP
+	autoRotateMu sync.Mutex
+	// entryTraffic 入口 ID -> 最近一次有用户产生流量的时间与人数 (用于断流判断)
+	entryTrafficMu sync.Mutex
+	entryTraffic   = make(map[uint]entryTrafficMark)
+	// lastRotationDecision 入口 ID -> 最近一次记录的决策 (用于去重)
+	lastRotationDecision = make(map[uint]models.RotationDecision)
+)
+
+type entryTrafficMark struct {
+	at    time.Time
+	users int
+}
+
+// noteEntryTraffic 记录入口最近一次有用户产生流量的时间
+func noteEntryTraffic(entryID uint, activeUsers int, now time.Time) {
+	if activeUsers == 0 {
+		return
+	}
+	entryTrafficMu.Lock()
+	entryTraffic[entryID] = entryTrafficMark{at: now, users: activeUsers}
+	entryTrafficMu.Unlock()
+}
+
+// GetRotationPolicy 返回自动换 IP 策略 (未配置时为默认值，未启用)
+func GetRotationPolicy() models.RotationPolicy {
+	policy := models.RotationPolicy{ID: 1, CooldownMinutes: defaultRotateCooldown}
+	database.DB.Where("id = ?", 1).Find(&policy)
+	return policy
+}
+
+// ValidateRotationPolicy 校验策略参数
+func ValidateRotationPolicy(p models.RotationPolicy) error {
+	if p.ProbeBlockedLabels < 0 || p.ZeroTrafficMinutes < 0 || p.HeartbeatLossMinutes < 0 || p.CooldownMinutes < 0 || p.DailyBudget < 0 {
+		return errors.New("thresholds, cooldown and budget must not be negative")
+	}
+	if (p.MaintenanceStart == "") != (p.MaintenanceEnd == "") {
+		return errors.New("maintenance_start and maintenance_end must be set together")
+	}
+	if p.MaintenanceStart != "" {
+		if _, err := time.Parse("15:04", p.MaintenanceStart); err != nil {
+			return fmt.Errorf("invalid maintenance_start %q (HH:MM)", p.MaintenanceStart)
+		}
+		if _, err := time.Parse("15:04", p.MaintenanceEnd); err != nil {
+			return fmt.Errorf("invalid maintenance_end %q (HH:MM)", p.MaintenanceEnd)
+		}
+	}
+	return nil
+}
+
+// SaveRotationPolicy 保存自动换 IP 策略
+func SaveRotationPolicy(p models.RotationPolicy) (models.RotationPolicy, error) {
+	if err := ValidateRotationPolicy(p); err != nil {
+		return p, err
+	}
+	p.ID = 1
+	if err := database.DB.Save(&p).Error; err != nil {
+		return p, err
+	}
+	return p, nil
+}
+
+// inMaintenanceWindow 判断当前是否处于允许换 IP 的维护窗口
+func inMaintenanceWindow(p models.RotationPolicy, now time.Time) bool {
+	if p.MaintenanceStart == "" || p.MaintenanceEnd == "" {
+		return true
+	}
+	start, err1 := time.Parse("15:04", p.MaintenanceStart)
+	end, err2 := time.Parse("15:04", p.MaintenanceEnd)
+	if err1 != nil || err2 != nil {
+		return true
+	}
+	cur := now.Hour()*60 + now.Minute()
+	s := start.Hour()*60 + start.Minute()
+	e := end.Hour()*60 + end.Minute()
+	if s <= e {
+		return cur >= s && cur < e
+	}
+	return cur >= s || cur < e // 跨午夜
+}
+
+// StartAutoRotation 定时按策略检查开启自动换 IP 的入口
+func StartAutoRotation() {
+	go func() {
+		ticker := time.NewTicker(autoRotateTick)
+		for now := range ticker.C {
+			policy := GetRotationPolicy()
+			if policy.Enabled {
+				EvaluateAutoRotation(policy, now, false)
+			}
+		}
+	}()
+}
+
+// rotationSignal 检查入口的健康信号，返回第一个越过阈值的信号
+func rotationSignal(p models.RotationPolicy, entry models.EntryNode, since, now time.Time) (signal, detail string) {
+	var status models.NodeStatus
+	hasStatus := database.DB.Where("entry_node_id = ?", entry.ID).Find(&status).RowsAffected > 0
+
+	// 1. 探测机判定被封锁 (只看上次换 IP 之后的判定)
+	if p.ProbeBlockedLabels > 0 {
+		var labels []string
+		database.DB.Model(&models.ReachabilityState{}).
+			Where("entry_node_id = ? AND status = ? AND blocked_at IN ? AND since > ?", entry.ID, models.ReachabilityBlocked, []string{"tcp", "tls"}, since).
+			Distinct().Pluck("label", &labels)
+		if len(labels) >= p.ProbeBlockedLabels {
+			return models.RotationSignalProbeBlocked, fmt.Sprintf("%d 个探测网络判定被封锁: %s", len(labels), strings.Join(labels, ", "))
+		}
+	}
+
+	// 2. Agent 仍在上报，但此前活跃的用户长时间没有流量
+	if p.ZeroTrafficMinutes > 0 && hasStatus && status.Status == models.NodeStatusOnline {
+		entryTrafficMu.Lock()
+		mark, ok := entryTraffic[entry.ID]
+		entryTrafficMu.Unlock()
+		if ok && mark.at.After(since) && now.Sub(mark.at) >= time.Duration(p.ZeroTrafficMinutes)*time.Minute {
+			// 用户全部下线后无流量是正常的：仍有在线用户或活跃连接却没有流量才视为断流
+			var conns int64
+			if stats := latestNodeStats(entry.ID); stats != nil {
+				conns = stats.ActiveConns
+			}
+			if online := entryOnlineUsers(entry, now); online > 0 || conns > 0 {
+				return models.RotationSignalZeroTraffic, fmt.Sprintf("最近活跃 %d 个用户，已 %d 分钟无流量 (当前在线 %d 个用户，%d 个活跃连接)",
+					mark.users, int(now.Sub(mark.at).Minutes()), online, conns)
+			}
+		}
+	}
+
+	// 3. 心跳丢失
+	if p.HeartbeatLossMinutes > 0 && hasStatus && status.Status == models.NodeStatusOffline && status.LastReportAt != nil {
+		lost := now.Sub(*status.LastReportAt)
+		if lost >= time.Duration(p.HeartbeatLossMinutes)*time.Minute && status.LastReportAt.After(since) {
+			return models.RotationSignalHeartbeatLoss, fmt.Sprintf("已 %d 分钟无心跳", int(lost.Minutes()))
+		}
+	}
+	return "", ""
+}
+
+// lastRotationAt 入口最近一次换 IP (含手动) 的时间，succeededOnly 时只看成功的
+func lastRotationAt(entryID uint, succeededOnly bool) time.Time {
+	types := []string{models.EventRotationSucceeded, models.EventRotationFailed}
+	if succeededOnly {
+		types = types[:1]
+	}
+	var event models.Event
+	database.DB.Where("subject = ? AND type IN ?", entrySubject(entryID), types).
+		Order("id DESC").Limit(1).Find(&event)
+	return event.CreatedAt
+}
+
+// rotationsToday 今天在同一 云账号/区域 下已执行的自动换 IP 次数 (额度按账号计算，不同账号互不占用)
+func rotationsToday(accountID uint, provider, region string, now time.Time) int64 {
+	y, m, d := now.Date()
+	dayStart := time.Date(y, m, d, 0, 0, 0, 0, now.Location())
+	var count int64
+	database.DB.Model(&models.RotationDecision{}).
+		Where("account_id = ? AND provider = ? AND region = ? AND action IN ? AND created_at >= ?", accountID, provider, region,
+			[]string{models.RotationActionRotated, models.RotationActionFailed}, dayStart).
+		Count(&count)
+	return count
+}
+
+// EvaluateAutoRotation 按策略检查所有开启自动换 IP 的入口；forceDryRun 时只返回决策不换 IP
+// 返回本轮产生的决策 (含被去重、未写入日志的跳过决策)
+func EvaluateAutoRotation(p models.RotationPolicy, now time.Time, forceDryRun bool) []models.RotationDecision {
+	autoRotateMu.Lock()
+	defer autoRotateMu.Unlock()
+
+	cooldown := time.Duration(p.CooldownMinutes) * time.Minute
+	if p.CooldownMinutes <= 0 {
+		cooldown = defaultRotateCooldown * time.Minute
+	}
+
+	var entries []models.EntryNode
+	database.DB.Where("auto_rotate_ip = ?", true).Order("id").Find(&entries)
+	decisions := []models.RotationDecision{}
+	for _, entry := range entries {
+		// 信号只看上次成功换 IP 之后的数据，冷却时间从上次尝试算起
+		signal, detail := rotationSignal(p, entry, lastRotationAt(entry.ID, true), now)
+		if signal == "" {
+			continue
+		}
+		decision := models.RotationDecision{
+			EntryNodeID: entry.ID,
+			Signal:      signal,
+			Detail:      detail,
+			Provider:    entry.CloudProvider,
+			AccountID:   entry.CloudAccountID,
+			Region:      entry.CloudRegion,
+			OldIP:       entry.IP,
+			CreatedAt:   now,
+		}
+
+		last := lastRotationAt(entry.ID, false)
+		switch {
+		case entry.CloudInstanceID == "" || entry.CloudProvider == "none":
+			decision.Action = models.RotationActionNoInstance
+		case !last.IsZero() && now.Sub(last) < cooldown:
+			decision.Action = models.RotationActionCooldown
+			decision.Detail += fmt.Sprintf("；距上次换 IP 仅 %d 分钟", int(now.Sub(last).Minutes()))
+		case !inMaintenanceWindow(p, now):
+			decision.Action = models.RotationActionWindow
+			decision.Detail += fmt.Sprintf("；不在维护窗口 %s-%s", p.MaintenanceStart, p.MaintenanceEnd)
+		case p.DailyBudget > 0 && rotationsToday(entry.CloudAccountID, entry.CloudProvider, entry.CloudRegion, now) >= int64(p.DailyBudget):
+			decision.Action = models.RotationActionBudget
+			decision.Detail += fmt.Sprintf("；%s 账号 #%d/%s 今日已用完 %d 次额度", entry.CloudProvider, entry.CloudAccountID, entry.CloudRegion, p.DailyBudget)
+		case p.DryRun || forceDryRun:
+			decision.Action = models.RotationActionDryRun
+		default:
+			ctx, cancel := context.WithTimeout(context.Background(), autoRotateTimeout)
+			newIP, err := RotateEntryIP(ctx, entry, entry.CloudRegion, entry.CloudInstanceID, "", entry.CloudRecordName, "auto:"+signal)
+			cancel()
+			decision.NewIP = newIP
+			decision.Action = models.RotationActionRotated
+			if err != nil {
+				decision.Action = models.RotationActionFailed
+				decision.Error = err.Error()
+			}
+			// 换 IP 后旧 IP 的断流记录不再有效
+			entryTrafficMu.Lock()
+			delete(entryTraffic, entry.ID)
+			entryTrafficMu.Unlock()
+		}
+
+		decisions = append(decisions, decision)
+		if !forceDryRun {
+			recordRotationDecision(decision)
+		}
+	}
+	return decisions
+}
+
+// recordRotationDecision 写入决策日志；同一入口相同的跳过/演练决策在一段时间内只记录一次
+func recordRotationDecision(d models.RotationDecision) {
+	prev, ok := lastRotationDecision[d.EntryNodeID]
+	executed := d.Action == models.RotationActionRotated || d.Action == models.RotationActionFailed
+	if !executed && ok && prev.Action == d.Action && prev.Signal == d.Signal && d.CreatedAt.Sub(prev.CreatedAt) < rotationDecisionRepeat {
+		return
+	}
+	lastRotationDecision[d.EntryNodeID] = d
+	log.Printf("[AutoRotate] 入口 #%d %s: %s (%s)", d.EntryNodeID, d.Action, d.Detail, d.Signal)
+	database.DB.Create(&d)
+	database.DB.Where("created_at < ?", d.CreatedAt.Add(-rotationDecisionKeep)).Delete(&models.RotationDecision{})
+}
+
+// GetRotationDecisions 返回自动换 IP 决策日志 (按时间倒序)
+func GetRotationDecisions(entryID uint, limit int) []models.RotationDecision {
+	query := database.DB.Order("id DESC").Limit(limit)
+	if entryID > 0 {
+		query = query.Where("entry_node_id = ?", entryID)
+	}
+	decisions := []models.RotationDecision{}
+	query.Find(&decisions)
+	return decisions
+}
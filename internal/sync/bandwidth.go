@@ -0,0 +1,376 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wangn9900/StealthForward/internal/cloud"
+	"github.com/wangn9900/StealthForward/internal/database"
+	"github.com/wangn9900/StealthForward/internal/dns"
+	"github.com/wangn9900/StealthForward/internal/models"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	defaultAllowanceThresholds = "80,90,100"
+	// bundleSyncInterval 从云厂商刷新套餐额度的间隔
+	bundleSyncInterval = 6 * time.Hour
+	// allowanceActionRetry 动作执行失败后的重试间隔 (避免每分钟反复申请 IP)
+	allowanceActionRetry = 30 * time.Minute
+	// cloudGB 云厂商流量额度中的 1 GB
+	cloudGB = int64(1) << 30
+)
+
+var (
+	// ifaceMu 串行化网卡用量的累加
+	ifaceMu sync.Mutex
+	// bandwidthMu 串行化额度检查，bundleSyncedAt / actionFailedAt 记录各入口上次刷新套餐额度、动作失败的时间
+	bandwidthMu    sync.Mutex
+	bundleSyncedAt = make(map[uint]time.Time)
+	actionFailedAt = make(map[uint]time.Time)
+
+	// errEntrySuspended 入口已有其他来源 (配额/手动) 的暂停，额度暂停暂不写入，待其解除后再执行
+	errEntrySuspended = errors.New("entry is already suspended by another source")
+)
+
+// allowanceCycleStart 流量额度周期起点：设置了计费日的入口按计费周期，否则按云厂商的自然月 (UTC)
+func allowanceCycleStart(now time.Time, entry models.EntryNode) time.Time {
+	if entry.BillingDay > 0 {
+		return billingPeriodStart(now, entry.BillingDay, billingLocation(entry.BillingTimezone))
+	}
+	return billingPeriodStart(now, 1, time.UTC)
+}
+
+// counterDelta 计算网卡计数的增量，计数变小说明 Agent 所在机器重启过
+func counterDelta(last, current int64) int64 {
+	if current >= last {
+		return current - last
+	}
+	return current
+}
+
+// recordInterfaceCounters 按 Agent 上报的网卡累计计数累加入口本周期的用量
+func recordInterfaceCounters(entryID uint, stats *models.SystemStats) {
+	if stats.NetRxTotal == 0 && stats.NetTxTotal == 0 {
+		return // 旧版 Agent 不上报网卡计数
+	}
+	var entry models.EntryNode
+	if err := database.DB.Select("id, billing_day, billing_timezone").First(&entry, entryID).Error; err != nil {
+		return
+	}
+	start := allowanceCycleStart(time.Now(), entry)
+
+	ifaceMu.Lock()
+	defer ifaceMu.Unlock()
+
+	var usage models.InterfaceUsage
+	if err := database.DB.Where("entry_node_id = ? AND cycle_start = ?", entryID, start).First(&usage).Error; err != nil {
+		usage = models.InterfaceUsage{EntryNodeID: entryID, CycleStart: start}
+		// 新周期以上一周期最后的计数为基线；首次上报只记录基线，不把开机以来的流量算进来
+		var prev models.InterfaceUsage
+		if database.DB.Where("entry_node_id = ?", entryID).Order("cycle_start DESC").First(&prev).Error == nil {
+			usage.LastRx, usage.LastTx = prev.LastRx, prev.LastTx
+		} else {
+			usage.LastRx, usage.LastTx = stats.NetRxTotal, stats.NetTxTotal
+		}
+	}
+
+	usage.RxBytes += counterDelta(usage.LastRx, stats.NetRxTotal)
+	usage.TxBytes += counterDelta(usage.LastTx, stats.NetTxTotal)
+	usage.LastRx, usage.LastTx = stats.NetRxTotal, stats.NetTxTotal
+	if err := database.DB.Save(&usage).Error; err != nil {
+		log.Printf("[Bandwidth] 记录入口 #%d 网卡用量失败: %v", entryID, err)
+	}
+}
+
+// allowanceThresholds 读取告警阈值 (升序)
+func allowanceThresholds() []int {
+	value := defaultAllowanceThresholds
+	var setting models.SystemSetting
+	if err := database.DB.Where(&models.SystemSetting{Key: models.ConfigKeyBandwidthAlertThresholds}).First(&setting).Error; err == nil && setting.Value != "" {
+		value = setting.Value
+	}
+	var thresholds []int
+	for _, part := range strings.Split(value, ",") {
+		if t, err := strconv.Atoi(strings.TrimSpace(part)); err == nil && t > 0 {
+			thresholds = append(thresholds, t)
+		}
+	}
+	sort.Ints(thresholds)
+	return thresholds
+}
+
+// SyncBundleAllowance 从 Lightsail 实例套餐读取流量额度并写入入口的 bandwidth_allowance
+func SyncBundleAllowance(entry *models.EntryNode) error {
+	if entry.CloudProvider != cloud.ProviderAWSLightsail || entry.CloudRegion == "" || entry.CloudInstanceID == "" {
+		return fmt.Errorf("entry #%d is not bound to a lightsail instance", entry.ID)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	ctx, err := cloud.AccountContext(ctx, entry.CloudAccountID)
+	if err != nil {
+		return err
+	}
+	gb, err := cloud.GetLightsailTransferAllowance(ctx, entry.CloudRegion, entry.CloudInstanceID)
+	if err != nil {
+		return err
+	}
+	allowance := gb * cloudGB
+	if allowance != entry.BandwidthAllowance {
+		if err := database.DB.Model(&models.EntryNode{}).Where("id = ?", entry.ID).Update("bandwidth_allowance", allowance).Error; err != nil {
+			return err
+		}
+		log.Printf("[Bandwidth] 入口 #%d 套餐流量额度: %d GB", entry.ID, gb)
+		entry.BandwidthAllowance = allowance
+	}
+	return nil
+}
+
+// checkBandwidthAllowances 检查云流量额度：跨阈值告警，达到动作阈值执行动作，周期结束后撤销暂停/切换
+func checkBandwidthAllowances(now time.Time) {
+	bandwidthMu.Lock()
+	defer bandwidthMu.Unlock()
+
+	var entries []models.EntryNode
+	database.DB.Find(&entries)
+	var thresholds []int
+	for i := range entries {
+		entry := &entries[i]
+		start := allowanceCycleStart(now, *entry)
+		revertAllowanceActions(*entry, start)
+
+		if entry.AllowanceFromBundle && now.Sub(bundleSyncedAt[entry.ID]) >= bundleSyncInterval {
+			bundleSyncedAt[entry.ID] = now
+			if err := SyncBundleAllowance(entry); err != nil {
+				log.Printf("[Bandwidth] 读取入口 #%d 套餐额度失败: %v", entry.ID, err)
+			}
+		}
+		if entry.BandwidthAllowance <= 0 {
+			continue
+		}
+
+		var usage models.InterfaceUsage
+		if err := database.DB.Where("entry_node_id = ? AND cycle_start = ?", entry.ID, start).First(&usage).Error; err != nil {
+			continue
+		}
+		if thresholds == nil {
+			thresholds = allowanceThresholds()
+		}
+		used := usage.RxBytes + usage.TxBytes
+		percent := int(used * 100 / entry.BandwidthAllowance)
+		updates := map[string]interface{}{"allowance": entry.BandwidthAllowance}
+
+		alerted := usage.AlertedPercent
+		for _, t := range thresholds {
+			if t > alerted && percent >= t {
+				alerted = t
+			}
+		}
+		if alerted != usage.AlertedPercent {
+			msg := fmt.Sprintf("入口 #%d (%s) 本周期网卡流量已达额度的 %d%% (%s / %s)",
+				entry.ID, entry.Name, percent, FormatBytes(used), FormatBytes(entry.BandwidthAllowance))
+			log.Printf("!!!! [Bandwidth] %s", msg)
+			notifyBandwidth(models.EventBandwidthAlert, "[流量额度] "+entry.Name, msg, entry.ID, map[string]interface{}{
+				"entry_id":   entry.ID,
+				"threshold":  alerted,
+				"percent":    percent,
+				"used_bytes": used,
+				"allowance":  entry.BandwidthAllowance,
+			})
+			updates["alerted_percent"] = alerted
+		}
+
+		actionPercent := entry.AllowanceActionPercent
+		if actionPercent <= 0 {
+			actionPercent = 100
+		}
+		if entry.AllowanceAction != "" && usage.Action == "" && percent >= actionPercent &&
+			now.Sub(actionFailedAt[entry.ID]) >= allowanceActionRetry {
+			err := runAllowanceAction(*entry)
+			switch {
+			case errors.Is(err, errEntrySuspended):
+				// 不记录动作，下一轮检查 (或其他暂停被解除时) 重新执行，避免解除后超额继续放行
+				if alerted != usage.AlertedPercent {
+					log.Printf("[Bandwidth] 入口 #%d 已被其他来源暂停，额度暂停待其解除后执行", entry.ID)
+				}
+			case err != nil:
+				actionFailedAt[entry.ID] = now
+				log.Printf("[Bandwidth] 入口 #%d 执行额度动作 %s 失败: %v", entry.ID, entry.AllowanceAction, err)
+			default:
+				msg := fmt.Sprintf("入口 #%d (%s) 本周期网卡流量已达额度的 %d%%，已执行额度动作: %s",
+					entry.ID, entry.Name, percent, entry.AllowanceAction)
+				log.Printf("!!!! [Bandwidth] %s", msg)
+				notifyBandwidth(models.EventBandwidthAction, "[流量额度] "+entry.Name, msg, entry.ID, map[string]interface{}{
+					"entry_id":   entry.ID,
+					"action":     entry.AllowanceAction,
+					"percent":    percent,
+					"used_bytes": used,
+					"allowance":  entry.BandwidthAllowance,
+				})
+				updates["action"] = entry.AllowanceAction
+				updates["action_at"] = now
+			}
+		}
+		database.DB.Model(&models.InterfaceUsage{}).Where("id = ?", usage.ID).Updates(updates)
+	}
+}
+
+// notifyBandwidth 发布云流量额度事件并发送到 bandwidth.alert_channels 指定的渠道
+func notifyBandwidth(typ, title, msg string, entryID uint, data map[string]interface{}) {
+	PublishEvent(typ, entrySubject(entryID), msg, data)
+	Notify(parseIDList(settingString(models.ConfigKeyBandwidthAlertChannels)), title, msg)
+}
+
+// CheckBandwidthAllowances 立即检查云流量额度 (额度设置修改后、解除暂停后调用)
+func CheckBandwidthAllowances() {
+	checkBandwidthAllowances(time.Now())
+}
+
+// ValidateAllowanceAction 校验入口的额度动作设置
+func ValidateAllowanceAction(entry models.EntryNode) error {
+	switch entry.AllowanceAction {
+	case "", models.AllowanceActionPause:
+	case models.AllowanceActionRotate:
+		if entry.CloudInstanceID == "" {
+			return fmt.Errorf("allowance_action rotate requires a bound cloud instance")
+		}
+	case models.AllowanceActionShift:
+		if entry.AllowanceShiftEntryID == 0 || entry.AllowanceShiftEntryID == entry.ID {
+			return fmt.Errorf("allowance_action shift requires another allowance_shift_entry_id")
+		}
+		if entry.CloudRecordName == "" {
+			return fmt.Errorf("allowance_action shift requires cloud_record_name")
+		}
+	default:
+		return fmt.Errorf("unknown allowance_action: %s", entry.AllowanceAction)
+	}
+	if entry.AllowanceActionPercent < 0 {
+		return fmt.Errorf("allowance_action_percent must not be negative")
+	}
+	return nil
+}
+
+// runAllowanceAction 执行入口的额度动作
+func runAllowanceAction(entry models.EntryNode) error {
+	switch entry.AllowanceAction {
+	case models.AllowanceActionRotate:
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+		defer cancel()
+		_, err := RotateEntryIP(ctx, entry, entry.CloudRegion, entry.CloudInstanceID, "", entry.CloudRecordName, "bandwidth")
+		return err
+	case models.AllowanceActionPause:
+		suspension := models.Suspension{
+			Scope:    models.QuotaScopeEntry,
+			TargetID: entry.ID,
+			Source:   models.SuspensionSourceBandwidth,
+			Reason:   "cloud bandwidth allowance reached",
+		}
+		result := database.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&suspension)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			// 每个入口只有一条暂停；已有的若不是额度暂停，则不能算作本动作已执行
+			var existing models.Suspension
+			if err := database.DB.Where("scope = ? AND target_id = ?", models.QuotaScopeEntry, entry.ID).First(&existing).Error; err != nil {
+				return err
+			}
+			if existing.Source != models.SuspensionSourceBandwidth {
+				return errEntrySuspended
+			}
+		}
+		ApplySuspensions()
+		return nil
+	case models.AllowanceActionShift:
+		var target models.EntryNode
+		if err := database.DB.First(&target, entry.AllowanceShiftEntryID).Error; err != nil {
+			return fmt.Errorf("shift target entry #%d not found", entry.AllowanceShiftEntryID)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		return dns.UpdateEntryRecord(ctx, entry, "", entry.CloudRecordName, target.IP)
+	}
+	return nil
+}
+
+// revertAllowanceActions 撤销已结束周期中执行的暂停/切换
+func revertAllowanceActions(entry models.EntryNode, currentStart time.Time) {
+	var pending []models.InterfaceUsage
+	database.DB.Where("entry_node_id = ? AND cycle_start < ? AND action IN ? AND reverted = ?", entry.ID, currentStart,
+		[]string{models.AllowanceActionPause, models.AllowanceActionShift}, false).Find(&pending)
+	for _, usage := range pending {
+		var err error
+		switch usage.Action {
+		case models.AllowanceActionPause:
+			database.DB.Where("scope = ? AND target_id = ? AND source = ?", models.QuotaScopeEntry, entry.ID, models.SuspensionSourceBandwidth).
+				Delete(&models.Suspension{})
+			ApplySuspensions()
+		case models.AllowanceActionShift:
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			err = dns.UpdateEntryRecord(ctx, entry, "", entry.CloudRecordName, entry.IP)
+			cancel()
+		}
+		if err != nil {
+			log.Printf("[Bandwidth] 入口 #%d 撤销额度动作 %s 失败，下次重试: %v", entry.ID, usage.Action, err)
+			continue
+		}
+		database.DB.Model(&models.InterfaceUsage{}).Where("id = ?", usage.ID).Update("reverted", true)
+		log.Printf("[Bandwidth] 入口 #%d 进入新周期，已撤销额度动作: %s", entry.ID, usage.Action)
+	}
+}
+
+// BandwidthStatus 入口当前周期的云流量额度状态
+type BandwidthStatus struct {
+	EntryNodeID    uint       `json:"entry_node_id"`
+	Name           string     `json:"name"`
+	CloudProvider  string     `json:"cloud_provider"`
+	CycleStart     time.Time  `json:"cycle_start"`
+	RxBytes        int64      `json:"rx_bytes"`
+	TxBytes        int64      `json:"tx_bytes"`
+	UsedBytes      int64      `json:"used_bytes"`
+	Allowance      int64      `json:"allowance"` // 0 表示未设置额度
+	UsedPercent    float64    `json:"used_percent"`
+	AlertedPercent int        `json:"alerted_percent"`
+	Action         string     `json:"action"`
+	ActionAt       *time.Time `json:"action_at"`
+}
+
+// GetBandwidthStatus 返回绑定云平台或设置了额度的入口的当前周期用量
+func GetBandwidthStatus() []BandwidthStatus {
+	var entries []models.EntryNode
+	database.DB.Order("id").Find(&entries)
+	now := time.Now()
+	result := make([]BandwidthStatus, 0)
+	for _, entry := range entries {
+		cloudBound := entry.CloudProvider != "" && entry.CloudProvider != "none"
+		if !cloudBound && entry.BandwidthAllowance <= 0 {
+			continue
+		}
+		status := BandwidthStatus{
+			EntryNodeID:   entry.ID,
+			Name:          entry.Name,
+			CloudProvider: entry.CloudProvider,
+			CycleStart:    allowanceCycleStart(now, entry),
+			Allowance:     entry.BandwidthAllowance,
+		}
+		var usage models.InterfaceUsage
+		if database.DB.Where("entry_node_id = ? AND cycle_start = ?", entry.ID, status.CycleStart).First(&usage).Error == nil {
+			status.RxBytes, status.TxBytes = usage.RxBytes, usage.TxBytes
+			status.AlertedPercent = usage.AlertedPercent
+			status.Action, status.ActionAt = usage.Action, usage.ActionAt
+		}
+		status.UsedBytes = status.RxBytes + status.TxBytes
+		if status.Allowance > 0 {
+			status.UsedPercent = float64(status.UsedBytes) * 100 / float64(status.Allowance)
+		}
+		result = append(result, status)
+	}
+	return result
+}
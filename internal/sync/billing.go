@@ -0,0 +1,301 @@
+package sync
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/wangn9900/StealthForward/internal/database"
+	"github.com/wangn9900/StealthForward/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// billingMu 串行化计费周期检查
+var billingMu sync.Mutex
+
+// billingNode 入口/落地节点在计费任务中的统一视图
+type billingNode struct {
+	scope    string
+	id       uint
+	name     string
+	settings models.BillingSettings
+}
+
+// ValidateBillingSettings 校验计费周期设置
+func ValidateBillingSettings(b models.BillingSettings) error {
+	if b.BillingDay < 0 || b.BillingDay > 28 {
+		return fmt.Errorf("billing_day must be between 0 and 28")
+	}
+	if b.BandwidthAllowance < 0 {
+		return fmt.Errorf("bandwidth_allowance must not be negative")
+	}
+	if b.BillingTimezone != "" {
+		if _, err := time.LoadLocation(b.BillingTimezone); err != nil {
+			return fmt.Errorf("invalid billing_timezone: %v", err)
+		}
+	}
+	return nil
+}
+
+// billingLocation 返回计费时区，为空或无法识别时使用服务器时区
+func billingLocation(tz string) *time.Location {
+	if tz == "" {
+		return time.Local
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return time.Local
+	}
+	return loc
+}
+
+// loadBillingNodes 读取节点及其计费设置，onlyScheduled 时只返回设置了重置日的节点
+func loadBillingNodes(onlyScheduled bool) []billingNode {
+	var entries []models.EntryNode
+	var exits []models.ExitNode
+	entryQuery := database.DB.Order("id")
+	exitQuery := database.DB.Order("id")
+	if onlyScheduled {
+		entryQuery = entryQuery.Where("billing_day > 0")
+		exitQuery = exitQuery.Where("billing_day > 0")
+	}
+	entryQuery.Find(&entries)
+	exitQuery.Find(&exits)
+
+	nodes := make([]billingNode, 0, len(entries)+len(exits))
+	for _, e := range entries {
+		nodes = append(nodes, billingNode{models.BillingScopeEntry, e.ID, e.Name, e.BillingSettings})
+	}
+	for _, e := range exits {
+		nodes = append(nodes, billingNode{models.BillingScopeExit, e.ID, e.Name, e.BillingSettings})
+	}
+	return nodes
+}
+
+// billingModel 返回作用对象对应的节点表
+func billingModel(scope string) interface{} {
+	if scope == models.BillingScopeExit {
+		return &models.ExitNode{}
+	}
+	return &models.EntryNode{}
+}
+
+// trafficCursor 节点维度的内存聚合与已落库游标 (入口/落地各一套)
+type trafficCursor struct {
+	mem    *sync.Map
+	lock   *sync.RWMutex
+	synced map[uint][2]int64
+}
+
+func billingCursor(scope string) trafficCursor {
+	if scope == models.BillingScopeExit {
+		return trafficCursor{&exitTrafficMap, &syncedExitLock, syncedExitTraffic}
+	}
+	return trafficCursor{&entryTrafficMap, &syncedEntryLock, syncedEntryTraffic}
+}
+
+// current 返回节点的内存聚合当前值
+func (c trafficCursor) current(id uint) [2]int64 {
+	if val, ok := c.mem.Load(id); ok {
+		counters := val.(*[2]int64)
+		return [2]int64{atomic.LoadInt64(&counters[0]), atomic.LoadInt64(&counters[1])}
+	}
+	return [2]int64{}
+}
+
+// lifetimeTotals 返回节点的累计流量 (数据库值 + 未落库的内存增量) 与对应的内存聚合值，调用方需持有游标锁
+func lifetimeTotals(db *gorm.DB, scope string, id uint, cursor trafficCursor) (totals, cur [2]int64, err error) {
+	var row struct {
+		TotalUpload   int64
+		TotalDownload int64
+	}
+	if err = db.Model(billingModel(scope)).Select("total_upload, total_download").Where("id = ?", id).Scan(&row).Error; err != nil {
+		return
+	}
+	cur = cursor.current(id)
+	synced := cursor.synced[id]
+	totals = [2]int64{row.TotalUpload + max(cur[0]-synced[0], 0), row.TotalDownload + max(cur[1]-synced[1], 0)}
+	return
+}
+
+// alignBillingCycle 首次对齐周期起点，记录此刻的累计流量作为基线，之前的流量不计入本周期
+func alignBillingCycle(n billingNode, start time.Time) error {
+	cursor := billingCursor(n.scope)
+	cursor.lock.Lock()
+	defer cursor.lock.Unlock()
+
+	totals, _, err := lifetimeTotals(database.DB, n.scope, n.id, cursor)
+	if err != nil {
+		return err
+	}
+	return database.DB.Model(billingModel(n.scope)).Where("id = ?", n.id).Updates(map[string]interface{}{
+		"cycle_start":         start,
+		"cycle_base_upload":   totals[0],
+		"cycle_base_download": totals[1],
+	}).Error
+}
+
+// archiveBillingCycle 在一个事务中归档本周期流量、清零累计流量并进入新周期。
+// 持有游标锁期间把未落库的内存增量一并归档，之后到达的流量计入新周期，不会在落库与清零之间丢失
+func archiveBillingCycle(n billingNode, end time.Time) (models.BillingCycle, error) {
+	cursor := billingCursor(n.scope)
+	cursor.lock.Lock()
+	defer cursor.lock.Unlock()
+
+	cycle := models.BillingCycle{
+		Scope:      n.scope,
+		NodeID:     n.id,
+		NodeName:   n.name,
+		CycleStart: n.settings.CycleStart,
+		CycleEnd:   end,
+		Allowance:  n.settings.BandwidthAllowance,
+	}
+	var cur [2]int64
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var totals [2]int64
+		var err error
+		if totals, cur, err = lifetimeTotals(tx, n.scope, n.id, cursor); err != nil {
+			return err
+		}
+		cycle.Upload = max(totals[0]-n.settings.CycleBaseUpload, 0)
+		cycle.Download = max(totals[1]-n.settings.CycleBaseDownload, 0)
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&cycle).Error; err != nil {
+			return err
+		}
+		return tx.Model(billingModel(n.scope)).Where("id = ?", n.id).Updates(map[string]interface{}{
+			"total_upload":        0,
+			"total_download":      0,
+			"cycle_base_upload":   0,
+			"cycle_base_download": 0,
+			"cycle_start":         end,
+		}).Error
+	})
+	if err != nil {
+		return cycle, err
+	}
+	// 已归档的内存增量不再落库
+	cursor.synced[n.id] = cur
+	return cycle, nil
+}
+
+// checkBillingCycles 检查所有设置了重置日的节点，周期结束时归档本周期流量并清零
+func checkBillingCycles(now time.Time) {
+	billingMu.Lock()
+	defer billingMu.Unlock()
+
+	nodes := loadBillingNodes(true)
+	for _, n := range nodes {
+		start := billingPeriodStart(now, n.settings.BillingDay, billingLocation(n.settings.BillingTimezone))
+		if n.settings.CycleStart.Equal(start) {
+			continue
+		}
+		// 首次设置重置日：对齐起点并记录基线，不归档
+		if n.settings.CycleStart.IsZero() {
+			if err := alignBillingCycle(n, start); err != nil {
+				log.Printf("[Billing] 对齐 %s #%d 计费周期失败: %v", n.scope, n.id, err)
+			}
+			continue
+		}
+		// 修改时区等导致周期起点提前时，只对齐起点，不归档
+		if !n.settings.CycleStart.Before(start) {
+			database.DB.Model(billingModel(n.scope)).Where("id = ?", n.id).Update("cycle_start", start)
+			continue
+		}
+
+		cycle, err := archiveBillingCycle(n, start)
+		if err != nil {
+			log.Printf("[Billing] 归档 %s #%d 计费周期失败: %v", n.scope, n.id, err)
+			continue
+		}
+		log.Printf("[Billing] %s #%d (%s) 计费周期结束，已归档 ↑%s ↓%s 并清零",
+			n.scope, n.id, n.name, FormatBytes(cycle.Upload), FormatBytes(cycle.Download))
+	}
+}
+
+// UpdateBillingSettings 保存节点的计费设置。
+// 关闭或重新开启重置日时清除周期起点与基线 (开启后由计费任务重新记录基线)；
+// 修改重置日或时区时直接对齐到新的周期起点，不归档，本周期已用流量保留
+func UpdateBillingSettings(scope string, id uint, req models.BillingSettings) error {
+	billingMu.Lock()
+	defer billingMu.Unlock()
+
+	var old models.BillingSettings
+	if err := database.DB.Model(billingModel(scope)).Select("billing_day, billing_timezone, cycle_start").Where("id = ?", id).Scan(&old).Error; err != nil {
+		return err
+	}
+	updates := map[string]interface{}{
+		"billing_day":         req.BillingDay,
+		"billing_timezone":    req.BillingTimezone,
+		"bandwidth_allowance": req.BandwidthAllowance,
+	}
+	switch {
+	case req.BillingDay == 0 || old.BillingDay == 0:
+		updates["cycle_start"] = time.Time{}
+		updates["cycle_base_upload"] = 0
+		updates["cycle_base_download"] = 0
+	case !old.CycleStart.IsZero() && (old.BillingDay != req.BillingDay || old.BillingTimezone != req.BillingTimezone):
+		updates["cycle_start"] = billingPeriodStart(time.Now(), req.BillingDay, billingLocation(req.BillingTimezone))
+	}
+	return database.DB.Model(billingModel(scope)).Where("id = ?", id).Updates(updates).Error
+}
+
+// BillingStatus 节点当前计费周期状态
+type BillingStatus struct {
+	Scope              string     `json:"scope"`
+	NodeID             uint       `json:"node_id"`
+	NodeName           string     `json:"node_name"`
+	BillingDay         int        `json:"billing_day"`
+	BillingTimezone    string     `json:"billing_timezone"`
+	CycleStart         *time.Time `json:"cycle_start"` // 未设置重置日时为空
+	NextReset          *time.Time `json:"next_reset"`
+	Upload             int64      `json:"upload"` // 本周期已用 (含未落库的内存增量)
+	Download           int64      `json:"download"`
+	BandwidthAllowance int64      `json:"bandwidth_allowance"`
+	UsedPercent        float64    `json:"used_percent"` // 额度为 0 时为 0
+}
+
+// GetBillingStatus 返回所有节点的当前计费周期状态
+func GetBillingStatus() []BillingStatus {
+	stats := GetTrafficStatsByEntry()
+	nodes := loadBillingNodes(false)
+	result := make([]BillingStatus, 0, len(nodes))
+	for _, n := range nodes {
+		status := BillingStatus{
+			Scope:              n.scope,
+			NodeID:             n.id,
+			NodeName:           n.name,
+			BillingDay:         n.settings.BillingDay,
+			BillingTimezone:    n.settings.BillingTimezone,
+			BandwidthAllowance: n.settings.BandwidthAllowance,
+		}
+		used := stats.EntryStats[n.id]
+		if n.scope == models.BillingScopeExit {
+			used = stats.ExitStats[n.id]
+		}
+		status.Upload, status.Download = used.Upload, used.Download
+
+		if n.settings.BillingDay > 0 {
+			// 本周期用量扣除首次对齐时的基线
+			status.Upload = max(used.Upload-n.settings.CycleBaseUpload, 0)
+			status.Download = max(used.Download-n.settings.CycleBaseDownload, 0)
+			loc := billingLocation(n.settings.BillingTimezone)
+			start := billingPeriodStart(time.Now(), n.settings.BillingDay, loc)
+			next := start.In(loc).AddDate(0, 1, 0).UTC()
+			status.CycleStart = &start
+			status.NextReset = &next
+		}
+		if n.settings.BandwidthAllowance > 0 {
+			status.UsedPercent = float64(status.Upload+status.Download) * 100 / float64(n.settings.BandwidthAllowance)
+		}
+		result = append(result, status)
+	}
+	return result
+}
+
+// CheckBillingCycles 立即检查节点计费周期 (计费设置修改后调用)
+func CheckBillingCycles() {
+	checkBillingCycles(time.Now())
+}
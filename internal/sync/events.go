@@ -0,0 +1,304 @@
+package sync
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wangn9900/StealthForward/internal/database"
+	"github.com/wangn9900/StealthForward/internal/license"
+	"github.com/wangn9900/StealthForward/internal/models"
+)
+
+const (
+	// defaultWebhookRetries 订阅未设置时的失败重试次数
+	defaultWebhookRetries = 5
+	// webhookRetryBase 首次重试间隔，之后按 2 的幂递增
+	webhookRetryBase = 30 * time.Second
+	// webhookDispatchInterval 检查待投递记录的间隔 (新事件会立即唤醒)
+	webhookDispatchInterval = 10 * time.Second
+	// eventRetention 事件与投递记录的保留时长
+	eventRetention = 30 * 24 * time.Hour
+	// licenseExpiryWarning 授权剩余时间低于该值时每天发布一次 license.expiring
+	licenseExpiryWarning = 7 * 24 * time.Hour
+)
+
+var (
+	eventClient = &http.Client{Timeout: 10 * time.Second}
+	// eventKick 唤醒投递协程
+	eventKick = make(chan struct{}, 1)
+	// licenseWarnedDay 最近一次发布授权过期提醒的日期
+	licenseWarnedDay string
+)
+
+// eventPayload Webhook 请求体
+type eventPayload struct {
+	ID        uint            `json:"id"`
+	Type      string          `json:"type"`
+	Subject   string          `json:"subject"`
+	Message   string          `json:"message"`
+	Data      json.RawMessage `json:"data,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// PublishEvent 记录一条事件，并为匹配的 Webhook 订阅生成投递任务
+func PublishEvent(typ, subject, message string, data interface{}) {
+	ev := models.Event{Type: typ, Subject: subject, Message: message}
+	if data != nil {
+		if b, err := json.Marshal(data); err == nil {
+			ev.Data = string(b)
+		}
+	}
+	if err := database.DB.Create(&ev).Error; err != nil {
+		log.Printf("[Event] 记录事件 %s 失败: %v", typ, err)
+		return
+	}
+
+	var subs []models.WebhookSubscription
+	database.DB.Where("enabled = ?", true).Find(&subs)
+	queued := false
+	for _, sub := range subs {
+		if !eventMatches(sub.Events, typ) {
+			continue
+		}
+		delivery := models.WebhookDelivery{
+			SubscriptionID: sub.ID,
+			EventID:        ev.ID,
+			EventType:      typ,
+			Status:         models.DeliveryPending,
+			NextAttemptAt:  ev.CreatedAt,
+		}
+		if err := database.DB.Create(&delivery).Error; err == nil {
+			queued = true
+		}
+	}
+	if queued {
+		select {
+		case eventKick <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// eventMatches 判断事件类型是否命中订阅过滤 (逗号分隔，支持 * 与 xxx.* 前缀)
+func eventMatches(filter, typ string) bool {
+	if strings.TrimSpace(filter) == "" {
+		return true
+	}
+	for _, part := range strings.Split(filter, ",") {
+		p := strings.TrimSpace(part)
+		if p == "*" || p == typ {
+			return true
+		}
+		if strings.HasSuffix(p, ".*") && strings.HasPrefix(typ, strings.TrimSuffix(p, "*")) {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateWebhookSubscription 校验 Webhook 订阅设置
+func ValidateWebhookSubscription(sub models.WebhookSubscription) error {
+	if !strings.HasPrefix(sub.URL, "http://") && !strings.HasPrefix(sub.URL, "https://") {
+		return fmt.Errorf("url must be http(s)")
+	}
+	if sub.MaxRetries < 0 || sub.MaxRetries > 20 {
+		return fmt.Errorf("max_retries must be between 0 and 20")
+	}
+	return nil
+}
+
+// StartEventBus 启动 Webhook 投递协程 (含授权过期检查与过期数据清理)
+func StartEventBus() {
+	go func() {
+		ticker := time.NewTicker(webhookDispatchInterval)
+		var lastHousekeeping time.Time
+		for {
+			select {
+			case <-ticker.C:
+			case <-eventKick:
+			}
+			now := time.Now()
+			dispatchWebhooks(now)
+			if now.Sub(lastHousekeeping) >= time.Hour {
+				lastHousekeeping = now
+				checkLicenseExpiry(now)
+				cutoff := now.Add(-eventRetention)
+				database.DB.Where("created_at < ?", cutoff).Delete(&models.Event{})
+				database.DB.Where("created_at < ?", cutoff).Delete(&models.WebhookDelivery{})
+			}
+		}
+	}()
+}
+
+// dispatchWebhooks 投递到期的记录，同一订阅按顺序发送，不同订阅并发
+func dispatchWebhooks(now time.Time) {
+	var deliveries []models.WebhookDelivery
+	database.DB.Where("status = ? AND next_attempt_at <= ?", models.DeliveryPending, now).Order("id").Limit(200).Find(&deliveries)
+	if len(deliveries) == 0 {
+		return
+	}
+
+	bySub := make(map[uint][]models.WebhookDelivery)
+	for _, d := range deliveries {
+		bySub[d.SubscriptionID] = append(bySub[d.SubscriptionID], d)
+	}
+	var wg sync.WaitGroup
+	for subID, list := range bySub {
+		var sub models.WebhookSubscription
+		if err := database.DB.First(&sub, subID).Error; err != nil || !sub.Enabled {
+			ids := make([]uint, 0, len(list))
+			for _, d := range list {
+				ids = append(ids, d.ID)
+			}
+			database.DB.Model(&models.WebhookDelivery{}).Where("id IN ?", ids).
+				Updates(map[string]interface{}{"status": models.DeliveryFailed, "last_error": "subscription removed or disabled"})
+			continue
+		}
+		wg.Add(1)
+		go func(sub models.WebhookSubscription, list []models.WebhookDelivery) {
+			defer wg.Done()
+			for _, d := range list {
+				attemptDelivery(sub, d)
+			}
+		}(sub, list)
+	}
+	wg.Wait()
+}
+
+// attemptDelivery 发送一次并更新投递状态，失败时按指数退避安排重试
+func attemptDelivery(sub models.WebhookSubscription, d models.WebhookDelivery) {
+	var ev models.Event
+	if err := database.DB.First(&ev, d.EventID).Error; err != nil {
+		database.DB.Model(&d).Updates(map[string]interface{}{"status": models.DeliveryFailed, "last_error": "event not found"})
+		return
+	}
+
+	code, err := deliverWebhook(sub, ev)
+	d.Attempts++
+	d.ResponseCode = code
+	if err == nil {
+		d.Status = models.DeliverySucceeded
+		d.LastError = ""
+	} else {
+		d.LastError = err.Error()
+		retries := sub.MaxRetries
+		if retries == 0 {
+			retries = defaultWebhookRetries
+		}
+		if d.Attempts > retries {
+			d.Status = models.DeliveryFailed
+			log.Printf("[Event] Webhook #%d (%s) 投递事件 #%d 失败，已重试 %d 次: %v", sub.ID, sub.Name, ev.ID, retries, err)
+		} else {
+			d.NextAttemptAt = time.Now().Add(webhookRetryBase << (d.Attempts - 1))
+		}
+	}
+	database.DB.Save(&d)
+}
+
+// deliverWebhook 发送事件。设置了 Secret 时附带签名：
+// X-StealthForward-Signature: sha256=hex(HMAC-SHA256(secret, timestamp + "." + body))，timestamp 取自 X-StealthForward-Timestamp
+func deliverWebhook(sub models.WebhookSubscription, ev models.Event) (int, error) {
+	payload := eventPayload{
+		ID:        ev.ID,
+		Type:      ev.Type,
+		Subject:   ev.Subject,
+		Message:   ev.Message,
+		CreatedAt: ev.CreatedAt,
+	}
+	if ev.Data != "" {
+		payload.Data = json.RawMessage(ev.Data)
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, sub.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "StealthForward-Webhook")
+	req.Header.Set("X-StealthForward-Event", ev.Type)
+	req.Header.Set("X-StealthForward-Event-ID", strconv.FormatUint(uint64(ev.ID), 10))
+	req.Header.Set("X-StealthForward-Timestamp", timestamp)
+	if sub.Secret != "" {
+		mac := hmac.New(sha256.New, []byte(sub.Secret))
+		mac.Write([]byte(timestamp + "."))
+		mac.Write(body)
+		req.Header.Set("X-StealthForward-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := eventClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return resp.StatusCode, fmt.Errorf("HTTP %d: %s", resp.StatusCode, string(respBody))
+	}
+	return resp.StatusCode, nil
+}
+
+// PingWebhook 同步发送一条 ping 事件 (不入库)，用于测试订阅
+func PingWebhook(sub models.WebhookSubscription) (int, error) {
+	return deliverWebhook(sub, models.Event{Type: "ping", Subject: "webhook:" + strconv.FormatUint(uint64(sub.ID), 10), Message: "pong", CreatedAt: time.Now()})
+}
+
+// RetryDelivery 将投递记录重新置为待发送 (重置重试次数)
+func RetryDelivery(id uint) error {
+	res := database.DB.Model(&models.WebhookDelivery{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status":          models.DeliveryPending,
+		"attempts":        0,
+		"next_attempt_at": time.Now(),
+	})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return fmt.Errorf("delivery %d not found", id)
+	}
+	select {
+	case eventKick <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// checkLicenseExpiry 授权即将过期时每天发布一次提醒
+func checkLicenseExpiry(now time.Time) {
+	info := license.GetInfo()
+	if info == nil || !info.Valid {
+		return
+	}
+	left := info.ExpiresAt.Sub(now)
+	if left <= 0 || left > licenseExpiryWarning {
+		return
+	}
+	day := now.Format("2006-01-02")
+	if licenseWarnedDay == day {
+		return
+	}
+	licenseWarnedDay = day
+	PublishEvent(models.EventLicenseExpiring, "license",
+		fmt.Sprintf("授权将于 %s 过期 (剩余 %d 小时)", info.ExpiresAt.Format("2006-01-02 15:04"), int(left.Hours())),
+		map[string]interface{}{"level": info.Level, "expires_at": info.ExpiresAt})
+}
+
+// entrySubject 入口节点的事件对象标识
+func entrySubject(id uint) string {
+	return "entry:" + strconv.FormatUint(uint64(id), 10)
+}
@@ -0,0 +1,280 @@
+package sync
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wangn9900/StealthForward/internal/database"
+	"github.com/wangn9900/StealthForward/internal/models"
+)
+
+const (
+	defaultFailureThreshold = 3
+	defaultMinDwellSeconds  = 300
+	// probeFreshness 超过该时长的探测结果不参与健康判断
+	probeFreshness = time.Hour
+	// failoverHistoryRetention 切换记录保留时长
+	failoverHistoryRetention = 90 * 24 * time.Hour
+)
+
+var (
+	// failoverMu 串行化故障切换判断与手动切换
+	failoverMu sync.Mutex
+
+	ErrMappingNotFound = errors.New("mapping not found")
+	ErrExitNotInChain  = errors.New("exit is neither the primary nor a backup of this mapping")
+)
+
+// ParseExitIDs 解析逗号分隔的落地 ID 列表
+func ParseExitIDs(s string) ([]uint, error) {
+	var ids []uint
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		id, err := strconv.ParseUint(part, 10, 32)
+		if err != nil || id == 0 {
+			return nil, fmt.Errorf("invalid exit id %q", part)
+		}
+		ids = append(ids, uint(id))
+	}
+	return ids, nil
+}
+
+// exitChain 返回映射的落地顺序：主落地在前，备用落地按优先级在后
+func exitChain(m models.NodeMapping) []uint {
+	chain := []uint{m.TargetExitID}
+	backups, _ := ParseExitIDs(m.BackupExitIDs)
+	return append(chain, backups...)
+}
+
+// ValidateMappingFailover 校验并规范化映射的故障切换策略
+// 当前生效的落地不在新的落地列表中时重置为主落地
+func ValidateMappingFailover(m *models.NodeMapping) error {
+	if m.FailureThreshold < 0 || m.MinDwellSeconds < 0 {
+		return errors.New("failure_threshold and min_dwell_seconds must not be negative")
+	}
+	backups, err := ParseExitIDs(m.BackupExitIDs)
+	if err != nil {
+		return err
+	}
+	seen := map[uint]bool{m.TargetExitID: true}
+	var normalized []string
+	for _, id := range backups {
+		if seen[id] {
+			return fmt.Errorf("exit %d appears more than once", id)
+		}
+		seen[id] = true
+		var count int64
+		database.DB.Model(&models.ExitNode{}).Where("id = ?", id).Count(&count)
+		if count == 0 {
+			return fmt.Errorf("backup exit %d not found", id)
+		}
+		normalized = append(normalized, strconv.FormatUint(uint64(id), 10))
+	}
+	if m.FailoverEnabled && len(backups) == 0 {
+		return errors.New("failover requires at least one backup exit")
+	}
+	m.BackupExitIDs = strings.Join(normalized, ",")
+	if m.ActiveExitID == m.TargetExitID || !seen[m.ActiveExitID] {
+		m.ActiveExitID = 0
+	}
+	return nil
+}
+
+// probeFailed 一次探测是否视为失败：TCP 全部失败，或 URL 测试失败
+func probeFailed(p models.ExitProbe) bool {
+	return p.TCPLoss >= 1 || (p.URLTested && !p.URLOK)
+}
+
+// recentProbes 返回入口 -> 落地 最近 n 条新鲜的探测结果 (按时间倒序)
+func recentProbes(entryID, exitID uint, n int, now time.Time) []models.ExitProbe {
+	var probes []models.ExitProbe
+	database.DB.Where("entry_node_id = ? AND exit_node_id = ? AND probed_at >= ?", entryID, exitID, now.Add(-probeFreshness)).
+		Order("probed_at DESC").Limit(n).Find(&probes)
+	return probes
+}
+
+// exitHealth 按最近 n 轮探测判断落地状态：down 为连续 n 轮失败，up 为连续 n 轮成功
+// 样本不足 n 轮时两者都为 false
+func exitHealth(entryID, exitID uint, n int, now time.Time) (down, up bool) {
+	probes := recentProbes(entryID, exitID, n, now)
+	if len(probes) < n {
+		return false, false
+	}
+	failed := 0
+	for _, p := range probes {
+		if probeFailed(p) {
+			failed++
+		}
+	}
+	return failed == n, failed == 0
+}
+
+// exitAvailable 落地最近一次探测是否成功 (作为切换目标的最低要求)
+func exitAvailable(entryID, exitID uint, now time.Time) bool {
+	probes := recentProbes(entryID, exitID, 1, now)
+	return len(probes) == 1 && !probeFailed(probes[0])
+}
+
+// evaluateFailover 根据入口最新的探测结果检查其下各映射是否需要切换
+func evaluateFailover(entryID uint, now time.Time) {
+	failoverMu.Lock()
+	defer failoverMu.Unlock()
+
+	var mappings []models.NodeMapping
+	database.DB.Where("entry_node_id = ? AND failover_enabled = ?", entryID, true).Find(&mappings)
+	for _, m := range mappings {
+		threshold := m.FailureThreshold
+		if threshold <= 0 {
+			threshold = defaultFailureThreshold
+		}
+		dwell := m.MinDwellSeconds
+		if dwell <= 0 {
+			dwell = defaultMinDwellSeconds
+		}
+		if !m.ActiveSince.IsZero() && now.Sub(m.ActiveSince) < time.Duration(dwell)*time.Second {
+			continue
+		}
+
+		active := m.EffectiveExitID()
+		down, _ := exitHealth(entryID, active, threshold, now)
+		if down {
+			for _, candidate := range exitChain(m) {
+				if candidate == active || !exitAvailable(entryID, candidate, now) {
+					continue
+				}
+				reason := fmt.Sprintf("落地 %s 连续 %d 轮探测失败", exitLabel(active), threshold)
+				if err := switchMapping(m, candidate, models.FailoverTriggerAuto, reason, now); err != nil {
+					log.Printf("!!!! [Failover] 映射 #%d 切换失败: %v", m.ID, err)
+				}
+				break
+			}
+			continue
+		}
+
+		// 主落地恢复后切回
+		if m.FailBack && m.ActiveExitID != 0 {
+			if _, up := exitHealth(entryID, m.TargetExitID, threshold, now); up {
+				reason := fmt.Sprintf("主落地 %s 连续 %d 轮探测成功", exitLabel(m.TargetExitID), threshold)
+				if err := switchMapping(m, m.TargetExitID, models.FailoverTriggerAuto, reason, now); err != nil {
+					log.Printf("!!!! [Failover] 映射 #%d 切回失败: %v", m.ID, err)
+				}
+			}
+		}
+	}
+}
+
+// exitLabel 返回落地的可读名称
+func exitLabel(id uint) string {
+	var exit models.ExitNode
+	if err := database.DB.Select("id, name").First(&exit, id).Error; err != nil {
+		return fmt.Sprintf("#%d", id)
+	}
+	return fmt.Sprintf("#%d (%s)", exit.ID, exit.Name)
+}
+
+// switchMapping 将映射切到指定落地，记录历史、发布事件并触发规则同步，调用方需持有 failoverMu
+func switchMapping(m models.NodeMapping, to uint, trigger, reason string, now time.Time) error {
+	from := m.EffectiveExitID()
+	active := to
+	if to == m.TargetExitID {
+		active = 0
+	}
+	if err := database.DB.Model(&models.NodeMapping{}).Where("id = ?", m.ID).
+		Updates(map[string]interface{}{"active_exit_id": active, "active_since": now}).Error; err != nil {
+		return err
+	}
+	record := models.MappingFailover{
+		MappingID:   m.ID,
+		EntryNodeID: m.EntryNodeID,
+		FromExitID:  from,
+		ToExitID:    to,
+		Restored:    active == 0,
+		Trigger:     trigger,
+		Reason:      reason,
+		CreatedAt:   now,
+	}
+	database.DB.Create(&record)
+
+	typ := models.EventFailoverSwitched
+	msg := fmt.Sprintf("映射 #%d (V2B节点#%d) 由落地 %s 切换到 %s: %s", m.ID, m.V2boardNodeID, exitLabel(from), exitLabel(to), reason)
+	if record.Restored {
+		typ = models.EventFailoverRestored
+		msg = fmt.Sprintf("映射 #%d (V2B节点#%d) 已切回主落地 %s: %s", m.ID, m.V2boardNodeID, exitLabel(to), reason)
+	}
+	log.Printf(">>>> [Failover] %s", msg)
+	PublishEvent(typ, entrySubject(m.EntryNodeID), msg, map[string]interface{}{
+		"mapping_id":      m.ID,
+		"entry_id":        m.EntryNodeID,
+		"v2board_node_id": m.V2boardNodeID,
+		"from_exit_id":    from,
+		"to_exit_id":      to,
+		"trigger":         trigger,
+		"reason":          reason,
+	})
+
+	// Agent 下次拉取配置即使用新落地；规则的落地归属由同步更新
+	SyncEntryNow(m.EntryNodeID, SyncTriggerFailover)
+	return nil
+}
+
+// SwitchMappingExit 手动将映射切到指定落地 (主落地或备用落地之一)
+func SwitchMappingExit(mappingID, exitID uint, reason string) (models.NodeMapping, error) {
+	failoverMu.Lock()
+	defer failoverMu.Unlock()
+
+	var m models.NodeMapping
+	if err := database.DB.First(&m, mappingID).Error; err != nil {
+		return m, ErrMappingNotFound
+	}
+	if exitID == 0 {
+		exitID = m.TargetExitID
+	}
+	inChain := false
+	for _, id := range exitChain(m) {
+		if id == exitID {
+			inChain = true
+			break
+		}
+	}
+	if !inChain {
+		return m, ErrExitNotInChain
+	}
+	if exitID == m.EffectiveExitID() {
+		return m, nil
+	}
+	if reason == "" {
+		reason = "管理员手动切换"
+	}
+	if err := switchMapping(m, exitID, models.FailoverTriggerManual, reason, time.Now()); err != nil {
+		return m, err
+	}
+	database.DB.First(&m, mappingID)
+	return m, nil
+}
+
+// GetFailoverHistory 返回映射切换记录 (按时间倒序)
+func GetFailoverHistory(mappingID, entryID uint, limit int) []models.MappingFailover {
+	query := database.DB.Order("id DESC").Limit(limit)
+	if mappingID > 0 {
+		query = query.Where("mapping_id = ?", mappingID)
+	}
+	if entryID > 0 {
+		query = query.Where("entry_node_id = ?", entryID)
+	}
+	history := []models.MappingFailover{}
+	query.Find(&history)
+	return history
+}
+
+// pruneFailoverHistory 清理过期的切换记录
+func pruneFailoverHistory(now time.Time) {
+	database.DB.Where("created_at < ?", now.Add(-failoverHistoryRetention)).Delete(&models.MappingFailover{})
+}
@@ -0,0 +1,146 @@
+package sync
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/wangn9900/StealthForward/internal/database"
+	"github.com/wangn9900/StealthForward/internal/models"
+)
+
+const (
+	SyncTriggerTimer    = "timer"    // 定时任务触发
+	SyncTriggerAPI      = "api"      // 手动 / 接口触发
+	SyncTriggerWebhook  = "webhook"  // 面板推送触发
+	SyncTriggerFailover = "failover" // 映射故障切换触发
+
+	// syncHistoryRetention 同步历史保留时长
+	syncHistoryRetention = 7 * 24 * time.Hour
+)
+
+var (
+	// syncMu 保证同一时间只有一轮同步在执行 (定时任务与手动触发互斥)
+	syncMu sync.Mutex
+	// syncRunning 标记当前是否有同步在执行，用于状态接口
+	syncRunning atomic.Bool
+)
+
+// RuleDiff 描述单条转发规则的变更
+type RuleDiff struct {
+	RuleID     uint     `json:"rule_id,omitempty"`
+	UserEmail  string   `json:"user_email"`
+	UserID     string   `json:"user_id"`
+	V2boardUID uint     `json:"v2board_uid"`
+	ExitNodeID uint     `json:"exit_node_id"`
+	Changes    []string `json:"changes,omitempty"` // 仅更新时存在，例如 "exit_node_id: 3 -> 5"
+}
+
+// NodeSyncDiff 描述一个 入口 + V2Board 节点 的同步差异
+type NodeSyncDiff struct {
+	EntryNodeID   uint       `json:"entry_node_id"`
+	V2boardNodeID int        `json:"v2board_node_id"`
+	TargetExitID  uint       `json:"target_exit_id"`
+	UsersFetched  int        `json:"users_fetched"`
+	Unchanged     bool       `json:"unchanged,omitempty"` // 面板数据未变化，跳过比对
+	Add           []RuleDiff `json:"add"`
+	Update        []RuleDiff `json:"update"`
+	Remove        []RuleDiff `json:"remove"`
+	Error         string     `json:"error,omitempty"`
+}
+
+// SyncStatus 同步状态概览
+type SyncStatus struct {
+	Running   bool                `json:"running"`
+	Latest    []models.SyncRun    `json:"latest"`    // 每个 入口 + V2Board 节点 最近一次同步
+	Schedules []EntrySyncSchedule `json:"schedules"` // 每个入口的调度状态
+}
+
+// recordSyncRuns 将一轮同步结果写入历史表
+func recordSyncRuns(diffs []NodeSyncDiff, trigger string, startedAt time.Time, applyErr error) {
+	finishedAt := time.Now()
+	for _, d := range diffs {
+		run := models.SyncRun{
+			EntryNodeID:   d.EntryNodeID,
+			V2boardNodeID: d.V2boardNodeID,
+			Trigger:       trigger,
+			StartedAt:     startedAt,
+			FinishedAt:    finishedAt,
+			UsersFetched:  d.UsersFetched,
+			Unchanged:     d.Unchanged,
+			Error:         d.Error,
+		}
+		if applyErr != nil {
+			// 事务已回滚，本轮没有任何规则被写入
+			run.Error = applyErr.Error()
+		} else {
+			if run.Error != "" {
+				PublishEvent(models.EventSyncFailed, entrySubject(d.EntryNodeID),
+					fmt.Sprintf("入口 #%d 拉取面板节点 #%d 用户失败: %s", d.EntryNodeID, d.V2boardNodeID, run.Error),
+					map[string]interface{}{"entry_id": d.EntryNodeID, "v2board_node_id": d.V2boardNodeID, "trigger": trigger, "error": run.Error})
+			}
+			run.RulesCreated = len(d.Add)
+			run.RulesUpdated = len(d.Update)
+			run.RulesDeleted = len(d.Remove)
+		}
+		metricSyncRuns.Inc(idLabel(run.EntryNodeID), idLabel(run.V2boardNodeID), resultLabel(run.Error != ""))
+		if err := database.DB.Create(&run).Error; err != nil {
+			log.Printf("[Sync] Failed to record sync run (Entry #%d, Node #%d): %v", d.EntryNodeID, d.V2boardNodeID, err)
+		}
+	}
+}
+
+// pruneSyncHistory 清理过期的同步历史
+func pruneSyncHistory() {
+	database.DB.Where("started_at < ?", time.Now().Add(-syncHistoryRetention)).Delete(&models.SyncRun{})
+}
+
+// DryRunSync 拉取面板用户并返回将要产生的规则变更，不写库
+// entryID 为 0 时计算所有已配置 V2Board 的入口
+func DryRunSync(entryID uint) []NodeSyncDiff {
+	syncMu.Lock()
+	defer syncMu.Unlock()
+
+	var entries []models.EntryNode
+	query := database.DB.Where("v2board_url <> '' AND v2board_key <> ''")
+	if entryID != 0 {
+		query = query.Where("id = ?", entryID)
+	}
+	query.Find(&entries)
+
+	diffs := []NodeSyncDiff{}
+	for _, entry := range entries {
+		entryDiffs, _ := syncEntry(entry, SyncTriggerAPI, true)
+		diffs = append(diffs, entryDiffs...)
+	}
+	return diffs
+}
+
+// GetSyncHistory 按时间倒序返回同步历史，entryID / nodeID 为 0 时不过滤
+func GetSyncHistory(entryID uint, nodeID int, limit int) []models.SyncRun {
+	query := database.DB.Order("id DESC").Limit(limit)
+	if entryID != 0 {
+		query = query.Where("entry_node_id = ?", entryID)
+	}
+	if nodeID != 0 {
+		query = query.Where("v2board_node_id = ?", nodeID)
+	}
+
+	runs := []models.SyncRun{}
+	query.Find(&runs)
+	return runs
+}
+
+// GetSyncStatus 返回当前同步状态及每个节点最近一次的同步结果
+func GetSyncStatus() SyncStatus {
+	status := SyncStatus{
+		Running:   syncRunning.Load(),
+		Latest:    []models.SyncRun{},
+		Schedules: getSyncSchedules(),
+	}
+	latestIDs := database.DB.Model(&models.SyncRun{}).Select("MAX(id)").Group("entry_node_id, v2board_node_id")
+	database.DB.Where("id IN (?)", latestIDs).Order("entry_node_id, v2board_node_id").Find(&status.Latest)
+	return status
+}
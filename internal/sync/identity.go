@@ -0,0 +1,142 @@
+package sync
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/wangn9900/StealthForward/internal/database"
+	"github.com/wangn9900/StealthForward/internal/models"
+	"gorm.io/gorm"
+)
+
+// identityKey 唯一确定一个用户身份 (入口维度内)
+type identityKey struct {
+	NodeID int
+	UID    uint
+}
+
+// trafficAccount 描述一个可计费的流量账户：标签 -> V2Board 节点 + 用户
+type trafficAccount struct {
+	Tag    string
+	NodeID int
+	UID    uint
+}
+
+// newIdentityTag 生成不透明的身份标签，如 "u3f9a0c4d1b2e7f60"
+// 随机源不可用时返回错误，不能退化为可预测或重复的标签
+func newIdentityTag() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generate identity tag: %w", err)
+	}
+	return "u" + hex.EncodeToString(b), nil
+}
+
+// loadEntryIdentities 加载入口下的所有身份
+func loadEntryIdentities(db *gorm.DB, entryID uint) []models.UserIdentity {
+	var identities []models.UserIdentity
+	db.Where("entry_node_id = ?", entryID).Find(&identities)
+	return identities
+}
+
+// entryAccounts 列出入口下所有需要向面板上报的账户 (读取内存索引)
+// 身份表中的账户即使规则已被删除也保留，确保迟到的流量依然能够计费
+func entryAccounts(entry models.EntryNode) []trafficAccount {
+	indexMu.RLock()
+	defer indexMu.RUnlock()
+	var accounts []trafficAccount
+	for _, account := range currentIndex.accounts[entry.ID] {
+		if account.UID == 0 {
+			continue
+		}
+		accounts = append(accounts, account.trafficAccount)
+	}
+	return accounts
+}
+
+// parseLegacyTag 解析旧版标签 n<node>-<uuid[:8]>，仅用于迁移
+func parseLegacyTag(tag string) (int, bool) {
+	if !strings.HasPrefix(tag, "n") || !strings.Contains(tag, "-") {
+		return 0, false
+	}
+	id, err := strconv.Atoi(strings.Split(tag, "-")[0][1:])
+	if err != nil {
+		return 0, false
+	}
+	return id, true
+}
+
+// MigrateLegacyIdentities 为旧版 n<node>-<uuid[:8]> 标签的规则建立身份记录
+// 标签未被占用时原样保留 (Agent 无需重载即可继续计费)；
+// 同一旧标签出现在多个入口时，后者分配新标签并改写规则
+func MigrateLegacyIdentities() {
+	var rules []models.ForwardingRule
+	database.DB.Where("v2board_uid <> 0").Order("id").Find(&rules)
+
+	var identities []models.UserIdentity
+	database.DB.Find(&identities)
+	usedTags := make(map[string]bool)
+	owners := make(map[uint]map[identityKey]bool)
+	for _, identity := range identities {
+		usedTags[identity.Tag] = true
+		if owners[identity.EntryNodeID] == nil {
+			owners[identity.EntryNodeID] = make(map[identityKey]bool)
+		}
+		owners[identity.EntryNodeID][identityKey{identity.V2boardNodeID, identity.V2boardUID}] = true
+	}
+
+	migrated, retagged := 0, 0
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		for _, rule := range rules {
+			nodeID, ok := parseLegacyTag(rule.UserEmail)
+			if !ok {
+				continue
+			}
+			key := identityKey{nodeID, rule.V2boardUID}
+			if owners[rule.EntryNodeID][key] {
+				// 已迁移，或同一用户存在重复规则 (交由下次同步清理)
+				continue
+			}
+
+			identity := models.UserIdentity{
+				EntryNodeID:   rule.EntryNodeID,
+				V2boardNodeID: nodeID,
+				V2boardUID:    rule.V2boardUID,
+				Tag:           rule.UserEmail,
+			}
+			if usedTags[identity.Tag] {
+				tag, err := newIdentityTag()
+				if err != nil {
+					return err
+				}
+				identity.Tag = tag
+				if err := tx.Model(&models.ForwardingRule{}).Where("id = ?", rule.ID).Update("user_email", identity.Tag).Error; err != nil {
+					return err
+				}
+				retagged++
+			}
+			if err := tx.Create(&identity).Error; err != nil {
+				return err
+			}
+
+			usedTags[identity.Tag] = true
+			if owners[rule.EntryNodeID] == nil {
+				owners[rule.EntryNodeID] = make(map[identityKey]bool)
+			}
+			owners[rule.EntryNodeID][key] = true
+			migrated++
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("[Sync] Legacy identity migration failed: %v", err)
+		return
+	}
+	if migrated > 0 {
+		log.Printf("[Sync] Migrated %d legacy identity tags (%d re-tagged)", migrated, retagged)
+	}
+}
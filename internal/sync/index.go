@@ -0,0 +1,165 @@
+package sync
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/wangn9900/StealthForward/internal/database"
+	"github.com/wangn9900/StealthForward/internal/generator"
+	"github.com/wangn9900/StealthForward/internal/models"
+)
+
+// indexedAccount 索引中的计费账户：标签 -> V2Board 节点 + 用户 + 当前落地
+type indexedAccount struct {
+	trafficAccount
+	ExitNodeID uint
+}
+
+// ruleIndex 规则与身份的内存索引，流量汇报路径只读此索引，不再逐用户查库
+type ruleIndex struct {
+	accounts map[uint]map[string]indexedAccount // 入口 ID -> 标签 -> 账户
+	entries  map[uint]models.EntryNode          // 入口 ID -> 入口
+	byV2bID  map[int]uint                       // V2Board 节点 ID -> 入口 ID (兼容按面板节点 ID 上报的旧 Agent)
+	exitTags map[string]uint                    // 落地 outbound tag -> 落地 ID
+}
+
+var (
+	indexMu      sync.RWMutex
+	currentIndex = &ruleIndex{
+		accounts: make(map[uint]map[string]indexedAccount),
+		entries:  make(map[uint]models.EntryNode),
+		byV2bID:  make(map[int]uint),
+		exitTags: make(map[string]uint),
+	}
+
+	// entryTrafficMap / exitTrafficMap: 入口/落地 ID -> *[Upload, Download] (进程启动以来的累计值，随采集实时累加)
+	entryTrafficMap sync.Map
+	exitTrafficMap  sync.Map
+)
+
+// RefreshRuleIndex 从数据库重建规则索引
+// 同步写库、规则/入口增删后调用；推送任务每轮也会重建一次兜底
+func RefreshRuleIndex() {
+	var entries []models.EntryNode
+	database.DB.Find(&entries)
+	var mappings []models.NodeMapping
+	database.DB.Find(&mappings)
+	var identities []models.UserIdentity
+	database.DB.Find(&identities)
+	var rules []models.ForwardingRule
+	database.DB.Find(&rules)
+	var exits []models.ExitNode
+	database.DB.Find(&exits)
+
+	idx := &ruleIndex{
+		accounts: make(map[uint]map[string]indexedAccount),
+		entries:  make(map[uint]models.EntryNode),
+		byV2bID:  make(map[int]uint),
+		exitTags: make(map[string]uint),
+	}
+	for _, exit := range exits {
+		idx.exitTags[generator.ExitOutboundTag(exit.Name)] = exit.ID
+	}
+	for _, entry := range entries {
+		idx.entries[entry.ID] = entry
+		idx.accounts[entry.ID] = make(map[string]indexedAccount)
+		if entry.V2boardNodeID != 0 {
+			if _, ok := idx.byV2bID[entry.V2boardNodeID]; !ok {
+				idx.byV2bID[entry.V2boardNodeID] = entry.ID
+			}
+		}
+	}
+	for _, m := range mappings {
+		if _, ok := idx.byV2bID[m.V2boardNodeID]; !ok {
+			idx.byV2bID[m.V2boardNodeID] = m.EntryNodeID
+		}
+	}
+
+	identityByTag := make(map[string]models.UserIdentity)
+	for _, identity := range identities {
+		identityByTag[identity.Tag] = identity
+	}
+
+	for _, rule := range rules {
+		entryAccounts, ok := idx.accounts[rule.EntryNodeID]
+		if !ok {
+			continue
+		}
+		account := indexedAccount{
+			trafficAccount: trafficAccount{Tag: rule.UserEmail, UID: rule.V2boardUID},
+			ExitNodeID:     rule.ExitNodeID,
+		}
+		if identity, ok := identityByTag[rule.UserEmail]; ok && identity.EntryNodeID == rule.EntryNodeID {
+			account.NodeID = identity.V2boardNodeID
+			account.UID = identity.V2boardUID
+		} else {
+			// 手动创建的规则没有身份记录，按入口默认节点上报
+			account.NodeID = idx.entries[rule.EntryNodeID].V2boardNodeID
+		}
+		entryAccounts[rule.UserEmail] = account
+	}
+
+	// 规则已删除但身份仍在的账户也要保留，确保迟到的流量依然能够计费
+	for _, identity := range identities {
+		entryAccounts, ok := idx.accounts[identity.EntryNodeID]
+		if !ok {
+			continue
+		}
+		if _, exists := entryAccounts[identity.Tag]; !exists {
+			entryAccounts[identity.Tag] = indexedAccount{
+				trafficAccount: trafficAccount{Tag: identity.Tag, NodeID: identity.V2boardNodeID, UID: identity.V2boardUID},
+			}
+		}
+	}
+
+	indexMu.Lock()
+	currentIndex = idx
+	indexMu.Unlock()
+}
+
+// lookupAccount 在索引中定位入口下某个标签的账户
+func lookupAccount(entryID uint, tag string) (indexedAccount, bool) {
+	indexMu.RLock()
+	defer indexMu.RUnlock()
+	account, ok := currentIndex.accounts[entryID][tag]
+	return account, ok
+}
+
+// lookupExitByTag 将 outbound tag 解析为落地 ID
+func lookupExitByTag(tag string) (uint, bool) {
+	indexMu.RLock()
+	defer indexMu.RUnlock()
+	exitID, ok := currentIndex.exitTags[tag]
+	return exitID, ok
+}
+
+// resolveReportEntry 将 Agent 上报的节点 ID 解析为入口 ID
+// 依次尝试：入口 ID、入口默认 V2Board 节点 ID、多端口映射的 V2Board 节点 ID
+func resolveReportEntry(nodeID uint) (uint, bool) {
+	indexMu.RLock()
+	defer indexMu.RUnlock()
+	if _, ok := currentIndex.entries[nodeID]; ok {
+		return nodeID, true
+	}
+	entryID, ok := currentIndex.byV2bID[int(nodeID)]
+	return entryID, ok
+}
+
+// addAggregate 累加 入口/落地 维度的流量
+func addAggregate(m *sync.Map, id uint, up, down int64) {
+	val, _ := m.LoadOrStore(id, &[2]int64{0, 0})
+	counters := val.(*[2]int64)
+	atomic.AddInt64(&counters[0], up)
+	atomic.AddInt64(&counters[1], down)
+}
+
+// loadAggregates 读取 入口/落地 维度的流量快照
+func loadAggregates(m *sync.Map) map[uint][2]int64 {
+	result := make(map[uint][2]int64)
+	m.Range(func(key, value interface{}) bool {
+		counters := value.(*[2]int64)
+		result[key.(uint)] = [2]int64{atomic.LoadInt64(&counters[0]), atomic.LoadInt64(&counters[1])}
+		return true
+	})
+	return result
+}
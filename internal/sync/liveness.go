@@ -0,0 +1,198 @@
+package sync
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/wangn9900/StealthForward/internal/database"
+	"github.com/wangn9900/StealthForward/internal/models"
+)
+
+const (
+	defaultDegradedAfter = 90  // 秒
+	defaultOfflineAfter  = 300 // 秒
+	// livenessTick 节点状态与告警规则的检查间隔
+	livenessTick = 30 * time.Second
+	// nodeHistoryRetention 状态变化与已恢复告警的保留时长
+	nodeHistoryRetention = 90 * 24 * time.Hour
+)
+
+var (
+	// livenessMu 串行化状态检查；monitorStartedAt 之前的上报不算超时 (Controller 停机期间 Agent 无法上报)
+	livenessMu       sync.Mutex
+	monitorStartedAt time.Time
+	// alertPending 规则 ID -> 入口 ID -> 条件开始成立的时间 (用于持续时间判断)
+	alertPending = make(map[uint]map[uint]time.Time)
+)
+
+// StartNodeMonitor 恢复持久化的探针数据，并定时计算节点状态、检查告警规则
+func StartNodeMonitor() {
+	restoreNodeStats()
+	monitorStartedAt = time.Now()
+	go func() {
+		ticker := time.NewTicker(livenessTick)
+		for now := range ticker.C {
+			checkNodeLiveness(now)
+		}
+	}()
+}
+
+// restoreNodeStats 将持久化的最近一次探针数据载入内存
+func restoreNodeStats() {
+	var statuses []models.NodeStatus
+	database.DB.Find(&statuses)
+	for _, s := range statuses {
+		if s.LastStats == "" {
+			continue
+		}
+		var stats models.SystemStats
+		if err := json.Unmarshal([]byte(s.LastStats), &stats); err == nil {
+			nodeStatsMap.LoadOrStore(s.EntryNodeID, &stats)
+		}
+	}
+}
+
+// nodeThresholds 读取延迟/离线判定时长
+func nodeThresholds() (degraded, offline time.Duration) {
+	degraded = time.Duration(settingInt(models.ConfigKeyNodeDegradedAfter, defaultDegradedAfter)) * time.Second
+	offline = time.Duration(settingInt(models.ConfigKeyNodeOfflineAfter, defaultOfflineAfter)) * time.Second
+	if offline <= degraded {
+		offline = degraded + time.Minute
+	}
+	return degraded, offline
+}
+
+// latestNodeStats 返回入口最近一次探针数据
+func latestNodeStats(entryID uint) *models.SystemStats {
+	if v, ok := nodeStatsMap.Load(entryID); ok {
+		return v.(*models.SystemStats)
+	}
+	return nil
+}
+
+// checkNodeLiveness 按上报新鲜度更新节点状态，记录状态变化，再检查告警规则
+func checkNodeLiveness(now time.Time) {
+	livenessMu.Lock()
+	defer livenessMu.Unlock()
+
+	degradedAfter, offlineAfter := nodeThresholds()
+	var entries []models.EntryNode
+	database.DB.Select("id, name").Find(&entries)
+	var rows []models.NodeStatus
+	database.DB.Find(&rows)
+	existing := make(map[uint]models.NodeStatus, len(rows))
+	for _, row := range rows {
+		existing[row.EntryNodeID] = row
+	}
+
+	statuses := make(map[uint]models.NodeStatus, len(entries))
+	ids := make([]uint, 0, len(entries))
+	for _, entry := range entries {
+		ids = append(ids, entry.ID)
+		row := existing[entry.ID]
+		stats := latestNodeStats(entry.ID)
+
+		status := models.NodeStatusUnknown
+		var lastReport *time.Time
+		if stats != nil && stats.ReportAt > 0 {
+			reportAt := time.Unix(stats.ReportAt, 0)
+			lastReport = &reportAt
+			age := now.Sub(reportAt)
+			sinceStart := now.Sub(monitorStartedAt)
+			// 重启前的上报 (恢复的探针数据)：Controller 停机期间不算超时，但也不能据此判定上线
+			restored := reportAt.Before(monitorStartedAt.Truncate(time.Second))
+			if restored && sinceStart < age {
+				age = sinceStart
+			}
+			switch {
+			case age >= offlineAfter:
+				status = models.NodeStatusOffline
+			case age >= degradedAfter:
+				status = models.NodeStatusDegraded
+			default:
+				status = models.NodeStatusOnline
+			}
+			// 重启后的观察期内沿用持久化的状态，等待 Agent 重新上报
+			if restored && sinceStart < offlineAfter && row.Status != "" {
+				status = row.Status
+			}
+		}
+
+		if row.Status != status {
+			from := row.Status
+			if from == "" {
+				from = models.NodeStatusUnknown
+			}
+			if from != status {
+				reason := "no report yet"
+				if lastReport != nil {
+					reason = fmt.Sprintf("last report %s ago", now.Sub(*lastReport).Round(time.Second))
+				}
+				database.DB.Create(&models.NodeStatusChange{EntryNodeID: entry.ID, From: from, To: status, Reason: reason})
+				log.Printf("[Node] 入口 #%d (%s) 状态 %s -> %s (%s)", entry.ID, entry.Name, from, status, reason)
+				// 首次上线不算状态变化事件
+				if status != models.NodeStatusUnknown && !(from == models.NodeStatusUnknown && status == models.NodeStatusOnline) {
+					PublishEvent("node."+status, entrySubject(entry.ID),
+						fmt.Sprintf("入口 #%d (%s) 状态 %s -> %s (%s)", entry.ID, entry.Name, from, status, reason),
+						map[string]interface{}{"entry_id": entry.ID, "from": from, "to": status, "last_report_at": lastReport})
+				}
+			}
+			row.Since = now
+		}
+		row.EntryNodeID = entry.ID
+		row.Status = status
+		row.LastReportAt = lastReport
+		if stats != nil {
+			if b, err := json.Marshal(stats); err == nil {
+				row.LastStats = string(b)
+			}
+		}
+		if err := database.DB.Save(&row).Error; err != nil {
+			log.Printf("[Node] 保存入口 #%d 状态失败: %v", entry.ID, err)
+		}
+		statuses[entry.ID] = row
+	}
+	if len(ids) > 0 {
+		database.DB.Where("entry_node_id NOT IN ?", ids).Delete(&models.NodeStatus{})
+	} else {
+		database.DB.Where("1 = 1").Delete(&models.NodeStatus{})
+	}
+
+	evaluateAlertRules(now, entries, statuses)
+
+	cutoff := now.Add(-nodeHistoryRetention)
+	database.DB.Where("created_at < ?", cutoff).Delete(&models.NodeStatusChange{})
+	database.DB.Where("state = ? AND fired_at < ?", models.AlertStateResolved, cutoff).Delete(&models.AlertEvent{})
+}
+
+// NodeStatusView 节点状态接口的返回结构
+type NodeStatusView struct {
+	models.NodeStatus
+	Name  string              `json:"name"`
+	Stats *models.SystemStats `json:"stats"`
+}
+
+// GetNodeStatuses 返回所有入口的当前状态与最近一次探针数据
+func GetNodeStatuses() []NodeStatusView {
+	var entries []models.EntryNode
+	database.DB.Select("id, name").Order("id").Find(&entries)
+	var rows []models.NodeStatus
+	database.DB.Find(&rows)
+	byID := make(map[uint]models.NodeStatus, len(rows))
+	for _, row := range rows {
+		byID[row.EntryNodeID] = row
+	}
+
+	result := make([]NodeStatusView, 0, len(entries))
+	for _, entry := range entries {
+		row, ok := byID[entry.ID]
+		if !ok {
+			row = models.NodeStatus{EntryNodeID: entry.ID, Status: models.NodeStatusUnknown}
+		}
+		result = append(result, NodeStatusView{NodeStatus: row, Name: entry.Name, Stats: latestNodeStats(entry.ID)})
+	}
+	return result
+}
@@ -0,0 +1,106 @@
+package sync
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/wangn9900/StealthForward/internal/database"
+	"github.com/wangn9900/StealthForward/internal/metrics"
+	"github.com/wangn9900/StealthForward/internal/models"
+)
+
+// Metrics Controller 的 Prometheus 指标 (由 /metrics 输出)
+var Metrics = metrics.NewRegistry()
+
+var (
+	metricSyncRuns = Metrics.Counter("stealth_sync_runs_total",
+		"V2Board user sync runs per entry and panel node.", "entry", "node", "result")
+	metricPushTotal = Metrics.Counter("stealth_v2board_push_total",
+		"Traffic pushes to V2Board per entry and panel node.", "entry", "node", "result")
+	metricPushDuration = Metrics.Histogram("stealth_v2board_push_duration_seconds",
+		"Latency of traffic pushes to V2Board.", metrics.DefaultBuckets, "entry", "node")
+	metricAgentReports = Metrics.Counter("stealth_agent_reports_total",
+		"Traffic reports received from agents.", "node")
+
+	metricOutboxRecords = Metrics.Gauge("stealth_outbox_pending_records",
+		"Traffic records waiting to be pushed to V2Board.", "entry", "node")
+	metricOutboxBytes = Metrics.Gauge("stealth_outbox_pending_bytes",
+		"Bytes waiting to be pushed to V2Board.", "entry", "node")
+	metricEntryBytes = Metrics.Gauge("stealth_entry_traffic_bytes",
+		"Accumulated traffic per entry node since the last reset.", "entry", "name", "direction")
+	metricExitBytes = Metrics.Gauge("stealth_exit_traffic_bytes",
+		"Accumulated traffic per exit node since the last reset.", "exit", "name", "direction")
+	metricAgentLastSeen = Metrics.Gauge("stealth_agent_last_seen_timestamp_seconds",
+		"Unix time of the last report from each agent.", "node")
+
+	// agentLastSeen 上报的节点 ID -> 最近一次上报时间
+	agentLastSeen sync.Map
+)
+
+func init() {
+	Metrics.OnCollect(collectMetricSnapshots)
+}
+
+// idLabel 数字 ID 转为标签值
+func idLabel[T ~uint | ~int](id T) string {
+	return strconv.FormatUint(uint64(id), 10)
+}
+
+// resultLabel 按错误返回 success / error
+func resultLabel(failed bool) string {
+	if failed {
+		return "error"
+	}
+	return "success"
+}
+
+// observeAgentReport 记录一次 Agent 上报
+func observeAgentReport(nodeID uint, now time.Time) {
+	metricAgentReports.Inc(idLabel(nodeID))
+	agentLastSeen.Store(nodeID, now)
+}
+
+// collectMetricSnapshots 抓取时重建积压、节点流量与 Agent 在线时间
+func collectMetricSnapshots() {
+	metricOutboxRecords.Reset()
+	metricOutboxBytes.Reset()
+	var backlog []struct {
+		EntryNodeID   uint
+		V2boardNodeID int
+		Records       int64
+		Bytes         int64
+	}
+	database.DB.Model(&models.TrafficOutbox{}).
+		Select("entry_node_id, v2board_node_id, COUNT(*) AS records, COALESCE(SUM(upload + download), 0) AS bytes").
+		Where("pushed_at IS NULL").
+		Group("entry_node_id, v2board_node_id").
+		Scan(&backlog)
+	for _, b := range backlog {
+		metricOutboxRecords.Set(float64(b.Records), idLabel(b.EntryNodeID), idLabel(b.V2boardNodeID))
+		metricOutboxBytes.Set(float64(b.Bytes), idLabel(b.EntryNodeID), idLabel(b.V2boardNodeID))
+	}
+
+	stats := GetTrafficStatsByEntry()
+	metricEntryBytes.Reset()
+	var entries []models.EntryNode
+	database.DB.Select("id, name").Find(&entries)
+	for _, e := range entries {
+		t := stats.EntryStats[e.ID]
+		metricEntryBytes.Set(float64(t.Upload), idLabel(e.ID), e.Name, "up")
+		metricEntryBytes.Set(float64(t.Download), idLabel(e.ID), e.Name, "down")
+	}
+	metricExitBytes.Reset()
+	var exits []models.ExitNode
+	database.DB.Select("id, name").Find(&exits)
+	for _, e := range exits {
+		t := stats.ExitStats[e.ID]
+		metricExitBytes.Set(float64(t.Upload), idLabel(e.ID), e.Name, "up")
+		metricExitBytes.Set(float64(t.Download), idLabel(e.ID), e.Name, "down")
+	}
+
+	agentLastSeen.Range(func(key, value interface{}) bool {
+		metricAgentLastSeen.Set(float64(value.(time.Time).Unix()), idLabel(key.(uint)))
+		return true
+	})
+}
@@ -0,0 +1,150 @@
+package sync
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wangn9900/StealthForward/internal/database"
+	"github.com/wangn9900/StealthForward/internal/models"
+	"github.com/wangn9900/StealthForward/internal/telegram"
+)
+
+// notifyClient 发送通知使用的 HTTP 客户端
+var notifyClient = &http.Client{Timeout: 10 * time.Second}
+
+// channelConfig 通知渠道配置 (按类型取用字段)
+type channelConfig struct {
+	URL      string `json:"url"`
+	BotToken string `json:"bot_token"`
+	ChatID   string `json:"chat_id"`
+}
+
+// ValidateNotificationChannel 校验通知渠道设置
+func ValidateNotificationChannel(ch models.NotificationChannel) error {
+	var cfg channelConfig
+	if err := json.Unmarshal([]byte(ch.Config), &cfg); err != nil {
+		return fmt.Errorf("invalid config: %v", err)
+	}
+	switch ch.Type {
+	case models.NotifyChannelWebhook:
+		if !strings.HasPrefix(cfg.URL, "http://") && !strings.HasPrefix(cfg.URL, "https://") {
+			return fmt.Errorf("webhook config requires an http(s) url")
+		}
+	case models.NotifyChannelTelegram:
+		if cfg.BotToken == "" || cfg.ChatID == "" {
+			return fmt.Errorf("telegram config requires bot_token and chat_id")
+		}
+	default:
+		return fmt.Errorf("unknown channel type: %s", ch.Type)
+	}
+	return nil
+}
+
+// channelSecretMask 响应中代替渠道密钥的占位符，更新时原样提交表示保留原密钥
+const channelSecretMask = "******"
+
+// MaskChannelSecrets 返回隐藏密钥 (bot_token) 后的渠道，用于 API 响应
+func MaskChannelSecrets(ch models.NotificationChannel) models.NotificationChannel {
+	var cfg map[string]interface{}
+	if err := json.Unmarshal([]byte(ch.Config), &cfg); err != nil {
+		return ch
+	}
+	if token, _ := cfg["bot_token"].(string); token != "" {
+		cfg["bot_token"] = channelSecretMask
+		masked, _ := json.Marshal(cfg)
+		ch.Config = string(masked)
+	}
+	return ch
+}
+
+// RestoreChannelSecrets 更新渠道时，配置中的密钥仍为占位符则沿用原配置中的密钥
+func RestoreChannelSecrets(config, oldConfig string) string {
+	var cfg map[string]interface{}
+	if err := json.Unmarshal([]byte(config), &cfg); err != nil {
+		return config
+	}
+	if token, _ := cfg["bot_token"].(string); token != channelSecretMask {
+		return config
+	}
+	var old channelConfig
+	json.Unmarshal([]byte(oldConfig), &old)
+	cfg["bot_token"] = old.BotToken
+	restored, _ := json.Marshal(cfg)
+	return string(restored)
+}
+
+// parseIDList 解析逗号分隔的 ID 列表
+func parseIDList(s string) []uint {
+	var ids []uint
+	for _, part := range strings.Split(s, ",") {
+		if id, err := strconv.ParseUint(strings.TrimSpace(part), 10, 32); err == nil && id > 0 {
+			ids = append(ids, uint(id))
+		}
+	}
+	return ids
+}
+
+// Notify 异步发送通知到指定渠道，channelIDs 为空时发送到所有启用的渠道
+func Notify(channelIDs []uint, title, message string) {
+	var channels []models.NotificationChannel
+	query := database.DB.Where("enabled = ?", true)
+	if len(channelIDs) > 0 {
+		query = query.Where("id IN ?", channelIDs)
+	}
+	query.Find(&channels)
+	for _, ch := range channels {
+		go func(ch models.NotificationChannel) {
+			if err := SendNotification(ch, title, message); err != nil {
+				log.Printf("[Notify] 渠道 #%d (%s) 发送失败: %v", ch.ID, ch.Name, err)
+			}
+		}(ch)
+	}
+}
+
+// SendNotification 同步发送一条通知 (也用于测试渠道)
+func SendNotification(ch models.NotificationChannel, title, message string) error {
+	var cfg channelConfig
+	if err := json.Unmarshal([]byte(ch.Config), &cfg); err != nil {
+		return fmt.Errorf("invalid config: %v", err)
+	}
+
+	switch ch.Type {
+	case models.NotifyChannelWebhook:
+		return postWebhookNotification(cfg.URL, title, message)
+	case models.NotifyChannelTelegram:
+		// 与运维机器人共用 Bot API 客户端及 telegram.api_base 设置
+		ctx, cancel := context.WithTimeout(context.Background(), notifyClient.Timeout)
+		defer cancel()
+		client := telegram.New(cfg.BotToken, settingString(models.ConfigKeyTelegramAPIBase))
+		return client.SendText(ctx, cfg.ChatID, title+"\n"+message)
+	default:
+		return fmt.Errorf("unknown channel type: %s", ch.Type)
+	}
+}
+
+// postWebhookNotification POST JSON {"title","message","time"} 到 Webhook 渠道
+func postWebhookNotification(url, title, message string) error {
+	body, _ := json.Marshal(map[string]interface{}{
+		"title":   title,
+		"message": message,
+		"time":    time.Now().Format(time.RFC3339),
+	})
+	resp, err := notifyClient.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, string(respBody))
+	}
+	return nil
+}
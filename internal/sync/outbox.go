@@ -0,0 +1,200 @@
+package sync
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/wangn9900/StealthForward/internal/database"
+	"github.com/wangn9900/StealthForward/internal/models"
+	"gorm.io/gorm"
+)
+
+const (
+	// 推送失败后的退避：1 分钟起按 2 的指数增长，最长 30 分钟
+	outboxBaseBackoff = 1 * time.Minute
+	outboxMaxBackoff  = 30 * time.Minute
+
+	// 单次推送最多取出的记录数，积压严重时分多轮推送
+	outboxBatchSize = 5000
+
+	defaultOutboxRetentionHours = 24
+	defaultOutboxMaxAgeHours    = 7 * 24
+
+	// agentCursorRetention Agent 实例长期不上报后清理其去重游标
+	agentCursorRetention = 30 * 24 * time.Hour
+)
+
+// OutboxBacklog 某个 入口 + V2Board 节点 的待推送积压
+type OutboxBacklog struct {
+	EntryNodeID   uint      `json:"entry_node_id"`
+	V2boardNodeID int       `json:"v2board_node_id"`
+	Records       int64     `json:"records"`
+	Users         int64     `json:"users"`
+	Upload        int64     `json:"upload"`
+	Download      int64     `json:"download"`
+	OldestAt      time.Time `json:"oldest_at"`
+	MaxAttempts   int       `json:"max_attempts"`
+	NextAttemptAt time.Time `json:"next_attempt_at"`
+	LastError     string    `json:"last_error"`
+}
+
+// settingHours 读取以小时为单位的系统配置，未配置或非法时返回默认值
+func settingHours(key string, def int) time.Duration {
+	return time.Duration(settingInt(key, def)) * time.Hour
+}
+
+// outboxBackoff 第 attempts 次失败后的等待时间
+func outboxBackoff(attempts int) time.Duration {
+	if attempts > 10 {
+		attempts = 10
+	}
+	d := outboxBaseBackoff << (attempts - 1)
+	if d > outboxMaxBackoff {
+		return outboxMaxBackoff
+	}
+	return d
+}
+
+// enqueueTraffic 将流量写入发件箱，写库成功后才能向 Agent 确认
+func enqueueTraffic(db *gorm.DB, records []models.TrafficOutbox) error {
+	if len(records) == 0 {
+		return nil
+	}
+	return db.CreateInBatches(&records, 200).Error
+}
+
+// applyTrafficBatch 在同一事务中写入发件箱并推进 Agent 上报游标
+// 返回已入账的最大序号；序号不大于游标时视为重复上报 (Agent 未收到确认而重发)，不再入账
+func applyTrafficBatch(report models.NodeTrafficReport, records []models.TrafficOutbox) (uint64, bool, error) {
+	if report.Seq == 0 || report.InstanceID == "" {
+		return 0, false, enqueueTraffic(database.DB, records)
+	}
+
+	var acked uint64
+	duplicate := false
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var cursor models.AgentReportCursor
+		err := tx.Where(&models.AgentReportCursor{EntryNodeID: report.NodeID, InstanceID: report.InstanceID}).First(&cursor).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		if cursor.ID != 0 && report.Seq <= cursor.LastSeq {
+			acked = cursor.LastSeq
+			duplicate = true
+			return nil
+		}
+
+		if err := enqueueTraffic(tx, records); err != nil {
+			return err
+		}
+		cursor.EntryNodeID = report.NodeID
+		cursor.InstanceID = report.InstanceID
+		cursor.LastSeq = report.Seq
+		if err := tx.Save(&cursor).Error; err != nil {
+			return err
+		}
+		acked = report.Seq
+		return nil
+	})
+	return acked, duplicate, err
+}
+
+// pendingOutbox 取出某节点当前可推送的流量记录
+func pendingOutbox(entryID uint, nodeID int, now time.Time) []models.TrafficOutbox {
+	var records []models.TrafficOutbox
+	database.DB.Where("entry_node_id = ? AND v2board_node_id = ? AND pushed_at IS NULL AND next_attempt_at <= ?", entryID, nodeID, now).
+		Order("id").Limit(outboxBatchSize).Find(&records)
+	return records
+}
+
+// pendingOutboxNodes 列出入口下仍有待推送流量的 V2Board 节点 (含已删除映射的节点)
+func pendingOutboxNodes(entryID uint) []int {
+	var nodeIDs []int
+	database.DB.Model(&models.TrafficOutbox{}).
+		Where("entry_node_id = ? AND pushed_at IS NULL", entryID).
+		Distinct().Pluck("v2board_node_id", &nodeIDs)
+	return nodeIDs
+}
+
+// markOutboxPushed 推送成功：保留期为 0 时直接删除，否则标记完成
+func markOutboxPushed(records []models.TrafficOutbox, now time.Time) error {
+	if len(records) == 0 {
+		return nil
+	}
+	ids := make([]uint, len(records))
+	for i, r := range records {
+		ids[i] = r.ID
+	}
+	if settingHours(models.ConfigKeyTrafficOutboxRetention, defaultOutboxRetentionHours) == 0 {
+		return database.DB.Where("id IN ?", ids).Delete(&models.TrafficOutbox{}).Error
+	}
+	return database.DB.Model(&models.TrafficOutbox{}).Where("id IN ?", ids).
+		Updates(map[string]interface{}{"pushed_at": now, "last_error": ""}).Error
+}
+
+// markOutboxFailed 推送失败：累加失败次数并按退避时间推迟下一次推送
+func markOutboxFailed(records []models.TrafficOutbox, pushErr error, now time.Time) {
+	byAttempts := make(map[int][]uint)
+	for _, r := range records {
+		byAttempts[r.Attempts+1] = append(byAttempts[r.Attempts+1], r.ID)
+	}
+	for attempts, ids := range byAttempts {
+		err := database.DB.Model(&models.TrafficOutbox{}).Where("id IN ?", ids).
+			Updates(map[string]interface{}{
+				"attempts":        attempts,
+				"next_attempt_at": now.Add(outboxBackoff(attempts)),
+				"last_error":      pushErr.Error(),
+			}).Error
+		if err != nil {
+			log.Printf("[Outbox] Failed to schedule retry for %d records: %v", len(ids), err)
+		}
+	}
+}
+
+// pruneOutbox 清理超过保留期的已推送记录与超过最长保留期仍未推送成功的记录
+func pruneOutbox(now time.Time) {
+	retention := settingHours(models.ConfigKeyTrafficOutboxRetention, defaultOutboxRetentionHours)
+	database.DB.Where("pushed_at IS NOT NULL AND pushed_at < ?", now.Add(-retention)).Delete(&models.TrafficOutbox{})
+
+	database.DB.Where("updated_at < ?", now.Add(-agentCursorRetention)).Delete(&models.AgentReportCursor{})
+
+	maxAge := settingHours(models.ConfigKeyTrafficOutboxMaxAge, defaultOutboxMaxAgeHours)
+	if maxAge == 0 {
+		return
+	}
+	result := database.DB.Where("pushed_at IS NULL AND created_at < ?", now.Add(-maxAge)).Delete(&models.TrafficOutbox{})
+	if result.RowsAffected > 0 {
+		log.Printf("[Outbox] Dropped %d undelivered traffic records older than %v", result.RowsAffected, maxAge)
+	}
+}
+
+// GetOutboxBacklog 返回各 入口 + V2Board 节点 的待推送积压
+func GetOutboxBacklog() []OutboxBacklog {
+	backlog := []OutboxBacklog{}
+	database.DB.Model(&models.TrafficOutbox{}).
+		Select("entry_node_id, v2board_node_id, COUNT(*) AS records, COUNT(DISTINCT v2board_uid) AS users, " +
+			"SUM(upload) AS upload, SUM(download) AS download, MAX(attempts) AS max_attempts").
+		Where("pushed_at IS NULL").
+		Group("entry_node_id, v2board_node_id").
+		Order("entry_node_id, v2board_node_id").
+		Scan(&backlog)
+
+	// 时间字段在 SQLite 聚合后是字符串，单独查询最早记录与最近一次失败
+	for i := range backlog {
+		b := &backlog[i]
+		scope := func() *gorm.DB {
+			return database.DB.Where("entry_node_id = ? AND v2board_node_id = ? AND pushed_at IS NULL", b.EntryNodeID, b.V2boardNodeID)
+		}
+		var oldest models.TrafficOutbox
+		if scope().Order("id").First(&oldest).Error == nil {
+			b.OldestAt = oldest.CreatedAt
+		}
+		var latestFailure models.TrafficOutbox
+		if scope().Where("attempts > 0").Order("next_attempt_at DESC").First(&latestFailure).Error == nil {
+			b.NextAttemptAt = latestFailure.NextAttemptAt
+			b.LastError = latestFailure.LastError
+		}
+	}
+	return backlog
+}
@@ -0,0 +1,197 @@
+package sync
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wangn9900/StealthForward/internal/database"
+	"github.com/wangn9900/StealthForward/internal/models"
+)
+
+const (
+	// defaultProbeRetentionDays 探测历史默认保留天数
+	defaultProbeRetentionDays = 7
+	// defaultMatrixWindow 延迟矩阵默认的统计窗口
+	defaultMatrixWindow = 15 * time.Minute
+)
+
+var (
+	probePruneMu   sync.Mutex
+	lastProbePrune time.Time
+	lastReachPrune time.Time
+)
+
+// RecordExitProbes 记录 Agent 上报的一轮探测结果，返回写入的条数
+func RecordExitProbes(report models.ExitProbeReport) (int, error) {
+	entryID, ok := resolveReportEntry(report.NodeID)
+	if !ok {
+		return 0, fmt.Errorf("unknown node %d", report.NodeID)
+	}
+	probedAt := time.Now()
+	// Agent 时钟偏差过大时以 Controller 时间为准
+	if report.ProbedAt > 0 {
+		if t := time.Unix(report.ProbedAt, 0); t.Sub(probedAt).Abs() < 10*time.Minute {
+			probedAt = t
+		}
+	}
+
+	var rows []models.ExitProbe
+	for _, r := range report.Results {
+		exitID, ok := lookupExitByTag(r.Tag)
+		if !ok {
+			continue
+		}
+		row := models.ExitProbe{
+			EntryNodeID:  entryID,
+			ExitNodeID:   exitID,
+			TCPLatencyMs: r.TCPLatencyMs,
+			URLTested:    r.URLTested,
+			URLOK:        r.URLTested && r.URLError == "",
+			URLLatencyMs: r.URLLatencyMs,
+			ProbedAt:     probedAt,
+		}
+		if r.TCPAttempts > 0 {
+			row.TCPLoss = float64(r.TCPFailures) / float64(r.TCPAttempts)
+		}
+		var errs []string
+		if r.TCPError != "" {
+			errs = append(errs, "tcp: "+r.TCPError)
+		}
+		if r.URLError != "" {
+			errs = append(errs, "url: "+r.URLError)
+		}
+		row.Error = strings.Join(errs, "; ")
+		rows = append(rows, row)
+	}
+	if len(rows) > 0 {
+		if err := database.DB.CreateInBatches(&rows, 200).Error; err != nil {
+			return 0, err
+		}
+	}
+	if len(rows) > 0 {
+		evaluateFailover(entryID, time.Now())
+	}
+	pruneExitProbes(probedAt)
+	return len(rows), nil
+}
+
+// pruneExitProbes 每小时清理一次过期的探测历史
+func pruneExitProbes(now time.Time) {
+	probePruneMu.Lock()
+	if now.Sub(lastProbePrune) < time.Hour {
+		probePruneMu.Unlock()
+		return
+	}
+	lastProbePrune = now
+	probePruneMu.Unlock()
+
+	days := settingInt(models.ConfigKeyProbeRetentionDays, defaultProbeRetentionDays)
+	database.DB.Where("probed_at < ?", now.AddDate(0, 0, -days)).Delete(&models.ExitProbe{})
+	pruneFailoverHistory(now)
+}
+
+// ProbeCell 延迟矩阵的一格 (入口 -> 落地)
+type ProbeCell struct {
+	EntryNodeID  uint      `json:"entry_node_id"`
+	ExitNodeID   uint      `json:"exit_node_id"`
+	Samples      int       `json:"samples"`
+	TCPLatencyMs float64   `json:"tcp_ms"`      // 窗口内平均 (仅计连接成功的样本)
+	TCPLoss      float64   `json:"tcp_loss"`    // 窗口内平均丢失率 0-1
+	URLLatencyMs float64   `json:"url_ms"`      // 窗口内 URL 测试成功样本的平均耗时
+	URLSuccess   float64   `json:"url_success"` // URL 测试成功率 0-1，-1 表示未测试 (外部内核)
+	LastProbedAt time.Time `json:"last_probed_at"`
+	LastError    string    `json:"last_error"`
+}
+
+// ProbeMatrix 入口 x 落地 延迟矩阵
+type ProbeMatrix struct {
+	Window  string      `json:"window"`
+	Entries []NamedNode `json:"entries"`
+	Exits   []NamedNode `json:"exits"`
+	Cells   []ProbeCell `json:"cells"`
+}
+
+// NamedNode 节点 ID 与名称
+type NamedNode struct {
+	ID   uint   `json:"id"`
+	Name string `json:"name"`
+}
+
+// GetProbeMatrix 汇总 window 内的探测结果为入口 x 落地 矩阵
+func GetProbeMatrix(window time.Duration) ProbeMatrix {
+	if window <= 0 {
+		window = defaultMatrixWindow
+	}
+	matrix := ProbeMatrix{Window: window.String(), Entries: []NamedNode{}, Exits: []NamedNode{}, Cells: []ProbeCell{}}
+	database.DB.Model(&models.EntryNode{}).Select("id, name").Order("id").Scan(&matrix.Entries)
+	database.DB.Model(&models.ExitNode{}).Select("id, name").Order("id").Scan(&matrix.Exits)
+
+	var probes []models.ExitProbe
+	database.DB.Where("probed_at >= ?", time.Now().Add(-window)).Order("probed_at").Find(&probes)
+
+	type acc struct {
+		cell                    ProbeCell
+		tcpSum, urlSum          float64
+		tcpOK, urlTested, urlOK int
+	}
+	cells := make(map[[2]uint]*acc)
+	var order [][2]uint
+	for _, p := range probes {
+		key := [2]uint{p.EntryNodeID, p.ExitNodeID}
+		a, ok := cells[key]
+		if !ok {
+			a = &acc{cell: ProbeCell{EntryNodeID: p.EntryNodeID, ExitNodeID: p.ExitNodeID}}
+			cells[key] = a
+			order = append(order, key)
+		}
+		a.cell.Samples++
+		a.cell.TCPLoss += p.TCPLoss
+		if p.TCPLoss < 1 {
+			a.tcpSum += p.TCPLatencyMs
+			a.tcpOK++
+		}
+		if p.URLTested {
+			a.urlTested++
+			if p.URLOK {
+				a.urlOK++
+				a.urlSum += p.URLLatencyMs
+			}
+		}
+		// 按时间升序遍历，最后一条即最新结果
+		a.cell.LastProbedAt = p.ProbedAt
+		a.cell.LastError = p.Error
+	}
+
+	for _, key := range order {
+		a := cells[key]
+		a.cell.TCPLoss /= float64(a.cell.Samples)
+		if a.tcpOK > 0 {
+			a.cell.TCPLatencyMs = a.tcpSum / float64(a.tcpOK)
+		}
+		a.cell.URLSuccess = -1
+		if a.urlTested > 0 {
+			a.cell.URLSuccess = float64(a.urlOK) / float64(a.urlTested)
+		}
+		if a.urlOK > 0 {
+			a.cell.URLLatencyMs = a.urlSum / float64(a.urlOK)
+		}
+		matrix.Cells = append(matrix.Cells, a.cell)
+	}
+	return matrix
+}
+
+// GetProbeHistory 返回入口/落地的探测历史 (按时间倒序)
+func GetProbeHistory(entryID, exitID uint, since time.Time, limit int) []models.ExitProbe {
+	query := database.DB.Where("probed_at >= ?", since).Order("probed_at DESC").Limit(limit)
+	if entryID > 0 {
+		query = query.Where("entry_node_id = ?", entryID)
+	}
+	if exitID > 0 {
+		query = query.Where("exit_node_id = ?", exitID)
+	}
+	var probes []models.ExitProbe
+	query.Find(&probes)
+	return probes
+}
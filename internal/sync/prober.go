@@ -0,0 +1,192 @@
+package sync
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wangn9900/StealthForward/internal/database"
+	"github.com/wangn9900/StealthForward/internal/generator"
+	"github.com/wangn9900/StealthForward/internal/models"
+)
+
+const (
+	// defaultProberRequestsPerMinute 探测机接口默认限频
+	defaultProberRequestsPerMinute = 30
+	// defaultProberDailyTrafficMB 探测机代理流量默认每日上限
+	defaultProberDailyTrafficMB = 100
+)
+
+// ErrProberUnauthorized 探测机 Token 无效或探测机已停用
+var ErrProberUnauthorized = errors.New("invalid or disabled prober token")
+
+var (
+	// proberWindows 探测机 ID -> 当前分钟窗口的请求计数
+	proberWindows   = make(map[uint]*proberWindow)
+	proberWindowsMu sync.Mutex
+)
+
+type proberWindow struct {
+	start time.Time
+	count int
+}
+
+// hashProberToken 数据库只保存 Token 的 SHA-256
+func hashProberToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// newProberToken 生成探测机接口 Token
+func newProberToken() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "sp_" + hex.EncodeToString(b), nil
+}
+
+// newProbeUUID 生成探测机的代理凭证 (UUID v4)
+func newProbeUUID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x40 // version 4
+	b[8] = b[8]&0x3f | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
+
+// CreateProber 创建探测机并返回其接口 Token (只在此时返回明文)
+func CreateProber(p *models.Prober) (string, error) {
+	p.Name = strings.TrimSpace(p.Name)
+	if p.Name == "" {
+		return "", fmt.Errorf("name is required")
+	}
+	if p.RequestsPerMinute < 0 || p.DailyTrafficMB < 0 {
+		return "", fmt.Errorf("limits must not be negative")
+	}
+	token, err := newProberToken()
+	if err != nil {
+		return "", err
+	}
+	uuid, err := newProbeUUID()
+	if err != nil {
+		return "", err
+	}
+	p.ID = 0
+	p.TokenHash = hashProberToken(token)
+	p.ProxyUUID = uuid
+	if err := database.DB.Create(p).Error; err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// RegenerateProberToken 重置探测机的接口 Token 与代理凭证，旧凭证随下次配置同步失效
+func RegenerateProberToken(id uint) (*models.Prober, string, error) {
+	var p models.Prober
+	if err := database.DB.First(&p, id).Error; err != nil {
+		return nil, "", fmt.Errorf("prober #%d not found", id)
+	}
+	token, err := newProberToken()
+	if err != nil {
+		return nil, "", err
+	}
+	uuid, err := newProbeUUID()
+	if err != nil {
+		return nil, "", err
+	}
+	p.TokenHash = hashProberToken(token)
+	p.ProxyUUID = uuid
+	if err := database.DB.Model(&p).Updates(map[string]interface{}{"token_hash": p.TokenHash, "proxy_uuid": p.ProxyUUID}).Error; err != nil {
+		return nil, "", err
+	}
+	return &p, token, nil
+}
+
+// AuthenticateProber 按 Token 查找已启用的探测机
+func AuthenticateProber(token string) (*models.Prober, error) {
+	if token == "" {
+		return nil, ErrProberUnauthorized
+	}
+	var p models.Prober
+	database.DB.Where("token_hash = ?", hashProberToken(token)).Limit(1).Find(&p)
+	if p.ID == 0 || !p.Enabled {
+		return nil, ErrProberUnauthorized
+	}
+	return &p, nil
+}
+
+// AllowProberRequest 按分钟窗口限制探测机的接口请求数
+func AllowProberRequest(p *models.Prober, now time.Time) bool {
+	limit := p.RequestsPerMinute
+	if limit <= 0 {
+		limit = defaultProberRequestsPerMinute
+	}
+	proberWindowsMu.Lock()
+	defer proberWindowsMu.Unlock()
+	w, ok := proberWindows[p.ID]
+	if !ok || now.Sub(w.start) >= time.Minute {
+		w = &proberWindow{start: now}
+		proberWindows[p.ID] = w
+	}
+	if w.count >= limit {
+		return false
+	}
+	w.count++
+	return true
+}
+
+// TouchProber 记录探测机最近一次访问
+func TouchProber(p *models.Prober, ip string, now time.Time) {
+	database.DB.Model(&models.Prober{}).Where("id = ?", p.ID).
+		Updates(map[string]interface{}{"last_seen_at": now, "last_ip": ip})
+}
+
+// ForgetProber 清理已删除探测机的限频状态
+func ForgetProber(id uint) {
+	proberWindowsMu.Lock()
+	delete(proberWindows, id)
+	proberWindowsMu.Unlock()
+}
+
+// proberTrafficToday 探测机当天经入口产生的代理流量 (来自已落库的天桶)
+func proberTrafficToday(id uint, now time.Time) int64 {
+	var total int64
+	database.DB.Model(&models.TrafficBucket{}).
+		Select("COALESCE(SUM(upload + download), 0)").
+		Where("granularity = ? AND bucket_start >= ? AND tag = ?",
+			models.TrafficGranularityDay, dayStart(now), generator.ProbeUserTag(id)).
+		Scan(&total)
+	return total
+}
+
+// proberWithinTraffic 探测机当天的代理流量是否未超出上限
+func proberWithinTraffic(p *models.Prober, now time.Time) bool {
+	limitMB := p.DailyTrafficMB
+	if limitMB <= 0 {
+		limitMB = defaultProberDailyTrafficMB
+	}
+	return proberTrafficToday(p.ID, now) < limitMB<<20
+}
+
+// ProbeUsers 返回写入入口配置的探测用户：已启用且当天代理流量未超上限的探测机
+func ProbeUsers() []generator.ProbeUser {
+	var probers []models.Prober
+	database.DB.Where("enabled = ?", true).Order("id").Find(&probers)
+	now := time.Now()
+	var users []generator.ProbeUser
+	for i := range probers {
+		if probers[i].ProxyUUID == "" || !proberWithinTraffic(&probers[i], now) {
+			continue
+		}
+		users = append(users, generator.ProbeUser{Tag: generator.ProbeUserTag(probers[i].ID), UUID: probers[i].ProxyUUID})
+	}
+	return users
+}
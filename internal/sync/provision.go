@@ -0,0 +1,54 @@
+package sync
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/wangn9900/StealthForward/internal/database"
+	"github.com/wangn9900/StealthForward/internal/models"
+	"github.com/wangn9900/StealthForward/internal/remote"
+)
+
+var (
+	ErrEntryNoIP   = errors.New("node has no IP, please provision it first")
+	ErrNoSSHKey    = errors.New("no SSH provisioning key found, please add one in settings")
+	ErrNoPublicURL = errors.New("controller public url is not configured")
+)
+
+// ReprovisionEntry 通过 SSH 在入口上重新执行初始化 (BBR + 对接)，controllerURL 为 Agent 回连的主控地址。
+// 初始化在后台执行，进度见中转机 /var/log/stealth-init.log
+func ReprovisionEntry(entry models.EntryNode, controllerURL string) error {
+	if entry.IP == "" {
+		return ErrEntryNoIP
+	}
+	if controllerURL == "" {
+		return ErrNoPublicURL
+	}
+	var sshKey models.SSHKey
+	if err := database.DB.First(&sshKey).Error; err != nil {
+		return ErrNoSSHKey
+	}
+
+	// 鉴权 Token
+	adminToken := os.Getenv("STEALTH_ADMIN_TOKEN")
+	installCmd := fmt.Sprintf(
+		"export CTRL_ADDR='%s' && export NODE_ID='%d' && export CTRL_TOKEN='%s' && export CTRL_DOMAIN='%s' && "+
+			"curl -fsSL https://raw.githubusercontent.com/wangn9900/StealthForward/main/scripts/install.sh | bash -s -- 2 >> /var/log/stealth-init.log 2>&1",
+		controllerURL, entry.ID, adminToken, entry.Domain,
+	)
+
+	go func() {
+		cfg := remote.ProvisionConfig{
+			Host:       entry.IP,
+			Port:       22,
+			User:       sshKey.User,
+			PrivateKey: sshKey.KeyContent,
+			AgentCmd:   installCmd,
+		}
+		if err := remote.RunProvisioning(cfg); err != nil {
+			fmt.Printf("[Provision] Failed for node %d: %v\n", entry.ID, err)
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,277 @@
+package sync
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/wangn9900/StealthForward/internal/database"
+	"github.com/wangn9900/StealthForward/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const defaultBillingDay = 1
+
+// quotaMu 串行化配额检查 (定时任务与接口触发的检查)
+var quotaMu sync.Mutex
+
+// quotaScopeColumns 配额作用对象 -> 流量历史中的列
+var quotaScopeColumns = map[string]string{
+	models.QuotaScopeUser:  "v2board_uid",
+	models.QuotaScopeEntry: "entry_node_id",
+	models.QuotaScopeExit:  "exit_node_id",
+}
+
+// ValidateQuota 校验配额设置
+func ValidateQuota(q models.TrafficQuota) error {
+	if _, ok := quotaScopeColumns[q.Scope]; !ok {
+		return fmt.Errorf("unknown scope: %s", q.Scope)
+	}
+	if q.TargetID == 0 {
+		return fmt.Errorf("target_id is required")
+	}
+	if q.LimitBytes <= 0 {
+		return fmt.Errorf("limit_bytes must be positive")
+	}
+	switch q.Action {
+	case models.QuotaActionWarn, models.QuotaActionSuspend:
+	case models.QuotaActionThrottle:
+		if q.ThrottleMbps <= 0 {
+			return fmt.Errorf("throttle_mbps must be positive")
+		}
+	default:
+		return fmt.Errorf("unknown action: %s", q.Action)
+	}
+	if q.BillingDay < 0 || q.BillingDay > 28 {
+		return fmt.Errorf("billing_day must be between 0 and 28 (0 = use the quota.billing_day setting)")
+	}
+	return nil
+}
+
+// billingPeriodStart 返回 now 所在计费周期的起点 (loc 时区的计费日零点，UTC 表示)
+func billingPeriodStart(now time.Time, day int, loc *time.Location) time.Time {
+	if day < 1 || day > 28 {
+		day = defaultBillingDay
+	}
+	local := now.In(loc)
+	start := time.Date(local.Year(), local.Month(), day, 0, 0, 0, 0, loc)
+	if local.Before(start) {
+		start = start.AddDate(0, -1, 0)
+	}
+	return start.UTC()
+}
+
+// quotaBillingDay 配额生效的计费日
+func quotaBillingDay(q models.TrafficQuota) int {
+	if q.BillingDay > 0 {
+		return q.BillingDay
+	}
+	return settingInt(models.ConfigKeyQuotaBillingDay, defaultBillingDay)
+}
+
+// quotaUsage 统计配额对象自周期起点以来的流量 (取天级历史，周期起点与天桶对齐)
+func quotaUsage(q models.TrafficQuota, since time.Time) int64 {
+	var total int64
+	database.DB.Model(&models.TrafficBucket{}).
+		Select("COALESCE(SUM(upload + download), 0)").
+		Where("granularity = ? AND bucket_start >= ? AND "+quotaScopeColumns[q.Scope]+" = ?",
+			models.TrafficGranularityDay, since, q.TargetID).
+		Scan(&total)
+	return total
+}
+
+// CheckQuotas 立即落库流量历史并检查配额 (配额增改后调用)
+func CheckQuotas() {
+	flushTrafficHistory()
+	checkQuotas(time.Now())
+}
+
+// checkQuotas 检查所有配额：跨周期时重置并解除暂停，超额时执行动作
+// 在流量历史落库之后调用，保证用量包含最近一分钟的流量
+func checkQuotas(now time.Time) {
+	quotaMu.Lock()
+	defer quotaMu.Unlock()
+
+	var quotas []models.TrafficQuota
+	database.DB.Where("enabled = ?", true).Find(&quotas)
+
+	changed, lifted := false, false
+	for i := range quotas {
+		q := &quotas[i]
+		start := billingPeriodStart(now, quotaBillingDay(*q), time.Local)
+		if !q.PeriodStart.Equal(start) {
+			if q.Triggered {
+				log.Printf("[Quota] 配额 #%d (%s #%d) 进入新计费周期，已重置", q.ID, q.Scope, q.TargetID)
+				lifted = liftQuota(q.ID) || lifted
+			}
+			q.PeriodStart = start
+			q.Triggered = false
+			q.TriggeredAt = nil
+		}
+
+		q.UsedBytes = quotaUsage(*q, start)
+		q.CheckedAt = now
+
+		switch {
+		case !q.Triggered && q.UsedBytes >= q.LimitBytes:
+			q.Triggered = true
+			triggeredAt := now
+			q.TriggeredAt = &triggeredAt
+			changed = enforceQuota(*q) || changed
+		case q.Triggered && q.UsedBytes < q.LimitBytes:
+			// 管理员调高了额度，撤销已执行的动作
+			log.Printf("[Quota] 配额 #%d (%s #%d) 额度已调高，解除限制", q.ID, q.Scope, q.TargetID)
+			q.Triggered = false
+			q.TriggeredAt = nil
+			lifted = liftQuota(q.ID) || lifted
+		}
+
+		if err := database.DB.Save(q).Error; err != nil {
+			log.Printf("[Quota] 保存配额 #%d 状态失败: %v", q.ID, err)
+		}
+	}
+
+	if lifted {
+		// 解除配额暂停前，仍超出云流量额度的入口先补上额度暂停
+		CheckBandwidthAllowances()
+	}
+	if changed || lifted {
+		ApplySuspensions()
+	}
+}
+
+// enforceQuota 执行超额动作，返回是否需要刷新规则
+func enforceQuota(q models.TrafficQuota) bool {
+	usage := fmt.Sprintf("%s / %s", FormatBytes(q.UsedBytes), FormatBytes(q.LimitBytes))
+	switch q.Action {
+	case models.QuotaActionWarn:
+		log.Printf("!!!! [Quota] %s #%d 本周期流量已超额 (%s)", q.Scope, q.TargetID, usage)
+	case models.QuotaActionThrottle:
+		log.Printf("!!!! [Quota] %s #%d 本周期流量已超额 (%s)，限速 %d Mbps", q.Scope, q.TargetID, usage, q.ThrottleMbps)
+	case models.QuotaActionSuspend:
+		log.Printf("!!!! [Quota] %s #%d 本周期流量已超额 (%s)，已暂停", q.Scope, q.TargetID, usage)
+		suspension := models.Suspension{
+			Scope:    q.Scope,
+			TargetID: q.TargetID,
+			QuotaID:  q.ID,
+			Source:   models.SuspensionSourceQuota,
+			Reason:   fmt.Sprintf("quota #%d exceeded: %s", q.ID, usage),
+		}
+		// 已有暂停 (手动或其他配额) 时保留原记录
+		result := database.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&suspension)
+		return result.Error == nil && result.RowsAffected > 0
+	}
+	return false
+}
+
+// liftQuota 解除由配额触发的暂停，返回是否有暂停被解除
+func liftQuota(quotaID uint) bool {
+	result := database.DB.Where("quota_id = ?", quotaID).Delete(&models.Suspension{})
+	return result.RowsAffected > 0
+}
+
+// LiftQuota 删除或停用配额时解除其暂停
+func LiftQuota(quotaID uint) {
+	if liftQuota(quotaID) {
+		CheckBandwidthAllowances() // 仍超出云流量额度的入口补上额度暂停
+		ApplySuspensions()
+	}
+}
+
+// suspensionSet 当前生效的暂停
+type suspensionSet map[string]map[uint]bool
+
+// loadSuspensions 读取所有暂停
+func loadSuspensions(db *gorm.DB) suspensionSet {
+	var suspensions []models.Suspension
+	db.Find(&suspensions)
+	set := make(suspensionSet)
+	for _, s := range suspensions {
+		if set[s.Scope] == nil {
+			set[s.Scope] = make(map[uint]bool)
+		}
+		set[s.Scope][s.TargetID] = true
+	}
+	return set
+}
+
+// blocks 判断规则是否被暂停 (用户、入口或落地任一被暂停)
+func (s suspensionSet) blocks(entryID, exitID, uid uint) bool {
+	return s[models.QuotaScopeEntry][entryID] || s[models.QuotaScopeExit][exitID] ||
+		(uid != 0 && s[models.QuotaScopeUser][uid])
+}
+
+// ApplySuspensions 按暂停表刷新所有规则的暂停标记
+// 只改写 Suspended，不触碰 Enabled，手动停用的规则在解除暂停后依然保持停用
+func ApplySuspensions() {
+	set := loadSuspensions(database.DB)
+	var rules []models.ForwardingRule
+	database.DB.Find(&rules)
+
+	var suspend, resume []uint
+	for _, rule := range rules {
+		want := set.blocks(rule.EntryNodeID, rule.ExitNodeID, rule.V2boardUID)
+		if want == rule.Suspended {
+			continue
+		}
+		if want {
+			suspend = append(suspend, rule.ID)
+		} else {
+			resume = append(resume, rule.ID)
+		}
+	}
+	if len(suspend) > 0 {
+		database.DB.Model(&models.ForwardingRule{}).Where("id IN ?", suspend).Update("suspended", true)
+	}
+	if len(resume) > 0 {
+		database.DB.Model(&models.ForwardingRule{}).Where("id IN ?", resume).Update("suspended", false)
+	}
+	if len(suspend) > 0 || len(resume) > 0 {
+		log.Printf("[Quota] 规则暂停状态已更新: 暂停 %d 条，恢复 %d 条", len(suspend), len(resume))
+	}
+}
+
+// ThrottlesForEntry 返回入口下需要限速的用户标签 -> 限速 (字节/秒)
+// 同一规则命中多个限速配额 (用户/入口/落地) 时取最低值
+func ThrottlesForEntry(entryID uint) map[string]int64 {
+	var quotas []models.TrafficQuota
+	database.DB.Where("enabled = ? AND triggered = ? AND action = ?", true, true, models.QuotaActionThrottle).Find(&quotas)
+	if len(quotas) == 0 {
+		return nil
+	}
+	limits := make(map[string]map[uint]int64)
+	for _, q := range quotas {
+		if limits[q.Scope] == nil {
+			limits[q.Scope] = make(map[uint]int64)
+		}
+		rate := int64(q.ThrottleMbps) * 1000 * 1000 / 8
+		if current, ok := limits[q.Scope][q.TargetID]; !ok || rate < current {
+			limits[q.Scope][q.TargetID] = rate
+		}
+	}
+
+	var rules []models.ForwardingRule
+	database.DB.Where("entry_node_id = ?", entryID).Find(&rules)
+	throttles := make(map[string]int64)
+	for _, rule := range rules {
+		var rate int64
+		for _, candidate := range []struct {
+			scope string
+			id    uint
+		}{
+			{models.QuotaScopeEntry, rule.EntryNodeID},
+			{models.QuotaScopeExit, rule.ExitNodeID},
+			{models.QuotaScopeUser, rule.V2boardUID},
+		} {
+			if limit, ok := limits[candidate.scope][candidate.id]; ok && candidate.id != 0 && (rate == 0 || limit < rate) {
+				rate = limit
+			}
+		}
+		if rate > 0 {
+			throttles[rule.UserEmail] = rate
+		}
+	}
+	return throttles
+}
@@ -0,0 +1,373 @@
+package sync
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/wangn9900/StealthForward/internal/database"
+	"github.com/wangn9900/StealthForward/internal/generator"
+	"github.com/wangn9900/StealthForward/internal/models"
+)
+
+const (
+	// defaultReachWindow 可达性矩阵默认的统计窗口
+	defaultReachWindow = 30 * time.Minute
+	// reachBlockedAfter 连续失败多少轮判定为封锁
+	reachBlockedAfter = 3
+	// reachFlapTransitions 窗口内成功/失败切换多少次判定为抖动
+	reachFlapTransitions = 3
+)
+
+// ReachabilityTargets 列出所有入口的监听端口，供探测机检测。
+// 出站使用该探测机自己的代理凭证；当天代理流量超出上限时只下发端口 (仅做握手探测)
+func ReachabilityTargets(p *models.Prober) []models.ReachabilityTarget {
+	probeUserID := p.ProxyUUID
+	if !proberWithinTraffic(p, time.Now()) {
+		probeUserID = ""
+	}
+	var entries []models.EntryNode
+	database.DB.Order("id").Find(&entries)
+	var mappings []models.NodeMapping
+	database.DB.Order("id").Find(&mappings)
+	byEntry := make(map[uint][]models.NodeMapping)
+	for _, m := range mappings {
+		byEntry[m.EntryNodeID] = append(byEntry[m.EntryNodeID], m)
+	}
+
+	targets := []models.ReachabilityTarget{}
+	for i := range entries {
+		targets = append(targets, generator.ReachabilityTargets(&entries[i], byEntry[entries[i].ID], probeUserID)...)
+	}
+	return targets
+}
+
+// reachLabel 由运营商与地区组成探测标签
+func reachLabel(isp, region string) string {
+	isp = strings.TrimSpace(isp)
+	region = strings.TrimSpace(region)
+	if isp == "" {
+		isp = "unknown"
+	}
+	if region == "" {
+		region = "unknown"
+	}
+	return isp + "/" + region
+}
+
+// RecordReachability 记录探测机上报的一轮结果，并检查各入口端口的状态变化
+func RecordReachability(report models.ReachabilityReport) (int, error) {
+	label := reachLabel(report.ISP, report.Region)
+	probedAt := time.Now()
+	if report.ProbedAt > 0 {
+		if t := time.Unix(report.ProbedAt, 0); t.Sub(probedAt).Abs() < 10*time.Minute {
+			probedAt = t
+		}
+	}
+
+	var entryIDs []uint
+	database.DB.Model(&models.EntryNode{}).Pluck("id", &entryIDs)
+	known := make(map[uint]bool, len(entryIDs))
+	for _, id := range entryIDs {
+		known[id] = true
+	}
+
+	var rows []models.ReachabilityProbe
+	for _, r := range report.Results {
+		if !known[r.EntryNodeID] || r.Port <= 0 {
+			continue
+		}
+		rows = append(rows, models.ReachabilityProbe{
+			Prober:      report.Prober,
+			Label:       label,
+			EntryNodeID: r.EntryNodeID,
+			Port:        r.Port,
+			TCPOK:       r.TCPOK,
+			TCPMs:       r.TCPMs,
+			TLSTested:   r.TLSTested,
+			TLSOK:       r.TLSTested && r.TLSOK,
+			TLSMs:       r.TLSMs,
+			ProxyTested: r.ProxyTested,
+			ProxyOK:     r.ProxyTested && r.ProxyOK,
+			ProxyMs:     r.ProxyMs,
+			Error:       r.Error,
+			ProbedAt:    probedAt,
+		})
+	}
+	if len(rows) == 0 {
+		return 0, nil
+	}
+	if err := database.DB.CreateInBatches(&rows, 200).Error; err != nil {
+		return 0, err
+	}
+
+	for _, row := range rows {
+		updateReachState(label, row.EntryNodeID, row.Port, time.Now())
+	}
+	pruneReachability(probedAt)
+	return len(rows), nil
+}
+
+// reachProbeOK 一次探测是否完全成功 (TCP、TLS 与代理请求均通过)
+func reachProbeOK(p models.ReachabilityProbe) bool {
+	return p.TCPOK && (!p.TLSTested || p.TLSOK) && (!p.ProxyTested || p.ProxyOK)
+}
+
+// reachFailStage 一次失败探测所处的阶段
+func reachFailStage(p models.ReachabilityProbe) string {
+	switch {
+	case !p.TCPOK:
+		return "tcp"
+	case p.TLSTested && !p.TLSOK:
+		return "tls"
+	case p.ProxyTested && !p.ProxyOK:
+		return "proxy"
+	}
+	return ""
+}
+
+// ReachCell 可达性矩阵的一格 (探测标签 -> 入口端口)
+type ReachCell struct {
+	Label        string    `json:"label"`
+	EntryNodeID  uint      `json:"entry_node_id"`
+	Port         int       `json:"port"`
+	Samples      int       `json:"samples"`
+	TCPSuccess   float64   `json:"tcp_success"`   // 0-1
+	TLSSuccess   float64   `json:"tls_success"`   // 0-1，-1 表示未测试
+	ProxySuccess float64   `json:"proxy_success"` // 0-1，-1 表示未测试
+	TCPMs        float64   `json:"tcp_ms"`        // 成功样本的平均耗时
+	TLSMs        float64   `json:"tls_ms"`
+	ProxyMs      float64   `json:"proxy_ms"`
+	Transitions  int       `json:"transitions"` // 窗口内成功/失败切换次数
+	Status       string    `json:"status"`
+	BlockedAt    string    `json:"blocked_at,omitempty"` // 最近一次失败的阶段: tcp, tls, proxy
+	LastProbedAt time.Time `json:"last_probed_at"`
+	LastError    string    `json:"last_error"`
+}
+
+// summarizeReach 汇总一格内按时间升序排列的探测结果
+func summarizeReach(probes []models.ReachabilityProbe) ReachCell {
+	cell := ReachCell{Status: models.ReachabilityUnknown, TLSSuccess: -1, ProxySuccess: -1}
+	if len(probes) == 0 {
+		return cell
+	}
+	first := probes[0]
+	cell.Label, cell.EntryNodeID, cell.Port = first.Label, first.EntryNodeID, first.Port
+
+	var tcpOK, tlsTested, tlsOK, proxyTested, proxyOK int
+	var tcpSum, tlsSum, proxySum float64
+	for i, p := range probes {
+		cell.Samples++
+		if p.TCPOK {
+			tcpOK++
+			tcpSum += p.TCPMs
+		}
+		if p.TLSTested {
+			tlsTested++
+			if p.TLSOK {
+				tlsOK++
+				tlsSum += p.TLSMs
+			}
+		}
+		if p.ProxyTested {
+			proxyTested++
+			if p.ProxyOK {
+				proxyOK++
+				proxySum += p.ProxyMs
+			}
+		}
+		if i > 0 && reachProbeOK(p) != reachProbeOK(probes[i-1]) {
+			cell.Transitions++
+		}
+	}
+	cell.TCPSuccess = float64(tcpOK) / float64(cell.Samples)
+	if tcpOK > 0 {
+		cell.TCPMs = tcpSum / float64(tcpOK)
+	}
+	if tlsTested > 0 {
+		cell.TLSSuccess = float64(tlsOK) / float64(tlsTested)
+	}
+	if tlsOK > 0 {
+		cell.TLSMs = tlsSum / float64(tlsOK)
+	}
+	if proxyTested > 0 {
+		cell.ProxySuccess = float64(proxyOK) / float64(proxyTested)
+	}
+	if proxyOK > 0 {
+		cell.ProxyMs = proxySum / float64(proxyOK)
+	}
+
+	last := probes[len(probes)-1]
+	cell.LastProbedAt = last.ProbedAt
+	cell.LastError = last.Error
+
+	// 末尾连续失败轮数
+	failStreak := 0
+	for i := len(probes) - 1; i >= 0 && !reachProbeOK(probes[i]); i-- {
+		failStreak++
+	}
+	switch {
+	case failStreak >= reachBlockedAfter:
+		cell.Status = models.ReachabilityBlocked
+	case cell.Transitions >= reachFlapTransitions:
+		cell.Status = models.ReachabilityFlapping
+	case failStreak == 0:
+		cell.Status = models.ReachabilityOK
+	default:
+		cell.Status = models.ReachabilityDegraded
+	}
+	if failStreak > 0 {
+		cell.BlockedAt = reachFailStage(last)
+	}
+	return cell
+}
+
+// updateReachState 重新计算一格的状态，封锁/抖动/恢复时发布事件
+func updateReachState(label string, entryID uint, port int, now time.Time) {
+	var probes []models.ReachabilityProbe
+	database.DB.Where("label = ? AND entry_node_id = ? AND port = ? AND probed_at >= ?", label, entryID, port, now.Add(-defaultReachWindow)).
+		Order("probed_at").Find(&probes)
+	cell := summarizeReach(probes)
+	if cell.Status == models.ReachabilityUnknown {
+		return
+	}
+
+	var state models.ReachabilityState
+	err := database.DB.Where("label = ? AND entry_node_id = ? AND port = ?", label, entryID, port).First(&state).Error
+	if err != nil {
+		state = models.ReachabilityState{Label: label, EntryNodeID: entryID, Port: port, Status: models.ReachabilityUnknown, Since: now}
+	}
+	previous := state.Status
+	// degraded 只是单轮失败，不单独作为状态变化
+	if cell.Status == previous || cell.Status == models.ReachabilityDegraded {
+		if state.ID != 0 && cell.Status == previous && cell.BlockedAt != state.BlockedAt {
+			database.DB.Model(&state).Update("blocked_at", cell.BlockedAt)
+		}
+		return
+	}
+	state.Status = cell.Status
+	state.BlockedAt = cell.BlockedAt
+	state.Since = now
+	database.DB.Save(&state)
+
+	var typ, msg string
+	target := fmt.Sprintf("入口 #%d 端口 %d", entryID, port)
+	switch cell.Status {
+	case models.ReachabilityBlocked:
+		typ = models.EventReachBlocked
+		msg = fmt.Sprintf("%s 在 %s 网络中连续 %d 轮无法访问 (失败阶段: %s)", target, label, reachBlockedAfter, cell.BlockedAt)
+	case models.ReachabilityFlapping:
+		typ = models.EventReachFlapping
+		msg = fmt.Sprintf("%s 在 %s 网络中时通时断 (%v 内切换 %d 次)", target, label, defaultReachWindow, cell.Transitions)
+	case models.ReachabilityOK:
+		// 首次判定为可达不发布事件
+		if previous == models.ReachabilityUnknown {
+			return
+		}
+		typ = models.EventReachRestored
+		msg = fmt.Sprintf("%s 在 %s 网络中已恢复可达 (之前: %s)", target, label, previous)
+	default:
+		return
+	}
+	log.Printf(">>>> [Reachability] %s", msg)
+	PublishEvent(typ, entrySubject(entryID), msg, map[string]interface{}{
+		"entry_id":   entryID,
+		"port":       port,
+		"label":      label,
+		"status":     cell.Status,
+		"previous":   previous,
+		"blocked_at": cell.BlockedAt,
+	})
+}
+
+// pruneReachability 与落地探测共用保留天数，每小时清理一次
+func pruneReachability(now time.Time) {
+	probePruneMu.Lock()
+	if now.Sub(lastReachPrune) < time.Hour {
+		probePruneMu.Unlock()
+		return
+	}
+	lastReachPrune = now
+	probePruneMu.Unlock()
+
+	days := settingInt(models.ConfigKeyProbeRetentionDays, defaultProbeRetentionDays)
+	database.DB.Where("probed_at < ?", now.AddDate(0, 0, -days)).Delete(&models.ReachabilityProbe{})
+}
+
+// ReachMatrix 探测标签 x 入口端口 可达性矩阵
+type ReachMatrix struct {
+	Window  string      `json:"window"`
+	Labels  []string    `json:"labels"`
+	Entries []NamedNode `json:"entries"`
+	Cells   []ReachCell `json:"cells"`
+}
+
+// GetReachabilityMatrix 汇总 window 内的探测结果为可达性矩阵
+func GetReachabilityMatrix(window time.Duration) ReachMatrix {
+	if window <= 0 {
+		window = defaultReachWindow
+	}
+	matrix := ReachMatrix{Window: window.String(), Labels: []string{}, Entries: []NamedNode{}, Cells: []ReachCell{}}
+	database.DB.Model(&models.EntryNode{}).Select("id, name").Order("id").Scan(&matrix.Entries)
+
+	var probes []models.ReachabilityProbe
+	database.DB.Where("probed_at >= ?", time.Now().Add(-window)).Order("probed_at").Find(&probes)
+
+	type cellKey struct {
+		label   string
+		entryID uint
+		port    int
+	}
+	grouped := make(map[cellKey][]models.ReachabilityProbe)
+	var keys []cellKey
+	labels := make(map[string]bool)
+	for _, p := range probes {
+		key := cellKey{p.Label, p.EntryNodeID, p.Port}
+		if _, ok := grouped[key]; !ok {
+			keys = append(keys, key)
+		}
+		grouped[key] = append(grouped[key], p)
+		if !labels[p.Label] {
+			labels[p.Label] = true
+			matrix.Labels = append(matrix.Labels, p.Label)
+		}
+	}
+	sort.Strings(matrix.Labels)
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.label != b.label {
+			return a.label < b.label
+		}
+		if a.entryID != b.entryID {
+			return a.entryID < b.entryID
+		}
+		return a.port < b.port
+	})
+	for _, key := range keys {
+		matrix.Cells = append(matrix.Cells, summarizeReach(grouped[key]))
+	}
+	return matrix
+}
+
+// GetReachabilityHistory 返回可达性探测历史 (按时间倒序)
+func GetReachabilityHistory(label string, entryID uint, since time.Time, limit int) []models.ReachabilityProbe {
+	query := database.DB.Where("probed_at >= ?", since).Order("probed_at DESC").Limit(limit)
+	if label != "" {
+		query = query.Where("label = ?", label)
+	}
+	if entryID > 0 {
+		query = query.Where("entry_node_id = ?", entryID)
+	}
+	probes := []models.ReachabilityProbe{}
+	query.Find(&probes)
+	return probes
+}
+
+// GetReachabilityStates 返回各探测标签 x 入口端口 的当前状态
+func GetReachabilityStates() []models.ReachabilityState {
+	states := []models.ReachabilityState{}
+	database.DB.Order("label, entry_node_id, port").Find(&states)
+	return states
+}
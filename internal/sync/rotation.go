@@ -0,0 +1,82 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/wangn9900/StealthForward/internal/cloud"
+	"github.com/wangn9900/StealthForward/internal/database"
+	"github.com/wangn9900/StealthForward/internal/dns"
+	"github.com/wangn9900/StealthForward/internal/models"
+)
+
+// RotateEntryIP 为入口更换公网 IP，成功后更新入口 IP，并发布 rotation.succeeded / rotation.failed 事件。
+// trigger 标识触发来源 (manual, bandwidth 等)
+func RotateEntryIP(ctx context.Context, entry models.EntryNode, region, instanceID, zoneName, recordName, trigger string) (string, error) {
+	oldIP := entry.IP
+	// 实例只能在其所在的云账号上操作 (未绑定账号时使用单一密钥)
+	var newIP string
+	err := cloud.RunOnAccount(ctx, entry.CloudAccountID, models.CloudAccountOpRotate, region, func(ctx context.Context) error {
+		var err error
+		newIP, err = cloud.RotateIP(ctx, entry.CloudProvider, region, instanceID)
+		return err
+	})
+	if newIP != "" {
+		database.DB.Model(&models.EntryNode{}).Where("id = ?", entry.ID).Update("ip", newIP)
+	}
+	// 子域名解析到新 IP (入口绑定的 DNS 域名，zoneName 不为空时覆盖根域名)
+	if err == nil && recordName != "" {
+		if dnsErr := dns.UpdateEntryRecord(ctx, entry, zoneName, recordName, newIP); dnsErr != nil {
+			err = fmt.Errorf("ip rotated to %s but dns update failed: %v", newIP, dnsErr)
+		}
+	}
+
+	data := map[string]interface{}{
+		"entry_id":    entry.ID,
+		"provider":    entry.CloudProvider,
+		"account_id":  entry.CloudAccountID,
+		"region":      region,
+		"instance_id": instanceID,
+		"old_ip":      oldIP,
+		"new_ip":      newIP,
+		"trigger":     trigger,
+	}
+	if err != nil {
+		data["error"] = err.Error()
+		log.Printf("[Rotate] 入口 #%d (%s) 换 IP 失败 (%s): %v", entry.ID, entry.Name, trigger, err)
+		PublishEvent(models.EventRotationFailed, entrySubject(entry.ID),
+			fmt.Sprintf("入口 #%d (%s) 换 IP 失败: %v", entry.ID, entry.Name, err), data)
+		return newIP, err
+	}
+	log.Printf("[Rotate] 入口 #%d (%s) IP %s -> %s (%s)", entry.ID, entry.Name, oldIP, newIP, trigger)
+	PublishEvent(models.EventRotationSucceeded, entrySubject(entry.ID),
+		fmt.Sprintf("入口 #%d (%s) IP %s -> %s", entry.ID, entry.Name, oldIP, newIP), data)
+	return newIP, nil
+}
+
+// ValidateCloudBinding 校验入口的云平台类型已支持，绑定的 DNS 域名存在，绑定的云账号存在且与云平台类型一致
+func ValidateCloudBinding(entry models.EntryNode) error {
+	if entry.CloudProvider != "" && entry.CloudProvider != "none" {
+		if _, err := cloud.GetProvider(entry.CloudProvider); err != nil {
+			return err
+		}
+	}
+	if entry.DNSZoneID != 0 {
+		var count int64
+		if database.DB.Model(&models.DNSZone{}).Where("id = ?", entry.DNSZoneID).Count(&count); count == 0 {
+			return fmt.Errorf("dns zone #%d not found", entry.DNSZoneID)
+		}
+	}
+	if entry.CloudAccountID == 0 {
+		return nil
+	}
+	var account models.CloudAccount
+	if err := database.DB.First(&account, entry.CloudAccountID).Error; err != nil {
+		return fmt.Errorf("cloud account #%d not found", entry.CloudAccountID)
+	}
+	if want := cloud.AccountProvider(entry.CloudProvider); account.Provider != want {
+		return fmt.Errorf("cloud account #%d is a %s account, entry cloud provider %q needs %s", account.ID, account.Provider, entry.CloudProvider, want)
+	}
+	return nil
+}
@@ -0,0 +1,211 @@
+package sync
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/wangn9900/StealthForward/internal/database"
+	"github.com/wangn9900/StealthForward/internal/models"
+)
+
+const (
+	defaultSyncInterval = 2 * time.Minute
+	minSyncInterval     = 30 * time.Second
+	maxSyncBackoff      = 30 * time.Minute
+
+	// fullReconcileInterval 面板数据未变化时，最长多久仍强制做一次完整比对 (修复本地被手动改动的规则)
+	fullReconcileInterval = 30 * time.Minute
+	// scheduleTick 调度器检查到期入口的频率
+	scheduleTick = 10 * time.Second
+)
+
+// entrySyncState 入口的同步调度状态 (仅内存，重启后首轮即完整同步)
+type entrySyncState struct {
+	NextSyncAt   time.Time
+	Failures     int
+	Fingerprint  string // 最近一次成功写库时的面板数据指纹
+	LastFullSync time.Time
+}
+
+// EntrySyncSchedule 对外展示的入口调度状态
+type EntrySyncSchedule struct {
+	EntryNodeID  uint      `json:"entry_node_id"`
+	Interval     int       `json:"interval"` // 当前生效间隔 (秒，含退避)
+	Failures     int       `json:"failures"` // 连续失败次数
+	NextSyncAt   time.Time `json:"next_sync_at"`
+	LastFullSync time.Time `json:"last_full_sync"`
+}
+
+var (
+	stateMu     sync.Mutex
+	entryStates = make(map[uint]*entrySyncState)
+
+	// pendingEntrySyncs 已排队等待执行的即时同步，合并短时间内的重复推送
+	pendingEntrySyncs sync.Map
+)
+
+// StartV2boardSync 启动一个后台任务，按各入口的同步间隔同步用户列表
+func StartV2boardSync() {
+	go func() {
+		// 启动时先同步一次
+		syncDueEntries()
+		ticker := time.NewTicker(scheduleTick)
+		for range ticker.C {
+			syncDueEntries()
+		}
+	}()
+}
+
+// syncInterval 返回入口配置的同步间隔
+func syncInterval(entry models.EntryNode) time.Duration {
+	if entry.SyncInterval <= 0 {
+		return defaultSyncInterval
+	}
+	interval := time.Duration(entry.SyncInterval) * time.Second
+	if interval < minSyncInterval {
+		return minSyncInterval
+	}
+	return interval
+}
+
+// backoffInterval 连续失败时按 2 的指数退避，最长 maxSyncBackoff
+func backoffInterval(base time.Duration, failures int) time.Duration {
+	if failures > 10 {
+		failures = 10
+	}
+	interval := base << failures
+	if interval > maxSyncBackoff {
+		return maxSyncBackoff
+	}
+	return interval
+}
+
+// entryState 获取入口的调度状态，调用方需持有 stateMu
+func entryState(entryID uint) *entrySyncState {
+	st, ok := entryStates[entryID]
+	if !ok {
+		st = &entrySyncState{}
+		entryStates[entryID] = st
+	}
+	return st
+}
+
+// syncDueEntries 同步所有已到期的入口
+func syncDueEntries() {
+	syncMu.Lock()
+	defer syncMu.Unlock()
+
+	var entries []models.EntryNode
+	database.DB.Where("v2board_url <> '' AND v2board_key <> ''").Find(&entries)
+
+	now := time.Now()
+	configured := make(map[uint]bool)
+	var due []models.EntryNode
+	stateMu.Lock()
+	for _, entry := range entries {
+		configured[entry.ID] = true
+		if !now.Before(entryState(entry.ID).NextSyncAt) {
+			due = append(due, entry)
+		}
+	}
+	// 入口被删除或取消对接后，清理其调度状态
+	for id := range entryStates {
+		if !configured[id] {
+			delete(entryStates, id)
+		}
+	}
+	stateMu.Unlock()
+
+	if len(due) == 0 {
+		return
+	}
+
+	syncRunning.Store(true)
+	defer syncRunning.Store(false)
+	for _, entry := range due {
+		runEntrySync(entry, SyncTriggerTimer)
+	}
+	pruneSyncHistory()
+}
+
+// syncAllNodes 立即同步所有入口 (强制完整比对)
+func syncAllNodes(trigger string) {
+	syncMu.Lock()
+	defer syncMu.Unlock()
+	syncRunning.Store(true)
+	defer syncRunning.Store(false)
+
+	var entries []models.EntryNode
+	database.DB.Where("v2board_url <> '' AND v2board_key <> ''").Find(&entries)
+
+	for _, entry := range entries {
+		runEntrySync(entry, trigger)
+	}
+
+	pruneSyncHistory()
+}
+
+// runEntrySync 同步单个入口并安排下一次同步时间，调用方需持有 syncMu
+func runEntrySync(entry models.EntryNode, trigger string) {
+	_, err := syncEntry(entry, trigger, false)
+
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	st := entryState(entry.ID)
+	if err != nil {
+		st.Failures++
+		next := backoffInterval(syncInterval(entry), st.Failures)
+		st.NextSyncAt = time.Now().Add(next)
+		log.Printf("!!!! [D-Sync] 入口 #%d 同步失败 (连续 %d 次)，%v 后重试", entry.ID, st.Failures, next)
+		return
+	}
+	st.Failures = 0
+	st.NextSyncAt = time.Now().Add(syncInterval(entry))
+}
+
+// SyncEntryNow 立即同步指定入口 (用于面板 Webhook 推送)
+// 同一入口已有排队中的同步时直接合并
+func SyncEntryNow(entryID uint, trigger string) {
+	if _, queued := pendingEntrySyncs.LoadOrStore(entryID, true); queued {
+		return
+	}
+	go func() {
+		syncMu.Lock()
+		defer syncMu.Unlock()
+		pendingEntrySyncs.Delete(entryID)
+		syncRunning.Store(true)
+		defer syncRunning.Store(false)
+
+		var entry models.EntryNode
+		if err := database.DB.Where("v2board_url <> '' AND v2board_key <> ''").First(&entry, entryID).Error; err != nil {
+			return
+		}
+		runEntrySync(entry, trigger)
+	}()
+}
+
+// getSyncSchedules 返回各入口的调度状态
+func getSyncSchedules() []EntrySyncSchedule {
+	var entries []models.EntryNode
+	database.DB.Where("v2board_url <> '' AND v2board_key <> ''").Order("id").Find(&entries)
+
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	schedules := []EntrySyncSchedule{}
+	for _, entry := range entries {
+		st := entryState(entry.ID)
+		interval := syncInterval(entry)
+		if st.Failures > 0 {
+			interval = backoffInterval(interval, st.Failures)
+		}
+		schedules = append(schedules, EntrySyncSchedule{
+			EntryNodeID:  entry.ID,
+			Interval:     int(interval / time.Second),
+			Failures:     st.Failures,
+			NextSyncAt:   st.NextSyncAt,
+			LastFullSync: st.LastFullSync,
+		})
+	}
+	return schedules
+}
@@ -7,20 +7,17 @@ import (
 	"io"
 	"log"
 	"net/http"
-	"strconv"
-	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/wangn9900/StealthForward/internal/database"
+	"github.com/wangn9900/StealthForward/internal/generator"
 	"github.com/wangn9900/StealthForward/internal/models"
 	"gorm.io/gorm"
 )
 
 var (
-	// userTrafficMap stores UID -> [Upload, Download] (Deltas for V2Board sync)
-	userTrafficMap sync.Map
 	// totalTrafficMap stores Tag/UserEmail -> [TotalUpload, TotalDownload] (Lifetime stats for UI)
 	totalTrafficMap sync.Map
 	// activeUsers stores UserEmail (Tag) -> LastSeenTime
@@ -39,6 +36,20 @@ var (
 	syncedExitLock    sync.RWMutex
 )
 
+// onlineUserWindow 用户最近一次上报流量在该时间内视为在线
+const onlineUserWindow = 3 * time.Minute
+
+// entryOnlineUsers 入口当前的在线用户数
+func entryOnlineUsers(entry models.EntryNode, now time.Time) int {
+	online := 0
+	for _, account := range entryAccounts(entry) {
+		if lastSeen, ok := activeUsers.Load(account.Tag); ok && now.Sub(lastSeen.(time.Time)) < onlineUserWindow {
+			online++
+		}
+	}
+	return online
+}
+
 // InitTrafficFromDB 从数据库加载历史流量统计
 func InitTrafficFromDB() {
 	log.Println("[Traffic] Loading traffic stats from database...")
@@ -55,7 +66,7 @@ func InitTrafficFromDB() {
 	database.DB.Find(&entries)
 	for _, entry := range entries {
 		if entry.TotalUpload > 0 || entry.TotalDownload > 0 {
-			log.Printf("[Traffic] Entry #%d persistent: ↑%s ↓%s", entry.ID, formatBytes(entry.TotalUpload), formatBytes(entry.TotalDownload))
+			log.Printf("[Traffic] Entry #%d persistent: ↑%s ↓%s", entry.ID, FormatBytes(entry.TotalUpload), FormatBytes(entry.TotalDownload))
 		}
 	}
 
@@ -71,45 +82,95 @@ func InitTrafficFromDB() {
 }
 
 // CollectTraffic 接收来自 Agent 的流量快照
-func CollectTraffic(report models.NodeTrafficReport) {
+// 用户流量先写入发件箱再返回，返回错误时 Agent 会保留数据并在下个周期重报
+// 返回该 Agent 实例已入账的最大序号，Agent 据此丢弃已确认的批次
+func CollectTraffic(report models.NodeTrafficReport) (uint64, error) {
+	observeAgentReport(report.NodeID, time.Now())
+
+	type accepted struct {
+		account  indexedAccount
+		upload   int64
+		download int64
+		probe    bool // 探测机流量：计入入口总量、流量历史与入口配额，不计在线人数，不同步到面板
+	}
+	var records []models.TrafficOutbox
+	var accounts []accepted
 	for _, t := range report.Traffic {
-		// 精确匹配：必须是这个入口下的这个特定标签 (例如 n21-ed296cba)
-		var rule models.ForwardingRule
-		err := database.DB.Where("user_email = ? AND entry_node_id = ?", t.UserEmail, report.NodeID).First(&rule).Error
-		if err != nil {
-			// 兜底：如果完全匹配失败，尝试去掉前缀匹配 UUID (兼容旧版或特殊标签)
-			lookupUUID := t.UserEmail
-			if parts := strings.Split(t.UserEmail, "-"); len(parts) > 1 {
-				lookupUUID = parts[len(parts)-1]
-			}
-			err = database.DB.Where("user_id = ? AND entry_node_id = ?", lookupUUID, report.NodeID).First(&rule).Error
-			if err != nil {
-				log.Printf("[Traffic] 无法定位用户规则: %s (Entry #%d)", t.UserEmail, report.NodeID)
-				continue
-			}
+		if _, ok := generator.ProberIDFromTag(t.UserEmail); ok {
+			account := indexedAccount{trafficAccount: trafficAccount{Tag: t.UserEmail}}
+			accounts = append(accounts, accepted{account: account, upload: t.Upload, download: t.Download, probe: true})
+			continue
+		}
+		// 通过内存索引定位计费账户 (标签全局唯一，不再解析标签字符串，也不逐用户查库)
+		account, ok := lookupAccount(report.NodeID, t.UserEmail)
+		if !ok {
+			log.Printf("[Traffic] 无法定位用户身份: %s (Entry #%d)", t.UserEmail, report.NodeID)
+			continue
 		}
 
-		if rule.V2boardUID == 0 {
+		if account.UID == 0 {
 			continue
 		}
+		accounts = append(accounts, accepted{account: account, upload: t.Upload, download: t.Download})
 
+		if t.Upload > 0 || t.Download > 0 {
+			records = append(records, models.TrafficOutbox{
+				EntryNodeID:   report.NodeID,
+				V2boardNodeID: account.NodeID,
+				V2boardUID:    account.UID,
+				Tag:           account.Tag,
+				Upload:        t.Upload,
+				Download:      t.Download,
+			})
+		}
+	}
+
+	// 1. 增量写入发件箱 (用于 V2Board 同步，推送成功后出队)，重复批次直接确认
+	ackedSeq, duplicate, err := applyTrafficBatch(report, records)
+	if err != nil {
+		log.Printf("[Traffic] 流量写入发件箱失败 (Entry #%d): %v", report.NodeID, err)
+		return 0, err
+	}
+	if duplicate {
+		log.Printf("[Traffic] 忽略重复上报: Entry #%d 实例 %s 序号 %d (已入账至 %d)", report.NodeID, report.InstanceID, report.Seq, ackedSeq)
+	}
+
+	// 内置内核会按 inbound / outbound 实测流量 (含未匹配用户的连接)，此时 入口/落地 总量以实测为准
+	measured := len(report.Inbounds) > 0 || len(report.Outbounds) > 0
+	if measured && !duplicate {
+		addMeasuredAggregates(report)
+	}
+
+	now := time.Now()
+	if !duplicate {
+		active := 0
+		for _, a := range accounts {
+			if !a.probe && (a.upload > 0 || a.download > 0) {
+				active++
+			}
+		}
+		noteEntryTraffic(report.NodeID, active, now)
+	}
+	for _, a := range accounts {
 		// 记录在线状态 (使用 Tag 而不是 UID，以便区分不同节点的在线状态)
-		activeUsers.Store(rule.UserEmail, time.Now())
+		if !a.probe {
+			activeUsers.Store(a.account.Tag, now)
+		}
 
-		// 累加流量 (增量)
-		if t.Upload > 0 || t.Download > 0 {
-			// 1. 记录增量 (用于 V2Board 同步, 同步后清零)
-			val, _ := userTrafficMap.LoadOrStore(t.UserEmail, &[2]int64{0, 0})
-			traffic := val.(*[2]int64)
-			atomic.AddInt64(&traffic[0], t.Upload)
-			atomic.AddInt64(&traffic[1], t.Download)
-
-			// 2. 记录总量 (用于 UI 展示, 不清零)
-			totVal, _ := totalTrafficMap.LoadOrStore(t.UserEmail, &[2]int64{0, 0})
+		// 2. 记录总量 (用于 UI 展示, 不清零)，同时累加 入口/落地 维度的聚合
+		if !duplicate && (a.upload > 0 || a.download > 0) {
+			totVal, _ := totalTrafficMap.LoadOrStore(a.account.Tag, &[2]int64{0, 0})
 			totalTraffic := totVal.(*[2]int64)
-			atomic.AddInt64(&totalTraffic[0], t.Upload)
-			atomic.AddInt64(&totalTraffic[1], t.Download)
-			// log.Printf("[Debug] 收到用户 %s (UID %d) 流量: Up %d, Down %d", t.UserEmail, rule.V2boardUID, t.Upload, t.Download)
+			atomic.AddInt64(&totalTraffic[0], a.upload)
+			atomic.AddInt64(&totalTraffic[1], a.download)
+
+			if !measured {
+				addAggregate(&entryTrafficMap, report.NodeID, a.upload, a.download)
+				if a.account.ExitNodeID != 0 {
+					addAggregate(&exitTrafficMap, a.account.ExitNodeID, a.upload, a.download)
+				}
+			}
+			recordTrafficHistory(now, report.NodeID, a.account, a.upload, a.download)
 		}
 	}
 	// log.Printf("[Traffic] 收到 Agent 流量汇报: Node %d, 条目数 %d", report.NodeID, len(report.Traffic))
@@ -118,33 +179,15 @@ func CollectTraffic(report models.NodeTrafficReport) {
 	if report.Stats != nil {
 		report.Stats.ReportAt = time.Now().Unix()
 
-		targetID := report.NodeID
-		found := false
-
-		// 调试日志：看看原始上报的是什么
-		// log.Printf("[Traffic-Debug] 原始上报 NodeID: %d", report.NodeID)
-
-		// 1. 尝试直接匹配入口 ID
-		var entry models.EntryNode
-		if err := database.DB.First(&entry, targetID).Error; err == nil {
-			found = true
-		} else {
-			// 2. 尝试匹配入口节点的 v2board_node_id
-			if err := database.DB.Where("v2board_node_id = ?", targetID).First(&entry).Error; err == nil {
-				targetID = entry.ID
-				found = true
-			} else {
-				// 3. 尝试从多端口映射表中找
-				var mapping models.NodeMapping
-				if err := database.DB.Where("v2board_node_id = ?", targetID).First(&mapping).Error; err == nil {
-					targetID = mapping.EntryNodeID
-					found = true
-				}
-			}
+		// 依次尝试匹配 入口 ID、入口的 v2board_node_id、多端口映射表 (均来自内存索引)
+		targetID, found := resolveReportEntry(report.NodeID)
+		if !found {
+			targetID = report.NodeID
 		}
 
 		if found {
 			nodeStatsMap.Store(targetID, report.Stats)
+			recordInterfaceCounters(targetID, report.Stats)
 			// 探针正常映射完全静默，不再打印
 		} else {
 			// 极端情况：完全不认识此 ID，但我们依然存下来，Key 使用上报的原始 ID
@@ -152,6 +195,7 @@ func CollectTraffic(report models.NodeTrafficReport) {
 			log.Printf("[Traffic-Warning] 收到未知节点的探针数据: ID #%d (请检查 Agent 启动参数)", targetID)
 		}
 	}
+	return ackedSeq, nil
 }
 
 // StartTrafficReporting 启动心跳和上报任务
@@ -163,84 +207,52 @@ func StartTrafficReporting() {
 			pushTrafficAndOnlineToV2Board()
 		}
 	}()
+
+	// 流量历史：每分钟落库一次，并按保留期降采样；落库后检查配额、节点计费周期与云流量额度
+	historyTicker := time.NewTicker(1 * time.Minute)
+	go func() {
+		for now := range historyTicker.C {
+			flushTrafficHistory()
+			pruneTrafficHistory(now)
+			checkQuotas(now)
+			checkBillingCycles(now)
+			checkBandwidthAllowances(now)
+		}
+	}()
 }
 
 func pushTrafficAndOnlineToV2Board() {
+	// 兜底重建规则索引，覆盖未显式刷新的写库路径
+	RefreshRuleIndex()
+
 	var entries []models.EntryNode
 	database.DB.Where("v2board_url <> '' AND v2board_key <> ''").Find(&entries)
 
 	now := time.Now()
 	for _, entry := range entries {
-		// 按 V2Board Node ID 分组的 Payloads
-		nodePayloads := make(map[int]map[string][]int64)
-
-		// 事务回滚数据结构：NodeID -> []{UserEmail, Up, Down}
-		// 如果上报失败，我们需要知道把流量退还给谁
-		type trafficTx struct {
-			UserEmail string
-			Up        int64
-			Down      int64
-		}
-		rollbackData := make(map[int][]trafficTx)
-
-		var rules []models.ForwardingRule
-		database.DB.Where("entry_node_id = ?", entry.ID).Find(&rules)
+		// 按 V2Board Node ID 分组的在线用户
+		onlineByNode := make(map[int]map[string]bool)
 
-		for _, rule := range rules {
-			uid := rule.V2boardUID
-			if uid == 0 {
+		for _, account := range entryAccounts(entry) {
+			if account.UID == 0 {
 				continue
 			}
 
-			// 从 UserEmail (标签) 中提取真正的 V2Board 节点 ID
-			// 格式: n20-ed296cba
-			reportingNodeID := entry.V2boardNodeID // 默认值
-			if strings.HasPrefix(rule.UserEmail, "n") && strings.Contains(rule.UserEmail, "-") {
-				idPart := strings.Split(rule.UserEmail, "-")[0][1:] // 拿到 "20"
-				if id, err := strconv.Atoi(idPart); err == nil {
-					reportingNodeID = id
-				}
-			}
-
-			// 初始化该节点的 PayloadMap
-			if _, ok := nodePayloads[reportingNodeID]; !ok {
-				nodePayloads[reportingNodeID] = make(map[string][]int64)
-			}
-
-			// 获取流量增量 (使用 UserEmail 作为 Key)
-			var u, d int64
-			if val, ok := userTrafficMap.Load(rule.UserEmail); ok {
-				traffic := val.(*[2]int64)
-				u = atomic.SwapInt64(&traffic[0], 0)
-				d = atomic.SwapInt64(&traffic[1], 0)
-			}
-
-			// 如果有流量被取出，立即记录到回滚日志，以防发送失败
-			if u > 0 || d > 0 {
-				rollbackData[reportingNodeID] = append(rollbackData[reportingNodeID], trafficTx{
-					UserEmail: rule.UserEmail,
-					Up:        u,
-					Down:      d,
-				})
-			}
-
-			// 判断是否在线
-			isOnline := false
-			// 使用 rule.UserEmail (Tag) 检查在线状态，实现分节点在线统计
-			if lastSeen, ok := activeUsers.Load(rule.UserEmail); ok {
-				if now.Sub(lastSeen.(time.Time)) < 3*time.Minute {
-					isOnline = true
+			// 使用 Tag 检查在线状态，实现分节点在线统计
+			if lastSeen, ok := activeUsers.Load(account.Tag); ok {
+				if now.Sub(lastSeen.(time.Time)) < onlineUserWindow {
+					// 账户所属的 V2Board 节点直接来自身份表
+					if onlineByNode[account.NodeID] == nil {
+						onlineByNode[account.NodeID] = make(map[string]bool)
+					}
+					onlineByNode[account.NodeID][fmt.Sprintf("%d", account.UID)] = true
 				} else {
-					activeUsers.Delete(rule.UserEmail)
+					activeUsers.Delete(account.Tag)
 				}
 			}
-
-			if isOnline || u > 0 || d > 0 {
-				nodePayloads[reportingNodeID][fmt.Sprintf("%d", uid)] = []int64{u, d}
-			}
 		}
 
-		// 确保 Entry 默认节点和 Mapping 节点都有心跳
+		// 确保 Entry 默认节点和 Mapping 节点都有心跳，发件箱中仍有积压的节点也要继续推送
 		var mappings []models.NodeMapping
 		database.DB.Where("entry_node_id = ?", entry.ID).Find(&mappings)
 
@@ -251,11 +263,26 @@ func pushTrafficAndOnlineToV2Board() {
 		for _, m := range mappings {
 			allTargetNodeIDs[m.V2boardNodeID] = true
 		}
+		for _, nodeID := range pendingOutboxNodes(entry.ID) {
+			allTargetNodeIDs[nodeID] = true
+		}
 
 		for nodeID := range allTargetNodeIDs {
-			payload := nodePayloads[nodeID]
-			if payload == nil {
-				payload = make(map[string][]int64)
+			// 从发件箱取出到期的流量，按用户合并
+			records := pendingOutbox(entry.ID, nodeID, now)
+			payload := make(map[string][]int64)
+			for _, r := range records {
+				uid := fmt.Sprintf("%d", r.V2boardUID)
+				if payload[uid] == nil {
+					payload[uid] = []int64{0, 0}
+				}
+				payload[uid][0] += r.Upload
+				payload[uid][1] += r.Download
+			}
+			for uid := range onlineByNode[nodeID] {
+				if payload[uid] == nil {
+					payload[uid] = []int64{0, 0}
+				}
 			}
 
 			nodeType := entry.V2boardType
@@ -276,35 +303,33 @@ func pushTrafficAndOnlineToV2Board() {
 				totalDown += v[1]
 			}
 
+			pushStart := time.Now()
 			err := reportToV2BoardAPIWithID(entry, nodeID, nodeType, payload)
+			metricPushDuration.Observe(time.Since(pushStart).Seconds(), idLabel(entry.ID), idLabel(nodeID))
+			metricPushTotal.Inc(idLabel(entry.ID), idLabel(nodeID), resultLabel(err != nil))
 			if err != nil {
-				log.Printf("[Sync-Error] V2Board 同步失败 (Entry #%d, Node #%d): %v. 正在执行流量回滚...", entry.ID, nodeID, err)
-
-				// --- 核心修复：执行流量回滚 ---
-				if txList, ok := rollbackData[nodeID]; ok {
-					restoredCount := 0
-					for _, tx := range txList {
-						// 将流量原子加回 map
-						val, _ := userTrafficMap.LoadOrStore(tx.UserEmail, &[2]int64{0, 0})
-						traffic := val.(*[2]int64)
-						atomic.AddInt64(&traffic[0], tx.Up)
-						atomic.AddInt64(&traffic[1], tx.Down)
-						restoredCount++
-					}
-					log.Printf("[Sync-Rollback] 已成功回滚 %d 个用户的流量数据，等待下一次重试。", restoredCount)
-				}
-				// ---------------------------
-			} else {
-				// 详尽保留流量日志，方便监控
-				status := "OK"
-				if totalUp+totalDown == 0 {
-					status = "EMPTY" // 高亮显示无流量上报，方便发现断流
-				}
-				log.Printf("[Sync] [%s] Entry #%d -> V2B Node #%d: %d 用户, ↑ %s, ↓ %s",
-					status, entry.ID, nodeID, len(payload), formatBytes(totalUp), formatBytes(totalDown))
+				// 流量保留在发件箱，按退避时间重试
+				log.Printf("[Sync-Error] V2Board 同步失败 (Entry #%d, Node #%d): %v. %d 条流量记录保留在发件箱等待重试", entry.ID, nodeID, err, len(records))
+				markOutboxFailed(records, err, now)
+				continue
+			}
+
+			if err := markOutboxPushed(records, now); err != nil {
+				// 面板已记账但出队失败，下一轮会重复推送，必须显著提示
+				log.Printf("!!!! [Outbox] Entry #%d Node #%d 推送成功但出队失败: %v", entry.ID, nodeID, err)
 			}
+
+			// 详尽保留流量日志，方便监控
+			status := "OK"
+			if totalUp+totalDown == 0 {
+				status = "EMPTY" // 高亮显示无流量上报，方便发现断流
+			}
+			log.Printf("[Sync] [%s] Entry #%d -> V2B Node #%d: %d 用户, ↑ %s, ↓ %s",
+				status, entry.ID, nodeID, len(payload), FormatBytes(totalUp), FormatBytes(totalDown))
 		}
 	}
+
+	pruneOutbox(now)
 }
 
 func reportToV2BoardAPIWithID(entry models.EntryNode, nodeID int, nodeType string, importData map[string][]int64) error {
@@ -347,6 +372,28 @@ func GetTrafficStats() map[string]models.TrafficStat {
 	return stats
 }
 
+// addMeasuredAggregates 按 Agent 实测的 inbound / outbound 流量累加 入口/落地 维度
+// 入口总量取所有 inbound 之和；outbound 按 tag 归属到落地，direct / block 等内置出站不计入落地
+func addMeasuredAggregates(report models.NodeTrafficReport) {
+	var up, down int64
+	for _, t := range report.Inbounds {
+		up += t.Upload
+		down += t.Download
+	}
+	if up > 0 || down > 0 {
+		addAggregate(&entryTrafficMap, report.NodeID, up, down)
+	}
+
+	for _, t := range report.Outbounds {
+		if t.Upload == 0 && t.Download == 0 {
+			continue
+		}
+		if exitID, ok := lookupExitByTag(t.Tag); ok {
+			addAggregate(&exitTrafficMap, exitID, t.Upload, t.Download)
+		}
+	}
+}
+
 // EntryTrafficStats 入口节点流量统计响应结构
 type EntryTrafficStats struct {
 	EntryStats map[uint]models.TrafficStat   `json:"entry_stats"` // entry_id -> traffic
@@ -371,8 +418,11 @@ func GetTrafficStatsByEntry() EntryTrafficStats {
 	})
 
 	// 获取所有用户流量 (内存中的实时数据)
-	userStats := GetTrafficStats()
-	result.UserStats = userStats
+	result.UserStats = GetTrafficStats()
+
+	// 入口/落地维度的内存聚合 (采集时实时累加)
+	entryMem := loadAggregates(&entryTrafficMap)
+	exitMem := loadAggregates(&exitTrafficMap)
 
 	// 从数据库读取持久化的入口节点流量
 	var entries []models.EntryNode
@@ -381,19 +431,8 @@ func GetTrafficStatsByEntry() EntryTrafficStats {
 		dbUp := entry.TotalUpload
 		dbDown := entry.TotalDownload
 
-		// 计算内存中的当前值
-		var memUp, memDown int64
-		// 获取该节点下所有用户的实时流量总和
-		// 优化：这里遍历所有规则可能较慢，但对于一般规模(几千用户)是可以接受的
-		// 如果规模很大，应该在 collect 时维护 node 维度的缓存
-		var rules []models.ForwardingRule
-		database.DB.Where("entry_node_id = ?", entry.ID).Find(&rules)
-		for _, rule := range rules {
-			if stat, ok := userStats[rule.UserEmail]; ok {
-				memUp += stat.Upload
-				memDown += stat.Download
-			}
-		}
+		// 内存中的当前值
+		memUp, memDown := entryMem[entry.ID][0], entryMem[entry.ID][1]
 
 		// 获取上次同步时的值 (Offset)
 		syncedEntryLock.RLock()
@@ -431,15 +470,7 @@ func GetTrafficStatsByEntry() EntryTrafficStats {
 		dbUp := exit.TotalUpload
 		dbDown := exit.TotalDownload
 
-		var memUp, memDown int64
-		var rules []models.ForwardingRule
-		database.DB.Where("exit_node_id = ?", exit.ID).Find(&rules)
-		for _, rule := range rules {
-			if stat, ok := userStats[rule.UserEmail]; ok {
-				memUp += stat.Upload
-				memDown += stat.Download
-			}
-		}
+		memUp, memDown := exitMem[exit.ID][0], exitMem[exit.ID][1]
 
 		syncedExitLock.RLock()
 		synced := syncedExitTraffic[exit.ID]
@@ -471,31 +502,10 @@ func GetTrafficStatsByEntry() EntryTrafficStats {
 
 // PersistTrafficToDB 将内存中的流量统计增量持久化到数据库
 func PersistTrafficToDB() {
-	// 获取当前内存中的用户流量统计
-	userStats := GetTrafficStats()
-
-	// 遍历所有转发规则，聚合节点当前的内存总量
-	var rules []models.ForwardingRule
-	database.DB.Find(&rules)
-
-	entryCur := make(map[uint][2]int64)
-	exitCur := make(map[uint][2]int64)
-
-	for _, rule := range rules {
-		if stat, ok := userStats[rule.UserEmail]; ok {
-			entryCur[rule.EntryNodeID] = [2]int64{
-				entryCur[rule.EntryNodeID][0] + stat.Upload,
-				entryCur[rule.EntryNodeID][1] + stat.Download,
-			}
-			exitCur[rule.ExitNodeID] = [2]int64{
-				exitCur[rule.ExitNodeID][0] + stat.Upload,
-				exitCur[rule.ExitNodeID][1] + stat.Download,
-			}
-		}
-	}
-
 	// 更新入口节点流量 (原子增量更新)
+	// 节点当前的内存总量在持锁后读取，避免与清零/计费归档交错时游标回退导致重复计入
 	syncedEntryLock.Lock()
+	entryCur := loadAggregates(&entryTrafficMap)
 	for entryID, current := range entryCur {
 		synced := syncedEntryTraffic[entryID]
 		deltaUp := current[0] - synced[0]
@@ -523,6 +533,7 @@ func PersistTrafficToDB() {
 
 	// 更新落地节点流量
 	syncedExitLock.Lock()
+	exitCur := loadAggregates(&exitTrafficMap)
 	for exitID, current := range exitCur {
 		synced := syncedExitTraffic[exitID]
 		deltaUp := current[0] - synced[0]
@@ -549,11 +560,13 @@ func PersistTrafficToDB() {
 
 // ClearEntryTraffic 清除指定入口节点的流量
 func ClearEntryTraffic(entryID uint) error {
-	// 1. 清空数据库字段
+	// 1. 清空数据库字段 (计费基线一并归零，本周期用量从零开始)
 	if err := database.DB.Model(&models.EntryNode{}).Where("id = ?", entryID).
 		Updates(map[string]interface{}{
-			"total_upload":   0,
-			"total_download": 0,
+			"total_upload":        0,
+			"total_download":      0,
+			"cycle_base_upload":   0,
+			"cycle_base_download": 0,
 		}).Error; err != nil {
 		return err
 	}
@@ -562,18 +575,10 @@ func ClearEntryTraffic(entryID uint) error {
 	syncedEntryLock.Lock()
 	defer syncedEntryLock.Unlock()
 
-	// 计算当前 Memory 值
-	userStats := GetTrafficStats()
-	var curUp, curDown int64
-	var rules []models.ForwardingRule
-	database.DB.Where("entry_node_id = ?", entryID).Find(&rules)
-	for _, rule := range rules {
-		if stat, ok := userStats[rule.UserEmail]; ok {
-			curUp += stat.Upload
-			curDown += stat.Download
-		}
-	}
-	syncedEntryTraffic[entryID] = [2]int64{curUp, curDown}
+	// 当前 Memory 值
+	cur := loadAggregates(&entryTrafficMap)[entryID]
+	curUp, curDown := cur[0], cur[1]
+	syncedEntryTraffic[entryID] = cur
 
 	log.Printf("[Traffic] Cleared traffic for Entry #%d (synced to mem: %d/%d)", entryID, curUp, curDown)
 	return nil
@@ -583,8 +588,10 @@ func ClearEntryTraffic(entryID uint) error {
 func ClearExitTraffic(exitID uint) error {
 	if err := database.DB.Model(&models.ExitNode{}).Where("id = ?", exitID).
 		Updates(map[string]interface{}{
-			"total_upload":   0,
-			"total_download": 0,
+			"total_upload":        0,
+			"total_download":      0,
+			"cycle_base_upload":   0,
+			"cycle_base_download": 0,
 		}).Error; err != nil {
 		return err
 	}
@@ -592,18 +599,7 @@ func ClearExitTraffic(exitID uint) error {
 	syncedExitLock.Lock()
 	defer syncedExitLock.Unlock()
 
-	userStats := GetTrafficStats()
-	var curUp, curDown int64
-	var rules []models.ForwardingRule
-	database.DB.Where("exit_node_id = ?", exitID).Find(&rules)
-	for _, rule := range rules {
-		if stat, ok := userStats[rule.UserEmail]; ok {
-			curUp += stat.Upload
-			curDown += stat.Download
-		}
-	}
-
-	syncedExitTraffic[exitID] = [2]int64{curUp, curDown}
+	syncedExitTraffic[exitID] = loadAggregates(&exitTrafficMap)[exitID]
 
 	log.Printf("[Traffic] Cleared traffic for Exit #%d", exitID)
 	return nil
@@ -611,8 +607,8 @@ func ClearExitTraffic(exitID uint) error {
 
 func ClearAllTraffic() error {
 	// 简单的实现：全部清零 DB
-	database.DB.Model(&models.EntryNode{}).Where("1=1").Updates(map[string]interface{}{"total_upload": 0, "total_download": 0})
-	database.DB.Model(&models.ExitNode{}).Where("1=1").Updates(map[string]interface{}{"total_upload": 0, "total_download": 0})
+	database.DB.Model(&models.EntryNode{}).Where("1=1").Updates(map[string]interface{}{"total_upload": 0, "total_download": 0, "cycle_base_upload": 0, "cycle_base_download": 0})
+	database.DB.Model(&models.ExitNode{}).Where("1=1").Updates(map[string]interface{}{"total_upload": 0, "total_download": 0, "cycle_base_upload": 0, "cycle_base_download": 0})
 
 	// 重置所有 Synced 指针到当前 Memory 值
 	PersistTrafficToDB() // 利用 Persist 重新对齐 SyncedMap
@@ -0,0 +1,287 @@
+package sync
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wangn9900/StealthForward/internal/database"
+	"github.com/wangn9900/StealthForward/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	defaultHourlyRetentionDays = 7
+	defaultDailyRetentionDays  = 365
+
+	// maxHistoryRows 单次查询返回的最大行数
+	maxHistoryRows = 100000
+)
+
+// bucketKey 流量历史的内存缓冲键 (小时粒度，天粒度在落库时派生)
+type bucketKey struct {
+	Hour          time.Time
+	EntryNodeID   uint
+	ExitNodeID    uint
+	V2boardNodeID int
+	Tag           string
+	UID           uint
+}
+
+var (
+	// pendingBuckets 尚未落库的流量历史，每分钟合并写入一次
+	pendingBuckets   = make(map[bucketKey]*[2]int64)
+	pendingBucketsMu sync.Mutex
+)
+
+// recordTrafficHistory 将一次采集的流量计入历史缓冲
+func recordTrafficHistory(at time.Time, entryID uint, account indexedAccount, up, down int64) {
+	key := bucketKey{
+		Hour:          at.UTC().Truncate(time.Hour),
+		EntryNodeID:   entryID,
+		ExitNodeID:    account.ExitNodeID,
+		V2boardNodeID: account.NodeID,
+		Tag:           account.Tag,
+		UID:           account.UID,
+	}
+
+	pendingBucketsMu.Lock()
+	defer pendingBucketsMu.Unlock()
+	counters, ok := pendingBuckets[key]
+	if !ok {
+		counters = &[2]int64{0, 0}
+		pendingBuckets[key] = counters
+	}
+	counters[0] += up
+	counters[1] += down
+}
+
+// dayStart 返回服务器本地时区的自然日起点 (UTC 表示)
+func dayStart(t time.Time) time.Time {
+	local := t.In(time.Local)
+	return time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, time.Local).UTC()
+}
+
+// flushTrafficHistory 将缓冲的流量同时累加到小时桶与天桶，失败时退回缓冲等待下次写入
+func flushTrafficHistory() {
+	pendingBucketsMu.Lock()
+	batch := pendingBuckets
+	pendingBuckets = make(map[bucketKey]*[2]int64)
+	pendingBucketsMu.Unlock()
+
+	if len(batch) == 0 {
+		return
+	}
+
+	rows := make([]models.TrafficBucket, 0, len(batch)*2)
+	for key, counters := range batch {
+		row := models.TrafficBucket{
+			Granularity:   models.TrafficGranularityHour,
+			BucketStart:   key.Hour,
+			EntryNodeID:   key.EntryNodeID,
+			ExitNodeID:    key.ExitNodeID,
+			V2boardNodeID: key.V2boardNodeID,
+			Tag:           key.Tag,
+			V2boardUID:    key.UID,
+			Upload:        counters[0],
+			Download:      counters[1],
+		}
+		rows = append(rows, row)
+
+		row.Granularity = models.TrafficGranularityDay
+		row.BucketStart = dayStart(key.Hour)
+		rows = append(rows, row)
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		// 同一批次中同一天的多个小时会命中同一天桶，逐条 upsert 保证累加正确
+		for i := range rows {
+			err := tx.Clauses(clause.OnConflict{
+				Columns: []clause.Column{{Name: "granularity"}, {Name: "bucket_start"}, {Name: "entry_node_id"},
+					{Name: "exit_node_id"}, {Name: "v2board_node_id"}, {Name: "tag"}},
+				DoUpdates: clause.Assignments(map[string]interface{}{
+					"upload":   gorm.Expr("traffic_buckets.upload + excluded.upload"),
+					"download": gorm.Expr("traffic_buckets.download + excluded.download"),
+				}),
+			}).Create(&rows[i]).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("[Traffic] 流量历史写入失败，%d 条记录将在下次重试: %v", len(batch), err)
+		pendingBucketsMu.Lock()
+		for key, counters := range batch {
+			if existing, ok := pendingBuckets[key]; ok {
+				existing[0] += counters[0]
+				existing[1] += counters[1]
+			} else {
+				pendingBuckets[key] = counters
+			}
+		}
+		pendingBucketsMu.Unlock()
+	}
+}
+
+// pruneTrafficHistory 按保留期清理 小时/天 级历史 (小时级过期后只保留天级，即降采样)
+func pruneTrafficHistory(now time.Time) {
+	hourlyDays := settingInt(models.ConfigKeyTrafficHourlyRetention, defaultHourlyRetentionDays)
+	dailyDays := settingInt(models.ConfigKeyTrafficDailyRetention, defaultDailyRetentionDays)
+
+	database.DB.Where("granularity = ? AND bucket_start < ?", models.TrafficGranularityHour, now.UTC().AddDate(0, 0, -hourlyDays)).
+		Delete(&models.TrafficBucket{})
+	database.DB.Where("granularity = ? AND bucket_start < ?", models.TrafficGranularityDay, now.UTC().AddDate(0, 0, -dailyDays)).
+		Delete(&models.TrafficBucket{})
+}
+
+// TrafficHistoryQuery 流量历史查询条件
+type TrafficHistoryQuery struct {
+	Granularity string    // hour, day
+	From        time.Time // 包含
+	To          time.Time // 不包含
+	GroupBy     []string  // entry, exit, mapping, user 的任意组合，空表示只按时间汇总
+	EntryNodeID uint
+	ExitNodeID  uint
+	NodeID      int // V2Board 节点 ID
+	Tag         string
+}
+
+// TrafficHistoryRow 一个时间桶内某个分组的流量
+type TrafficHistoryRow struct {
+	BucketStart   time.Time `json:"bucket_start"`
+	EntryNodeID   uint      `json:"entry_node_id,omitempty"`
+	ExitNodeID    uint      `json:"exit_node_id,omitempty"`
+	V2boardNodeID int       `json:"v2board_node_id,omitempty"`
+	Tag           string    `json:"tag,omitempty"`
+	V2boardUID    uint      `json:"v2board_uid,omitempty"`
+	Upload        int64     `json:"upload"`
+	Download      int64     `json:"download"`
+}
+
+// historyGroupColumns 分组维度 -> 列
+var historyGroupColumns = map[string][]string{
+	"entry":   {"entry_node_id"},
+	"exit":    {"exit_node_id"},
+	"mapping": {"entry_node_id", "v2board_node_id"},
+	"user":    {"tag", "v2board_uid"},
+}
+
+// HistoryGroupColumns 返回分组维度对应的输出列 (按查询维度顺序去重)，未知维度返回错误
+func HistoryGroupColumns(groupBy []string) ([]string, error) {
+	var columns []string
+	seen := make(map[string]bool)
+	for _, g := range groupBy {
+		cols, ok := historyGroupColumns[g]
+		if !ok {
+			return nil, fmt.Errorf("unknown group_by: %s", g)
+		}
+		for _, col := range cols {
+			if !seen[col] {
+				seen[col] = true
+				columns = append(columns, col)
+			}
+		}
+	}
+	return columns, nil
+}
+
+// QueryTrafficHistory 按时间范围与分组维度查询流量历史 (含尚未落库的缓冲)
+func QueryTrafficHistory(q TrafficHistoryQuery) ([]TrafficHistoryRow, error) {
+	if q.Granularity != models.TrafficGranularityHour && q.Granularity != models.TrafficGranularityDay {
+		return nil, fmt.Errorf("unknown granularity: %s", q.Granularity)
+	}
+	columns, err := HistoryGroupColumns(q.GroupBy)
+	if err != nil {
+		return nil, err
+	}
+	flushTrafficHistory()
+
+	selects := append([]string{"bucket_start"}, columns...)
+	groups := strings.Join(selects, ", ")
+	query := database.DB.Model(&models.TrafficBucket{}).
+		Select(groups+", SUM(upload) AS upload, SUM(download) AS download").
+		Where("granularity = ? AND bucket_start >= ? AND bucket_start < ?", q.Granularity, q.From.UTC(), q.To.UTC())
+	if q.EntryNodeID != 0 {
+		query = query.Where("entry_node_id = ?", q.EntryNodeID)
+	}
+	if q.ExitNodeID != 0 {
+		query = query.Where("exit_node_id = ?", q.ExitNodeID)
+	}
+	if q.NodeID != 0 {
+		query = query.Where("v2board_node_id = ?", q.NodeID)
+	}
+	if q.Tag != "" {
+		query = query.Where("tag = ?", q.Tag)
+	}
+
+	// bucket_start 在 SQLite 聚合后以字符串返回，先按原始行读出再在内存中解析
+	var raw []struct {
+		BucketStart   string
+		EntryNodeID   uint
+		ExitNodeID    uint
+		V2boardNodeID int
+		Tag           string
+		V2boardUID    uint
+		Upload        int64
+		Download      int64
+	}
+	if err := query.Group(groups).Order(groups).Limit(maxHistoryRows).Scan(&raw).Error; err != nil {
+		return nil, err
+	}
+
+	rows := make([]TrafficHistoryRow, 0, len(raw))
+	for _, r := range raw {
+		start, err := parseSQLiteTime(r.BucketStart)
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, TrafficHistoryRow{
+			BucketStart:   start,
+			EntryNodeID:   r.EntryNodeID,
+			ExitNodeID:    r.ExitNodeID,
+			V2boardNodeID: r.V2boardNodeID,
+			Tag:           r.Tag,
+			V2boardUID:    r.V2boardUID,
+			Upload:        r.Upload,
+			Download:      r.Download,
+		})
+	}
+	return rows, nil
+}
+
+// UserUsage 用户在一段时间内的流量
+type UserUsage struct {
+	Tag        string `json:"tag"`
+	V2boardUID uint   `json:"v2board_uid"`
+	Upload     int64  `json:"upload"`
+	Download   int64  `json:"download"`
+}
+
+// TopUsers 返回 since 之后总流量最大的用户 (按小时级历史，含尚未落库的缓冲)
+func TopUsers(since time.Time, limit int) ([]UserUsage, error) {
+	flushTrafficHistory()
+	var rows []UserUsage
+	err := database.DB.Model(&models.TrafficBucket{}).
+		Select("tag, v2board_uid, SUM(upload) AS upload, SUM(download) AS download").
+		Where("granularity = ? AND bucket_start >= ?", models.TrafficGranularityHour, since.UTC().Truncate(time.Hour)).
+		Group("tag, v2board_uid").
+		Order("SUM(upload) + SUM(download) DESC").
+		Limit(limit).
+		Scan(&rows).Error
+	return rows, err
+}
+
+// parseSQLiteTime 解析 SQLite 中以文本保存的时间
+func parseSQLiteTime(s string) (time.Time, error) {
+	for _, layout := range []string{"2006-01-02 15:04:05.999999999-07:00", time.RFC3339Nano, "2006-01-02 15:04:05"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time: %s", s)
+}
@@ -1,8 +1,15 @@
 package sync
 
-import "fmt"
+import (
+	"fmt"
+	"strconv"
+	"strings"
 
-func formatBytes(bytes int64) string {
+	"github.com/wangn9900/StealthForward/internal/database"
+	"github.com/wangn9900/StealthForward/internal/models"
+)
+
+func FormatBytes(bytes int64) string {
 	const unit = 1024
 	if bytes < unit {
 		return fmt.Sprintf("%d B", bytes)
@@ -14,3 +21,23 @@ func formatBytes(bytes int64) string {
 	}
 	return fmt.Sprintf("%.1f %cB", float64(bytes)/float64(div), "KMGTPE"[exp])
 }
+
+// settingString 读取字符串型系统配置，未配置时返回空字符串
+func settingString(key string) string {
+	var setting models.SystemSetting
+	if err := database.DB.Where(&models.SystemSetting{Key: key}).First(&setting).Error; err == nil {
+		return strings.TrimSpace(setting.Value)
+	}
+	return ""
+}
+
+// settingInt 读取整数型系统配置，未配置或非法 (负数) 时返回默认值
+func settingInt(key string, def int) int {
+	var setting models.SystemSetting
+	if err := database.DB.Where(&models.SystemSetting{Key: key}).First(&setting).Error; err == nil {
+		if v, err := strconv.Atoi(setting.Value); err == nil && v >= 0 {
+			return v
+		}
+	}
+	return def
+}
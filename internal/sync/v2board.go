@@ -1,11 +1,15 @@
 package sync
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/wangn9900/StealthForward/internal/database"
@@ -24,90 +28,366 @@ type V2boardResponse struct {
 	Users []V2boardUser `json:"users"` // 适配 V2board 源码中的 users 键
 }
 
-// StartV2boardSync 启动一个后台任务，定时同步用户列表
-func StartV2boardSync() {
-	ticker := time.NewTicker(2 * time.Minute) // 每 2 分钟同步一次
-	go func() {
-		for range ticker.C {
-			syncAllNodes()
+// syncTarget 描述一次同步中的单个 V2Board 节点目标
+type syncTarget struct {
+	NodeID   int
+	NodeType string
+	ExitID   uint
+}
+
+// syncTargetsForEntry 按优先级列出入口需要同步的 V2Board 节点
+func syncTargetsForEntry(entry models.EntryNode) []syncTarget {
+	var targets []syncTarget
+
+	// 1. 先同步 Mapping 规则 (最高优先级，按 ID 降序排列，让新节点/手动节点优先夺取用户)
+	var mappings []models.NodeMapping
+	database.DB.Where("entry_node_id = ?", entry.ID).Order("id DESC").Find(&mappings)
+	for _, m := range mappings {
+		targets = append(targets, syncTarget{NodeID: m.V2boardNodeID, NodeType: m.V2boardType, ExitID: m.EffectiveExitID()})
+	}
+
+	// 2. 再同步 EntryNode 自身的默认规则 (避开已在 Mapping 中定义的节点)
+	if entry.V2boardNodeID != 0 {
+		alreadyMapped := false
+		for _, m := range mappings {
+			if m.V2boardNodeID == entry.V2boardNodeID {
+				alreadyMapped = true
+				break
+			}
 		}
-	}()
-	// 启动时先同步一次
-	go syncAllNodes()
+		// 如果没有被 Mapping 定义，才用默认落地同步
+		if !alreadyMapped {
+			nodeType := entry.V2boardType
+			if nodeType == "" {
+				nodeType = "v2ray"
+			}
+			targets = append(targets, syncTarget{NodeID: entry.V2boardNodeID, NodeType: nodeType, ExitID: entry.TargetExitID})
+		}
+	}
+	return targets
 }
 
-func syncAllNodes() {
-	var entries []models.EntryNode
-	database.DB.Where("v2board_url <> '' AND v2board_key <> ''").Find(&entries)
+// syncEntry 计算入口的规则变更；dryRun 为 false 时写库并记录同步历史
+// 定时触发且面板数据指纹未变时跳过比对；返回首个拉取错误或写库错误
+func syncEntry(entry models.EntryNode, trigger string, dryRun bool) ([]NodeSyncDiff, error) {
+	startedAt := time.Now()
+
+	// 先拉取所有目标节点的用户列表 (命中 ETag 时直接复用缓存)
+	var targets []syncTarget
+	var fetched [][]V2boardUser
+	var fetchErrs []error
+	var firstErr error
+	fingerprint := sha256.New()
+	for _, t := range syncTargetsForEntry(entry) {
+		if t.NodeID <= 0 {
+			continue
+		}
+		users, hash, err := fetchUsers(entry, t.NodeID, t.NodeType)
+		if err != nil {
+			log.Printf("!!!! [D-Sync] 同步故障 (NodeID %d): %v", t.NodeID, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+		fmt.Fprintf(fingerprint, "%d|%s|%d|%s\n", t.NodeID, t.NodeType, t.ExitID, hash)
+		targets = append(targets, t)
+		fetched = append(fetched, users)
+		fetchErrs = append(fetchErrs, err)
+	}
+	entryFingerprint := hex.EncodeToString(fingerprint.Sum(nil))
+	if firstErr != nil {
+		entryFingerprint = ""
+	}
+
+	if !dryRun && trigger == SyncTriggerTimer && entryFingerprint != "" {
+		stateMu.Lock()
+		st := entryState(entry.ID)
+		unchanged := st.Fingerprint == entryFingerprint && time.Since(st.LastFullSync) < fullReconcileInterval
+		stateMu.Unlock()
+		if unchanged {
+			diffs := make([]NodeSyncDiff, 0, len(targets))
+			for i, t := range targets {
+				diffs = append(diffs, NodeSyncDiff{
+					EntryNodeID:   entry.ID,
+					V2boardNodeID: t.NodeID,
+					TargetExitID:  t.ExitID,
+					UsersFetched:  len(fetched[i]),
+					Unchanged:     true,
+				})
+			}
+			recordSyncRuns(diffs, trigger, startedAt, nil)
+			return diffs, nil
+		}
+	}
 
-	for _, entry := range entries {
-		processedUUIDs := make(map[string]bool) // 记录已由 Mapping 处理过的用户，防止被默认规则覆盖
+	// 预加载当前入口的所有规则到内存，构建 UserEmail -> Rule 索引
+	var existingList []models.ForwardingRule
+	if err := database.DB.Where("entry_node_id = ?", entry.ID).Find(&existingList).Error; err != nil {
+		log.Printf("!!!! [D-Sync] 读取入口 #%d 规则失败: %v", entry.ID, err)
+		return nil, err
+	}
+	ruleMap := make(map[string]*models.ForwardingRule)
+	for i := range existingList {
+		ruleMap[existingList[i].UserEmail] = &existingList[i]
+	}
 
-		// 1. 先同步 Mapping 规则 (最高优先级，按 ID 降序排列，让新节点/手动节点优先夺取用户)
-		var mappings []models.NodeMapping
-		database.DB.Where("entry_node_id = ?", entry.ID).Order("id DESC").Find(&mappings)
+	// 身份索引：(V2Board 节点, 用户 ID) -> 标签，标签 -> 身份
+	identities := loadEntryIdentities(database.DB, entry.ID)
+	tagByKey := make(map[identityKey]string)
+	identityByTag := make(map[string]models.UserIdentity)
+	for _, identity := range identities {
+		tagByKey[identityKey{identity.V2boardNodeID, identity.V2boardUID}] = identity.Tag
+		identityByTag[identity.Tag] = identity
+	}
 
-		var activeUUIDs []string
-		for _, m := range mappings {
-			log.Printf(">>>> [D-Sync] 优先分流同步: V2B节点#%d -> 落地ID#%d", m.V2boardNodeID, m.TargetExitID)
-			uuids := syncSingleTarget(entry, m.V2boardNodeID, m.V2boardType, m.TargetExitID, processedUUIDs)
-			activeUUIDs = append(activeUUIDs, uuids...)
-		}
-
-		// 2. 再同步 EntryNode 自身的默认规则 (避开已被映射的用户 AND 已在 Mapping 中定义的节点)
-		if entry.V2boardNodeID != 0 {
-			// 检查这个 V2B Node ID 是否已经在 Mapping 中定义
-			alreadyMapped := false
-			for _, m := range mappings {
-				if m.V2boardNodeID == entry.V2boardNodeID {
-					alreadyMapped = true
-					break
+	// 暂停表：被配额或管理员暂停的用户/入口/落地，同步时保持暂停
+	suspended := loadSuspensions(database.DB)
+
+	var diffs []NodeSyncDiff
+	diffIndex := make(map[int]int) // V2Board NodeID -> diffs 下标
+	planned := make(map[string]bool)
+	activeTags := make(map[string]bool)
+	activeUUIDs := make(map[string]bool)
+
+	var newIdentities []models.UserIdentity
+	var creates []models.ForwardingRule
+	var updates []*models.ForwardingRule
+
+	for i, t := range targets {
+		if !dryRun {
+			log.Printf(">>>> [D-Sync] 同步: V2B节点#%d -> 落地ID#%d", t.NodeID, t.ExitID)
+		}
+		diff := NodeSyncDiff{
+			EntryNodeID:   entry.ID,
+			V2boardNodeID: t.NodeID,
+			TargetExitID:  t.ExitID,
+		}
+
+		users := fetched[i]
+		if fetchErrs[i] != nil {
+			diff.Error = fetchErrs[i].Error()
+		}
+		diff.UsersFetched = len(users)
+
+		// 每个节点的用户都有独立身份，同一个 UUID 可以在多个节点下各有一个标签
+		// 这样用户才能自由切换节点
+		for _, user := range users {
+			activeUUIDs[user.UUID] = true
+			key := identityKey{t.NodeID, user.ID}
+			identityTag, ok := tagByKey[key]
+			if !ok {
+				tag, err := newIdentityTag()
+				if err != nil {
+					log.Printf("!!!! [D-Sync] 入口 #%d 生成身份标签失败: %v", entry.ID, err)
+					return nil, err
 				}
+				identityTag = tag
+				tagByKey[key] = identityTag
+				newIdentities = append(newIdentities, models.UserIdentity{
+					EntryNodeID:   entry.ID,
+					V2boardNodeID: t.NodeID,
+					V2boardUID:    user.ID,
+					Tag:           identityTag,
+				})
 			}
-			// 如果没有被 Mapping 定义，才用默认落地同步
-			if !alreadyMapped {
-				nodeType := entry.V2boardType
-				if nodeType == "" {
-					nodeType = "v2ray"
-				}
-				uuids := syncSingleTarget(entry, entry.V2boardNodeID, nodeType, entry.TargetExitID, processedUUIDs)
-				activeUUIDs = append(activeUUIDs, uuids...)
+			activeTags[identityTag] = true
+
+			// 同一节点被多个 Mapping 引用时，以优先级最高的为准
+			if planned[identityTag] {
+				continue
+			}
+			planned[identityTag] = true
+
+			rule, exists := ruleMap[identityTag]
+			if !exists {
+				// Case A: 新增规则
+				creates = append(creates, models.ForwardingRule{
+					EntryNodeID: entry.ID,
+					ExitNodeID:  t.ExitID,
+					UserID:      user.UUID,
+					V2boardUID:  user.ID,
+					UserEmail:   identityTag,
+					Enabled:     true,
+					Suspended:   suspended.blocks(entry.ID, t.ExitID, user.ID),
+				})
+				diff.Add = append(diff.Add, RuleDiff{
+					UserEmail:  identityTag,
+					UserID:     user.UUID,
+					V2boardUID: user.ID,
+					ExitNodeID: t.ExitID,
+				})
+				continue
+			}
+
+			// Case B: 逐字段比对，只有真正变化才触发 Update
+			var changes []string
+			if rule.UserID != user.UUID {
+				changes = append(changes, fmt.Sprintf("user_id: %s -> %s", rule.UserID, user.UUID))
+				rule.UserID = user.UUID
+			}
+			if rule.V2boardUID != user.ID {
+				changes = append(changes, fmt.Sprintf("v2board_uid: %d -> %d", rule.V2boardUID, user.ID))
+				rule.V2boardUID = user.ID
+			}
+			if rule.ExitNodeID != t.ExitID {
+				changes = append(changes, fmt.Sprintf("exit_node_id: %d -> %d", rule.ExitNodeID, t.ExitID))
+				rule.ExitNodeID = t.ExitID
+			}
+			if !rule.Enabled {
+				changes = append(changes, "enabled: false -> true")
+				rule.Enabled = true
+			}
+			if want := suspended.blocks(entry.ID, t.ExitID, user.ID); rule.Suspended != want {
+				changes = append(changes, fmt.Sprintf("suspended: %v -> %v", rule.Suspended, want))
+				rule.Suspended = want
+			}
+			if len(changes) > 0 {
+				updates = append(updates, rule)
+				diff.Update = append(diff.Update, RuleDiff{
+					RuleID:     rule.ID,
+					UserEmail:  rule.UserEmail,
+					UserID:     rule.UserID,
+					V2boardUID: rule.V2boardUID,
+					ExitNodeID: rule.ExitNodeID,
+					Changes:    changes,
+				})
 			}
 		}
 
-		// 3. 清理已失效/过期用户
-		if len(activeUUIDs) > 0 {
-			database.DB.Where("entry_node_id = ? AND user_id NOT IN ?", entry.ID, activeUUIDs).Delete(&models.ForwardingRule{})
-		} else {
-			database.DB.Where("entry_node_id = ?", entry.ID).Delete(&models.ForwardingRule{})
+		diffIndex[t.NodeID] = len(diffs)
+		diffs = append(diffs, diff)
+	}
+
+	// 拉取失败的节点不知道真实的用户列表，不能据此删除规则 (面板故障/超时时会误删全部用户)
+	failedNodes := make(map[int]bool)
+	for _, d := range diffs {
+		if d.Error != "" {
+			failedNodes[d.V2boardNodeID] = true
 		}
 	}
-}
 
-func syncSingleTarget(entry models.EntryNode, v2bNodeID int, v2bType string, targetExitID uint, processed map[string]bool) []string {
-	if v2bNodeID <= 0 {
-		return nil
+	// 清理已失效/过期用户：身份不在任何目标节点的用户列表中
+	// 没有身份记录的手动规则沿用旧逻辑，UUID 仍有效则保留
+	var deleteIDs []uint
+	for i := range existingList {
+		rule := existingList[i]
+		identity, hasIdentity := identityByTag[rule.UserEmail]
+		if activeTags[rule.UserEmail] || (!hasIdentity && activeUUIDs[rule.UserID]) {
+			continue
+		}
+		// 有身份的规则只在其节点拉取失败时保留；无身份的规则无法确定所属节点，任一节点失败即保留
+		if (hasIdentity && failedNodes[identity.V2boardNodeID]) || (!hasIdentity && len(failedNodes) > 0) {
+			continue
+		}
+		deleteIDs = append(deleteIDs, rule.ID)
+
+		nodeID := entry.V2boardNodeID
+		if hasIdentity {
+			nodeID = identity.V2boardNodeID
+		}
+		idx, ok := diffIndex[nodeID]
+		if !ok {
+			idx = len(diffs)
+			diffIndex[nodeID] = idx
+			diffs = append(diffs, NodeSyncDiff{EntryNodeID: entry.ID, V2boardNodeID: nodeID})
+		}
+		diffs[idx].Remove = append(diffs[idx].Remove, RuleDiff{
+			RuleID:     rule.ID,
+			UserEmail:  rule.UserEmail,
+			UserID:     rule.UserID,
+			V2boardUID: rule.V2boardUID,
+			ExitNodeID: rule.ExitNodeID,
+		})
 	}
-	users, err := fetchUsers(entry, v2bNodeID, v2bType)
-	if err != nil {
-		log.Printf("!!!! [D-Sync] 同步故障 (NodeID %d): %v", v2bNodeID, err)
+
+	if dryRun {
+		return diffs, firstErr
+	}
+
+	// 统一在一个事务中写库，仅在字段真正变更时才产生写操作
+	applyErr := database.DB.Transaction(func(tx *gorm.DB) error {
+		if len(newIdentities) > 0 {
+			if err := tx.CreateInBatches(&newIdentities, 200).Error; err != nil {
+				return fmt.Errorf("create identities: %v", err)
+			}
+		}
+		if len(creates) > 0 {
+			if err := tx.CreateInBatches(&creates, 200).Error; err != nil {
+				return fmt.Errorf("create rules: %v", err)
+			}
+		}
+		for _, rule := range updates {
+			if err := tx.Save(rule).Error; err != nil {
+				return fmt.Errorf("update rule %s: %v", rule.UserEmail, err)
+			}
+		}
+		if len(deleteIDs) > 0 {
+			if err := tx.Where("id IN ?", deleteIDs).Delete(&models.ForwardingRule{}).Error; err != nil {
+				return fmt.Errorf("delete rules: %v", err)
+			}
+		}
 		return nil
+	})
+	if applyErr != nil {
+		log.Printf("!!!! [D-Sync] 入口 #%d 规则写入失败，已回滚: %v", entry.ID, applyErr)
+		PublishEvent(models.EventSyncRolledBack, entrySubject(entry.ID),
+			fmt.Sprintf("入口 #%d (%s) 规则写入失败，已回滚: %v", entry.ID, entry.Name, applyErr),
+			map[string]interface{}{"entry_id": entry.ID, "trigger": trigger, "error": applyErr.Error()})
+	}
+
+	if applyErr == nil {
+		RefreshRuleIndex()
 	}
+	recordSyncRuns(diffs, trigger, startedAt, applyErr)
 
-	// 不再去重！每个节点的用户都需要同步，同一个 UUID 可以有多个身份（n20-xxx, n21-xxx）
-	// 这样用户才能自由切换节点
-	if len(users) > 0 {
-		updateRulesForEntry(entry.ID, entry.Name, targetExitID, v2bNodeID, users)
+	// 仅在写库成功且所有节点拉取正常时记住指纹，否则下一轮继续完整比对
+	stateMu.Lock()
+	st := entryState(entry.ID)
+	if applyErr == nil && firstErr == nil {
+		st.Fingerprint = entryFingerprint
+		st.LastFullSync = time.Now()
+	} else {
+		st.Fingerprint = ""
 	}
+	stateMu.Unlock()
 
-	uuids := make([]string, len(users))
-	for i, u := range users {
-		uuids[i] = u.UUID
+	if applyErr != nil {
+		return diffs, applyErr
 	}
-	return uuids
+	return diffs, firstErr
+}
+
+// panelCacheEntry 面板最近一次返回的用户列表，用于 ETag 条件请求与内容指纹
+type panelCacheEntry struct {
+	ETag  string
+	Hash  string
+	Users []V2boardUser
 }
 
-func fetchUsers(entry models.EntryNode, nodeID int, nodeType string) ([]V2boardUser, error) {
+// panelCache 请求 URL -> *panelCacheEntry
+var panelCache sync.Map
+
+// usersHash 计算用户列表的内容指纹 (与顺序无关)
+func usersHash(users []V2boardUser) string {
+	sorted := make([]V2boardUser, len(users))
+	copy(sorted, users)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].ID != sorted[j].ID {
+			return sorted[i].ID < sorted[j].ID
+		}
+		return sorted[i].UUID < sorted[j].UUID
+	})
+
+	h := sha256.New()
+	for _, u := range sorted {
+		fmt.Fprintf(h, "%d:%s\n", u.ID, u.UUID)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// fetchUsers 拉取面板节点的用户列表，返回用户及其内容指纹
+// 面板支持 ETag (如 Xboard) 时携带 If-None-Match，304 直接复用上次结果
+func fetchUsers(entry models.EntryNode, nodeID int, nodeType string) ([]V2boardUser, string, error) {
 	apiURL := entry.V2boardURL
 	key := entry.V2boardKey
 
@@ -116,106 +396,56 @@ func fetchUsers(entry models.EntryNode, nodeID int, nodeType string) ([]V2boardU
 	}
 	fullURL := fmt.Sprintf("%s/api/v1/server/UniProxy/user?node_id=%d&token=%s&node_type=%s", apiURL, nodeID, key, nodeType)
 
+	req, err := http.NewRequest(http.MethodGet, fullURL, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	var cached *panelCacheEntry
+	if v, ok := panelCache.Load(fullURL); ok {
+		cached = v.(*panelCacheEntry)
+		if cached.ETag != "" {
+			req.Header.Set("If-None-Match", cached.ETag)
+		}
+	}
+
 	client := &http.Client{Timeout: 15 * time.Second}
-	resp, err := client.Get(fullURL)
+	resp, err := client.Do(req)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		return cached.Users, cached.Hash, nil
+	}
+
 	body, _ := io.ReadAll(resp.Body)
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("V2Board 返回错误 %d: %s", resp.StatusCode, string(body))
+		return nil, "", fmt.Errorf("V2Board 返回错误 %d: %s", resp.StatusCode, string(body))
 	}
 
+	var users []V2boardUser
 	var v2resp V2boardResponse
 	if err := json.Unmarshal(body, &v2resp); err != nil {
 		var directUsers []V2boardUser
-		if err2 := json.Unmarshal(body, &directUsers); err2 == nil {
-			return directUsers, nil
+		if err2 := json.Unmarshal(body, &directUsers); err2 != nil {
+			return nil, "", fmt.Errorf("JSON 解析失败: %v", err)
 		}
-		return nil, fmt.Errorf("JSON 解析失败: %v", err)
+		users = directUsers
+	} else {
+		users = append(v2resp.Data, v2resp.Users...)
 	}
 
-	return append(v2resp.Data, v2resp.Users...), nil
-}
-
-func updateRulesForEntry(entryID uint, entryName string, targetExitID uint, v2bNodeID int, users []V2boardUser) {
-	// 终极性能优化：全量预加载 + 内存比对
-	// 1. 将 O(N) 次 SQL 查询降低为 O(1) 次
-	// 2. 仅在字段真正变更时才产生写操作
-	database.DB.Transaction(func(tx *gorm.DB) error {
-		// --- Step 1: 预加载当前节点的所有规则到内存 ---
-		var existingList []models.ForwardingRule
-		// 只查属于当前 Entry 的规则，减少传输量
-		if err := tx.Where("entry_node_id = ?", entryID).Find(&existingList).Error; err != nil {
-			return err
-		}
-
-		// 构建快速查找索引: UserEmail -> Rule Pointer
-		ruleMap := make(map[string]*models.ForwardingRule)
-		for i := range existingList {
-			// 使用指针以便直接修改
-			ruleMap[existingList[i].UserEmail] = &existingList[i]
-		}
-		// ---------------------------------------------
-
-		// --- Step 2: 内存比对 (无 SQL 查询) ---
-		for _, user := range users {
-			identityTag := fmt.Sprintf("n%d-%s", v2bNodeID, user.UUID[:8])
-
-			// 直接从 Map 获取，不再查询数据库
-			rule, exists := ruleMap[identityTag]
-
-			if !exists {
-				// Case A: 新增规则
-				newRule := models.ForwardingRule{
-					EntryNodeID: entryID,
-					ExitNodeID:  targetExitID,
-					UserID:      user.UUID,
-					V2boardUID:  user.ID,
-					UserEmail:   identityTag,
-					Enabled:     true,
-				}
-				if err := tx.Create(&newRule).Error; err != nil {
-					log.Printf("[Sync] Failed to create rule for %s: %v", identityTag, err)
-				}
-			} else {
-				// Case B: 检查更新
-				updated := false
-
-				// 逐字段比对，只有真正变化才触发 Update
-				if rule.V2boardUID != user.ID {
-					rule.V2boardUID = user.ID
-					updated = true
-				}
-				if rule.ExitNodeID != targetExitID {
-					rule.ExitNodeID = targetExitID
-					updated = true
-				}
-				if !rule.Enabled {
-					rule.Enabled = true
-					updated = true
-				}
-				// UserEmail (Tag) 已经在 Key 里匹配了，理论上不需要比对，但为了保险
-				if rule.UserEmail != identityTag {
-					rule.UserEmail = identityTag
-					updated = true
-				}
-
-				if updated {
-					// 只有变了才写库
-					if err := tx.Save(rule).Error; err != nil {
-						log.Printf("[Sync] Failed to update rule for %s: %v", identityTag, err)
-					}
-				}
-			}
-		}
-		return nil
+	hash := usersHash(users)
+	panelCache.Store(fullURL, &panelCacheEntry{
+		ETag:  resp.Header.Get("ETag"),
+		Hash:  hash,
+		Users: users,
 	})
+	return users, hash, nil
 }
 
 // GlobalSyncNow 提供给 API 调用的立即同步接口
 func GlobalSyncNow() {
-	go syncAllNodes()
+	go syncAllNodes(SyncTriggerAPI)
 }
@@ -0,0 +1,161 @@
+// Package telegram 极简的 Telegram Bot API 客户端 (长轮询 + 消息 + 内联按钮)，只覆盖运维机器人用到的方法
+package telegram
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultAPIBase 官方 Bot API 地址
+	DefaultAPIBase = "https://api.telegram.org"
+	// PollTimeout getUpdates 长轮询的等待时长
+	PollTimeout = 25 * time.Second
+)
+
+// Client Bot API 客户端
+type Client struct {
+	token   string
+	apiBase string
+	http    *http.Client
+}
+
+// New 创建客户端，apiBase 为空时使用官方地址 (可指向本地替身用于测试)
+func New(token, apiBase string) *Client {
+	if apiBase == "" {
+		apiBase = DefaultAPIBase
+	}
+	return &Client{
+		token:   token,
+		apiBase: strings.TrimRight(apiBase, "/"),
+		// 长轮询本身最长等待 PollTimeout，留出余量
+		http: &http.Client{Timeout: PollTimeout + 15*time.Second},
+	}
+}
+
+// User 用户
+type User struct {
+	ID       int64  `json:"id"`
+	Username string `json:"username"`
+}
+
+// Chat 会话
+type Chat struct {
+	ID int64 `json:"id"`
+}
+
+// Message 消息
+type Message struct {
+	MessageID int64  `json:"message_id"`
+	From      *User  `json:"from"`
+	Chat      Chat   `json:"chat"`
+	Text      string `json:"text"`
+}
+
+// CallbackQuery 内联按钮回调
+type CallbackQuery struct {
+	ID      string   `json:"id"`
+	From    User     `json:"from"`
+	Message *Message `json:"message"`
+	Data    string   `json:"data"`
+}
+
+// Update 一条更新
+type Update struct {
+	UpdateID      int64          `json:"update_id"`
+	Message       *Message       `json:"message"`
+	CallbackQuery *CallbackQuery `json:"callback_query"`
+}
+
+// InlineButton 内联按钮
+type InlineButton struct {
+	Text         string `json:"text"`
+	CallbackData string `json:"callback_data"`
+}
+
+// InlineKeyboard 内联键盘
+type InlineKeyboard struct {
+	InlineKeyboard [][]InlineButton `json:"inline_keyboard"`
+}
+
+// call 调用 Bot API 方法，result 为 nil 时忽略返回值
+func (c *Client) call(ctx context.Context, method string, params interface{}, result interface{}) error {
+	body, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("%s/bot%s/%s", c.apiBase, c.token, method), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.http.Do(req)
+	if err != nil {
+		// 错误信息里的 URL 含 Token，不直接返回
+		return fmt.Errorf("telegram %s: request failed", method)
+	}
+	defer resp.Body.Close()
+
+	var apiResp struct {
+		OK          bool            `json:"ok"`
+		Result      json.RawMessage `json:"result"`
+		Description string          `json:"description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&apiResp); err != nil {
+		return fmt.Errorf("telegram %s: HTTP %d", method, resp.StatusCode)
+	}
+	if !apiResp.OK {
+		return fmt.Errorf("telegram %s: %s", method, apiResp.Description)
+	}
+	if result != nil {
+		return json.Unmarshal(apiResp.Result, result)
+	}
+	return nil
+}
+
+// GetUpdates 长轮询获取 offset 之后的更新
+func (c *Client) GetUpdates(ctx context.Context, offset int64) ([]Update, error) {
+	var updates []Update
+	err := c.call(ctx, "getUpdates", map[string]interface{}{
+		"offset":          offset,
+		"timeout":         int(PollTimeout.Seconds()),
+		"allowed_updates": []string{"message", "callback_query"},
+	}, &updates)
+	return updates, err
+}
+
+// SendMessage 发送纯文本消息，keyboard 可为 nil
+func (c *Client) SendMessage(ctx context.Context, chatID int64, text string, keyboard *InlineKeyboard) error {
+	params := map[string]interface{}{"chat_id": chatID, "text": text}
+	if keyboard != nil {
+		params["reply_markup"] = keyboard
+	}
+	return c.call(ctx, "sendMessage", params, nil)
+}
+
+// SendText 向数字 chat_id 或频道用户名 (如 "@ops_channel") 发送纯文本消息，用于告警通知渠道
+func (c *Client) SendText(ctx context.Context, chatID, text string) error {
+	return c.call(ctx, "sendMessage", map[string]interface{}{"chat_id": chatID, "text": text}, nil)
+}
+
+// EditMessageText 修改消息内容 (同时移除内联按钮)
+func (c *Client) EditMessageText(ctx context.Context, chatID, messageID int64, text string) error {
+	return c.call(ctx, "editMessageText", map[string]interface{}{
+		"chat_id":    chatID,
+		"message_id": messageID,
+		"text":       text,
+	}, nil)
+}
+
+// AnswerCallbackQuery 应答按钮回调 (结束客户端的加载状态)
+func (c *Client) AnswerCallbackQuery(ctx context.Context, id, text string) error {
+	return c.call(ctx, "answerCallbackQuery", map[string]interface{}{
+		"callback_query_id": id,
+		"text":              text,
+	}, nil)
+}
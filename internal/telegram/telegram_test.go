@@ -0,0 +1,129 @@
+package telegram
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const testToken = "123:secret"
+
+// fakeAPI 记录请求的 Bot API 替身，reply 返回方法对应的响应体
+func fakeAPI(t *testing.T, reply func(method string, params map[string]interface{}) string) (*httptest.Server, *[]string) {
+	t.Helper()
+	var methods []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		prefix := "/bot" + testToken + "/"
+		if r.Method != http.MethodPost || !strings.HasPrefix(r.URL.Path, prefix) {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			http.NotFound(w, r)
+			return
+		}
+		if ct := r.Header.Get("Content-Type"); ct != "application/json" {
+			t.Errorf("content-type = %q", ct)
+		}
+		var params map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+			t.Errorf("decode body: %v", err)
+		}
+		method := strings.TrimPrefix(r.URL.Path, prefix)
+		methods = append(methods, method)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(reply(method, params)))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &methods
+}
+
+func TestGetUpdates(t *testing.T) {
+	srv, _ := fakeAPI(t, func(method string, params map[string]interface{}) string {
+		if method != "getUpdates" {
+			t.Errorf("method = %s", method)
+		}
+		if params["offset"] != float64(42) {
+			t.Errorf("offset = %v", params["offset"])
+		}
+		return `{"ok":true,"result":[
+			{"update_id":42,"message":{"message_id":1,"from":{"id":7,"username":"ops"},"chat":{"id":-100},"text":"/help"}},
+			{"update_id":43,"callback_query":{"id":"cb1","from":{"id":7},"message":{"message_id":2,"chat":{"id":-100}},"data":"ok:abc"}}
+		]}`
+	})
+	updates, err := New(testToken, srv.URL+"/").GetUpdates(context.Background(), 42)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(updates) != 2 {
+		t.Fatalf("got %d updates", len(updates))
+	}
+	if m := updates[0].Message; m == nil || m.Text != "/help" || m.Chat.ID != -100 || m.From.ID != 7 {
+		t.Errorf("message = %+v", updates[0].Message)
+	}
+	if q := updates[1].CallbackQuery; q == nil || q.Data != "ok:abc" || q.Message.MessageID != 2 {
+		t.Errorf("callback = %+v", updates[1].CallbackQuery)
+	}
+}
+
+func TestSendMessageWithKeyboard(t *testing.T) {
+	srv, methods := fakeAPI(t, func(method string, params map[string]interface{}) string {
+		if params["chat_id"] != float64(5) || params["text"] != "hi" {
+			t.Errorf("params = %v", params)
+		}
+		markup, _ := params["reply_markup"].(map[string]interface{})
+		rows, _ := markup["inline_keyboard"].([]interface{})
+		if len(rows) != 1 {
+			t.Errorf("reply_markup = %v", params["reply_markup"])
+		}
+		return `{"ok":true,"result":{"message_id":9,"chat":{"id":5}}}`
+	})
+	kb := &InlineKeyboard{InlineKeyboard: [][]InlineButton{{{Text: "确认", CallbackData: "ok:1"}}}}
+	if err := New(testToken, srv.URL).SendMessage(context.Background(), 5, "hi", kb); err != nil {
+		t.Fatal(err)
+	}
+	if len(*methods) != 1 || (*methods)[0] != "sendMessage" {
+		t.Errorf("methods = %v", *methods)
+	}
+}
+
+func TestSendText(t *testing.T) {
+	srv, methods := fakeAPI(t, func(method string, params map[string]interface{}) string {
+		if params["chat_id"] != "@ops" || params["text"] != "告警" {
+			t.Errorf("params = %v", params)
+		}
+		return `{"ok":true,"result":{"message_id":3,"chat":{"id":-100}}}`
+	})
+	if err := New(testToken, srv.URL).SendText(context.Background(), "@ops", "告警"); err != nil {
+		t.Fatal(err)
+	}
+	if len(*methods) != 1 || (*methods)[0] != "sendMessage" {
+		t.Errorf("methods = %v", *methods)
+	}
+}
+
+func TestAPIErrors(t *testing.T) {
+	srv, _ := fakeAPI(t, func(method string, _ map[string]interface{}) string {
+		if method == "editMessageText" {
+			return `{"ok":false,"error_code":400,"description":"Bad Request: message is not modified"}`
+		}
+		return `not json`
+	})
+	c := New(testToken, srv.URL)
+
+	err := c.EditMessageText(context.Background(), 1, 2, "x")
+	if err == nil || !strings.Contains(err.Error(), "message is not modified") {
+		t.Errorf("edit error = %v", err)
+	}
+	err = c.AnswerCallbackQuery(context.Background(), "cb", "")
+	if err == nil || !strings.Contains(err.Error(), "HTTP 200") {
+		t.Errorf("answer error = %v", err)
+	}
+
+	// 请求失败时错误信息不能带出含 Token 的 URL
+	srv.Close()
+	err = c.SendMessage(context.Background(), 1, "x", nil)
+	if err == nil || strings.Contains(err.Error(), testToken) {
+		t.Errorf("send error = %v", err)
+	}
+}